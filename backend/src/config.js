@@ -1,17 +1,359 @@
 require('dotenv').config();
+const os = require('os');
+
+// Env values that were set but couldn't be parsed; reported by
+// validateConfig at startup instead of silently using the fallback
+const envErrors = [];
+
+const DURATION_UNITS = { ms: 1, s: 1000, m: 60 * 1000, h: 60 * 60 * 1000 };
+
+/**
+ * Integer env value, or fallback when unset. A value that is set must be a
+ * whole integer of at least min.
+ */
+function envInt(name, fallback, { min = 0, max = Infinity } = {}) {
+  const raw = process.env[name];
+  if (raw === undefined || raw.trim() === '') return fallback;
+
+  const value = /^\s*-?\d+\s*$/.test(raw) ? parseInt(raw) : NaN;
+  if (Number.isNaN(value) || value < min || value > max) {
+    const range = max === Infinity ? `>= ${min}` : `between ${min} and ${max}`;
+    envErrors.push(`${name} must be an integer ${range}, got "${raw}"`);
+    return fallback;
+  }
+  return value;
+}
+
+/**
+ * Duration env value in ms, or fallback when unset. Accepts plain
+ * milliseconds ("30000") or a number with a unit: "500ms", "30s", "5m", "1h".
+ */
+function envDuration(name, fallback, { min = 0 } = {}) {
+  const raw = process.env[name];
+  if (raw === undefined || raw.trim() === '') return fallback;
+
+  const match = raw.trim().match(/^(\d+(?:\.\d+)?)(ms|s|m|h)?$/);
+  const value = match ? Math.round(parseFloat(match[1]) * DURATION_UNITS[match[2] || 'ms']) : NaN;
+  if (Number.isNaN(value) || value < min) {
+    envErrors.push(`${name} must be a duration of at least ${min}ms (e.g. 30000, 30s, 5m), got "${raw}"`);
+    return fallback;
+  }
+  return value;
+}
+
+/**
+ * Numeric env value, or fallback when unset. A value that is set must be a
+ * decimal number between min and max.
+ */
+function envFloat(name, fallback, { min = 0, max = Infinity } = {}) {
+  const raw = process.env[name];
+  if (raw === undefined || raw.trim() === '') return fallback;
+
+  const value = /^\s*-?\d+(?:\.\d+)?\s*$/.test(raw) ? parseFloat(raw) : NaN;
+  if (Number.isNaN(value) || value < min || value > max) {
+    const range = max === Infinity ? `>= ${min}` : `between ${min} and ${max}`;
+    envErrors.push(`${name} must be a number ${range}, got "${raw}"`);
+    return fallback;
+  }
+  return value;
+}
+
+// Bulk scan concurrency. Scans mostly wait on page loads rather than CPU, so
+// SCAN_OVERSUBSCRIPTION runs that many scans per CPU (clamped to 1-8) when
+// SCAN_CONCURRENCY isn't set, capped at MAX_SCAN_CONCURRENCY.
+function scanConcurrency() {
+  const explicit = envInt('SCAN_CONCURRENCY', 0, { min: 1 });
+  if (explicit > 0) return explicit;
+
+  const factor = envFloat('SCAN_OVERSUBSCRIPTION', 0);
+  if (!(factor > 0)) return 3;
+
+  const maxConcurrency = envInt('MAX_SCAN_CONCURRENCY', 32, { min: 1 });
+  const perCpu = Math.min(Math.max(factor, 1), 8);
+  return Math.min(Math.ceil(os.cpus().length * perCpu), maxConcurrency);
+}
+
+// Also the default RATE_LIMIT_BURST
+const rateLimitMax = envInt('RATE_LIMIT_MAX', 100, { min: 1 });
 
 module.exports = {
   // Server Configuration
-  port: parseInt(process.env.PORT) || 8000,
+  port: envInt('PORT', 8000, { min: 1, max: 65535 }),
   nodeEnv: process.env.NODE_ENV || 'development',
+  // How long shutdown waits for in-flight scans to finish
+  shutdownTimeout: envDuration('SHUTDOWN_TIMEOUT', 30000),
+  // Time allowed to receive a whole request, and to keep an idle
+  // keep-alive connection open (Node's defaults)
+  requestTimeout: envDuration('REQUEST_TIMEOUT', 5 * 60 * 1000),
+  keepAliveTimeout: envDuration('KEEP_ALIVE_TIMEOUT', 5000),
 
   // CORS Configuration
   corsOrigin: process.env.CORS_ORIGIN || '*',
 
+  // Keys accepted in X-API-Key by every /api endpoint (empty = no auth)
+  apiKeys: (process.env.API_KEYS || '')
+    .split(',')
+    .map(key => key.trim())
+    .filter(Boolean),
+
+  // Keys whose clients may ask for options.priority "high" (empty = any
+  // key in API_KEYS; without either, no client can)
+  priorityApiKeys: (process.env.PRIORITY_API_KEYS || '')
+    .split(',')
+    .map(key => key.trim())
+    .filter(Boolean),
+
   // Scanning Configuration
-  scanTimeout: parseInt(process.env.SCAN_TIMEOUT) || 30000,
-  scanConcurrency: parseInt(process.env.SCAN_CONCURRENCY) || 3,
-  maxRetriesPerScan: parseInt(process.env.MAX_RETRIES) || 3,
+  scanTimeout: envDuration('SCAN_TIMEOUT', 30000, { min: 1 }),
+  // Upper bound for the per-request options.timeout scan deadline
+  maxScanTimeout: envDuration('MAX_SCAN_TIMEOUT', 60000, { min: 1 }),
+  // How long a scan waits for a free browser before it is shed with 503
+  browserAcquireTimeout: envDuration('BROWSER_ACQUIRE_TIMEOUT', 30000, { min: 1 }),
+  // Upper bound for the per-request options.maxLoadWait
+  maxLoadWait: envDuration('MAX_LOAD_WAIT', 30000),
+  // Report browser pool load in X-Scanner-* headers on every response
+  backpressureHeaders: process.env.BACKPRESSURE_HEADERS !== 'false',
+  scanConcurrency: scanConcurrency(),
+
+  // Batch progress stream (/api/scan/stream): largest batch request
+  // message, and how long a connection may wait before sending it
+  webSocket: {
+    maxMessageBytes: envInt('WS_MAX_MESSAGE_BYTES', 10 * 1024 * 1024, { min: 1 }),
+    messageTimeout: envDuration('WS_MESSAGE_TIMEOUT', 30000, { min: 1 }),
+    // Browser origins allowed to open the stream (default: CORS_ORIGIN
+    // unless it's "*"); handshakes without an Origin header are allowed
+    allowedOrigins: (process.env.WS_ALLOWED_ORIGINS || (process.env.CORS_ORIGIN !== '*' && process.env.CORS_ORIGIN) || '')
+      .split(',')
+      .map(origin => origin.trim())
+      .filter(Boolean)
+  },
+
+  // Browser pool sizing; reserved browsers only serve high-priority scans
+  browserPool: {
+    minSize: envInt('MIN_POOL_SIZE', 2),
+    maxSize: envInt('MAX_POOL_SIZE', 5, { min: 1 }),
+    reservedSize: envInt('RESERVED_POOL_SIZE', 0),
+    maxDedicated: envInt('MAX_DEDICATED_BROWSERS', 2)
+  },
+  maxRetriesPerScan: envInt('MAX_RETRIES', 3, { min: 1 }),
+  // Delay before retrying a failed scan attempt, doubling each time, with
+  // up to half of it randomized
+  retryBackoff: {
+    baseDelay: envDuration('RETRY_BASE_DELAY', 1000),
+    maxDelay: envDuration('RETRY_MAX_DELAY', 10000)
+  },
+  // Fraction of the scan timeout after which a "slow scan" warning is logged
+  // (0 or 1 disables the warning)
+  scanTimeoutWarnFraction: envFloat('SCAN_TIMEOUT_WARN_FRACTION', 0.8, { min: 0, max: 1 }),
+
+  // Maximum page console errors kept per scan with options.captureConsole
+  maxConsoleErrors: envInt('MAX_CONSOLE_ERRORS', 50),
+  // Maximum nodes of the accessibility tree reported with options.accessibilityTree
+  maxAccessibilityTreeNodes: envInt('MAX_ACCESSIBILITY_TREE_NODES', 1000, { min: 1 }),
+
+  // Maximum lengths of free-text scan options
+  optionLimits: {
+    maxSelectorLength: envInt('MAX_OPTION_SELECTOR_LENGTH', 200, { min: 1 }),
+    maxStringLength: envInt('MAX_OPTION_STRING_LENGTH', 2048, { min: 1 }),
+    maxBodyLength: envInt('MAX_OPTION_BODY_LENGTH', 65536, { min: 1 }),
+    // Per storage area (localStorage / sessionStorage)
+    storage: {
+      maxEntries: envInt('MAX_STORAGE_OPTION_ENTRIES', 50, { min: 1 }),
+      maxBytes: envInt('MAX_STORAGE_OPTION_BYTES', 65536, { min: 1 })
+    },
+    // Serialized size of a request's clientMetadata
+    maxClientMetadataBytes: envInt('MAX_CLIENT_METADATA_BYTES', 4096, { min: 1 })
+  },
+
+  // Fail scans fast while browsers can't be launched, instead of every scan
+  // waiting out the launch timeout. Opens after failureThreshold consecutive
+  // launch failures and lets scans through again after resetTimeout ms.
+  browserBreaker: {
+    enabled: process.env.BROWSER_BREAKER_ENABLED !== 'false',
+    failureThreshold: envInt('BROWSER_BREAKER_FAILURE_THRESHOLD', 5, { min: 1 }),
+    successThreshold: envInt('BROWSER_BREAKER_SUCCESS_THRESHOLD', 1, { min: 1 }),
+    resetTimeout: envDuration('BROWSER_BREAKER_RESET_TIMEOUT', 30000, { min: 1 }),
+    // While open, try launching a browser this often (ms) and close the
+    // breaker as soon as one launches
+    healthCheckInterval: envDuration('BROWSER_BREAKER_PROBE_INTERVAL', 10000, { min: 1 })
+  },
+
+  // Reject mistyped scan options ("30000", "true", "1280x720") instead of
+  // coercing them with a warning
+  strictOptions: process.env.STRICT_SCAN_OPTIONS === 'true',
+
+  // Start a duplicate URL scan on an idle browser when the first takes
+  // longer than this many ms, using whichever finishes first (0 = disabled)
+  hedging: {
+    delay: envDuration('HEDGE_DELAY', 0)
+  },
+
+  // Fail URL scans whose page responds with an HTTP error status (5xx are
+  // retried) instead of scanning the error page
+  failOnHttpError: process.env.FAIL_ON_HTTP_ERROR === 'true',
+
+  // Fall back to a limited browser-less rule subset when no browser can be
+  // acquired; results are marked with metadata.degraded
+  degradedMode: {
+    enabled: process.env.DEGRADED_MODE_ENABLED === 'true',
+    // Largest page fetched for a degraded URL scan
+    maxHtmlBytes: envInt('DEGRADED_MAX_HTML_BYTES', 5 * 1024 * 1024, { min: 1 })
+  },
+
+  // Selectors tried in order when dismissing cookie consent banners
+  consentSelectors: process.env.CONSENT_SELECTORS
+    ? process.env.CONSENT_SELECTORS.split(',').map(selector => selector.trim()).filter(Boolean)
+    : [
+      '#onetrust-accept-btn-handler',
+      '#CybotCookiebotDialogBodyLevelButtonLevelOptinAllowAll',
+      '.cc-allow',
+      '.cc-dismiss',
+      '[data-testid="cookie-policy-banner-accept"]',
+      'button[aria-label="Accept cookies"]',
+      '#didomi-notice-agree-button',
+      '.qc-cmp2-summary-buttons button[mode="primary"]'
+    ],
+
+  // Hosts (and their subdomains) blocked by options.blockResources "analytics"
+  analyticsHosts: process.env.ANALYTICS_HOSTS
+    ? process.env.ANALYTICS_HOSTS.split(',').map(host => host.trim().toLowerCase()).filter(Boolean)
+    : [
+      'google-analytics.com',
+      'googletagmanager.com',
+      'doubleclick.net',
+      'connect.facebook.net',
+      'hotjar.com',
+      'segment.com',
+      'segment.io',
+      'mixpanel.com',
+      'clarity.ms',
+      'nr-data.net',
+      'js-agent.newrelic.com',
+      'plausible.io'
+    ],
+
+  // Operator-maintained checks clients can run by name with options.customChecks
+  customChecks: {
+    dir: process.env.CUSTOM_CHECKS_DIR || null
+  },
+
+  // Attributes that identify an element stably, used to anchor selectors
+  // with options.normalizeSelectors
+  selectorStableAttributes: (process.env.SELECTOR_STABLE_ATTRIBUTES || 'data-testid,data-test,data-cy,data-qa')
+    .split(',')
+    .map(attribute => attribute.trim())
+    .filter(Boolean),
+
+  // Stream single-scan JSON responses with at least this many affected
+  // nodes (0 = only when requested with ?stream=true)
+  streaming: {
+    minNodes: envInt('STREAM_RESPONSE_MIN_NODES', 0)
+  },
+
+  // Request correlation with scanned sites
+  correlation: {
+    // Send our correlation ID to the target site (off by default, as it is
+    // sent with every request the page makes, including third parties)
+    forward: process.env.FORWARD_CORRELATION_ID === 'true',
+    requestHeader: process.env.CORRELATION_REQUEST_HEADER || 'X-Correlation-ID',
+    // Response headers checked, in order, for the target's own request ID
+    responseHeaders: (process.env.CORRELATION_RESPONSE_HEADERS || 'x-request-id,x-correlation-id,x-amzn-requestid,cf-ray')
+      .split(',')
+      .map(header => header.trim().toLowerCase())
+      .filter(Boolean)
+  },
+
+  // Bulk Scan Configuration
+  bulk: {
+    // Scan pages with identical rendered HTML only once per batch
+    dedupContent: process.env.BULK_DEDUP_CONTENT === 'true',
+    // Maximum runtime of a whole bulk scan in ms (0 = unlimited)
+    maxDuration: envDuration('BULK_SCAN_MAX_DURATION', 0),
+    // Bulk scans one client (API key or IP) may have in progress (0 = unlimited)
+    maxActivePerClient: envInt('BULK_MAX_ACTIVE_PER_CLIENT', 0),
+    // Identical submissions by the same client within this many ms return
+    // the first one's batch ID instead of starting another scan (0 = off)
+    dedupWindow: envDuration('BULK_DEDUP_WINDOW', 0)
+  },
+
+  // Result Cache Configuration (RESULT_CACHE_TTL=0 disables caching)
+  cache: {
+    ttl: envDuration('RESULT_CACHE_TTL', 0),
+    maxEntries: envInt('RESULT_CACHE_MAX_ENTRIES', 1000, { min: 1 }),
+    // Bounds for the per-request options.cacheTtl override
+    minTtl: envDuration('RESULT_CACHE_MIN_TTL', 60 * 1000), // 1 minute
+    maxTtl: envDuration('RESULT_CACHE_MAX_TTL', 24 * 60 * 60 * 1000), // 24 hours
+    // Failed scans (timeouts, unreachable targets); 0 doesn't cache them
+    errorTtl: envDuration('RESULT_CACHE_ERROR_TTL', 0),
+    // How long past their TTL results are still served, marked stale, while
+    // a background rescan refreshes them (0 = never serve stale)
+    staleWindow: envDuration('RESULT_CACHE_STALE_WINDOW', 0),
+    // Shared cache store; empty keeps entries in memory
+    redisUrl: process.env.REDIS_URL || '',
+    redisPrefix: process.env.REDIS_KEY_PREFIX || 'wcagai:cache:',
+    redisTimeout: envDuration('REDIS_TIMEOUT', 1000, { min: 1 }),
+    // Query parameters ignored when building URL cache keys ("*" = prefix)
+    stripParams: (process.env.CACHE_STRIP_PARAMS || 'utm_*,gclid,fbclid,msclkid,mc_cid,mc_eid,_ga')
+      .split(',')
+      .map(param => param.trim())
+      .filter(Boolean),
+    preloadUrls: (process.env.CACHE_PRELOAD_URLS || '')
+      .split(',')
+      .map(url => url.trim())
+      .filter(Boolean),
+    preloadInterval: envDuration('CACHE_PRELOAD_INTERVAL', 10 * 60 * 1000, { min: 1 }), // 10 minutes
+    preloadConcurrency: envInt('CACHE_PRELOAD_CONCURRENCY', 2, { min: 1 })
+  },
+
+  // Single-scan reports kept for download (GET /api/report/:scanId/bundle)
+  reports: {
+    retention: envDuration('REPORT_RETENTION', 24 * 60 * 60 * 1000, { min: 1 }), // 24 hours
+    maxEntries: envInt('REPORT_STORE_MAX_ENTRIES', 500, { min: 1 }),
+    // Screenshots kept across all reports (least recently used are dropped)
+    maxScreenshots: envInt('REPORT_MAX_SCREENSHOTS', 100),
+    // Rendered HTML kept per report; larger pages are truncated
+    maxHtmlBytes: envInt('REPORT_MAX_HTML_BYTES', 1024 * 1024),
+    // How often expired reports are pruned in the background (0 = only on access)
+    pruneInterval: envDuration('REPORT_PRUNE_INTERVAL', 5 * 60 * 1000) // 5 minutes
+  },
+
+  // Completed scans listed by GET /api/scans; stored in Redis when
+  // REDIS_URL is set, otherwise in memory
+  history: {
+    enabled: process.env.SCAN_HISTORY_ENABLED === 'true',
+    maxEntries: envInt('SCAN_HISTORY_MAX_ENTRIES', 1000, { min: 1 }),
+    // Redis only: how long full results are kept
+    retention: envDuration('SCAN_HISTORY_RETENTION', 7 * 24 * 60 * 60 * 1000, { min: 1 }), // 7 days
+    redisPrefix: process.env.SCAN_HISTORY_REDIS_PREFIX || 'wcagai:history:'
+  },
+
+  // Recent /api/scan responses kept as baselines for ?deltaFrom patches
+  // (0 = never send deltas)
+  delta: {
+    maxBaselines: envInt('DELTA_MAX_BASELINES', 100)
+  },
+
+  // Scan summary emails (disabled unless SMTP_URL and EMAIL_TO are set)
+  email: {
+    smtpUrl: process.env.SMTP_URL || null,
+    from: process.env.EMAIL_FROM || 'wcagai@localhost',
+    to: (process.env.EMAIL_TO || '')
+      .split(',')
+      .map(address => address.trim())
+      .filter(Boolean),
+    // "breach": only scans with a page over violationThreshold; "all": every scan
+    notify: process.env.EMAIL_NOTIFY || 'breach',
+    violationThreshold: envInt('EMAIL_VIOLATION_THRESHOLD', 0)
+  },
+
+  // Completed scan results published to a message queue (disabled when no driver is set)
+  resultQueue: {
+    driver: process.env.RESULT_QUEUE_DRIVER || null,
+    url: process.env.RESULT_QUEUE_URL || 'nats://localhost:4222',
+    topic: process.env.RESULT_QUEUE_TOPIC || 'wcagai.scans.completed',
+    // JSON payload template applied to the completed result (see payloadTemplate.js)
+    templateFile: process.env.RESULT_QUEUE_TEMPLATE_FILE || null
+  },
 
   // Puppeteer Configuration
   puppeteer: {
@@ -33,22 +375,33 @@ module.exports = {
     prettyPrint: process.env.NODE_ENV === 'development'
   },
 
-  // Rate Limiting (for future implementation)
+  // Scan rate limiting per client (token bucket): bursts of up to burst
+  // scans, refilled at maxRequests per windowMs
   rateLimit: {
-    windowMs: parseInt(process.env.RATE_LIMIT_WINDOW) || 15 * 60 * 1000, // 15 minutes
-    maxRequests: parseInt(process.env.RATE_LIMIT_MAX) || 100
+    enabled: process.env.RATE_LIMIT_ENABLED === 'true',
+    windowMs: envDuration('RATE_LIMIT_WINDOW', 15 * 60 * 1000, { min: 1 }), // 15 minutes
+    maxRequests: rateLimitMax,
+    burst: envInt('RATE_LIMIT_BURST', rateLimitMax, { min: 1 })
   },
 
   // Security Configuration
   security: {
     blockPrivateIPs: process.env.BLOCK_PRIVATE_IPS !== 'false',
-    maxRequestSize: process.env.MAX_REQUEST_SIZE || '10mb'
+    maxRequestSize: process.env.MAX_REQUEST_SIZE || '10mb',
+    // CSV of network,country_code used to block targets by country
+    geoipDatabase: process.env.GEOIP_DATABASE || null,
+    geoBlockedCountries: (process.env.GEOIP_BLOCKED_COUNTRIES || '')
+      .split(',')
+      .map(code => code.trim().toUpperCase())
+      .filter(Boolean)
   },
 
   // Stress Test Configuration
   stressTest: {
-    defaultDuration: parseInt(process.env.STRESS_TEST_DURATION) || 300,
-    defaultConcurrency: parseInt(process.env.STRESS_TEST_CONCURRENCY) || 5,
-    maxConcurrency: parseInt(process.env.STRESS_TEST_MAX_CONCURRENCY) || 20
-  }
+    defaultDuration: envInt('STRESS_TEST_DURATION', 300, { min: 1 }),
+    defaultConcurrency: envInt('STRESS_TEST_CONCURRENCY', 5, { min: 1 }),
+    maxConcurrency: envInt('STRESS_TEST_MAX_CONCURRENCY', 20, { min: 1 })
+  },
+
+  envErrors
 };
@@ -0,0 +1,78 @@
+/**
+ * Startup Configuration Validation
+ *
+ * Most settings fall back to a default when unset, but a value that is set
+ * and wrong (PORT=http, MAX_POOL_SIZE=0, a REDIS_URL missing its scheme)
+ * would otherwise start a server that fails on every scan. Numbers and
+ * durations are parsed by config.js, which collects malformed values in
+ * config.envErrors; validateConfig adds cross-setting and URL checks and
+ * lists every problem so the server can refuse to start with all of them
+ * at once.
+ */
+
+const URL_SCHEMES = {
+  REDIS_URL: ['redis:', 'rediss:'],
+  SMTP_URL: ['smtp:', 'smtps:']
+};
+
+const EMAIL_NOTIFY_MODES = ['breach', 'all'];
+
+/**
+ * Problems with the configuration, as messages naming the env variable;
+ * empty when it is valid
+ *
+ * @param {Object} config - Loaded configuration (./config)
+ * @param {Object} env - Environment the configuration was loaded from
+ * @returns {string[]}
+ */
+function validateConfig(config, env = process.env) {
+  // Malformed or out-of-range numbers and durations (see envInt/envDuration)
+  const errors = [...(config.envErrors || [])];
+
+  const pool = config.browserPool;
+  if (pool.minSize > pool.maxSize) {
+    errors.push(`MIN_POOL_SIZE (${pool.minSize}) must not exceed MAX_POOL_SIZE (${pool.maxSize})`);
+  }
+  if (pool.reservedSize > 0 && pool.reservedSize >= pool.maxSize) {
+    errors.push(`RESERVED_POOL_SIZE (${pool.reservedSize}) must be less than MAX_POOL_SIZE (${pool.maxSize})`);
+  }
+  if (config.scanTimeout > config.maxScanTimeout) {
+    errors.push(`SCAN_TIMEOUT (${config.scanTimeout}) must not exceed MAX_SCAN_TIMEOUT (${config.maxScanTimeout})`);
+  }
+  if (config.retryBackoff.baseDelay > config.retryBackoff.maxDelay) {
+    errors.push(`RETRY_BASE_DELAY (${config.retryBackoff.baseDelay}) must not exceed RETRY_MAX_DELAY (${config.retryBackoff.maxDelay})`);
+  }
+  if (config.cache.minTtl > config.cache.maxTtl) {
+    errors.push(`RESULT_CACHE_MIN_TTL (${config.cache.minTtl}) must not exceed RESULT_CACHE_MAX_TTL (${config.cache.maxTtl})`);
+  }
+
+  // Service URLs
+  Object.entries(URL_SCHEMES).forEach(([name, schemes]) => {
+    if (!env[name]) return;
+    let url;
+    try {
+      url = new URL(env[name]);
+    } catch (error) {
+      errors.push(`${name} is not a valid URL: "${env[name]}"`);
+      return;
+    }
+    if (!schemes.includes(url.protocol)) {
+      errors.push(`${name} must use ${schemes.map(scheme => `${scheme}//`).join(' or ')}, got "${url.protocol}//"`);
+    }
+  });
+  if (config.resultQueue.driver) {
+    try {
+      new URL(config.resultQueue.url);
+    } catch (error) {
+      errors.push(`RESULT_QUEUE_URL is not a valid URL: "${config.resultQueue.url}"`);
+    }
+  }
+
+  if (!EMAIL_NOTIFY_MODES.includes(config.email.notify)) {
+    errors.push(`EMAIL_NOTIFY must be one of ${EMAIL_NOTIFY_MODES.join(', ')}, got "${config.email.notify}"`);
+  }
+
+  return errors;
+}
+
+module.exports = { validateConfig };
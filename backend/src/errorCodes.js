@@ -0,0 +1,54 @@
+/**
+ * API Error Codes
+ *
+ * Machine-readable `code` returned with every API error response, next to
+ * the human-readable `error`/`message`, so clients can branch on the code
+ * instead of matching message text. Codes are stable; messages may change.
+ */
+
+const ERROR_CODES = Object.freeze({
+  // 400: Malformed body, invalid options or query parameters
+  INVALID_INPUT: 'INVALID_INPUT',
+  // 401: API keys are configured and X-API-Key is missing or not one of them
+  UNAUTHORIZED: 'UNAUTHORIZED',
+  // 403: Target is a private/internal address
+  SSRF_PROTECTION: 'SSRF_PROTECTION',
+  // 403: Target is hosted in a GeoIP-blocked country
+  GEO_BLOCKED: 'GEO_BLOCKED',
+  // 403: Bulk scan cancellation by a client other than the one that submitted it
+  NOT_BATCH_OWNER: 'NOT_BATCH_OWNER',
+  // 403: WebSocket handshake from a browser Origin not in WS_ALLOWED_ORIGINS
+  ORIGIN_NOT_ALLOWED: 'ORIGIN_NOT_ALLOWED',
+  // 404: Unknown route, batch, report or baseline scan
+  NOT_FOUND: 'NOT_FOUND',
+  // 406: Unsupported Accept-Version
+  UNSUPPORTED_VERSION: 'UNSUPPORTED_VERSION',
+  // 409: Bulk scan hasn't finished yet
+  BATCH_IN_PROGRESS: 'BATCH_IN_PROGRESS',
+  // 413: Request body exceeds MAX_REQUEST_SIZE
+  PAYLOAD_TOO_LARGE: 'PAYLOAD_TOO_LARGE',
+  // 415: Request Content-Encoding other than gzip, deflate or identity
+  UNSUPPORTED_ENCODING: 'UNSUPPORTED_ENCODING',
+  // 422: Target answered with a 401 authentication challenge
+  AUTH_REQUIRED: 'AUTH_REQUIRED',
+  // 426: Streaming endpoint requested without a WebSocket upgrade
+  UPGRADE_REQUIRED: 'UPGRADE_REQUIRED',
+  // 429: Client has too many bulk scans in progress
+  BULK_SCAN_LIMIT: 'BULK_SCAN_LIMIT',
+  // 429: Client exceeded the scan rate limit
+  RATE_LIMITED: 'RATE_LIMITED',
+  // 500: Scan failed (network error, navigation timeout, page crash)
+  SCAN_FAILED: 'SCAN_FAILED',
+  // 500: Unexpected server error
+  INTERNAL_ERROR: 'INTERNAL_ERROR',
+  // 503: Browsers are failing to launch (circuit breaker open)
+  BROWSER_UNAVAILABLE: 'BROWSER_UNAVAILABLE',
+  // 503: No pooled or dedicated browser became free in time
+  OVERLOADED: 'OVERLOADED',
+  // 503: Server is shutting down and not accepting new scans
+  SHUTTING_DOWN: 'SHUTTING_DOWN',
+  // 504: Scan missed its options.timeout deadline
+  SCAN_TIMEOUT: 'SCAN_TIMEOUT'
+});
+
+module.exports = { ERROR_CODES };
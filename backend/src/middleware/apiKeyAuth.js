@@ -0,0 +1,57 @@
+/**
+ * API Key Authentication Middleware
+ *
+ * When API_KEYS (comma-separated) is set, every /api endpoint requires one
+ * of the keys in the X-API-Key header and answers 401 otherwise. Without
+ * API_KEYS the service stays open, as before.
+ *
+ * Keys are compared in constant time: both sides are hashed to a fixed
+ * length and compared with crypto.timingSafeEqual, against every
+ * configured key, so response timing reveals neither which key nor how
+ * much of one matched.
+ */
+
+const crypto = require('crypto');
+const pino = require('pino');
+const config = require('../config');
+const { ERROR_CODES } = require('../errorCodes');
+
+const logger = pino({
+  level: process.env.LOG_LEVEL || 'info'
+});
+
+const digest = key => crypto.createHash('sha256').update(key).digest();
+
+/**
+ * Whether key is one of keys, in time independent of where they differ
+ */
+function isValidApiKey(key, keys) {
+  if (typeof key !== 'string' || key === '') return false;
+
+  const candidate = digest(key);
+  return keys.reduce((valid, configured) => crypto.timingSafeEqual(candidate, digest(configured)) || valid, false);
+}
+
+/**
+ * Middleware requiring a valid X-API-Key when API keys are configured
+ */
+function requireApiKey(keys = config.apiKeys) {
+  return (req, res, next) => {
+    if (keys.length === 0 || isValidApiKey(req.get('x-api-key'), keys)) {
+      return next();
+    }
+
+    logger.warn({ correlationId: req.correlationId, ip: req.ip, path: req.path }, 'Missing or invalid API key');
+    res.set('WWW-Authenticate', 'API-Key header="X-API-Key"');
+    res.status(401).json({
+      error: 'Unauthorized',
+      message: req.get('x-api-key') ? 'Invalid API key' : 'Missing X-API-Key header',
+      code: ERROR_CODES.UNAUTHORIZED
+    });
+  };
+}
+
+module.exports = {
+  isValidApiKey,
+  requireApiKey
+};
@@ -0,0 +1,32 @@
+/**
+ * Backpressure Headers Middleware
+ *
+ * Tells clients how loaded the scanner is on every response, so they can
+ * slow down before scans start queuing for browsers or being shed with 503:
+ *
+ * - X-Scanner-Queue-Depth: scans waiting for a browser
+ * - X-Scanner-Capacity-Remaining: normal-priority scans that could start
+ *   right now (pool browsers not in use, including ones not launched yet,
+ *   less the RESERVED_POOL_SIZE browsers kept for high-priority scans)
+ *
+ * The values are read from the browser pool when the response headers are
+ * written, not when the request arrived, so a long scan's response reflects
+ * the load at the time it finished. Disabled with BACKPRESSURE_HEADERS=false.
+ */
+
+function backpressureHeaders(pool) {
+  return (req, res, next) => {
+    const writeHead = res.writeHead;
+    res.writeHead = function (...args) {
+      if (!res.headersSent) {
+        const stats = pool.getStats();
+        res.setHeader('X-Scanner-Queue-Depth', stats.queueSize);
+        res.setHeader('X-Scanner-Capacity-Remaining', Math.max(pool.capacityFor('normal') - stats.activeCount, 0));
+      }
+      return writeHead.apply(this, args);
+    };
+    next();
+  };
+}
+
+module.exports = { backpressureHeaders };
@@ -1,29 +1,41 @@
 /**
  * Correlation ID Middleware
  *
- * Adds unique correlation IDs to track requests across distributed systems
+ * Adds unique correlation IDs to track requests across distributed systems.
+ * A client-supplied X-Correlation-ID or X-Request-ID is reused when it looks
+ * like an ID (up to 128 letters, digits and ._:- characters), so it can't
+ * inject arbitrary text into log lines; otherwise one is generated. The ID
+ * is echoed in both response headers.
  */
 
 const crypto = require('crypto');
 
+const ID_PATTERN = /^[\w.:-]{1,128}$/;
+
 function generateCorrelationId() {
   return `req_${Date.now()}_${crypto.randomBytes(8).toString('hex')}`;
 }
 
+function clientCorrelationId(req) {
+  const id = req.headers['x-correlation-id'] || req.headers['x-request-id'];
+  return typeof id === 'string' && ID_PATTERN.test(id) ? id : null;
+}
+
 function correlationIdMiddleware(req, res, next) {
   // Use existing correlation ID from header or generate new one
-  const correlationId = req.headers['x-correlation-id'] || generateCorrelationId();
+  const correlationId = clientCorrelationId(req) || generateCorrelationId();
 
   // Attach to request
   req.correlationId = correlationId;
 
   // Add to response headers
   res.setHeader('X-Correlation-ID', correlationId);
+  res.setHeader('X-Request-ID', correlationId);
 
   // Add to request context for logging
   req.context = {
     correlationId,
-    requestId: generateCorrelationId(),
+    requestId: correlationId,
     timestamp: new Date().toISOString(),
     method: req.method,
     path: req.path,
@@ -0,0 +1,58 @@
+/**
+ * Error Handler Middleware
+ *
+ * Turns errors raised before or by route handlers into JSON error responses
+ * with an error code: oversized bodies (413 PAYLOAD_TOO_LARGE), bodies in a
+ * Content-Encoding the parsers can't decode (415 UNSUPPORTED_ENCODING),
+ * other client errors such as malformed JSON or corrupt gzip (their own 4xx
+ * status), and anything else as 500 INTERNAL_ERROR.
+ */
+
+const http = require('http');
+const config = require('../config');
+const { ERROR_CODES } = require('../errorCodes');
+
+function errorHandler(logger) {
+  return (err, req, res, next) => {
+    // e.g. the aborted read of a body requestSizeLimit already rejected
+    if (res.headersSent) {
+      return next(err);
+    }
+
+    if (err.type === 'entity.too.large') {
+      logger.warn({ correlationId: req.correlationId, length: err.length, limit: err.limit }, 'Request body too large');
+      return res.status(413).json({
+        error: 'Payload Too Large',
+        message: `Request body exceeds the maximum size of ${config.security.maxRequestSize}`,
+        code: ERROR_CODES.PAYLOAD_TOO_LARGE
+      });
+    }
+
+    if (err.type === 'encoding.unsupported') {
+      return res.status(415).json({
+        error: 'Unsupported Media Type',
+        message: err.message,
+        code: ERROR_CODES.UNSUPPORTED_ENCODING
+      });
+    }
+
+    // Client errors raised by middleware (e.g. malformed JSON, corrupt gzip)
+    const status = err.status || err.statusCode;
+    if (status >= 400 && status < 500 && err.expose) {
+      return res.status(status).json({
+        error: http.STATUS_CODES[status],
+        message: err.message,
+        code: status === 400 ? ERROR_CODES.INVALID_INPUT : undefined
+      });
+    }
+
+    logger.error(err);
+    res.status(500).json({
+      error: 'Internal server error',
+      message: err.message,
+      code: ERROR_CODES.INTERNAL_ERROR
+    });
+  };
+}
+
+module.exports = { errorHandler };
@@ -0,0 +1,147 @@
+/**
+ * Scan Rate Limiting Middleware
+ *
+ * Token bucket per client (valid X-API-Key, otherwise IP): each client
+ * may burst up to RATE_LIMIT_BURST scans, refilled at RATE_LIMIT_MAX scans
+ * per RATE_LIMIT_WINDOW ms. Batch and bulk requests take one token per
+ * scan. Over-limit requests get 429 with Retry-After and are counted in
+ * wcagai_rate_limited_total.
+ *
+ * Buckets are kept in memory per instance by default. The store is
+ * pluggable via setRateLimitStore() so it can be shared, e.g. in Redis:
+ * store.take(key, cost, { rate, burst }) => { allowed, remaining, retryAfter }
+ */
+
+const pino = require('pino');
+const config = require('../config');
+const { ERROR_CODES } = require('../errorCodes');
+const { isValidApiKey } = require('./apiKeyAuth');
+const { rateLimitedCounter } = require('../services/metrics');
+
+const logger = pino({
+  level: process.env.LOG_LEVEL || 'info'
+});
+
+class MemoryTokenBucketStore {
+  constructor(options = {}) {
+    this.buckets = new Map();
+    this.sweepInterval = options.sweepInterval || 60 * 1000;
+    this.lastSweep = Date.now();
+  }
+
+  /**
+   * Take cost tokens from a client's bucket
+   *
+   * @param {number} limits.rate - Tokens refilled per ms
+   * @param {number} limits.burst - Bucket capacity
+   * @returns {{allowed, remaining, retryAfter}} retryAfter in ms when not allowed
+   */
+  async take(key, cost, { rate, burst }, now = Date.now()) {
+    this.sweep(burst, rate, now);
+
+    const bucket = this.buckets.get(key) || { tokens: burst, updatedAt: now };
+    bucket.tokens = Math.min(burst, bucket.tokens + (now - bucket.updatedAt) * rate);
+    bucket.updatedAt = now;
+    this.buckets.set(key, bucket);
+
+    if (bucket.tokens < cost) {
+      // Requests costing more than the burst can never succeed; report the
+      // time until the bucket is full
+      const missing = Math.min(cost, burst) - bucket.tokens;
+      return { allowed: false, remaining: Math.floor(bucket.tokens), retryAfter: Math.ceil(missing / rate) };
+    }
+
+    bucket.tokens -= cost;
+    return { allowed: true, remaining: Math.floor(bucket.tokens), retryAfter: 0 };
+  }
+
+  // Drop buckets that have refilled completely, as a fresh one is the same
+  sweep(burst, rate, now) {
+    if (now - this.lastSweep < this.sweepInterval) return;
+    this.lastSweep = now;
+
+    for (const [key, bucket] of this.buckets) {
+      if (bucket.tokens + (now - bucket.updatedAt) * rate >= burst) {
+        this.buckets.delete(key);
+      }
+    }
+  }
+}
+
+let store = new MemoryTokenBucketStore();
+
+/**
+ * Replace the bucket store: { take(key, cost, { rate, burst }) }
+ */
+function setRateLimitStore(rateLimitStore) {
+  store = rateLimitStore;
+}
+
+// Clients are identified by API key when a configured one is sent,
+// otherwise by IP; made-up keys mustn't get a fresh bucket each
+function clientId(req) {
+  const apiKey = req.get('x-api-key');
+  return isValidApiKey(apiKey, config.apiKeys) ? `key:${apiKey}` : `ip:${req.ip}`;
+}
+
+/**
+ * Take cost tokens from the request's client; null when rate limiting is
+ * disabled or the store failed, in which case the request is allowed
+ *
+ * @returns {Promise<{allowed, remaining, retryAfter, message}|null>}
+ */
+async function takeRateLimit(req, cost) {
+  if (!config.rateLimit.enabled) {
+    return null;
+  }
+
+  const { windowMs, maxRequests, burst } = config.rateLimit;
+  const limits = { rate: maxRequests / windowMs, burst };
+
+  try {
+    const result = await store.take(clientId(req), Math.max(1, cost), limits);
+    if (!result.allowed) {
+      rateLimitedCounter.inc();
+      logger.warn({ correlationId: req.correlationId, ip: req.ip, path: req.path }, 'Scan rate limit exceeded');
+    }
+    return {
+      ...result,
+      message: `Rate limit of ${maxRequests} scans per ${windowMs / 1000}s (burst ${burst}) exceeded`
+    };
+  } catch (error) {
+    // A failing shared store shouldn't take scanning down with it
+    logger.warn({ error: error.message }, 'Rate limit store failed, allowing request');
+    return null;
+  }
+}
+
+/**
+ * Rate limit middleware; cost(req) is the number of tokens a request takes
+ */
+function rateLimit(cost = () => 1) {
+  return async (req, res, next) => {
+    const result = await takeRateLimit(req, cost(req));
+    if (!result) {
+      return next();
+    }
+
+    res.set('X-RateLimit-Remaining', String(result.remaining));
+    if (!result.allowed) {
+      res.set('Retry-After', String(Math.ceil(result.retryAfter / 1000)));
+      return res.status(429).json({
+        error: 'Too Many Requests',
+        message: result.message,
+        code: ERROR_CODES.RATE_LIMITED
+      });
+    }
+    next();
+  };
+}
+
+module.exports = {
+  MemoryTokenBucketStore,
+  rateLimit,
+  takeRateLimit,
+  setRateLimitStore,
+  clientId
+};
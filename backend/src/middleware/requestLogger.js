@@ -0,0 +1,51 @@
+/**
+ * Request Logging Middleware
+ *
+ * Logs one JSON line per finished request, with its correlation ID, route
+ * and timing: at error level for 5xx responses, info otherwise. Also
+ * records the request duration metric and audits API access.
+ */
+
+const { httpRequestDuration, routeLabel, sanitizeLabels } = require('../services/metrics');
+const { auditLogger } = require('../services/auditLogger');
+
+function requestLogger(logger) {
+  return (req, res, next) => {
+    const start = Date.now();
+    res.on('finish', () => {
+      const duration = (Date.now() - start) / 1000;
+
+      // Log request, one line each
+      logger[res.statusCode >= 500 ? 'error' : 'info']({
+        correlationId: req.correlationId,
+        method: req.method,
+        url: req.url,
+        route: routeLabel(req),
+        status: res.statusCode,
+        duration: duration * 1000
+      }, 'Request completed');
+
+      // Record metrics
+      httpRequestDuration.observe(
+        sanitizeLabels({ method: req.method, route: routeLabel(req), status: res.statusCode }),
+        duration
+      );
+
+      // Audit log API access
+      if (req.path.startsWith('/api/')) {
+        auditLogger.logApiAccess({
+          correlationId: req.correlationId,
+          method: req.method,
+          path: req.path,
+          status: res.statusCode,
+          duration: duration * 1000,
+          ip: req.ip,
+          userAgent: req.headers['user-agent']
+        });
+      }
+    });
+    next();
+  };
+}
+
+module.exports = { requestLogger };
@@ -0,0 +1,26 @@
+/**
+ * Shutdown Middleware
+ *
+ * Rejects new scans with 503 SHUTTING_DOWN once the server has started
+ * shutting down, while in-flight scans finish. The connection is closed so
+ * clients retry against another instance instead of reusing this one.
+ */
+
+const { ERROR_CODES } = require('../errorCodes');
+
+function rejectWhileShuttingDown(isShuttingDown) {
+  return (req, res, next) => {
+    if (!isShuttingDown()) {
+      return next();
+    }
+
+    res.set('Connection', 'close');
+    res.status(503).json({
+      error: 'Service Unavailable',
+      message: 'Server is shutting down',
+      code: ERROR_CODES.SHUTTING_DOWN
+    });
+  };
+}
+
+module.exports = { rejectWhileShuttingDown };
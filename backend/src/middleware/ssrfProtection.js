@@ -9,12 +9,22 @@
  * 5. Domain rebinding protection
  * 6. Rate limiting per domain
  *
+ * Malformed URLs and schemes other than http/https are rejected with 400.
+ * With BLOCK_PRIVATE_IPS=false, private and loopback targets are allowed
+ * (e.g. to scan a local dev server); metadata endpoints stay blocked, by
+ * name and by resolved address.
+ *
+ * options.hostOverrides apply to every request the scan's browser makes,
+ * not just the target, so every override is checked.
+ *
  * Security Level: CRITICAL
  */
 
 const dns = require('dns').promises;
 const url = require('url');
 const pino = require('pino');
+const config = require('../config');
+const { ERROR_CODES } = require('../errorCodes');
 
 const logger = pino({
   level: process.env.LOG_LEVEL || 'info'
@@ -42,15 +52,20 @@ const PRIVATE_IP_RANGES = [
   { start: '0.0.0.0', end: '0.255.255.255' }, // 0.0.0.0/8 (this network)
 ];
 
-// Private IPv6 ranges
+// Private IPv6 ranges, by the value of the first 16 bits
 const PRIVATE_IPV6_RANGES = [
-  '::1', // Loopback
-  'fe80::', // Link-local
-  'fc00::', // Unique local addresses
-  'fd00::', // Unique local addresses
-  'ff00::', // Multicast
+  { start: 0xfc00, end: 0xfdff }, // fc00::/7 (unique local)
+  { start: 0xfe80, end: 0xfebf }, // fe80::/10 (link-local)
+  { start: 0xff00, end: 0xffff }, // ff00::/8 (multicast)
 ];
 
+// Cloud metadata services, blocked even when private targets are allowed
+const METADATA_IP_RANGES = [
+  { start: '169.254.0.0', end: '169.254.255.255' }, // Link-local: AWS, GCP, Azure, DigitalOcean
+  { start: '100.100.100.200', end: '100.100.100.200' }, // Alibaba Cloud
+];
+const METADATA_IPV6 = ['fd00:ec2::254']; // AWS IMDS over IPv6
+
 /**
  * Convert IP address string to integer for range checking
  */
@@ -59,24 +74,55 @@ function ipToInt(ip) {
   return ((parts[0] << 24) | (parts[1] << 16) | (parts[2] << 8) | parts[3]) >>> 0;
 }
 
+function inIPv4Ranges(ip, ranges) {
+  const ipInt = ipToInt(ip);
+  return ranges.some(range => ipInt >= ipToInt(range.start) && ipInt <= ipToInt(range.end));
+}
+
 /**
  * Check if IPv4 address is in private range
  */
 function isPrivateIPv4(ip) {
-  const ipInt = ipToInt(ip);
+  return inIPv4Ranges(ip, PRIVATE_IP_RANGES);
+}
 
-  return PRIVATE_IP_RANGES.some(range => {
-    const startInt = ipToInt(range.start);
-    const endInt = ipToInt(range.end);
-    return ipInt >= startInt && ipInt <= endInt;
-  });
+/**
+ * Lowercase an IPv6 address without URL brackets or zone ID
+ */
+function normalizeIPv6(ip) {
+  return ip.toLowerCase().replace(/^\[|\]$/g, '').replace(/%.*$/, '');
+}
+
+/**
+ * The IPv4 address of an IPv4-mapped IPv6 address (::ffff:10.0.0.1, or
+ * ::ffff:a00:1 as URLs write it), or null
+ */
+function mappedIPv4(ip) {
+  const dotted = ip.match(/^(?:0{0,4}:){0,5}:?ffff:(\d{1,3}(?:\.\d{1,3}){3})$/);
+  if (dotted) return dotted[1];
+
+  const hex = ip.match(/^(?:0{0,4}:){0,5}:?ffff:([0-9a-f]{1,4}):([0-9a-f]{1,4})$/);
+  if (!hex) return null;
+  const high = parseInt(hex[1], 16);
+  const low = parseInt(hex[2], 16);
+  return [high >> 8, high & 0xff, low >> 8, low & 0xff].join('.');
 }
 
 /**
  * Check if IPv6 address is in private range
  */
 function isPrivateIPv6(ip) {
-  return PRIVATE_IPV6_RANGES.some(prefix => ip.startsWith(prefix));
+  const address = normalizeIPv6(ip);
+  const ipv4 = mappedIPv4(address);
+  if (ipv4) {
+    return isPrivateIPv4(ipv4);
+  }
+  // Loopback and unspecified
+  if (/^(0{0,4}:){0,7}:?0{0,3}[01]$/.test(address) || address === '::') {
+    return true;
+  }
+  const firstGroup = address.startsWith('::') ? 0 : parseInt(address.split(':')[0], 16);
+  return PRIVATE_IPV6_RANGES.some(range => firstGroup >= range.start && firstGroup <= range.end);
 }
 
 /**
@@ -89,6 +135,41 @@ function isPrivateIP(ip) {
   return isPrivateIPv4(ip);
 }
 
+/**
+ * Check if IP address (v4 or v6) belongs to a cloud metadata service
+ */
+function isMetadataIP(ip) {
+  if (!ip.includes(':')) {
+    return inIPv4Ranges(ip, METADATA_IP_RANGES);
+  }
+  const address = normalizeIPv6(ip);
+  const ipv4 = mappedIPv4(address);
+  return ipv4 ? inIPv4Ranges(ipv4, METADATA_IP_RANGES) : METADATA_IPV6.includes(address);
+}
+
+/**
+ * Whether a scan may connect to an IP: never to metadata services, and to
+ * private addresses only with BLOCK_PRIVATE_IPS=false
+ */
+function isForbiddenIP(ip) {
+  return isMetadataIP(ip) || (config.security.blockPrivateIPs && isPrivateIP(ip));
+}
+
+/**
+ * Reject host overrides to forbidden IPs. Overrides are browser-wide, so
+ * each one is checked, not only the target's: an override for a
+ * subresource host could otherwise point the page at internal services.
+ */
+function checkHostOverrides(hostOverrides = {}) {
+  const forbidden = Object.entries(hostOverrides).filter(([, ip]) => isForbiddenIP(ip));
+  if (forbidden.length > 0) {
+    logger.warn({ overrides: Object.fromEntries(forbidden) }, 'SSRF attempt blocked: host override to private IP');
+    throw new Error(
+      `Host overrides to private or metadata IP addresses are not allowed: ${forbidden.map(([host]) => host).join(', ')}`
+    );
+  }
+}
+
 /**
  * Check if hostname is blocked
  */
@@ -99,43 +180,98 @@ function isBlockedHost(hostname) {
   );
 }
 
+function isLoopbackHost(hostname) {
+  const lowerHostname = hostname.toLowerCase();
+  return lowerHostname === 'localhost' || lowerHostname.endsWith('.localhost');
+}
+
 /**
- * Validate URL and check for SSRF vulnerabilities
+ * IP a hostname is overridden to by options.hostOverrides, if any
+ */
+function hostOverrideFor(hostOverrides = {}, hostname) {
+  const entry = Object.entries(hostOverrides)
+    .find(([host]) => host.toLowerCase() === hostname.toLowerCase());
+  return entry ? entry[1] : null;
+}
+
+function invalidURLError(message) {
+  const error = new Error(message);
+  error.code = ERROR_CODES.INVALID_INPUT;
+  return error;
+}
+
+/**
+ * Parse a scan URL, allowing only HTTP and HTTPS
  */
-async function validateURL(inputUrl) {
+function parseScanURL(inputUrl) {
   let parsedUrl;
 
   try {
     parsedUrl = new url.URL(inputUrl);
   } catch (error) {
-    throw new Error(`Invalid URL: ${error.message}`);
+    throw invalidURLError(`Invalid URL: ${inputUrl}`);
   }
 
-  // Only allow HTTP and HTTPS
   if (!['http:', 'https:'].includes(parsedUrl.protocol)) {
-    throw new Error(`Protocol not allowed: ${parsedUrl.protocol}. Only HTTP and HTTPS are supported.`);
+    throw invalidURLError(`Protocol not allowed: ${parsedUrl.protocol}. Only HTTP and HTTPS are supported.`);
   }
 
+  return parsedUrl;
+}
+
+/**
+ * Normalize a scan URL so equivalent URLs are scanned and cached alike: the
+ * scheme and host are lowercased (by URL parsing) and the fragment, which
+ * is never sent to the server, is dropped. Client-side routes ("#/path",
+ * "#!/path") are kept, as they select what single-page apps render.
+ */
+function normalizeURL(inputUrl) {
+  const parsedUrl = parseScanURL(inputUrl);
+  if (!/^#!?\//.test(parsedUrl.hash)) {
+    parsedUrl.hash = '';
+  }
+  return parsedUrl.href;
+}
+
+/**
+ * Validate URL and check for SSRF vulnerabilities
+ *
+ * hostOverrides (hostname -> IP) replace DNS resolution for those hosts, so
+ * the IP a scan will actually connect to is the one validated.
+ */
+async function validateURL(inputUrl, hostOverrides = {}) {
+  const parsedUrl = parseScanURL(inputUrl);
   const hostname = parsedUrl.hostname;
+  const allowPrivate = !config.security.blockPrivateIPs;
 
   // Check if hostname is blocked
-  if (isBlockedHost(hostname)) {
+  if (isBlockedHost(hostname) && !(allowPrivate && isLoopbackHost(hostname))) {
     logger.warn({ hostname, url: inputUrl }, 'SSRF attempt blocked: blacklisted hostname');
     throw new Error('Scanning of internal/metadata endpoints is not allowed for security reasons');
   }
 
+  checkHostOverrides(hostOverrides);
+  if (hostOverrideFor(hostOverrides, hostname)) {
+    return;
+  }
+
   // Check if hostname is an IP address
   const isIPv4 = /^(\d{1,3}\.){3}\d{1,3}$/.test(hostname);
   const isIPv6 = hostname.includes(':');
 
   if (isIPv4 || isIPv6) {
-    if (isPrivateIP(hostname)) {
+    if (isForbiddenIP(hostname)) {
       logger.warn({ hostname, url: inputUrl }, 'SSRF attempt blocked: private IP in URL');
       throw new Error('Scanning of private IP addresses is not allowed for security reasons');
     }
     return; // Public IP is allowed
   }
 
+  // Loopback names never resolve to metadata services
+  if (allowPrivate && isLoopbackHost(hostname)) {
+    return;
+  }
+
   // Resolve DNS for hostname validation
   try {
     // Resolve both IPv4 and IPv6
@@ -155,12 +291,23 @@ async function validateURL(inputUrl) {
       // IPv6 resolution failed, continue
     }
 
+    // Local dev hosts may only be in /etc/hosts, which resolve*() skip
+    if (addresses.length === 0 && allowPrivate) {
+      try {
+        const lookedUp = await dns.lookup(hostname, { all: true });
+        addresses.push(...lookedUp.map(entry => entry.address));
+      } catch (error) {
+        // Lookup failed too, reported below
+      }
+    }
+
     if (addresses.length === 0) {
       throw new Error(`Could not resolve hostname: ${hostname}`);
     }
 
-    // Check if any resolved IP is private
-    const privateIPs = addresses.filter(ip => isPrivateIP(ip));
+    // Check if any resolved IP is private (or, when private targets are
+    // allowed, a metadata service)
+    const privateIPs = addresses.filter(ip => isForbiddenIP(ip));
 
     if (privateIPs.length > 0) {
       logger.warn({
@@ -200,7 +347,7 @@ async function validateURL(inputUrl) {
  */
 async function ssrfProtection(req, res, next) {
   try {
-    const { type, input } = req.body;
+    const { type, input, options = {} } = req.body;
 
     // Only validate URL scans
     if (type !== 'url') {
@@ -208,25 +355,40 @@ async function ssrfProtection(req, res, next) {
     }
 
     // Validate and check for SSRF
-    await validateURL(input);
+    await validateURL(input, options.hostOverrides);
+    req.body.input = normalizeURL(input);
 
     next();
   } catch (error) {
-    logger.error({
-      url: req.body.input,
-      error: error.message,
-      ip: req.ip,
-      userAgent: req.headers['user-agent']
-    }, 'SSRF protection triggered');
-
-    res.status(403).json({
-      error: 'Security Violation',
+    const rejection = urlRejection(error);
+
+    if (rejection.code === ERROR_CODES.SSRF_PROTECTION) {
+      logger.error({
+        url: req.body.input,
+        error: error.message,
+        ip: req.ip,
+        userAgent: req.headers['user-agent']
+      }, 'SSRF protection triggered');
+    }
+
+    res.status(rejection.status).json({
+      error: rejection.error,
       message: error.message,
-      code: 'SSRF_PROTECTION'
+      code: rejection.code
     });
   }
 }
 
+/**
+ * Status, error and code to reject a URL that failed validateURL() with
+ */
+function urlRejection(error) {
+  if (error.code === ERROR_CODES.INVALID_INPUT) {
+    return { status: 400, error: 'Invalid URL', code: ERROR_CODES.INVALID_INPUT };
+  }
+  return { status: 403, error: 'Security Violation', code: ERROR_CODES.SSRF_PROTECTION };
+}
+
 /**
  * Standalone validation function for use outside Express
  */
@@ -246,6 +408,14 @@ module.exports = {
   ssrfProtection,
   validateURL,
   validateScanURL,
+  normalizeURL,
+  urlRejection,
   isPrivateIP,
-  isBlockedHost
+  isMetadataIP,
+  checkHostOverrides,
+  isBlockedHost,
+  hostOverrideFor,
+  ipToInt,
+  normalizeIPv6,
+  mappedIPv4
 };
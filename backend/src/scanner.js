@@ -1,17 +1,704 @@
+const crypto = require('crypto');
+const { StringDecoder } = require('string_decoder');
 const { AxePuppeteer } = require('@axe-core/puppeteer');
 const pino = require('pino');
 const { getBrowserPool } = require('./services/browserPool');
+const { scanHtmlDegraded, fetchHtml } = require('./services/degradedScanner');
+const { manager: circuitBreakerManager } = require('./services/circuitBreaker');
+const { updateCircuitBreakerMetrics, activeScansGauge, scanTimeoutWarningCounter } = require('./services/metrics');
+const { runCustomChecks } = require('./services/customChecks');
+const { filterRules } = require('./services/resultFormatter');
+const config = require('./config');
+const { ERROR_CODES } = require('./errorCodes');
+const { checkHostOverrides } = require('./middleware/ssrfProtection');
 
 const logger = pino({
   level: process.env.LOG_LEVEL || 'info'
 });
 
-const MAX_RETRIES = 3;
-const SCAN_TIMEOUT = parseInt(process.env.SCAN_TIMEOUT) || 30000;
+const MAX_RETRIES = config.maxRetriesPerScan;
+const SCAN_TIMEOUT = config.scanTimeout;
 
 // Get browser pool instance
 const browserPool = getBrowserPool();
 
+// Trips on browser launch failures; a full pool is load, not an outage,
+// and a canceled wait is neither. The pool bounds an acquire by
+// BROWSER_ACQUIRE_TIMEOUT plus a launch, so the breaker only times out
+// acquires that hang beyond that.
+const browserBreaker = circuitBreakerManager.getBreaker('browser', {
+  ...config.browserBreaker,
+  timeout: config.browserAcquireTimeout + browserPool.launchConfig.timeout,
+  // While open, a test launch closes the breaker as soon as browsers work
+  healthCheck: () => browserPool.probe(),
+  isFailure: error => !error.queueTimeout && error.name !== 'AbortError'
+});
+['open', 'close', 'halfOpen'].forEach(event => {
+  browserBreaker.on(event, () => updateCircuitBreakerMetrics('browser', browserBreaker.state));
+});
+updateCircuitBreakerMetrics('browser', browserBreaker.state);
+
+// Scans in progress, so shutdown can wait for them
+let activeScans = 0;
+let idleWaiters = [];
+
+async function trackScan(scan) {
+  activeScans++;
+  activeScansGauge.set(activeScans);
+  try {
+    return await scan();
+  } finally {
+    activeScans--;
+    activeScansGauge.set(activeScans);
+    if (activeScans === 0) {
+      idleWaiters.forEach(resolve => resolve(true));
+      idleWaiters = [];
+    }
+  }
+}
+
+function activeScanCount() {
+  return activeScans;
+}
+
+/**
+ * Wait until no scans are in progress
+ *
+ * @returns {Promise<boolean>} false if scans were still running after timeout ms
+ */
+function waitForIdle(timeout) {
+  if (activeScans === 0) return Promise.resolve(true);
+
+  return new Promise(resolve => {
+    const timer = setTimeout(() => resolve(false), timeout);
+    idleWaiters.push(() => {
+      clearTimeout(timer);
+      resolve(true);
+    });
+  });
+}
+
+// Log a warning once a scan has used up most of its time budget so
+// operators get early notice before scans start timing out.
+function startTimeoutWarning(context, timeout = SCAN_TIMEOUT) {
+  const fraction = config.scanTimeoutWarnFraction;
+  if (!(fraction > 0 && fraction < 1)) {
+    return () => {};
+  }
+
+  const startTime = Date.now();
+  const timer = setTimeout(() => {
+    scanTimeoutWarningCounter.inc();
+    logger.warn({
+      ...context,
+      elapsed: Date.now() - startTime,
+      timeout,
+      fraction
+    }, 'Scan is approaching its timeout');
+  }, Math.floor(timeout * fraction));
+
+  // Never keep the process alive just for the warning
+  timer.unref();
+
+  return () => clearTimeout(timer);
+}
+
+// Hash of the rendered page HTML, used to detect different URLs that
+// serve identical content
+function fingerprintContent(html) {
+  return crypto.createHash('sha256').update(html).digest('hex');
+}
+
+// Click the first visible consent banner button matching one of the
+// selectors so the banner doesn't obscure content during the scan
+async function dismissConsentBanner(page, selectors) {
+  for (const selector of selectors) {
+    try {
+      const button = await page.$(selector);
+      if (button && await button.isIntersectingViewport()) {
+        await button.click();
+        await page.waitForTimeout(500);
+        logger.debug({ selector }, 'Dismissed consent banner');
+        return true;
+      }
+    } catch (error) {
+      logger.debug({ selector, error: error.message }, 'Consent selector did not match');
+    }
+  }
+  return false;
+}
+
+// Record page console errors and uncaught exceptions into metadata, keeping
+// at most config.maxConsoleErrors of them
+function captureConsoleErrors(page, metadata) {
+  metadata.consoleErrors = [];
+  metadata.consoleErrorsDropped = 0;
+
+  const record = (source, message) => {
+    if (metadata.consoleErrors.length < config.maxConsoleErrors) {
+      metadata.consoleErrors.push({ source, message: message.slice(0, 1000) });
+    } else {
+      metadata.consoleErrorsDropped++;
+    }
+  };
+
+  page.on('console', message => {
+    if (message.type() === 'error') {
+      record('console', message.text());
+    }
+  });
+  page.on('pageerror', error => record('exception', error.message));
+}
+
+function isAnalyticsHost(url) {
+  const { hostname } = new URL(url);
+  return config.analyticsHosts.some(host => hostname === host || hostname.endsWith(`.${host}`));
+}
+
+// Subresource requests of the options.blockResources categories: puppeteer
+// resource types (image, font, media, stylesheet), or "analytics" for
+// requests to config.analyticsHosts
+function isBlockedResource(request, categories) {
+  return categories.includes(request.resourceType()) ||
+    (categories.includes('analytics') && isAnalyticsHost(request.url()));
+}
+
+// Chrome's console warning for each insecure subresource of an https page,
+// saying whether the request was blocked or upgraded to https
+const MIXED_CONTENT_MESSAGE = /^Mixed Content: .* requested an insecure (\S+) '([^']+)'/;
+const MAX_MIXED_CONTENT = 100;
+
+// Record http:// subresources of https pages into metadata.mixedContent:
+// those the browser loaded (passive content such as images) and those it
+// blocked or upgraded, which never reach the network as http requests
+function captureMixedContent(page, metadata) {
+  metadata.mixedContent = [];
+  const seen = new Map();
+
+  const record = (url, type, status) => {
+    if (seen.has(url)) {
+      seen.get(url).status = status;
+    } else if (seen.size < MAX_MIXED_CONTENT) {
+      const resource = { url, type, status };
+      seen.set(url, resource);
+      metadata.mixedContent.push(resource);
+    }
+  };
+
+  page.on('request', request => {
+    const frame = request.frame();
+    if (!request.url().startsWith('http:') || !frame || !frame.url().startsWith('https:')) return;
+    if (request.isNavigationRequest() && frame === page.mainFrame()) return;
+    record(request.url(), request.resourceType(), 'loaded');
+  });
+
+  page.on('console', message => {
+    const match = message.text().match(MIXED_CONTENT_MESSAGE);
+    if (!match) return;
+
+    const text = message.text();
+    const status = text.includes('has been blocked')
+      ? 'blocked'
+      : text.includes('automatically upgraded') ? 'upgraded' : 'loaded';
+    record(match[2], match[1], status);
+  });
+}
+
+// Seed localStorage/sessionStorage in the top frame before page scripts run
+// (e.g. flags that skip onboarding)
+async function injectStorage(page, storage) {
+  await page.evaluateOnNewDocument(entries => {
+    if (window !== window.top) return;
+    try {
+      for (const [area, values] of Object.entries(entries)) {
+        for (const [key, value] of Object.entries(values || {})) {
+          window[area].setItem(key, value);
+        }
+      }
+    } catch (error) {
+      // Storage is unavailable on opaque origins such as about:blank
+    }
+  }, storage);
+}
+
+// Scans that seed storage get a page in their own incognito context, so the
+// values don't stay in the pooled browser's default context, where later
+// scans for other clients would see them
+async function openPage(browser, options) {
+  if (!options.localStorage && !options.sessionStorage) {
+    return browser.newPage();
+  }
+
+  const context = await browser.createIncognitoBrowserContext();
+  try {
+    return await context.newPage();
+  } catch (error) {
+    await context.close();
+    throw error;
+  }
+}
+
+// Close a page, and the incognito context openPage() created for it
+async function closePage(page) {
+  const context = page.browserContext();
+  try {
+    await page.close();
+  } finally {
+    if (context.isIncognito()) {
+      await context.close();
+    }
+  }
+}
+
+// Start the page's clock at a fixed time. Date keeps ticking from there so
+// timers and elapsed-time logic still behave; performance.now() is untouched.
+async function mockClock(page, timestamp) {
+  await page.evaluateOnNewDocument(start => {
+    const RealDate = Date;
+    const offset = start - RealDate.now();
+    const now = () => RealDate.now() + offset;
+
+    function MockDate(...args) {
+      if (!new.target) {
+        return new RealDate(now()).toString();
+      }
+      return new RealDate(...(args.length > 0 ? args : [now()]));
+    }
+    MockDate.prototype = RealDate.prototype;
+    MockDate.now = now;
+    MockDate.parse = RealDate.parse;
+    MockDate.UTC = RealDate.UTC;
+
+    window.Date = MockDate;
+  }, timestamp);
+}
+
+// Browser emulation applied to a fresh page before the content is loaded
+async function configurePage(page, options, metadata, origin = null) {
+  // Pooled browsers are reused, so don't inherit another scan's grants
+  await page.browserContext().clearPermissionOverrides();
+
+  if (options.geolocation) {
+    if (origin) {
+      await page.browserContext().overridePermissions(origin, ['geolocation']);
+    }
+    await page.setGeolocation({ accuracy: 100, ...options.geolocation });
+  }
+
+  if (options.timezone) {
+    await page.emulateTimezone(options.timezone);
+  }
+
+  if (options.mockDate !== undefined) {
+    const timestamp = new Date(options.mockDate).getTime();
+    await mockClock(page, timestamp);
+    metadata.mockDate = new Date(timestamp).toISOString();
+  }
+
+  if (options.captureConsole) {
+    captureConsoleErrors(page, metadata);
+  }
+
+  if (options.mixedContent) {
+    captureMixedContent(page, metadata);
+  }
+
+  if (options.localStorage || options.sessionStorage) {
+    await injectStorage(page, {
+      localStorage: options.localStorage,
+      sessionStorage: options.sessionStorage
+    });
+  }
+
+  const mediaFeatures = [];
+
+  if (options.reducedMotion) {
+    mediaFeatures.push({ name: 'prefers-reduced-motion', value: options.reducedMotion });
+  }
+
+  // Windows High Contrast mode
+  if (options.forcedColors) {
+    mediaFeatures.push({ name: 'forced-colors', value: options.forcedColors });
+  }
+
+  if (mediaFeatures.length > 0) {
+    await page.emulateMediaFeatures(mediaFeatures);
+  }
+}
+
+// Whether a scan needs to intercept the page's requests
+function needsInterception(options) {
+  return options.method === 'POST' || Boolean(options.acceptHeader) || Boolean(options.blockResources);
+}
+
+// Override the page's own navigation request: send it as a POST with the
+// given body, and/or with a custom Accept header. Redirects the server
+// answers with keep the Accept header but aren't POSTed again.
+// Subresources of the options.blockResources categories are aborted and
+// counted in metadata.blockedRequests; others are left alone.
+async function interceptRequests(page, options, metadata) {
+  let posted = false;
+  if (options.blockResources) {
+    metadata.blockedRequests = 0;
+  }
+
+  await page.setRequestInterception(true);
+  page.on('request', request => {
+    if (request.isInterceptResolutionHandled()) return;
+
+    if (request.isNavigationRequest() && request.frame() === page.mainFrame()) {
+      const overrides = { headers: { ...request.headers() } };
+      if (options.acceptHeader) {
+        overrides.headers.accept = options.acceptHeader;
+      }
+      if (options.method === 'POST' && !posted) {
+        posted = true;
+        overrides.method = 'POST';
+        overrides.postData = options.body || '';
+        overrides.headers['content-type'] = options.contentType || 'application/x-www-form-urlencoded';
+      }
+      return request.continue(overrides);
+    }
+    if (options.blockResources && isBlockedResource(request, options.blockResources)) {
+      metadata.blockedRequests++;
+      return request.abort('blockedbyclient');
+    }
+    request.continue();
+  });
+}
+
+// axe-core run options for a scan
+function axeRunOptions(options) {
+  return {
+    // options.runOnly replaces the WCAG tag selection with a list of rules
+    runOnly: options.runOnly
+      ? { type: 'rule', values: options.runOnly }
+      : { type: 'tag', values: ['wcag2a', 'wcag2aa', 'wcag21a', 'wcag21aa', 'wcag22aa'] },
+    rules: options.disableRules
+      ? Object.fromEntries(options.disableRules.map(id => [id, { enabled: false }]))
+      : undefined,
+    // Report an XPath for each node alongside its selector
+    xpath: options.xpath === true
+  };
+}
+
+// Run axe on the loaded page. Rule IDs axe doesn't know are the client's
+// mistake, not a scan failure worth retrying.
+async function runAxe(page, options) {
+  try {
+    return await new AxePuppeteer(page)
+      .options(axeRunOptions(options))
+      .analyze();
+  } catch (error) {
+    if (/unknown rule/i.test(error.message)) {
+      error.code = ERROR_CODES.INVALID_INPUT;
+      error.retryable = false;
+    }
+    throw error;
+  }
+}
+
+// Drop rules outside options.runOnly / options.disableRules in case the
+// engine didn't apply them (degraded scans run their own rule subset)
+function selectRules(result, options) {
+  if (!result.violations || (!options.runOnly && !options.disableRules)) {
+    return result;
+  }
+  return filterRules(result, options);
+}
+
+// Capture artifacts of the rendered page for the report bundle
+async function captureArtifacts(page, options, artifacts) {
+  if (options.screenshot && artifacts) {
+    artifacts.screenshot = await page.screenshot({ fullPage: true, type: 'png' });
+  }
+
+  // The DOM as axe saw it, after scripts ran
+  if (options.renderedHtml && artifacts) {
+    const html = Buffer.from(await page.content());
+    const maxBytes = config.reports.maxHtmlBytes;
+    // StringDecoder holds back a character cut off at the cap
+    artifacts.html = new StringDecoder('utf8').write(html.subarray(0, maxBytes));
+    artifacts.htmlTruncated = html.length > maxBytes;
+  }
+}
+
+const MAX_AX_TEXT = 500;
+
+// Copy of an accessibility tree keeping the first maxNodes nodes in
+// document order; long names and values are shortened
+function capAccessibilityTree(root, maxNodes) {
+  let count = 0;
+  let truncated = false;
+
+  const copy = node => {
+    count++;
+    const { children, ...fields } = node;
+    Object.keys(fields)
+      .filter(key => typeof fields[key] === 'string' && fields[key].length > MAX_AX_TEXT)
+      .forEach(key => { fields[key] = fields[key].slice(0, MAX_AX_TEXT); });
+
+    const copies = [];
+    for (const child of children || []) {
+      if (count >= maxNodes) {
+        truncated = true;
+        break;
+      }
+      copies.push(copy(child));
+    }
+    return copies.length > 0 ? { ...fields, children: copies } : fields;
+  };
+
+  const tree = root ? copy(root) : null;
+  return { root: tree, nodes: count, truncated };
+}
+
+// The page's accessibility tree (computed roles, names and states) as the
+// browser exposes it to assistive technology, into metadata.accessibilityTree
+async function captureAccessibilityTree(page, options, metadata) {
+  if (!options.accessibilityTree) return;
+
+  const snapshot = await page.accessibility.snapshot({ interestingOnly: true });
+  metadata.accessibilityTree = capAccessibilityTree(snapshot, config.maxAccessibilityTreeNodes);
+}
+
+// Page preparation steps that run after load and before axe analysis
+async function preparePage(page, options, metadata) {
+  if (options.dismissConsent) {
+    metadata.consentDismissed = await dismissConsentBanner(
+      page,
+      options.consentSelectors || config.consentSelectors
+    );
+  }
+}
+
+// options.timeout, clamped to MAX_SCAN_TIMEOUT
+function scanTimeout(options) {
+  return Math.min(options.timeout, config.maxScanTimeout);
+}
+
+// options.maxLoadWait, clamped to MAX_LOAD_WAIT and the scan timeout
+function loadWait(options, timeout) {
+  return Math.min(options.maxLoadWait, config.maxLoadWait, timeout);
+}
+
+/**
+ * With options.maxLoadWait, wait at most that long for the load event of a
+ * page whose DOM is ready, then scan it anyway. Pages that never finish
+ * loading (long-polling SPAs, stalled third-party scripts) are scanned as
+ * rendered so far instead of timing out; metadata.loadWaitExceeded marks
+ * them.
+ */
+async function waitForLoad(page, options, timeout, metadata) {
+  if (options.maxLoadWait === undefined) return;
+
+  const wait = loadWait(options, timeout);
+  try {
+    await page.waitForFunction(() => document.readyState === 'complete', { timeout: wait });
+  } catch (error) {
+    if (error.name !== 'TimeoutError') throw error;
+    metadata.loadWaitExceeded = true;
+    logger.info({ url: page.url(), maxLoadWait: wait }, 'Page load event not fired in time, scanning anyway');
+  }
+}
+
+// How long navigation waits: the DOM only when the load event is waited
+// for separately (options.maxLoadWait)
+function navigationWaitUntil(options) {
+  return options.maxLoadWait === undefined ? 'networkidle2' : 'domcontentloaded';
+}
+
+// Signal aborted with the reason of whichever of signals aborts first
+// (AbortSignal.any needs Node 20.3)
+function anySignal(signals) {
+  const controller = new AbortController();
+  for (const signal of signals) {
+    if (signal.aborted) {
+      controller.abort(signal.reason);
+      break;
+    }
+    signal.addEventListener('abort', () => controller.abort(signal.reason), { once: true });
+  }
+  return controller.signal;
+}
+
+// Signal aborted with a TimeoutError after timeout ms, like
+// AbortSignal.timeout(), whose reason records the timeout
+function deadlineSignal(timeout) {
+  const controller = new AbortController();
+  setTimeout(() => {
+    const reason = new DOMException(`Deadline of ${timeout}ms passed`, 'TimeoutError');
+    reason.timeout = timeout;
+    controller.abort(reason);
+  }, timeout).unref();
+  return controller.signal;
+}
+
+// Signal for a scan: the caller's, plus the deadline of options.timeout
+function scanSignal(signal, options) {
+  if (!options.timeout) return signal;
+
+  const deadline = deadlineSignal(scanTimeout(options));
+  return signal ? anySignal([signal, deadline]) : deadline;
+}
+
+// Error for an aborted scan: SCAN_TIMEOUT, with the timeout that passed,
+// when its deadline passed, otherwise an AbortError for a caller that gave up
+function canceledError(signal) {
+  if (signal.reason && signal.reason.name === 'TimeoutError') {
+    const error = new Error('Scan timeout');
+    error.code = ERROR_CODES.SCAN_TIMEOUT;
+    error.timeout = signal.reason.timeout;
+    error.retryable = false;
+    return error;
+  }
+
+  const error = new Error('Scan canceled');
+  error.name = 'AbortError';
+  return error;
+}
+
+// Fail fast when the caller has already given up on the scan, before a
+// browser is acquired from the pool
+function throwIfCanceled(signal) {
+  if (signal && signal.aborted) {
+    throw canceledError(signal);
+  }
+}
+
+// Settle like step, or reject as soon as signal aborts. Page steps (waits,
+// axe, custom checks) can't be interrupted themselves; the scan closes the
+// page on the rejection, which ends the abandoned step.
+function untilCanceled(step, signal) {
+  if (!signal) return step;
+
+  // The abandoned step rejects once its page is closed
+  step.catch(() => {});
+  let onAbort;
+  const canceled = new Promise((_, reject) => {
+    onAbort = () => reject(canceledError(signal));
+    if (signal.aborted) {
+      onAbort();
+    } else {
+      signal.addEventListener('abort', onAbort, { once: true });
+    }
+  });
+  return Promise.race([step, canceled]).finally(() => signal.removeEventListener('abort', onAbort));
+}
+
+// Acquire a browser, letting high-priority scans use reserved capacity.
+// Launch and breaker failures are flagged so scans can fall back to
+// degraded mode. Waiting for a busy pool is bounded by
+// BROWSER_ACQUIRE_TIMEOUT and the scan's signal; running out of time sheds
+// the scan as OVERLOADED, without a degraded fallback, so load is still
+// turned away with a 503.
+function acquireBrowser(options, signal) {
+  const priority = options.priority === 'high' ? 'high' : 'normal';
+  let pending = null;
+  const acquire = () => (pending = browserPool.acquire(config.browserAcquireTimeout, priority, signal));
+
+  return (config.browserBreaker.enabled ? browserBreaker.execute(acquire) : acquire())
+    .catch(error => {
+      // The breaker stopped waiting; a browser arriving later goes back to
+      // the pool instead of leaking its slot
+      if (error.breakerTimeout && pending) {
+        pending.then(browser => browserPool.release(browser), () => {});
+      }
+      // Queueing again would only hold the request longer
+      if (error.queueTimeout) {
+        error.code = ERROR_CODES.OVERLOADED;
+        error.retryable = false;
+        throw error;
+      }
+      error.browserUnavailable = true;
+      // Retrying can't help until the breaker lets scans through again
+      if (error.circuitOpen) {
+        error.code = ERROR_CODES.BROWSER_UNAVAILABLE;
+        error.retryable = false;
+      }
+      throw error;
+    });
+}
+
+// Hostname overrides are browser-wide, so such scans get a browser of
+// their own instead of a pooled one
+function hostResolverRules(hostOverrides) {
+  const rules = Object.entries(hostOverrides)
+    .map(([host, ip]) => `MAP ${host} ${ip.includes(':') ? `[${ip}]` : ip}`);
+  return `--host-resolver-rules=${rules.join(',')}`;
+}
+
+async function acquireScanBrowser(options, signal) {
+  if (options.hostOverrides && Object.keys(options.hostOverrides).length > 0) {
+    try {
+      checkHostOverrides(options.hostOverrides);
+    } catch (error) {
+      error.retryable = false;
+      throw error;
+    }
+    const browser = await browserPool.launchDedicated([hostResolverRules(options.hostOverrides)])
+      .catch(error => {
+        // Out of dedicated browsers: shed like a busy pool
+        if (error.dedicatedLimit) {
+          error.code = ERROR_CODES.OVERLOADED;
+          error.retryable = false;
+        }
+        throw error;
+      });
+    browser._dedicated = true;
+    return browser;
+  }
+  return acquireBrowser(options, signal);
+}
+
+function releaseBrowser(browser) {
+  if (browser._dedicated) {
+    return browser.close().catch(error => {
+      logger.error({ error: error.message }, 'Error closing dedicated browser');
+    });
+  }
+  return browserPool.release(browser);
+}
+
+function canDegrade(error) {
+  return error.browserUnavailable === true && config.degradedMode.enabled;
+}
+
+// Error for a 401 carrying a WWW-Authenticate challenge, e.g.
+// 'Basic realm="Staging"' -> scheme "Basic", realm "Staging"
+function authRequiredError(challenge) {
+  const scheme = challenge.trim().split(/\s+/)[0];
+  const realm = (challenge.match(/realm="([^"]*)"/i) || [])[1];
+  const error = new Error(`Target requires ${scheme} authentication`);
+  error.code = ERROR_CODES.AUTH_REQUIRED;
+  error.scheme = scheme;
+  error.realm = realm;
+  error.retryable = false;
+  return error;
+}
+
+// Exponential backoff with jitter, so scans that failed together don't all
+// retry at the same moment
+function retryDelay(attempt) {
+  const delay = Math.min(config.retryBackoff.baseDelay * 2 ** (attempt - 1), config.retryBackoff.maxDelay);
+  return delay / 2 + Math.random() * delay / 2;
+}
+
+// Wait before a retry, giving up as soon as the scan is canceled
+function waitForRetry(delay, signal) {
+  return new Promise((resolve, reject) => {
+    const onAbort = () => {
+      clearTimeout(timer);
+      reject(canceledError(signal));
+    };
+    const timer = setTimeout(() => {
+      if (signal) signal.removeEventListener('abort', onAbort);
+      resolve();
+    }, delay);
+    if (signal) signal.addEventListener('abort', onAbort, { once: true });
+  });
+}
+
 // SSRF Protection: Block private IPs
 function isPrivateIP(url) {
   const privateRanges = [
@@ -25,141 +712,281 @@ function isPrivateIP(url) {
   return privateRanges.some(regex => regex.test(url));
 }
 
-async function scanURL(url, options = {}) {
+/**
+ * Scan a URL.
+ *
+ * context.signal: AbortSignal that cancels the scan when aborted
+ * context.artifacts: object receiving captured artifacts (options.screenshot)
+ * context.correlationId: API request ID, logged and optionally forwarded to
+ *   the target site so both sides' logs can be correlated
+ * context.fingerprints: Map (content hash -> url) shared across scans; pages
+ *   whose content was already scanned under another URL are not analyzed
+ *   again and a { url, duplicateOf, contentHash } marker is returned
+ */
+function scanURL(url, options = {}, context = {}) {
+  return trackScan(async () => selectRules(await runURLScan(url, options, context), options));
+}
+
+async function runURLScan(url, options, context) {
+  const { fingerprints, correlationId, artifacts } = context;
+  const signal = scanSignal(context.signal, options);
+  const timeout = options.timeout ? scanTimeout(options) : SCAN_TIMEOUT;
   const startTime = Date.now();
 
-  // Security validation
-  if (isPrivateIP(url)) {
+  throwIfCanceled(signal);
+
+  // Security validation; callers validate targets with ssrfProtection, this
+  // guards direct use. BLOCK_PRIVATE_IPS=false allows private targets.
+  if (config.security.blockPrivateIPs && isPrivateIP(url)) {
     throw new Error('Scanning private/internal URLs is not allowed for security reasons');
   }
 
   let browser = null;
   let page = null;
   let retries = 0;
+  const metadata = {};
 
   while (retries < MAX_RETRIES) {
+    throwIfCanceled(signal);
+    const stopTimeoutWarning = startTimeoutWarning({ correlationId, url, attempt: retries + 1 }, timeout);
+
     try {
       // Acquire browser from pool
-      browser = await browserPool.acquire();
-      page = await browser.newPage();
+      browser = await acquireScanBrowser(options, signal);
+      page = await openPage(browser, options);
 
       // Set viewport and user agent
       await page.setViewport({ width: 1920, height: 1080 });
       await page.setUserAgent(
         'Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Safari/537.36'
       );
+      await configurePage(page, options, metadata, new URL(url).origin);
+
+      if (correlationId && config.correlation.forward) {
+        await page.setExtraHTTPHeaders({ [config.correlation.requestHeader]: correlationId });
+      }
+
+      if (needsInterception(options)) {
+        await interceptRequests(page, options, metadata);
+      }
 
       // Navigate with timeout
-      await page.goto(url, {
-        waitUntil: 'networkidle2',
-        timeout: SCAN_TIMEOUT
-      });
+      const response = await untilCanceled(page.goto(url, {
+        waitUntil: navigationWaitUntil(options),
+        timeout,
+        referer: options.referrer
+      }), signal);
+      await untilCanceled(waitForLoad(page, options, timeout, metadata), signal);
+
+      // The target's own request ID, for correlating with its server logs
+      const backendRequestId = response && config.correlation.responseHeaders
+        .map(header => response.headers()[header])
+        .find(Boolean);
+      if (backendRequestId) {
+        metadata.backendRequestId = backendRequestId;
+        logger.info({ correlationId, url, backendRequestId }, 'Target responded with request ID');
+      }
+
+      // Set by a failed earlier attempt; report this attempt's status only
+      delete metadata.httpStatus;
+
+      // A login challenge isn't the site; tell the client credentials are
+      // needed instead of scanning the 401 page
+      const challenge = response && response.status() === 401 && response.headers()['www-authenticate'];
+      if (challenge) {
+        metadata.httpStatus = 401;
+        throw authRequiredError(challenge);
+      }
+
+      // Navigation succeeds for error pages too; scanning a 500 page as if
+      // it were the site gives misleading results
+      if (response && !response.ok()) {
+        metadata.httpStatus = response.status();
+        logger.warn({ correlationId, url, status: metadata.httpStatus }, 'Target responded with an HTTP error');
+
+        if (config.failOnHttpError) {
+          const error = new Error(`Target responded with HTTP ${metadata.httpStatus}`);
+          // Server errors may be transient, client errors won't change
+          error.retryable = metadata.httpStatus >= 500;
+          throw error;
+        }
+      }
 
       // Wait for dynamic content
-      await page.waitForTimeout(2000);
+      await untilCanceled(page.waitForTimeout(2000), signal);
+
+      await untilCanceled(preparePage(page, options, metadata), signal);
+
+      if (fingerprints) {
+        const contentHash = fingerprintContent(await page.content());
+        const original = fingerprints.get(contentHash);
+
+        if (original && original !== url) {
+          stopTimeoutWarning();
+          await closePage(page);
+          await releaseBrowser(browser);
+          return { url, duplicateOf: original, contentHash };
+        }
+        fingerprints.set(contentHash, url);
+      }
+
+      await untilCanceled(captureArtifacts(page, options, artifacts), signal);
+      await untilCanceled(captureAccessibilityTree(page, options, metadata), signal);
 
       // Run axe-core scan
-      const axeResults = await new AxePuppeteer(page)
-        .options({
-          runOnly: {
-            type: 'tag',
-            values: ['wcag2a', 'wcag2aa', 'wcag21a', 'wcag21aa', 'wcag22aa']
-          }
-        })
-        .analyze();
+      const axeResults = await untilCanceled(runAxe(page, options), signal);
+      if (options.customChecks) {
+        await untilCanceled(runCustomChecks(page, options.customChecks, axeResults), signal);
+      }
 
-      await page.close();
+      stopTimeoutWarning();
+      await closePage(page);
 
       // Release browser back to pool
-      await browserPool.release(browser);
+      await releaseBrowser(browser);
 
       // Format results
-      return formatScanResults(url, axeResults, Date.now() - startTime);
+      metadata.retries = retries;
+      return formatScanResults(url, axeResults, Date.now() - startTime, metadata);
 
     } catch (error) {
+      stopTimeoutWarning();
       retries++;
-      logger.warn({ url, retries, error: error.message }, 'Scan attempt failed');
+      logger.warn({ correlationId, url, retries, error: error.message }, 'Scan attempt failed');
 
       if (page) {
         try {
-          await page.close();
+          await closePage(page);
         } catch (closeError) {
           logger.error('Error closing page:', closeError);
         }
       }
 
       if (browser) {
-        await browserPool.release(browser);
+        await releaseBrowser(browser);
         browser = null;
       }
 
+      // Don't retry a scan nobody is waiting for
+      throwIfCanceled(signal);
+
+      // No browser to retry with: check what we can on the raw HTML
+      if (canDegrade(error)) {
+        logger.warn({ correlationId, url, error: error.message }, 'Browser unavailable, running degraded scan');
+        const html = await fetchHtml(url, {
+          timeout,
+          maxBytes: config.degradedMode.maxHtmlBytes,
+          method: options.method,
+          body: options.body,
+          contentType: options.contentType,
+          acceptHeader: options.acceptHeader
+        });
+        return scanHtmlDegraded(html, url, { ...metadata, degradedReason: error.message });
+      }
+
+      const { AUTH_REQUIRED, BROWSER_UNAVAILABLE, INVALID_INPUT, OVERLOADED, SCAN_TIMEOUT } = ERROR_CODES;
+      if ([AUTH_REQUIRED, BROWSER_UNAVAILABLE, INVALID_INPUT, OVERLOADED, SCAN_TIMEOUT].includes(error.code)) {
+        throw error;
+      }
+
+      if (error.retryable === false) {
+        throw new Error(`Scan failed: ${error.message}`);
+      }
+
       if (retries >= MAX_RETRIES) {
         throw new Error(`Scan failed after ${MAX_RETRIES} retries: ${error.message}`);
       }
 
-      // Exponential backoff
-      await new Promise(resolve => setTimeout(resolve, 1000 * retries));
+      await waitForRetry(retryDelay(retries), signal);
     }
   }
 }
 
-async function scanHTML(html, options = {}) {
+function scanHTML(html, options = {}, context = {}) {
+  return trackScan(async () => selectRules(await runHTMLScan(html, options, context), options));
+}
+
+async function runHTMLScan(html, options, context) {
+  const { correlationId, artifacts } = context;
+  const signal = scanSignal(context.signal, options);
+  const timeout = options.timeout ? scanTimeout(options) : SCAN_TIMEOUT;
   const startTime = Date.now();
+
+  throwIfCanceled(signal);
+
   let browser = null;
   let page = null;
+  const metadata = {};
+  const stopTimeoutWarning = startTimeoutWarning({ correlationId, url: '[HTML Content]' }, timeout);
 
   try {
     // Acquire browser from pool
-    browser = await browserPool.acquire();
-    page = await browser.newPage();
+    browser = await acquireScanBrowser(options, signal);
+    page = await openPage(browser, options);
 
     await page.setViewport({ width: 1920, height: 1080 });
+    await configurePage(page, options, metadata);
+
+    if (options.blockResources) {
+      await interceptRequests(page, options, metadata);
+    }
 
     // Set HTML content
-    await page.setContent(html, {
-      waitUntil: 'networkidle2',
-      timeout: SCAN_TIMEOUT
-    });
+    await untilCanceled(page.setContent(html, {
+      waitUntil: navigationWaitUntil(options),
+      timeout
+    }), signal);
+    await untilCanceled(waitForLoad(page, options, timeout, metadata), signal);
 
     // Wait for dynamic content
-    await page.waitForTimeout(1000);
+    await untilCanceled(page.waitForTimeout(1000), signal);
+
+    await untilCanceled(preparePage(page, options, metadata), signal);
+    await untilCanceled(captureArtifacts(page, options, artifacts), signal);
+    await untilCanceled(captureAccessibilityTree(page, options, metadata), signal);
 
     // Run axe-core scan
-    const axeResults = await new AxePuppeteer(page)
-      .options({
-        runOnly: {
-          type: 'tag',
-          values: ['wcag2a', 'wcag2aa', 'wcag21a', 'wcag21aa', 'wcag22aa']
-        }
-      })
-      .analyze();
+    const axeResults = await untilCanceled(runAxe(page, options), signal);
+    if (options.customChecks) {
+      await untilCanceled(runCustomChecks(page, options.customChecks, axeResults), signal);
+    }
 
-    await page.close();
+    stopTimeoutWarning();
+    await closePage(page);
 
     // Release browser back to pool
-    await browserPool.release(browser);
+    await releaseBrowser(browser);
 
     // Format results
-    return formatScanResults('[HTML Content]', axeResults, Date.now() - startTime);
+    return formatScanResults('[HTML Content]', axeResults, Date.now() - startTime, metadata);
 
   } catch (error) {
+    stopTimeoutWarning();
+
     if (page) {
       try {
-        await page.close();
+        await closePage(page);
       } catch (closeError) {
         logger.error('Error closing page:', closeError);
       }
     }
 
     if (browser) {
-      await browserPool.release(browser);
+      await releaseBrowser(browser);
+    }
+
+    throwIfCanceled(signal);
+
+    if (canDegrade(error)) {
+      logger.warn({ correlationId, error: error.message }, 'Browser unavailable, running degraded scan');
+      return scanHtmlDegraded(html, '[HTML Content]', { ...metadata, degradedReason: error.message });
     }
 
     throw error;
   }
 }
 
-function formatScanResults(url, axeResults, scanTime) {
+function formatScanResults(url, axeResults, scanTime, metadata = {}) {
   const violations = axeResults.violations.map(violation => ({
     id: violation.id,
     impact: violation.impact,
@@ -170,6 +997,7 @@ function formatScanResults(url, axeResults, scanTime) {
     nodes: violation.nodes.map(node => ({
       html: node.html,
       target: node.target,
+      xpath: node.xpath,
       failureSummary: node.failureSummary,
       impact: node.impact
     }))
@@ -233,7 +1061,8 @@ function formatScanResults(url, axeResults, scanTime) {
       windowWidth: axeResults.testEnvironment.windowWidth,
       windowHeight: axeResults.testEnvironment.windowHeight,
       orientationType: axeResults.testEnvironment.orientationType
-    }
+    },
+    metadata
   };
 }
 
@@ -267,5 +1096,7 @@ module.exports = {
   scanURL,
   scanHTML,
   getHealthStatus,
+  activeScanCount,
+  waitForIdle,
   browserPool
 };
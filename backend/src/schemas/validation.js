@@ -4,7 +4,63 @@
  * Type-safe validation for all API endpoints
  */
 
+const net = require('net');
 const { z } = require('zod');
+const config = require('../config');
+const { ERROR_CODES } = require('../errorCodes');
+const { hasCheck } = require('../services/customChecks');
+const { stageError } = require('../services/resultPipeline');
+
+// Free-text option string, bounded so megabyte values are rejected with a
+// message naming the option
+function optionString(name, maxLength = config.optionLimits.maxStringLength) {
+  return z.string().max(maxLength, `${name} exceeds maximum length of ${maxLength} characters`);
+}
+
+// Storage entries injected before scanning, bounded in count and total size
+function storageEntries(name) {
+  const { maxEntries, maxBytes } = config.optionLimits.storage;
+  return z.record(z.string().min(1), z.string())
+    .refine(entries => Object.keys(entries).length <= maxEntries, {
+      message: `${name} exceeds maximum of ${maxEntries} entries`
+    })
+    .refine(entries => Buffer.byteLength(JSON.stringify(entries)) <= maxBytes, {
+      message: `${name} exceeds maximum size of ${maxBytes} bytes`
+    });
+}
+
+// Free-form client metadata echoed back in results, bounded in size
+function clientMetadata() {
+  const { maxClientMetadataBytes } = config.optionLimits;
+  return z.record(z.string(), z.unknown())
+    .refine(metadata => Buffer.byteLength(JSON.stringify(metadata)) <= maxClientMetadataBytes, {
+      message: `clientMetadata exceeds maximum size of ${maxClientMetadataBytes} bytes`
+    });
+}
+
+// Accept header value: media ranges with optional parameters, e.g.
+// "text/html;q=0.9, application/xhtml+xml"
+const MEDIA_RANGE = String.raw`[\w.+*-]+/[\w.+*-]+([ \t]*;[ \t]*[\w.-]+=("[^"\r\n]*"|[\w.-]+))*`;
+const ACCEPT_HEADER = new RegExp(String.raw`^[ \t]*${MEDIA_RANGE}([ \t]*,[ \t]*${MEDIA_RANGE})*[ \t]*$`);
+
+// axe rule ID, e.g. "color-contrast"
+const AXE_RULE_ID = /^[a-z0-9][a-z0-9-]*$/;
+
+// ISO 8601 date or date-time, e.g. "2024-01-15" or "2024-01-15T09:30:00Z"
+const ISO_TIMESTAMP = /^\d{4}-\d{2}-\d{2}(T\d{2}:\d{2}(:\d{2}(\.\d{1,3})?)?(Z|[+-]\d{2}:\d{2})?)?$/;
+
+function isTimestamp(value) {
+  return ISO_TIMESTAMP.test(value) && !isNaN(Date.parse(value));
+}
+
+function isTimeZone(value) {
+  try {
+    new Intl.DateTimeFormat('en-US', { timeZone: value });
+    return true;
+  } catch (error) {
+    return false;
+  }
+}
 
 // Scan Request Schema
 const ScanRequestSchema = z.object({
@@ -15,16 +71,148 @@ const ScanRequestSchema = z.object({
     .min(1, 'Input cannot be empty')
     .max(1000000, 'Input exceeds maximum size of 1MB'),
   options: z.object({
+    // Deadline for the whole scan, clamped to MAX_SCAN_TIMEOUT
     timeout: z.number()
       .min(5000, 'Timeout must be at least 5 seconds')
-      .max(60000, 'Timeout cannot exceed 60 seconds')
       .optional(),
     viewport: z.object({
       width: z.number().min(320).max(3840).optional(),
       height: z.number().min(240).max(2160).optional()
     }).optional(),
-    waitUntil: z.enum(['load', 'domcontentloaded', 'networkidle0', 'networkidle2']).optional()
-  }).optional()
+    waitUntil: z.enum(['load', 'domcontentloaded', 'networkidle0', 'networkidle2']).optional(),
+    // Longest wait for the page's load event before scanning anyway, in
+    // ms; clamped to MAX_LOAD_WAIT and the scan timeout
+    maxLoadWait: z.number()
+      .int('maxLoadWait must be a whole number of milliseconds')
+      .min(0, 'maxLoadWait cannot be negative')
+      .optional(),
+    // HTML scans: send raw bytes as base64 to have the charset detected
+    inputEncoding: z.enum(['utf8', 'base64']).optional(),
+    charset: z.string().max(40, 'Charset name is too long').optional(),
+    // Dismiss cookie consent banners before scanning
+    dismissConsent: z.boolean().optional(),
+    consentSelectors: z.array(optionString('consentSelectors', config.optionLimits.maxSelectorLength).min(1))
+      .max(20, 'Maximum 20 consent selectors')
+      .optional(),
+    // Result cache control
+    cacheTtl: z.number().int().min(0, 'cacheTtl cannot be negative').optional(),
+    noCache: z.boolean().optional(),
+    // URL scans: resolve these hostnames to the given IPs (e.g. staging
+    // hosts missing from public DNS); the IPs are subject to SSRF checks
+    hostOverrides: z.record(
+      z.string().regex(/^[a-zA-Z0-9.-]{1,253}$/, 'hostOverrides keys must be hostnames'),
+      z.string().refine(value => net.isIP(value) !== 0, 'hostOverrides values must be IP addresses')
+    )
+      .refine(overrides => Object.keys(overrides).length <= 10, 'Maximum 10 host overrides')
+      .optional(),
+    // Storage set before the page loads
+    localStorage: storageEntries('localStorage').optional(),
+    sessionStorage: storageEntries('sessionStorage').optional(),
+    // Full-page screenshot included in the report bundle
+    screenshot: z.boolean().optional(),
+    // Keep the rendered (post-JavaScript) HTML with the report
+    renderedHtml: z.boolean().optional(),
+    // Report page console errors in metadata
+    captureConsole: z.boolean().optional(),
+    // Report http:// subresources of https pages in metadata
+    mixedContent: z.boolean().optional(),
+    // Subresources not loaded, to speed up scans and cut noise
+    blockResources: z.array(z.enum(['image', 'font', 'media', 'stylesheet', 'analytics']))
+      .min(1, 'blockResources cannot be empty')
+      .max(5)
+      .optional(),
+    // Report the page's accessibility tree in metadata
+    accessibilityTree: z.boolean().optional(),
+    // Position reported by the Geolocation API (granted for URL scans)
+    geolocation: z.object({
+      latitude: z.number().min(-90, 'latitude must be between -90 and 90').max(90, 'latitude must be between -90 and 90'),
+      longitude: z.number().min(-180, 'longitude must be between -180 and 180').max(180, 'longitude must be between -180 and 180'),
+      accuracy: z.number().min(0).optional()
+    }).optional(),
+    // IANA time zone for the page, e.g. "America/New_York"
+    timezone: optionString('timezone', 64)
+      .refine(isTimeZone, 'timezone must be an IANA time zone name')
+      .optional(),
+    // Page clock start, as an ISO 8601 timestamp or epoch milliseconds
+    mockDate: z.union([
+      z.number().int().min(0, 'mockDate must not be before 1970').max(253402300799999, 'mockDate must be before year 10000'),
+      optionString('mockDate', 40).refine(isTimestamp, 'mockDate must be an ISO 8601 timestamp')
+    ]).optional(),
+    // Media preference emulation
+    reducedMotion: z.enum(['reduce', 'no-preference']).optional(),
+    forcedColors: z.enum(['active', 'none']).optional(),
+    // Report results segmented by WCAG version
+    standards: z.array(z.enum(['wcag20', 'wcag21', 'wcag22']))
+      .min(1)
+      .max(3)
+      .optional(),
+    // Report rule status changes since an earlier scan
+    baselineScanId: optionString('baselineScanId', 100).optional(),
+    // Report an XPath for each violation node
+    xpath: z.boolean().optional(),
+    // Stabilize selectors in flattened nodes and baseline comparisons
+    normalizeSelectors: z.boolean().optional(),
+    // Bulk scans: group violations repeated across pages
+    groupTemplateIssues: z.boolean().optional(),
+    // Report the criteria added in WCAG 2.2 separately
+    wcag22Report: z.boolean().optional(),
+    // Only report rules of this conformance level and below
+    wcagLevel: z.enum(['A', 'AA', 'AAA']).optional(),
+    // axe rules to run instead of the WCAG rule set, and rules to skip
+    runOnly: z.array(optionString('runOnly', 100).regex(AXE_RULE_ID, 'runOnly entries must be axe rule IDs'))
+      .min(1, 'runOnly cannot be empty')
+      .max(100, 'Maximum 100 rules in runOnly')
+      .optional(),
+    disableRules: z.array(optionString('disableRules', 100).regex(AXE_RULE_ID, 'disableRules entries must be axe rule IDs'))
+      .max(100, 'Maximum 100 rules in disableRules')
+      .optional(),
+    // Registered custom checks to run after axe, by name
+    customChecks: z.array(optionString('customChecks', 100))
+      .max(20, 'Maximum 20 custom checks')
+      .superRefine((names, ctx) => {
+        const unknown = names.filter(name => !hasCheck(name));
+        if (unknown.length > 0) {
+          ctx.addIssue({ code: 'custom', message: `Unknown custom checks: ${unknown.join(', ')}` });
+        }
+      })
+      .optional(),
+    // Transforms applied to the result in order, by name or
+    // { transform, ...params }
+    pipeline: z.array(z.union([z.string(), z.record(z.string(), z.unknown())]))
+      .max(10, 'Maximum 10 pipeline stages')
+      .superRefine((stages, ctx) => {
+        stages.forEach((stage, index) => {
+          const message = stageError(stage);
+          if (message) {
+            ctx.addIssue({ code: 'custom', message, path: [index] });
+          }
+        });
+      })
+      .optional(),
+    // "high" may use browsers reserved for interactive clients
+    priority: z.enum(['normal', 'high']).optional(),
+    // URL scans: Referer header sent when loading the page
+    referrer: optionString('referrer')
+      .url('referrer must be a valid URL')
+      .refine(value => /^https?:\/\//i.test(value), 'referrer must be an http or https URL')
+      .optional(),
+    // URL scans: Accept header of the page's navigation request, e.g. to
+    // get the AMP or full HTML variant of a page
+    acceptHeader: optionString('acceptHeader', 256)
+      .regex(ACCEPT_HEADER, 'acceptHeader must be a list of media types, e.g. "text/html,application/xhtml+xml;q=0.9"')
+      .optional(),
+    // URL scans: load the page with a POST request
+    method: z.enum(['GET', 'POST']).optional(),
+    body: optionString('body', config.optionLimits.maxBodyLength).optional(),
+    contentType: optionString('contentType', 200).optional()
+  })
+    .refine(options => options.body === undefined || options.method === 'POST', {
+      message: 'body requires method "POST"',
+      path: ['body']
+    })
+    .optional(),
+  // Echoed verbatim in metadata.client, e.g. build number or commit SHA
+  clientMetadata: clientMetadata().optional()
 });
 
 // Bulk Scan Request Schema
@@ -32,9 +220,150 @@ const BulkScanRequestSchema = z.object({
   urls: z.array(z.string().url('Each URL must be valid'))
     .min(1, 'URLs array cannot be empty')
     .max(100, 'Maximum 100 URLs per bulk scan'),
-  options: ScanRequestSchema.shape.options.optional()
+  options: ScanRequestSchema.shape.options.optional(),
+  clientMetadata: clientMetadata().optional()
+});
+
+// Batch Scan Request Schema
+const BatchScanRequestSchema = z.object({
+  requests: z.array(ScanRequestSchema)
+    .min(1, 'requests array cannot be empty')
+    .max(100, 'Maximum 100 requests per batch')
 });
 
+// Option Coercion
+//
+// Clients built against loosely-typed configs often send recoverable type
+// mismatches ("30000" for a number, "true" for a boolean, "1280x720" for a
+// viewport). These are coerced before validation and reported as warnings;
+// values that can't be coerced still fail validation with a 400.
+
+const COERCIBLE_OPTIONS = {
+  number: ['timeout', 'cacheTtl', 'maxLoadWait'],
+  boolean: [
+    'dismissConsent', 'noCache', 'captureConsole', 'screenshot', 'xpath',
+    'normalizeSelectors', 'groupTemplateIssues', 'wcag22Report', 'renderedHtml',
+    'mixedContent', 'accessibilityTree'
+  ],
+  lowercaseEnum: ['waitUntil', 'inputEncoding', 'reducedMotion', 'forcedColors', 'priority'],
+  uppercaseEnum: ['method', 'wcagLevel'],
+  stringArray: ['consentSelectors', 'customChecks', 'pipeline', 'runOnly', 'disableRules', 'blockResources']
+};
+
+function coerceViewport(value) {
+  if (Array.isArray(value) && value.length === 2) {
+    return { width: Number(value[0]), height: Number(value[1]) };
+  }
+  if (typeof value === 'string' && /^\d+x\d+$/i.test(value.trim())) {
+    const [width, height] = value.trim().toLowerCase().split('x').map(Number);
+    return { width, height };
+  }
+  if (value && typeof value === 'object') {
+    const viewport = { ...value };
+    ['width', 'height'].forEach(key => {
+      if (typeof viewport[key] === 'string' && /^\d+$/.test(viewport[key].trim())) {
+        viewport[key] = Number(viewport[key]);
+      }
+    });
+    return viewport;
+  }
+  return value;
+}
+
+/**
+ * Coerce recoverable option type mismatches in place
+ *
+ * @returns {string[]} Warnings describing each coercion
+ */
+function coerceOptions(options) {
+  const warnings = [];
+  if (!options || typeof options !== 'object' || Array.isArray(options)) {
+    return warnings;
+  }
+
+  const coerce = (field, value) => {
+    if (JSON.stringify(value) !== JSON.stringify(options[field])) {
+      warnings.push(`options.${field}: coerced ${JSON.stringify(options[field])} to ${JSON.stringify(value)}`);
+      options[field] = value;
+    }
+  };
+
+  COERCIBLE_OPTIONS.number.forEach(field => {
+    const value = options[field];
+    if (typeof value === 'string' && value.trim() !== '' && !isNaN(Number(value))) {
+      coerce(field, Number(value));
+    }
+  });
+
+  COERCIBLE_OPTIONS.boolean.forEach(field => {
+    const value = options[field];
+    if (value === 'true' || value === 'false') {
+      coerce(field, value === 'true');
+    } else if (value === 1 || value === 0) {
+      coerce(field, value === 1);
+    }
+  });
+
+  COERCIBLE_OPTIONS.lowercaseEnum.forEach(field => {
+    const value = options[field];
+    if (typeof value === 'string') {
+      coerce(field, value.trim().toLowerCase());
+    }
+  });
+
+  COERCIBLE_OPTIONS.uppercaseEnum.forEach(field => {
+    const value = options[field];
+    if (typeof value === 'string') {
+      coerce(field, value.trim().toUpperCase());
+    }
+  });
+
+  COERCIBLE_OPTIONS.stringArray.forEach(field => {
+    const value = options[field];
+    if (typeof value === 'string') {
+      coerce(field, [value]);
+    }
+  });
+
+  if (options.viewport !== undefined) {
+    coerce('viewport', coerceViewport(options.viewport));
+  }
+
+  return warnings;
+}
+
+/**
+ * Middleware coercing req.body.options before validation; warnings are
+ * exposed as req.optionWarnings
+ */
+function coerceRequestOptions(req, res, next) {
+  req.optionWarnings = req.body && !config.strictOptions ? coerceOptions(req.body.options) : [];
+  next();
+}
+
+/**
+ * Middleware coercing the options of each request in a batch; warnings are
+ * exposed as req.optionWarnings, one array per request
+ */
+function coerceBatchRequestOptions(req, res, next) {
+  const requests = req.body && Array.isArray(req.body.requests) ? req.body.requests : [];
+  req.optionWarnings = requests.map(request =>
+    request && !config.strictOptions ? coerceOptions(request.options) : []
+  );
+  next();
+}
+
+/**
+ * Per-field details of a validation error, as returned to clients
+ */
+function validationDetails(error) {
+  return error.issues.map(err => ({
+    field: err.path.join('.'),
+    message: err.message,
+    code: err.code
+  }));
+}
+
 // Validation Middleware Factory
 function validateRequest(schema) {
   return (req, res, next) => {
@@ -45,11 +374,8 @@ function validateRequest(schema) {
       if (error instanceof z.ZodError) {
         return res.status(400).json({
           error: 'Validation Error',
-          details: error.errors.map(err => ({
-            field: err.path.join('.'),
-            message: err.message,
-            code: err.code
-          }))
+          code: ERROR_CODES.INVALID_INPUT,
+          details: validationDetails(error)
         });
       }
       next(error);
@@ -59,6 +385,12 @@ function validateRequest(schema) {
 
 module.exports = {
   ScanRequestSchema,
+  optionString,
   BulkScanRequestSchema,
+  BatchScanRequestSchema,
+  coerceOptions,
+  coerceRequestOptions,
+  coerceBatchRequestOptions,
+  validationDetails,
   validateRequest
 };
@@ -4,78 +4,146 @@ const helmet = require('helmet');
 const compression = require('compression');
 const pino = require('pino');
 const swaggerUi = require('swagger-ui-express');
-const { scanURL, scanHTML, getHealthStatus, browserPool } = require('./scanner');
-const { ssrfProtection } = require('./middleware/ssrfProtection');
+const crypto = require('crypto');
+const http = require('http');
+const {
+  scanURL,
+  scanHTML,
+  getHealthStatus,
+  activeScanCount,
+  waitForIdle,
+  browserPool
+} = require('./scanner');
+const {
+  ssrfProtection,
+  validateURL,
+  normalizeURL,
+  urlRejection,
+  hostOverrideFor
+} = require('./middleware/ssrfProtection');
+const { geoBlocking, findBlockedCountry } = require('./middleware/geoBlocking');
 const { manager: circuitBreakerManager } = require('./services/circuitBreaker');
 const { correlationIdMiddleware } = require('./middleware/correlationId');
-const { validateRequest, ScanRequestSchema, BulkScanRequestSchema } = require('./schemas/validation');
-const { metricsHandler, httpRequestDuration, scanCounter, scanDuration, updateBrowserPoolMetrics } = require('./services/metrics');
+const { backpressureHeaders } = require('./middleware/backpressure');
+const { rateLimit, clientId } = require('./middleware/rateLimit');
+const { requireApiKey, isValidApiKey } = require('./middleware/apiKeyAuth');
+const { requestSizeLimit } = require('./middleware/requestSize');
+const { rejectWhileShuttingDown } = require('./middleware/shutdown');
+const { requestLogger } = require('./middleware/requestLogger');
+const { errorHandler } = require('./middleware/errorHandler');
+const {
+  validateRequest,
+  coerceRequestOptions,
+  coerceBatchRequestOptions,
+  ScanRequestSchema,
+  BulkScanRequestSchema,
+  BatchScanRequestSchema
+} = require('./schemas/validation');
+const { metricsHandler, scanCounter, observeScanDuration, updateBrowserPoolMetrics, sanitizeLabels } = require('./services/metrics');
 const { auditLogger } = require('./services/auditLogger');
+const {
+  flattenViolationNodes,
+  violationTickets,
+  violationsSarif,
+  violationsCsv,
+  filterByWcagLevel,
+  withClientMetadata,
+  segmentByStandard,
+  wcag22NewCriteria,
+  compareWithBaseline
+} = require('./services/resultFormatter');
+const { resultCache } = require('./services/resultCache');
+const { buildConformanceReport } = require('./services/conformanceReport');
+const { CachePreloader } = require('./services/cachePreloader');
+const { BulkScanRunner } = require('./services/bulkScanRunner');
+const { resultPublisher } = require('./services/resultPublisher');
+const { emailNotifier } = require('./services/emailNotifier');
+const msgpack = require('./services/msgpack');
+const { streamJson } = require('./services/jsonStream');
+const { reportStore } = require('./services/reportStore');
+const { scanHistory } = require('./services/scanHistory');
+const { resultDelta } = require('./services/resultDelta');
+const { isWebSocketUpgrade, isAllowedOrigin, acceptWebSocket } = require('./services/webSocket');
+const { createBundleStream } = require('./services/reportBundle');
+const { apiVersion, formatForVersion } = require('./services/responseVersion');
+const { hedge } = require('./services/hedging');
+const { decodeHtmlInput } = require('./services/htmlEncoding');
+const { applyPipeline } = require('./services/resultPipeline');
+const { runSelfTest } = require('./services/selfTest');
+const { runBatch, batchSummary } = require('./services/batchScan');
+const { streamBatchScan } = require('./services/batchStream');
+const { SubmissionDedup } = require('./services/submissionDedup');
+const config = require('./config');
+const { validateConfig } = require('./configValidation');
+const { ERROR_CODES } = require('./errorCodes');
 const swaggerSpec = require('../swagger');
 
+// JSON lines for log aggregators; LOG_FORMAT=pretty for reading locally
 const logger = pino({
   level: process.env.LOG_LEVEL || 'info',
-  transport: {
-    target: 'pino-pretty',
-    options: { colorize: true }
-  }
+  transport: process.env.LOG_FORMAT === 'pretty'
+    ? { target: 'pino-pretty', options: { colorize: true } }
+    : undefined
 });
 
+// Refuse to start with settings that would break every scan
+const configErrors = validateConfig(config);
+if (configErrors.length > 0) {
+  configErrors.forEach(message => logger.fatal(message));
+  logger.fatal('Invalid configuration; not starting');
+  process.exit(1);
+}
+
 const app = express();
-const PORT = process.env.PORT || 8000;
+const PORT = config.port;
 
 // Security middleware
 app.use(helmet());
 app.use(compression());
 app.use(cors({
   origin: process.env.CORS_ORIGIN || '*',
-  methods: ['GET', 'POST', 'OPTIONS'],
+  methods: ['GET', 'POST', 'DELETE', 'OPTIONS'],
   credentials: true
 }));
 
-// Body parsers
-app.use(express.json({ limit: '10mb' }));
-app.use(express.urlencoded({ extended: true, limit: '10mb' }));
+// Body parsers. Bodies over MAX_REQUEST_SIZE are rejected with 413 by
+// requestSizeLimit before they are buffered.
+app.use(requestSizeLimit());
+app.use(express.json({ limit: config.security.maxRequestSize }));
+app.use(express.urlencoded({ extended: true, limit: config.security.maxRequestSize }));
 
 // Correlation ID for request tracing
 app.use(correlationIdMiddleware);
 
+// Current scanner load, so clients can throttle themselves
+if (config.backpressureHeaders) {
+  app.use(backpressureHeaders(browserPool));
+}
+
 // Request logging with metrics
-app.use((req, res, next) => {
-  const start = Date.now();
-  res.on('finish', () => {
-    const duration = (Date.now() - start) / 1000;
+app.use(requestLogger(logger));
 
-    // Log request
-    logger.info({
-      correlationId: req.correlationId,
-      method: req.method,
-      url: req.url,
-      status: res.statusCode,
-      duration: duration * 1000
+// Send a scan response as JSON, or MessagePack when the client asks for it
+function sendScanResponse(req, res, body) {
+  body = formatForVersion(body, req.apiVersion);
+
+  if (req.accepts(['application/json', msgpack.CONTENT_TYPE]) === msgpack.CONTENT_TYPE) {
+    return res.type(msgpack.CONTENT_TYPE).send(msgpack.encode(body));
+  }
+
+  // Stream large results so clients can parse them as they arrive
+  const nodeCount = (body.violations || []).reduce((sum, v) => sum + v.nodes.length, 0)
+    + (body.nodes || []).length;
+  const minNodes = config.streaming.minNodes;
+  if (req.query.stream === 'true' || (minNodes > 0 && nodeCount >= minNodes)) {
+    return streamJson(res, body).catch(error => {
+      logger.warn({ correlationId: req.correlationId, error: error.message }, 'Streaming response failed');
+      res.destroy();
     });
+  }
 
-    // Record metrics
-    httpRequestDuration.observe(
-      { method: req.method, route: req.path, status: res.statusCode },
-      duration
-    );
-
-    // Audit log API access
-    if (req.path.startsWith('/api/')) {
-      auditLogger.logApiAccess({
-        correlationId: req.correlationId,
-        method: req.method,
-        path: req.path,
-        status: res.statusCode,
-        duration: duration * 1000,
-        ip: req.ip,
-        userAgent: req.headers['user-agent']
-      });
-    }
-  });
-  next();
-});
+  res.json(body);
+}
 
 // Swagger Documentation
 app.use('/api-docs', swaggerUi.serve, swaggerUi.setup(swaggerSpec));
@@ -83,6 +151,15 @@ app.use('/api-docs', swaggerUi.serve, swaggerUi.setup(swaggerSpec));
 // Prometheus Metrics
 app.get('/metrics', metricsHandler);
 
+// Everything under /api needs an API key when API_KEYS is set; health
+// checks, metrics and the docs above stay open
+app.use('/api', requireApiKey());
+
+// Set once SIGTERM is received; new scans are rejected while in-flight
+// ones finish
+let shuttingDown = false;
+const rejectWhenShuttingDown = rejectWhileShuttingDown(() => shuttingDown);
+
 // Health check endpoint
 app.get('/health', async (req, res) => {
   try {
@@ -104,6 +181,10 @@ app.get('/health', async (req, res) => {
 
 // Readiness check (for Kubernetes/Railway)
 app.get('/health/ready', async (req, res) => {
+  if (shuttingDown) {
+    return res.status(503).json({ ready: false, shuttingDown: true });
+  }
+
   const health = await getHealthStatus();
   if (health.status === 'healthy' && health.puppeteerReady) {
     res.status(200).json({ ready: true });
@@ -121,6 +202,13 @@ app.get('/health/live', (req, res) => {
   });
 });
 
+// Self-test: scan a bundled page through the full scanning pipeline so
+// synthetic monitoring exercises the real browser and axe-core path
+app.get('/api/selftest', async (req, res) => {
+  const { passed, ...result } = await runSelfTest(html => scanHTML(html));
+  res.status(passed ? 200 : 503).json({ status: passed ? 'pass' : 'fail', ...result });
+});
+
 // Browser Pool Stats endpoint
 app.get('/api/pool/stats', (req, res) => {
   try {
@@ -148,36 +236,172 @@ app.get('/api/circuit-breakers', (req, res) => {
   }
 });
 
+// Scan a URL, starting a second scan on another browser if the first is
+// still running after HEDGE_DELAY; the first result wins. POST scans are
+// never hedged since the target would receive the request twice.
+async function hedgedScanURL(url, options, scanContext) {
+  const attemptArtifacts = [{}, {}];
+  const { result, attempt } = await hedge(
+    (signal, i) => scanURL(url, options, { ...scanContext, signal, artifacts: attemptArtifacts[i] }),
+    {
+      delay: config.hedging.delay,
+      signal: scanContext.signal,
+      // Only hedge with an idle browser, never by queueing
+      shouldHedge: () => browserPool.pool.length > 0 &&
+        browserPool.activeCount < browserPool.capacityFor(options.priority)
+    }
+  );
+
+  if (attempt === 1) {
+    logger.info({ correlationId: scanContext.correlationId, url }, 'Hedged scan finished first');
+  }
+  Object.assign(scanContext.artifacts, attemptArtifacts[attempt]);
+  return result;
+}
+
+// Reserved browsers are for interactive clients, so "high" priority is
+// only honored on single scans by a client sending a priority key (one of
+// PRIORITY_API_KEYS, or of API_KEYS when that's empty); anyone else, and
+// batch, stream and bulk scans, run at normal priority
+function scanPriority(req, options) {
+  if (options.priority !== 'high') {
+    return 'normal';
+  }
+
+  const priorityKeys = config.priorityApiKeys.length > 0 ? config.priorityApiKeys : config.apiKeys;
+  if (isValidApiKey(req.get('x-api-key'), priorityKeys)) {
+    return 'high';
+  }
+  req.optionWarnings.push('options.priority: "high" requires a priority API key; scanned at "normal"');
+  return 'normal';
+}
+
 // Main scan endpoint with SSRF protection and validation
-app.post('/api/scan', validateRequest(ScanRequestSchema), ssrfProtection, async (req, res) => {
-  const { type, input, options = {} } = req.body;
+app.post('/api/scan', rejectWhenShuttingDown, rateLimit(), apiVersion, coerceRequestOptions, validateRequest(ScanRequestSchema), ssrfProtection, geoBlocking, async (req, res) => {
+  const { type, input, clientMetadata } = req.body;
+  const options = { ...req.body.options, priority: scanPriority(req, req.body.options || {}) };
 
   // Validation
   if (!type || !input) {
     return res.status(400).json({
-      error: 'Missing required fields: type and input'
+      error: 'Missing required fields: type and input',
+      code: ERROR_CODES.INVALID_INPUT
     });
   }
 
   if (!['url', 'html'].includes(type)) {
     return res.status(400).json({
-      error: 'Invalid type. Must be "url" or "html"'
+      error: 'Invalid type. Must be "url" or "html"',
+      code: ERROR_CODES.INVALID_INPUT
     });
   }
 
-  const scanId = `scan_${Date.now()}_${Math.random().toString(36).substr(2, 9)}`;
+  const { flatten } = req.query;
+  if (flatten !== undefined && flatten !== 'nodes') {
+    return res.status(400).json({
+      error: 'Invalid flatten value. Must be "nodes"',
+      code: ERROR_CODES.INVALID_INPUT
+    });
+  }
+
+  const { format } = req.query;
+  if (format !== undefined && !['tickets', 'sarif'].includes(format)) {
+    return res.status(400).json({
+      error: 'Invalid format value. Must be "tickets" or "sarif"',
+      code: ERROR_CODES.INVALID_INPUT
+    });
+  }
+
+  const { deltaFrom } = req.query;
+  if (deltaFrom !== undefined && !/^[a-f0-9]{64}$/.test(deltaFrom)) {
+    return res.status(400).json({
+      error: 'Invalid deltaFrom value. Must be an X-Result-Hash (64 hex characters)',
+      code: ERROR_CODES.INVALID_INPUT
+    });
+  }
+
+  // Transcode HTML to UTF-8 from whatever charset it was submitted in
+  let html = input;
+  if (type === 'html') {
+    try {
+      ({ html } = decodeHtmlInput(input, options));
+    } catch (error) {
+      return res.status(400).json({
+        error: error.message,
+        code: ERROR_CODES.INVALID_INPUT
+      });
+    }
+  }
+
+  const baseline = options.baselineScanId ? ownReport(req, options.baselineScanId) : null;
+  if (options.baselineScanId && !baseline) {
+    return res.status(404).json({
+      error: 'Baseline scan not found',
+      baselineScanId: options.baselineScanId,
+      code: ERROR_CODES.NOT_FOUND
+    });
+  }
+
+  const scanId = `scan_${crypto.randomUUID()}`;
   logger.info({ scanId, type, input: type === 'url' ? input : '[HTML]' }, 'Starting scan');
 
+  // Cancel the scan if the client disconnects before we respond
+  const abortController = new AbortController();
+  res.on('close', () => {
+    if (!res.writableEnded) {
+      abortController.abort();
+    }
+  });
+  const scanContext = {
+    signal: abortController.signal,
+    correlationId: req.correlationId,
+    artifacts: {}
+  };
+
+  const startTime = Date.now();
+
   try {
-    const startTime = Date.now();
-    let result;
+    const cacheKey = resultCache.key(type, input, options);
+    let result = skipCacheLookup(options) ? null : await resultCache.get(cacheKey);
 
-    if (type === 'url') {
-      result = await scanURL(input, options);
-    } else {
-      result = await scanHTML(input, options);
+    // A recent failure for the same request fails again without rescanning
+    if (result && result.error) {
+      throw Object.assign(new Error(result.error.message), result.error, { cached: true });
+    }
+    if (result) {
+      result = cachedResult(cacheKey, result, { type, input, html, options }, req.correlationId);
+    }
+
+    if (!result) {
+      try {
+        if (type === 'url' && config.hedging.delay > 0 && options.method !== 'POST') {
+          result = await hedgedScanURL(input, options, scanContext);
+        } else if (type === 'url') {
+          result = await scanURL(input, options, scanContext);
+        } else {
+          result = await scanHTML(html, options, scanContext);
+        }
+      } catch (error) {
+        if (!options.noCache) {
+          resultCache.setError(cacheKey, error);
+        }
+        throw error;
+      }
+
+      // Degraded results shouldn't outlive the outage
+      if (!options.noCache && !result.metadata.degraded) {
+        result = resultCache.setResult(cacheKey, result, options.cacheTtl);
+      }
     }
 
+    if (options.wcagLevel) {
+      result = filterByWcagLevel(result, options.wcagLevel);
+    }
+    if (options.pipeline) {
+      result = applyPipeline(result, options.pipeline);
+    }
+    result = withClientMetadata(result, clientMetadata);
+
     const scanTime = Date.now() - startTime;
 
     logger.info({
@@ -188,8 +412,26 @@ app.post('/api/scan', validateRequest(ScanRequestSchema), ssrfProtection, async
     }, 'Scan completed');
 
     // Record metrics
-    scanCounter.inc({ type, status: 'success' });
-    scanDuration.observe({ type, status: 'success' }, scanTime / 1000);
+    scanCounter.inc(sanitizeLabels({ type, status: 'success' }));
+    observeScanDuration({ type, status: 'success' }, scanTime / 1000, req.correlationId);
+
+    resultPublisher.publish(scanId, result);
+    emailNotifier.notifyScan(scanId, result);
+    reportStore.save(scanId, {
+      correlationId: req.correlationId,
+      type,
+      owner: clientId(req),
+      options,
+      scanTime,
+      result,
+      artifacts: scanContext.artifacts
+    });
+    scanHistory.record(scanId, {
+      type,
+      input,
+      owner: clientId(req),
+      response: { scanId, correlationId: req.correlationId, ...result, scanTime }
+    });
 
     // Audit log
     await auditLogger.logScan({
@@ -203,19 +445,85 @@ app.post('/api/scan', validateRequest(ScanRequestSchema), ssrfProtection, async
       ip: req.ip
     });
 
-    res.json({
+    if (format === 'tickets') {
+      return sendScanResponse(req, res, {
+        scanId,
+        correlationId: req.correlationId,
+        url: result.url,
+        timestamp: result.timestamp,
+        summary: result.summary,
+        tickets: violationTickets(result)
+      });
+    }
+
+    if (format === 'sarif') {
+      return res.type('application/sarif+json').json(
+        violationsSarif(result, { scanId, correlationId: req.correlationId })
+      );
+    }
+
+    if (req.accepts(['application/json', 'text/csv']) === 'text/csv') {
+      return res.type('text/csv; charset=utf-8').send(violationsCsv(result));
+    }
+
+    if (flatten === 'nodes') {
+      return sendScanResponse(req, res, {
+        scanId,
+        correlationId: req.correlationId,
+        url: result.url,
+        timestamp: result.timestamp,
+        scanTime,
+        summary: result.summary,
+        nodes: flattenViolationNodes(result.violations, options)
+      });
+    }
+
+    const response = {
       scanId,
       correlationId: req.correlationId,
       ...result,
       scanTime
-    });
+    };
+    if (options.standards) {
+      response.standards = segmentByStandard(result, options.standards);
+    }
+    if (baseline) {
+      response.comparison = {
+        baselineScanId: options.baselineScanId,
+        ...compareWithBaseline(baseline.result, result, options)
+      };
+    }
+    if (options.wcag22Report) {
+      response.wcag22 = wcag22NewCriteria(result);
+    }
+    if (req.optionWarnings.length > 0) {
+      response.metadata = { ...result.metadata, warnings: req.optionWarnings };
+    }
+
+    // Let polling clients fetch only what changed since a previous response
+    const versioned = formatForVersion(response, req.apiVersion);
+    res.set('X-Result-Hash', resultDelta.remember(versioned));
+    const patch = deltaFrom ? resultDelta.patchFrom(deltaFrom, versioned) : null;
+    if (patch) {
+      res.set('X-Delta-Base', deltaFrom);
+      return res.type('application/json-patch+json').send(JSON.stringify(patch));
+    }
+
+    sendScanResponse(req, res, versioned);
 
   } catch (error) {
+    if (error.name === 'AbortError') {
+      logger.info({ correlationId: req.correlationId, scanId }, 'Scan canceled by client');
+      scanCounter.inc(sanitizeLabels({ type, status: 'canceled' }));
+      return;
+    }
+
     logger.error({ correlationId: req.correlationId, scanId, error: error.message }, 'Scan failed');
 
     // Record metrics
-    scanCounter.inc({ type, status: 'error' });
-    scanDuration.observe({ type, status: 'error' }, (Date.now() - Date.now()) / 1000);
+    const status = error.code === ERROR_CODES.SCAN_TIMEOUT ? 'timeout' : 'error';
+    scanCounter.inc(sanitizeLabels({ type, status }));
+    observeScanDuration({ type, status }, (Date.now() - startTime) / 1000, req.correlationId);
 
     // Audit log error
     await auditLogger.logScan({
@@ -227,163 +535,668 @@ app.post('/api/scan', validateRequest(ScanRequestSchema), ssrfProtection, async
       ip: req.ip
     });
 
+    if (error.code === ERROR_CODES.AUTH_REQUIRED) {
+      return res.status(422).json({
+        scanId,
+        correlationId: req.correlationId,
+        error: 'Authentication Required',
+        message: error.message,
+        code: error.code,
+        scheme: error.scheme,
+        realm: error.realm,
+        cached: error.cached
+      });
+    }
+
+    if (error.code === ERROR_CODES.SCAN_TIMEOUT) {
+      return res.status(504).json({
+        scanId,
+        correlationId: req.correlationId,
+        error: 'Scan timeout',
+        message: `Scan did not finish within ${error.timeout}ms`,
+        code: error.code
+      });
+    }
+
+    if (error.code === ERROR_CODES.BROWSER_UNAVAILABLE) {
+      res.set('Retry-After', String(Math.ceil(error.retryAfter / 1000)));
+      return res.status(503).json({
+        scanId,
+        correlationId: req.correlationId,
+        error: 'Service Unavailable',
+        message: 'Browsers are failing to launch; scans are paused until they recover',
+        code: error.code
+      });
+    }
+
+    if (error.code === ERROR_CODES.INVALID_INPUT) {
+      return res.status(400).json({
+        scanId,
+        correlationId: req.correlationId,
+        error: 'Invalid options',
+        message: error.message,
+        code: error.code
+      });
+    }
+
+    if (error.code === ERROR_CODES.OVERLOADED) {
+      return res.status(503).json({
+        scanId,
+        correlationId: req.correlationId,
+        error: 'Service Unavailable',
+        message: error.queueTimeout
+          ? `No browser became available within ${config.browserAcquireTimeout}ms; retry later`
+          : error.message,
+        code: error.code
+      });
+    }
+
     res.status(500).json({
       scanId,
       correlationId: req.correlationId,
       error: error.message,
+      code: ERROR_CODES.SCAN_FAILED,
+      cached: error.cached,
       stack: process.env.NODE_ENV === 'development' ? error.stack : undefined
     });
   }
 });
 
+// Artifacts (screenshot, rendered HTML) aren't cached, so requests for
+// them always scan; their results still refresh the cache for others
+function skipCacheLookup(options) {
+  return Boolean(options.noCache || options.screenshot || options.renderedHtml);
+}
+
+/**
+ * Mark a result served from the cache. A stale one is served as is, marked
+ * metadata.cache "stale", while a rescan refreshes the cache in the
+ * background: detached from the client's request, so it completes even if
+ * the client disconnects, and never on reserved browsers.
+ */
+function cachedResult(cacheKey, result, { type, input, html, options }, correlationId) {
+  if (!resultCache.isStale(result)) {
+    return { ...result, metadata: { ...result.metadata, cache: 'hit' } };
+  }
+
+  resultCache.revalidate(cacheKey, () => {
+    logger.info({ correlationId, type, input: type === 'url' ? input : '[HTML]' }, 'Refreshing stale cached result');
+    const refreshOptions = { ...options, priority: 'normal' };
+    const refreshContext = { correlationId, artifacts: {} };
+    return type === 'url'
+      ? scanURL(input, refreshOptions, refreshContext)
+      : scanHTML(html, refreshOptions, refreshContext);
+  }, options.cacheTtl);
+
+  return { ...result, metadata: { ...result.metadata, cache: 'stale' } };
+}
+
+// Run one request of a batch scan. Checks the single scan endpoint does in
+// middleware are done here, so a rejected request only fails its own entry.
+async function runBatchScan({ type, input, options = {}, clientMetadata }, warnings, context) {
+  options = { ...options, priority: 'normal' };
+  const scanId = `scan_${crypto.randomUUID()}`;
+  const scanContext = { ...context, artifacts: {} };
+  const startTime = Date.now();
+
+  try {
+    let html = input;
+    if (type === 'url') {
+      try {
+        await validateURL(input, options.hostOverrides);
+        input = normalizeURL(input);
+      } catch (error) {
+        const { error: label, code } = urlRejection(error);
+        return { scanId, error: label, message: error.message, code };
+      }
+
+      const hostname = new URL(input).hostname;
+      const country = await findBlockedCountry(hostOverrideFor(options.hostOverrides, hostname) || hostname);
+      if (country) {
+        return {
+          scanId,
+          error: 'Forbidden',
+          message: `Scanning targets hosted in ${country} is not allowed`,
+          code: ERROR_CODES.GEO_BLOCKED
+        };
+      }
+    } else {
+      try {
+        ({ html } = decodeHtmlInput(input, options));
+      } catch (error) {
+        return { scanId, error: 'Invalid input', message: error.message, code: ERROR_CODES.INVALID_INPUT };
+      }
+    }
+
+    const cacheKey = resultCache.key(type, input, options);
+    let result = skipCacheLookup(options) ? null : await resultCache.get(cacheKey);
+    if (result && result.error) {
+      throw Object.assign(new Error(result.error.message), result.error, { cached: true });
+    }
+    if (result) {
+      result = cachedResult(cacheKey, result, { type, input, html, options }, context.correlationId);
+    } else {
+      try {
+        result = type === 'url'
+          ? await scanURL(input, options, scanContext)
+          : await scanHTML(html, options, scanContext);
+      } catch (error) {
+        if (!options.noCache) {
+          resultCache.setError(cacheKey, error);
+        }
+        throw error;
+      }
+
+      if (!options.noCache && !result.metadata.degraded) {
+        result = resultCache.setResult(cacheKey, result, options.cacheTtl);
+      }
+    }
+
+    if (options.wcagLevel) {
+      result = filterByWcagLevel(result, options.wcagLevel);
+    }
+    if (options.pipeline) {
+      result = applyPipeline(result, options.pipeline);
+    }
+    result = withClientMetadata(result, clientMetadata);
+
+    const scanTime = Date.now() - startTime;
+    scanCounter.inc(sanitizeLabels({ type, status: 'success' }));
+    observeScanDuration({ type, status: 'success' }, scanTime / 1000, context.correlationId);
+    reportStore.save(scanId, {
+      correlationId: context.correlationId,
+      type,
+      owner: context.owner,
+      options,
+      scanTime,
+      result,
+      artifacts: scanContext.artifacts
+    });
+    scanHistory.record(scanId, {
+      type,
+      input,
+      owner: context.owner,
+      response: { scanId, correlationId: context.correlationId, ...result, scanTime }
+    });
+
+    return {
+      scanId,
+      ...result,
+      scanTime,
+      metadata: warnings.length > 0 ? { ...result.metadata, warnings } : result.metadata
+    };
+  } catch (error) {
+    if (error.name === 'AbortError') {
+      throw error;
+    }
+
+    logger.warn({ correlationId: context.correlationId, scanId, error: error.message }, 'Batch scan request failed');
+    scanCounter.inc(sanitizeLabels({ type, status: error.code === ERROR_CODES.SCAN_TIMEOUT ? 'timeout' : 'error' }));
+
+    return {
+      scanId,
+      error: {
+        [ERROR_CODES.AUTH_REQUIRED]: 'Authentication Required',
+        [ERROR_CODES.BROWSER_UNAVAILABLE]: 'Service Unavailable',
+        [ERROR_CODES.OVERLOADED]: 'Service Unavailable',
+        [ERROR_CODES.INVALID_INPUT]: 'Invalid options',
+        [ERROR_CODES.SCAN_TIMEOUT]: 'Scan timeout'
+      }[error.code] || 'Scan failed',
+      message: error.message,
+      code: error.code || ERROR_CODES.SCAN_FAILED,
+      scheme: error.scheme,
+      realm: error.realm,
+      cached: error.cached
+    };
+  }
+}
+
+// Scans requested, for rate limiting before the body is validated
+function batchScanCount(req) {
+  return Array.isArray(req.body.requests) ? req.body.requests.length : 1;
+}
+
+// Scan several URL or HTML inputs in one call. Results keep the order of the
+// requests, and a failed scan is reported in its own entry without affecting
+// the others.
+app.post('/api/scan/batch', rejectWhenShuttingDown, rateLimit(batchScanCount), coerceBatchRequestOptions, validateRequest(BatchScanRequestSchema), async (req, res, next) => {
+  const { requests } = req.body;
+  logger.info({ correlationId: req.correlationId, count: requests.length }, 'Starting batch scan');
+
+  // Cancel scans in flight if the client disconnects before we respond
+  const abortController = new AbortController();
+  res.on('close', () => {
+    if (!res.writableEnded) {
+      abortController.abort();
+    }
+  });
+  const context = { signal: abortController.signal, correlationId: req.correlationId, owner: clientId(req) };
+
+  let results;
+  try {
+    results = await scanBatch(requests, req.optionWarnings, context);
+  } catch (error) {
+    if (error.name !== 'AbortError') {
+      return next(error);
+    }
+  }
+
+  if (abortController.signal.aborted) {
+    logger.info({ correlationId: req.correlationId }, 'Batch scan canceled by client');
+    return;
+  }
+
+  res.json({
+    correlationId: req.correlationId,
+    summary: batchSummary(results),
+    results
+  });
+});
+
+// Stream a batch scan's progress over a WebSocket. The client sends one
+// batch request message; each sub-scan's outcome is pushed as it finishes,
+// then a summary, and the server closes the connection. Scans still running
+// are canceled if the client disconnects. Browsers may only connect from
+// WS_ALLOWED_ORIGINS.
+app.get('/api/scan/stream', rejectWhenShuttingDown, (req, res) => {
+  if (!req.upgradeHead || !isWebSocketUpgrade(req)) {
+    res.set('Upgrade', 'websocket');
+    return res.status(426).json({
+      error: 'Upgrade Required',
+      message: 'Connect to this endpoint with a WebSocket client',
+      code: ERROR_CODES.UPGRADE_REQUIRED
+    });
+  }
+
+  // WebSockets aren't covered by CORS; without this check any site could
+  // run scans from its visitors' browsers
+  if (!isAllowedOrigin(req, config.webSocket.allowedOrigins)) {
+    logger.warn({ correlationId: req.correlationId, origin: req.headers.origin }, 'WebSocket origin not allowed');
+    return res.status(403).json({
+      error: 'Forbidden',
+      message: 'Origin not allowed',
+      code: ERROR_CODES.ORIGIN_NOT_ALLOWED
+    });
+  }
+
+  res.detachSocket(req.socket);
+  acceptWebSocket(req, req.socket, req.upgradeHead, {
+    maxMessageBytes: config.webSocket.maxMessageBytes,
+    headers: { 'X-Correlation-ID': req.correlationId }
+  }, ws => streamBatchScan(req, ws, scanBatch));
+});
+
+/**
+ * Run a batch's scans, no more at a time than the browsers normal-priority
+ * scans may use. onResult is called with each scan's index and entry as it
+ * finishes.
+ */
+function scanBatch(requests, warnings, context, onResult) {
+  return runBatch(requests, (request, index) => runBatchScan(request, warnings[index], context), {
+    concurrency: Math.min(config.scanConcurrency, browserPool.capacityFor('normal')),
+    signal: context.signal,
+    onResult
+  });
+}
+
+// Recent completed scans of the calling client, newest first
+app.get('/api/scans', async (req, res, next) => {
+  if (!scanHistory.enabled) {
+    return res.status(404).json({
+      error: 'Scan history is disabled',
+      code: ERROR_CODES.NOT_FOUND
+    });
+  }
+
+  const limit = req.query.limit === undefined ? 20 : Number(req.query.limit);
+  const cursor = req.query.cursor === undefined ? null : String(req.query.cursor);
+  if (!Number.isInteger(limit) || limit < 1 || limit > 100 || (cursor !== null && scanHistory.parseCursor(cursor) === null)) {
+    return res.status(400).json({
+      error: 'Invalid pagination. limit must be 1-100 and cursor a nextCursor from an earlier page',
+      code: ERROR_CODES.INVALID_INPUT
+    });
+  }
+
+  try {
+    const { total, scans, nextCursor } = await scanHistory.list({ owner: clientId(req), cursor, limit });
+    res.json({ total, limit, scans, nextCursor });
+  } catch (error) {
+    next(error);
+  }
+});
+
+// Full result of a recent completed scan. Other clients' scans are
+// reported as not found.
+app.get('/api/scans/:scanId', async (req, res, next) => {
+  try {
+    const scan = scanHistory.enabled ? await scanHistory.get(req.params.scanId, clientId(req)) : null;
+    if (!scan) {
+      return res.status(404).json({
+        error: 'Scan not found',
+        code: ERROR_CODES.NOT_FOUND
+      });
+    }
+    res.json(scan);
+  } catch (error) {
+    next(error);
+  }
+});
+
+// A stored report, or null when it's missing or another client's
+function ownReport(req, scanId) {
+  const report = reportStore.get(scanId);
+  return report && reportStore.isOwner(scanId, clientId(req)) ? report : null;
+}
+
+// Download a single scan's results, metadata and screenshot as a zip. Only
+// the client that ran the scan can download it.
+app.get('/api/report/:scanId/bundle', (req, res) => {
+  const { scanId } = req.params;
+  const report = ownReport(req, scanId);
+
+  if (!report) {
+    return res.status(404).json({
+      error: 'Report not found',
+      code: ERROR_CODES.NOT_FOUND
+    });
+  }
+
+  res.attachment(`${scanId}.zip`);
+  createBundleStream(scanId, report)
+    .on('error', error => {
+      logger.error({ scanId, error: error.message }, 'Failed to stream report bundle');
+      res.destroy();
+    })
+    .pipe(res);
+});
+
+// Rendered HTML of a scan run with options.renderedHtml. It's the scanned
+// site's markup, so it's sandboxed: no scripts run and nothing is loaded.
+// Like the bundle, it's only served to the client that ran the scan.
+app.get('/api/report/:scanId/html', (req, res) => {
+  const { scanId } = req.params;
+  const report = ownReport(req, scanId);
+
+  if (!report || !report.artifacts.html) {
+    return res.status(404).json({
+      error: report ? 'Rendered HTML was not captured for this scan' : 'Report not found',
+      code: ERROR_CODES.NOT_FOUND
+    });
+  }
+
+  res.set({
+    'Content-Security-Policy': "sandbox; default-src 'none'",
+    'X-Content-Type-Options': 'nosniff',
+    'X-Content-Truncated': String(report.artifacts.htmlTruncated)
+  });
+  res.type('html').send(report.artifacts.html);
+});
+
+// Bulk scans run in the background; their status is kept for the
+// endpoints below
+const bulkScans = new BulkScanRunner({
+  scan: scanURL,
+  isShuttingDown: () => shuttingDown,
+  onResult: (batchId, scanId, result) => resultPublisher.publish(scanId, result, { batchId }),
+  onComplete: (batchId, { status, results, errors }) => emailNotifier.notifyBulk(batchId, { status, results, errors })
+});
+
+// Recent bulk submissions, so a repeated one gets the existing batch
+const bulkSubmissions = new SubmissionDedup();
+
+// Scans requested, for rate limiting before the body is validated
+function bulkScanCount(req) {
+  return Array.isArray(req.body.urls) ? req.body.urls.length : 1;
+}
+
 // Bulk scan endpoint (for stress testing)
-app.post('/api/scan/bulk', validateRequest(BulkScanRequestSchema), async (req, res) => {
-  const { urls, options = {} } = req.body;
+app.post('/api/scan/bulk', rejectWhenShuttingDown, rateLimit(bulkScanCount), coerceRequestOptions, validateRequest(BulkScanRequestSchema), async (req, res) => {
+  const { urls, clientMetadata } = req.body;
+  const options = { ...req.body.options, priority: 'normal' };
 
   if (!Array.isArray(urls) || urls.length === 0) {
     return res.status(400).json({
-      error: 'urls must be a non-empty array'
+      error: 'urls must be a non-empty array',
+      code: ERROR_CODES.INVALID_INPUT
     });
   }
 
   if (urls.length > 100) {
     return res.status(400).json({
-      error: 'Maximum 100 URLs per bulk scan'
+      error: 'Maximum 100 URLs per bulk scan',
+      code: ERROR_CODES.INVALID_INPUT
+    });
+  }
+
+  // Reject the whole bulk scan up front instead of scanning unsafe URLs
+  const checks = await Promise.allSettled(urls.map(url => validateURL(url, options.hostOverrides)));
+  const rejectedIndex = checks.findIndex(check => check.status === 'rejected');
+  if (rejectedIndex !== -1) {
+    const error = checks[rejectedIndex].reason;
+    const rejection = urlRejection(error);
+    return res.status(rejection.status).json({
+      error: rejection.error,
+      message: error.message,
+      url: urls[rejectedIndex],
+      code: rejection.code
     });
   }
+  const scanUrls = urls.map(normalizeURL);
 
-  const batchId = `batch_${Date.now()}`;
+  const countries = await Promise.all(scanUrls.map(url => {
+    const hostname = new URL(url).hostname;
+    return findBlockedCountry(hostOverrideFor(options.hostOverrides, hostname) || hostname);
+  }));
+  const blockedIndex = countries.findIndex(Boolean);
+  if (blockedIndex !== -1) {
+    logger.warn({ url: urls[blockedIndex], country: countries[blockedIndex], ip: req.ip }, 'Scan target blocked by GeoIP policy');
+    return res.status(403).json({
+      error: 'Forbidden',
+      message: `Scanning targets hosted in ${countries[blockedIndex]} is not allowed`,
+      url: urls[blockedIndex],
+      code: ERROR_CODES.GEO_BLOCKED
+    });
+  }
+
+  // A repeated submission (e.g. a client retrying) gets the existing batch
+  const submissionHash = bulkSubmissions.enabled
+    ? bulkSubmissions.hash(clientId(req), scanUrls, options, clientMetadata)
+    : null;
+  const existingBatchId = submissionHash && bulkSubmissions.find(submissionHash);
+  if (existingBatchId && bulkScans.has(existingBatchId)) {
+    logger.info({ correlationId: req.correlationId, batchId: existingBatchId }, 'Duplicate bulk scan submission');
+    return res.json({
+      batchId: existingBatchId,
+      status: bulkScans.get(existingBatchId).status,
+      totalUrls: urls.length,
+      duplicate: true,
+      message: 'Identical bulk scan submitted recently. Check /api/scan/bulk/:batchId for status'
+    });
+  }
+
+  // Cap the bulk scans one client can have running at once
+  const client = clientId(req);
+  if (config.bulk.maxActivePerClient > 0 && bulkScans.activeCount(client) >= config.bulk.maxActivePerClient) {
+    return res.status(429).json({
+      error: 'Too Many Requests',
+      message: `Maximum ${config.bulk.maxActivePerClient} bulk scans in progress per client`,
+      code: ERROR_CODES.BULK_SCAN_LIMIT
+    });
+  }
+  const batchId = `batch_${crypto.randomUUID()}`;
   logger.info({ batchId, count: urls.length }, 'Starting bulk scan');
 
+  if (submissionHash) {
+    bulkSubmissions.remember(submissionHash, batchId);
+  }
+
   // Return immediately and process async
   res.json({
     batchId,
     status: 'processing',
     totalUrls: urls.length,
-    message: 'Bulk scan initiated. Check /api/scan/bulk/:batchId for status'
+    message: 'Bulk scan initiated. Check /api/scan/bulk/:batchId for status',
+    warnings: req.optionWarnings.length > 0 ? req.optionWarnings : undefined
   });
 
   // Process scans in background (in production, use a queue like Bull/BullMQ)
-  processBulkScan(batchId, urls, options);
+  // Scans beyond the browsers available to them would only queue in the pool
+  const concurrency = Math.max(1, Math.min(config.scanConcurrency, browserPool.capacityFor(options.priority)));
+  bulkScans.run(batchId, scanUrls, options, { clientMetadata, concurrency, owner: client })
+    .catch(error => {
+      logger.error({ batchId, error: error.message }, 'Bulk scan failed');
+    });
 });
 
-// Bulk scan status endpoint
-const bulkScanResults = new Map();
+// A bulk scan, or null when it is unknown or another client submitted it
+function ownBatch(req, batchId) {
+  const result = bulkScans.get(batchId);
+  return result && bulkScans.isOwner(batchId, clientId(req)) ? result : null;
+}
 
+// Bulk scan status endpoint. Only the client that submitted the batch can
+// read it.
 app.get('/api/scan/bulk/:batchId', (req, res) => {
   const { batchId } = req.params;
-  const result = bulkScanResults.get(batchId);
+  const result = ownBatch(req, batchId);
 
   if (!result) {
     return res.status(404).json({
-      error: 'Batch not found'
+      error: 'Batch not found',
+      code: ERROR_CODES.NOT_FOUND
     });
   }
 
   res.json(result);
 });
 
-async function processBulkScan(batchId, urls, options) {
-  const results = [];
-  const errors = [];
-  const startTime = Date.now();
+// Draft accessibility conformance report (VPAT layout) for a finished batch
+app.get('/api/scan/bulk/:batchId/conformance', (req, res) => {
+  const { batchId } = req.params;
+  const { level = 'AA', product } = req.query;
+  const result = ownBatch(req, batchId);
 
-  bulkScanResults.set(batchId, {
-    status: 'processing',
-    progress: 0,
-    total: urls.length,
-    results: [],
-    errors: []
-  });
+  if (!result) {
+    return res.status(404).json({
+      error: 'Batch not found',
+      code: ERROR_CODES.NOT_FOUND
+    });
+  }
 
-  const concurrency = parseInt(process.env.SCAN_CONCURRENCY) || 3;
-
-  for (let i = 0; i < urls.length; i += concurrency) {
-    const batch = urls.slice(i, i + concurrency);
-
-    const batchResults = await Promise.allSettled(
-      batch.map(url => scanURL(url, options))
-    );
-
-    batchResults.forEach((result, idx) => {
-      if (result.status === 'fulfilled') {
-        results.push({
-          url: batch[idx],
-          ...result.value
-        });
-      } else {
-        errors.push({
-          url: batch[idx],
-          error: result.reason.message
-        });
-      }
+  if (result.status === 'processing') {
+    return res.status(409).json({
+      error: 'Batch is still processing',
+      code: ERROR_CODES.BATCH_IN_PROGRESS
     });
+  }
 
-    // Update progress
-    bulkScanResults.set(batchId, {
-      status: 'processing',
-      progress: Math.min(i + concurrency, urls.length),
-      total: urls.length,
-      results,
-      errors
+  const levels = { A: ['A'], AA: ['A', 'AA'], AAA: ['A', 'AA', 'AAA'] }[level];
+  if (!levels) {
+    return res.status(400).json({
+      error: 'Invalid level value. Must be "A", "AA" or "AAA"',
+      code: ERROR_CODES.INVALID_INPUT
     });
+  }
 
-    logger.info({
-      batchId,
-      progress: `${Math.min(i + concurrency, urls.length)}/${urls.length}`
-    }, 'Bulk scan progress');
+  res.json({
+    batchId,
+    ...buildConformanceReport(result.results, { levels, productName: product })
+  });
+});
+
+// Cancel a running bulk scan: URLs not yet started are skipped and scans in
+// flight are aborted. Finished batches are left unchanged. Only the client
+// that submitted the batch may cancel it.
+app.delete('/api/scan/bulk/:batchId', (req, res) => {
+  const { batchId } = req.params;
+  const result = bulkScans.get(batchId);
+
+  if (!result) {
+    return res.status(404).json({
+      error: 'Batch not found',
+      code: ERROR_CODES.NOT_FOUND
+    });
   }
 
-  const totalTime = Date.now() - startTime;
+  if (!bulkScans.isOwner(batchId, clientId(req))) {
+    return res.status(403).json({
+      error: 'Forbidden',
+      message: 'Only the client that submitted a bulk scan can cancel it',
+      code: ERROR_CODES.NOT_BATCH_OWNER
+    });
+  }
 
-  bulkScanResults.set(batchId, {
-    status: 'completed',
-    progress: urls.length,
-    total: urls.length,
-    results,
-    errors,
-    totalTime,
-    averageTimePerScan: totalTime / urls.length
-  });
+  const canceled = bulkScans.cancel(batchId);
 
-  logger.info({
+  res.json({
     batchId,
-    totalScans: results.length,
-    errors: errors.length,
-    totalTime
-  }, 'Bulk scan completed');
-}
-
-// Error handling middleware
-app.use((err, req, res, next) => {
-  logger.error(err);
-  res.status(500).json({
-    error: 'Internal server error',
-    message: err.message
+    status: canceled ? 'canceled' : result.status
   });
 });
 
+// Error handling middleware
+app.use(errorHandler(logger));
+
 // 404 handler
 app.use((req, res) => {
   res.status(404).json({
     error: 'Not found',
-    path: req.url
+    path: req.url,
+    code: ERROR_CODES.NOT_FOUND
   });
 });
 
-// Graceful shutdown
-process.on('SIGTERM', () => {
-  logger.info('SIGTERM received, shutting down gracefully');
+// Keep popular pages warm in the result cache
+const cachePreloader = new CachePreloader({
+  scan: url => scanURL(url),
+  cache: resultCache
+});
+
+// Graceful shutdown: stop accepting scans, let in-flight scans finish (up
+// to SHUTDOWN_TIMEOUT), then close browsers and exit
+process.on('SIGTERM', async () => {
+  if (shuttingDown) return;
+  shuttingDown = true;
+  logger.info({ activeScans: activeScanCount() }, 'SIGTERM received, shutting down gracefully');
+
+  cachePreloader.stop();
+  reportStore.stopJanitor();
   server.close(() => {
     logger.info('Server closed');
-    process.exit(0);
   });
+
+  const drained = await waitForIdle(config.shutdownTimeout);
+  if (drained) {
+    logger.info('In-flight scans finished');
+  } else {
+    logger.warn({ activeScans: activeScanCount() }, 'Shutdown timeout reached with scans in progress');
+  }
+
+  resultPublisher.close();
+  await browserPool.cleanup();
+  process.exit(0);
 });
 
 const server = app.listen(PORT, () => {
   logger.info(`🚀 WCAGAI Backend running on port ${PORT}`);
   logger.info(`📊 Health check: http://localhost:${PORT}/health`);
   logger.info(`🔍 Scan endpoint: POST http://localhost:${PORT}/api/scan`);
+  cachePreloader.start();
+  reportStore.startJanitor();
+});
+server.requestTimeout = config.requestTimeout;
+server.keepAliveTimeout = config.keepAliveTimeout;
+
+// WebSocket upgrades are routed through the app like any request, so they
+// pass the same middleware; the /api/scan/stream handler takes over the
+// socket, and any other response closes it
+server.on('upgrade', (req, socket, head) => {
+  const res = new http.ServerResponse(req);
+  res.assignSocket(socket);
+  res.shouldKeepAlive = false;
+  res.on('finish', () => socket.end());
+  req.upgradeHead = head;
+  app.handle(req, res);
 });
 
 module.exports = app;
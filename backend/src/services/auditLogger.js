@@ -124,9 +124,9 @@ const auditLogger = new AuditLogger({
   enabled: process.env.AUDIT_LOGGING !== 'false'
 });
 
-// Cleanup old logs daily
+// Cleanup old logs daily, without keeping the process alive for it
 if (auditLogger.enabled) {
-  setInterval(() => auditLogger.cleanup(), 24 * 60 * 60 * 1000);
+  setInterval(() => auditLogger.cleanup(), 24 * 60 * 60 * 1000).unref();
 }
 
 module.exports = { AuditLogger, auditLogger };
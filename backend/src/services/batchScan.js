@@ -0,0 +1,52 @@
+/**
+ * Batch Scan Scheduling
+ *
+ * Runs the scans of a POST /api/scan/batch (or /api/scan/stream) request
+ * with a bounded number of workers, so a batch can't claim more browsers
+ * than normal-priority scans may use. Each scan reports its own outcome as
+ * an entry (failures included), and entries keep the order of the requests
+ * whatever order the scans finish in.
+ */
+
+/**
+ * Run scan(request, index) for every request, concurrency at a time.
+ * onResult is called with each scan's index and entry as it finishes. No
+ * new scans start once signal is aborted, and the batch then rejects with
+ * an AbortError, as when a scan in flight is aborted, instead of returning
+ * entries for scans that never ran.
+ *
+ * @returns {Promise<Object[]>} Entries in request order
+ */
+async function runBatch(requests, scan, { concurrency = 1, signal, onResult = () => {} } = {}) {
+  const results = new Array(requests.length);
+  let nextIndex = 0;
+
+  const worker = async () => {
+    while (nextIndex < requests.length && !(signal && signal.aborted)) {
+      const index = nextIndex++;
+      results[index] = await scan(requests[index], index);
+      onResult(index, results[index]);
+    }
+  };
+
+  const workers = Math.min(Math.max(1, concurrency), requests.length);
+  await Promise.all(Array.from({ length: workers }, worker));
+
+  if (signal && signal.aborted) {
+    const error = new Error('Batch scan canceled');
+    error.name = 'AbortError';
+    throw error;
+  }
+  return results;
+}
+
+function batchSummary(results) {
+  const failed = results.filter(result => result.error).length;
+  return {
+    total: results.length,
+    succeeded: results.length - failed,
+    failed
+  };
+}
+
+module.exports = { runBatch, batchSummary };
@@ -0,0 +1,124 @@
+/**
+ * Streamed Batch Scans
+ *
+ * Serves a /api/scan/stream WebSocket connection: the client sends one
+ * batch request ({ requests: [...] }, as POST /api/scan/batch takes), and
+ * gets a { type: "result" } message per sub-scan as it finishes, then a
+ * { type: "summary" } message before the server closes the connection.
+ * Problems with the request are sent as a { type: "error" } message and
+ * close the connection with 1008 (1003 for a binary message); closing the
+ * connection cancels the scans still outstanding.
+ */
+
+const pino = require('pino');
+const config = require('../config');
+const { ERROR_CODES } = require('../errorCodes');
+const { takeRateLimit, clientId } = require('../middleware/rateLimit');
+const { BatchScanRequestSchema, coerceOptions, validationDetails } = require('../schemas/validation');
+const { CLOSE_CODES } = require('./webSocket');
+const { batchSummary } = require('./batchScan');
+
+const logger = pino({
+  level: process.env.LOG_LEVEL || 'info'
+});
+
+/**
+ * Read the batch request from ws and stream its scans' outcomes
+ *
+ * @param {http.IncomingMessage} req - Upgrade request, for rate limiting
+ * @param {WebSocket} ws - Accepted connection (see acceptWebSocket)
+ * @param {Function} scanBatch - (requests, warnings, context, onResult) =>
+ *   entries in request order; onResult(index, entry) as each finishes
+ */
+function streamBatchScan(req, ws, scanBatch) {
+  const abortController = new AbortController();
+  ws.on('close', () => abortController.abort());
+
+  const send = message => ws.send(JSON.stringify(message));
+  const fail = (code, body) => {
+    send({ type: 'error', ...body });
+    ws.close(code, body.error);
+  };
+
+  const messageTimer = setTimeout(() => {
+    fail(CLOSE_CODES.policyViolation, {
+      error: 'No batch request received',
+      code: ERROR_CODES.INVALID_INPUT
+    });
+  }, config.webSocket.messageTimeout);
+
+  ws.once('message', async (message, isBinary) => {
+    clearTimeout(messageTimer);
+
+    if (isBinary) {
+      return fail(CLOSE_CODES.unsupportedData, {
+        error: 'Binary messages are not supported',
+        code: ERROR_CODES.INVALID_INPUT
+      });
+    }
+
+    let body;
+    try {
+      body = JSON.parse(message.toString('utf8'));
+    } catch (error) {
+      return fail(CLOSE_CODES.policyViolation, {
+        error: 'Batch request must be JSON',
+        code: ERROR_CODES.INVALID_INPUT
+      });
+    }
+    const requests = body && Array.isArray(body.requests) ? body.requests : null;
+
+    const limit = await takeRateLimit(req, requests ? requests.length : 1);
+    if (limit && !limit.allowed) {
+      return fail(CLOSE_CODES.policyViolation, {
+        error: 'Too Many Requests',
+        message: limit.message,
+        retryAfter: Math.ceil(limit.retryAfter / 1000),
+        code: ERROR_CODES.RATE_LIMITED
+      });
+    }
+
+    const warnings = (requests || []).map(request =>
+      request && !config.strictOptions ? coerceOptions(request.options) : []
+    );
+    const parsed = BatchScanRequestSchema.safeParse(body);
+    if (!parsed.success) {
+      return fail(CLOSE_CODES.policyViolation, {
+        error: 'Validation Error',
+        code: ERROR_CODES.INVALID_INPUT,
+        details: validationDetails(parsed.error)
+      });
+    }
+
+    logger.info({ correlationId: req.correlationId, count: requests.length }, 'Starting streamed batch scan');
+    const context = { signal: abortController.signal, correlationId: req.correlationId, owner: clientId(req) };
+
+    try {
+      const results = await scanBatch(requests, warnings, context, (index, result) => {
+        send({
+          type: 'result',
+          index,
+          scanId: result.scanId,
+          status: result.error ? 'failed' : 'succeeded',
+          violationsCount: result.error ? null : result.violations.length,
+          ...(result.error && { error: result.error, code: result.code })
+        });
+      });
+
+      send({ type: 'summary', correlationId: req.correlationId, summary: batchSummary(results) });
+      ws.close(CLOSE_CODES.normal);
+    } catch (error) {
+      if (error.name === 'AbortError') {
+        logger.info({ correlationId: req.correlationId }, 'Streamed batch scan canceled by client');
+        return;
+      }
+      logger.error({ correlationId: req.correlationId, error: error.message }, 'Streamed batch scan failed');
+      fail(CLOSE_CODES.internalError, {
+        error: 'Internal Server Error',
+        code: ERROR_CODES.INTERNAL_ERROR
+      });
+    }
+  });
+}
+
+module.exports = { streamBatchScan };
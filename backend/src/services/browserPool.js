@@ -10,7 +10,8 @@
  * - Expected: 20x faster concurrent scans
  *
  * Features:
- * - Configurable pool size (MIN_POOL, MAX_POOL)
+ * - Configurable pool size (MIN_POOL_SIZE, MAX_POOL_SIZE)
+ * - Browsers reserved for high-priority (interactive) requests
  * - Request queuing when pool exhausted
  * - Health checks for browser instances
  * - Automatic cleanup on shutdown
@@ -19,6 +20,8 @@
 
 const puppeteer = require('puppeteer');
 const pino = require('pino');
+const config = require('../config');
+const { browserAcquireWait, updateBrowserPoolMetrics } = require('./metrics');
 
 const logger = pino({
   level: process.env.LOG_LEVEL || 'info'
@@ -26,11 +29,19 @@ const logger = pino({
 
 class BrowserPool {
   constructor(options = {}) {
-    this.minSize = parseInt(options.minSize || process.env.MIN_POOL_SIZE || 2);
-    this.maxSize = parseInt(options.maxSize || process.env.MAX_POOL_SIZE || 5);
+    this.minSize = options.minSize !== undefined ? options.minSize : config.browserPool.minSize;
+    this.maxSize = options.maxSize || config.browserPool.maxSize;
+    // Browsers only high-priority requests may use, so bulk scans can't
+    // starve interactive clients
+    this.reservedSize = Math.min(
+      options.reservedSize !== undefined ? options.reservedSize : config.browserPool.reservedSize,
+      this.maxSize - 1
+    );
     this.pool = [];
     this.activeCount = 0;
     this.queue = [];
+    this.dedicatedCount = 0;
+    this.maxDedicated = options.maxDedicated !== undefined ? options.maxDedicated : config.browserPool.maxDedicated;
     this.launchConfig = options.launchConfig || {
       headless: 'new',
       args: [
@@ -43,6 +54,8 @@ class BrowserPool {
         '--disable-web-security', // For accessibility scanning only
         '--disable-features=IsolateOrigins,site-per-process'
       ],
+      // The server closes browsers itself once in-flight scans drained
+      handleSIGTERM: false,
       timeout: 30000
     };
 
@@ -106,17 +119,70 @@ class BrowserPool {
     }
   }
 
+  /**
+   * Launch a browser outside the pool with extra launch arguments, for scans
+   * needing browser-wide settings (e.g. --host-resolver-rules). It counts
+   * towards neither pool size nor capacity and must be closed by the caller.
+   */
+  async launchDedicated(extraArgs = []) {
+    if (this.dedicatedCount >= this.maxDedicated) {
+      const error = new Error(`Maximum ${this.maxDedicated} dedicated browsers in use, try again later`);
+      error.dedicatedLimit = true;
+      throw error;
+    }
+
+    this.dedicatedCount++;
+    try {
+      const browser = await puppeteer.launch({
+        ...this.launchConfig,
+        args: [...this.launchConfig.args, ...extraArgs]
+      });
+      browser.once('disconnected', () => {
+        this.dedicatedCount--;
+      });
+      return browser;
+    } catch (error) {
+      this.dedicatedCount--;
+      this.metrics.errors++;
+      throw error;
+    }
+  }
+
+  /**
+   * Launch and close a browser outside the pool; resolves true when
+   * browsers can be launched again (the browser breaker's health check)
+   */
+  async probe() {
+    const browser = await puppeteer.launch(this.launchConfig);
+    await browser.close().catch(() => {});
+    return true;
+  }
+
+  /**
+   * Number of browsers a request of the given priority may have active
+   */
+  capacityFor(priority) {
+    return priority === 'high' ? this.maxSize : this.maxSize - this.reservedSize;
+  }
+
   /**
    * Acquire a browser from the pool
    *
    * @param {number} timeout - Maximum wait time in ms (default: 30s)
+   * @param {string} priority - "high" may use reserved browsers (default: "normal")
+   * @param {AbortSignal} signal - Stops waiting in the queue when aborted
    * @returns {Promise<Browser>} Puppeteer browser instance
    */
-  async acquire(timeout = 30000) {
+  async acquire(timeout = 30000, priority = 'normal', signal = null) {
     this.metrics.totalAcquired++;
+    const hasCapacity = this.activeCount < this.capacityFor(priority);
+
+    if (hasCapacity) {
+      browserAcquireWait.observe({ priority }, 0);
+    }
 
     // Try to get from existing pool
-    if (this.pool.length > 0) {
+    if (this.pool.length > 0 && hasCapacity) {
       const browser = this.pool.pop();
       this.activeCount++;
 
@@ -126,7 +192,7 @@ class BrowserPool {
         await browser.close().catch(() => {});
         this.activeCount--;
         this.metrics.totalDestroyed++;
-        return this.acquire(timeout); // Retry
+        return this.acquire(timeout, priority, signal); // Retry
       }
 
       browser._poolMetadata.acquireCount++;
@@ -138,20 +204,23 @@ class BrowserPool {
         queueSize: this.queue.length
       }, 'Browser acquired from pool');
 
+      this.reportMetrics();
       return browser;
     }
 
     // Create new browser if under max size
-    if (this.activeCount < this.maxSize) {
+    if (hasCapacity) {
       this.activeCount++;
       try {
         const browser = await this.createBrowser();
         this.pool.pop(); // Remove from pool since we're using it immediately
         browser._poolMetadata.acquireCount++;
         browser._poolMetadata.lastAcquired = Date.now();
+        this.reportMetrics();
         return browser;
       } catch (error) {
         this.activeCount--;
+        this.reportMetrics();
         throw error;
       }
     }
@@ -159,7 +228,8 @@ class BrowserPool {
     // Pool exhausted - queue the request
     logger.info({
       activeCount: this.activeCount,
-      queueSize: this.queue.length
+      queueSize: this.queue.length,
+      priority
     }, 'Browser pool exhausted, queueing request');
 
     this.metrics.queueHighWaterMark = Math.max(
@@ -168,28 +238,64 @@ class BrowserPool {
     );
 
     return new Promise((resolve, reject) => {
-      const timeoutId = setTimeout(() => {
-        const index = this.queue.findIndex(item => item.resolve === resolve);
+      // Leave the queue without a browser: timed out or the caller gave up
+      const giveUp = (error) => {
+        const index = this.queue.indexOf(entry);
         if (index !== -1) {
           this.queue.splice(index, 1);
         }
-        reject(new Error(`Browser acquire timeout after ${timeout}ms`));
+        entry.reject(error);
+        this.reportMetrics();
+      };
+
+      const timeoutId = setTimeout(() => {
+        const error = new Error(`Browser acquire timeout after ${timeout}ms`);
+        error.queueTimeout = true;
+        giveUp(error);
       }, timeout);
+      const onAbort = () => {
+        const error = new Error('Browser acquire canceled');
+        error.name = 'AbortError';
+        giveUp(error);
+      };
 
-      this.queue.push({
+      const entry = {
         resolve: (browser) => {
           clearTimeout(timeoutId);
+          if (signal) signal.removeEventListener('abort', onAbort);
+          this.observeWait(entry);
           resolve(browser);
         },
         reject: (error) => {
           clearTimeout(timeoutId);
+          if (signal) signal.removeEventListener('abort', onAbort);
+          this.observeWait(entry);
           reject(error);
         },
+        priority,
         enqueuedAt: Date.now()
-      });
+      };
+      this.queue.push(entry);
+      this.reportMetrics();
+
+      if (signal && signal.aborted) {
+        onAbort();
+      } else if (signal) {
+        signal.addEventListener('abort', onAbort, { once: true });
+      }
     });
   }
 
+  // Time a queued request waited for a browser, until served or given up
+  observeWait(entry) {
+    browserAcquireWait.observe({ priority: entry.priority }, (Date.now() - entry.enqueuedAt) / 1000);
+  }
+
+  // Keep the wcagai_browser_pool_size gauges current between scrapes
+  reportMetrics() {
+    updateBrowserPoolMetrics(this.getStats());
+  }
+
   /**
    * Release a browser back to the pool
    *
@@ -208,6 +314,7 @@ class BrowserPool {
         logger.error({ error: error.message }, 'Error closing disconnected browser');
       }
       this.metrics.totalDestroyed++;
+      this.reportMetrics();
 
       // Create replacement if below min size
       if (this.pool.length + this.activeCount < this.minSize) {
@@ -219,9 +326,15 @@ class BrowserPool {
       return;
     }
 
-    // Serve queued requests first
-    if (this.queue.length > 0) {
-      const { resolve } = this.queue.shift();
+    // Serve queued requests first: high priority, then normal priority
+    // requests while they are within their capacity
+    let nextIndex = this.queue.findIndex(item => item.priority === 'high');
+    if (nextIndex === -1 && this.activeCount < this.capacityFor('normal')) {
+      nextIndex = 0;
+    }
+
+    if (nextIndex !== -1 && this.queue.length > 0) {
+      const [{ resolve }] = this.queue.splice(nextIndex, 1);
       this.activeCount++;
       browser._poolMetadata.acquireCount++;
       browser._poolMetadata.lastAcquired = Date.now();
@@ -231,6 +344,7 @@ class BrowserPool {
         activeCount: this.activeCount
       }, 'Browser released to queued request');
 
+      this.reportMetrics();
       resolve(browser);
       return;
     }
@@ -244,6 +358,7 @@ class BrowserPool {
       );
 
       this.pool.push(browser);
+      this.reportMetrics();
 
       logger.debug({
         poolSize: this.pool.length,
@@ -258,6 +373,7 @@ class BrowserPool {
       } catch (error) {
         logger.error({ error: error.message }, 'Error closing browser');
       }
+      this.reportMetrics();
     }
   }
 
@@ -271,6 +387,8 @@ class BrowserPool {
       queueSize: this.queue.length,
       minSize: this.minSize,
       maxSize: this.maxSize,
+      reservedSize: this.reservedSize,
+      dedicatedCount: this.dedicatedCount,
       metrics: { ...this.metrics },
       utilization: ((this.activeCount / this.maxSize) * 100).toFixed(2) + '%'
     };
@@ -364,14 +482,9 @@ function getBrowserPool(options) {
 }
 
 /**
- * Cleanup hook for graceful shutdown
+ * Cleanup hook for interrupts; on SIGTERM the server drains in-flight scans
+ * before calling cleanup()
  */
-process.on('SIGTERM', async () => {
-  if (poolInstance) {
-    await poolInstance.cleanup();
-  }
-});
-
 process.on('SIGINT', async () => {
   if (poolInstance) {
     await poolInstance.cleanup();
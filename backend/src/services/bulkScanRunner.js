@@ -0,0 +1,224 @@
+/**
+ * Bulk Scan Runner
+ *
+ * Runs bulk scans in the background and keeps their status for the bulk
+ * scan endpoints. URLs are scanned a few at a time; a batch stops starting
+ * new scans once it is canceled, exceeds BULK_MAX_DURATION or the server
+ * shuts down, and keeps the results it has so far.
+ */
+
+const crypto = require('crypto');
+const pino = require('pino');
+const config = require('../config');
+const { filterByWcagLevel, groupTemplateViolations, withClientMetadata } = require('./resultFormatter');
+const { applyPipeline } = require('./resultPipeline');
+
+const logger = pino({
+  level: process.env.LOG_LEVEL || 'info'
+});
+
+class BulkScanRunner {
+  constructor(options = {}) {
+    // (url, options, context) => scan result
+    this.scan = options.scan;
+    // Called with (batchId, scanId, result) for each page scanned
+    this.onResult = options.onResult || (() => {});
+    // Called with (batchId, status) once a batch has ended
+    this.onComplete = options.onComplete || (() => {});
+    this.isShuttingDown = options.isShuttingDown || (() => false);
+    this.maxDuration = options.maxDuration !== undefined ? options.maxDuration : config.bulk.maxDuration;
+    this.dedupContent = options.dedupContent !== undefined ? options.dedupContent : config.bulk.dedupContent;
+    // Status of every batch, by batch ID
+    this.batches = new Map();
+    // Abort controllers of batches still processing, by batch ID
+    this.controllers = new Map();
+    // Client that submitted each batch, by batch ID
+    this.owners = new Map();
+  }
+
+  has(batchId) {
+    return this.batches.has(batchId);
+  }
+
+  get(batchId) {
+    return this.batches.get(batchId);
+  }
+
+  /**
+   * Whether client submitted the batch; batches run without an owner
+   * belong to everyone
+   */
+  isOwner(batchId, client) {
+    const owner = this.owners.get(batchId);
+    return owner === undefined || owner === client;
+  }
+
+  /**
+   * Number of batches client submitted that are still processing
+   */
+  activeCount(client) {
+    let count = 0;
+    for (const batchId of this.controllers.keys()) {
+      if (this.owners.get(batchId) === client) count++;
+    }
+    return count;
+  }
+
+  /**
+   * Cancel a processing batch: URLs not yet started are skipped and scans
+   * in flight are aborted
+   *
+   * @returns {boolean} false when the batch had already ended
+   */
+  cancel(batchId) {
+    const controller = this.controllers.get(batchId);
+    if (!controller) {
+      return false;
+    }
+
+    logger.info({ batchId }, 'Bulk scan cancellation requested');
+    controller.abort('canceled');
+    return true;
+  }
+
+  /**
+   * Scan urls, concurrency at a time, recording progress under batchId.
+   * owner identifies the submitting client for isOwner().
+   */
+  async run(batchId, urls, options, { clientMetadata, concurrency = 1, owner } = {}) {
+    const results = [];
+    const errors = [];
+    const startTime = Date.now();
+
+    if (owner !== undefined) {
+      this.owners.set(batchId, owner);
+    }
+
+    this.batches.set(batchId, {
+      status: 'processing',
+      progress: 0,
+      total: urls.length,
+      results: [],
+      errors: []
+    });
+
+    const fingerprints = this.dedupContent ? new Map() : null;
+
+    // Stop starting new scans once the batch is canceled or exceeds its
+    // maximum runtime; the abort reason tells the two apart
+    const controller = new AbortController();
+    this.controllers.set(batchId, controller);
+    const deadlineTimer = this.maxDuration > 0
+      ? setTimeout(() => controller.abort('timeout'), this.maxDuration)
+      : null;
+    let progress = 0;
+
+    try {
+      for (let i = 0; i < urls.length && !controller.signal.aborted && !this.isShuttingDown(); i += concurrency) {
+        const batch = urls.slice(i, i + concurrency);
+
+        const batchResults = await Promise.allSettled(
+          batch.map(url => this.scan(url, options, { fingerprints, signal: controller.signal }))
+        );
+        const duplicates = [];
+
+        batchResults.forEach((result, idx) => {
+          if (result.status === 'fulfilled' && result.value.duplicateOf) {
+            duplicates.push(result.value);
+          } else if (result.status === 'fulfilled') {
+            let value = options.wcagLevel ? filterByWcagLevel(result.value, options.wcagLevel) : result.value;
+            if (options.pipeline) {
+              value = applyPipeline(value, options.pipeline);
+            }
+            value = withClientMetadata(value, clientMetadata);
+            // Each page gets its own scan ID so consumers of published
+            // results can tell the pages of a batch apart
+            const scanId = `scan_${crypto.randomUUID()}`;
+            results.push({
+              url: batch[idx],
+              scanId,
+              ...value
+            });
+            this.onResult(batchId, scanId, value);
+          } else {
+            errors.push({
+              url: batch[idx],
+              error: result.reason.name !== 'AbortError'
+                ? result.reason.message
+                : controller.signal.reason === 'canceled'
+                  ? 'Bulk scan was canceled'
+                  : 'Bulk scan exceeded its maximum duration',
+              code: result.reason.code,
+              scheme: result.reason.scheme
+            });
+          }
+        });
+
+        // Link URLs that served identical content to the result that was scanned
+        duplicates.forEach(({ url, duplicateOf }) => {
+          const original = results.find(r => r.url === duplicateOf);
+          if (original) {
+            original.aliases = [...(original.aliases || []), url];
+          } else {
+            errors.push({
+              url,
+              error: `Content identical to ${duplicateOf}, which failed to scan`
+            });
+          }
+        });
+
+        // Update progress
+        progress = Math.min(i + concurrency, urls.length);
+        this.batches.set(batchId, {
+          status: 'processing',
+          progress,
+          total: urls.length,
+          results,
+          errors
+        });
+
+        logger.info({
+          batchId,
+          progress: `${progress}/${urls.length}`
+        }, 'Bulk scan progress');
+      }
+    } finally {
+      clearTimeout(deadlineTimer);
+      this.controllers.delete(batchId);
+    }
+
+    const totalTime = Date.now() - startTime;
+    const stopped = progress < urls.length || controller.signal.aborted;
+    let status = 'completed';
+    if (stopped) {
+      status = this.isShuttingDown() && !controller.signal.aborted
+        ? 'interrupted'
+        : controller.signal.reason === 'canceled' ? 'canceled' : 'timed_out';
+    }
+
+    const batchStatus = {
+      status,
+      progress,
+      total: urls.length,
+      results,
+      errors,
+      templateIssues: options.groupTemplateIssues ? groupTemplateViolations(results) : undefined,
+      totalTime,
+      averageTimePerScan: progress > 0 ? totalTime / progress : 0
+    };
+    this.batches.set(batchId, batchStatus);
+
+    logger.info({
+      batchId,
+      totalScans: results.length,
+      errors: errors.length,
+      totalTime,
+      status
+    }, `Bulk scan ${status.replace('_', ' ')}`);
+
+    this.onComplete(batchId, batchStatus);
+    return batchStatus;
+  }
+}
+
+module.exports = { BulkScanRunner };
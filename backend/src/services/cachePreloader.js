@@ -0,0 +1,107 @@
+/**
+ * Cache Preloader
+ *
+ * Periodically rescans a configured list of popular URLs in the background
+ * so their result cache entries stay warm and user requests are fast.
+ */
+
+const pino = require('pino');
+const config = require('../config');
+
+const logger = pino({
+  level: process.env.LOG_LEVEL || 'info'
+});
+
+class CachePreloader {
+  constructor(options = {}) {
+    this.urls = options.urls || config.cache.preloadUrls;
+    this.interval = options.interval || config.cache.preloadInterval;
+    this.concurrency = options.concurrency || config.cache.preloadConcurrency;
+    this.scan = options.scan;
+    this.cache = options.cache;
+    this.timer = null;
+    this.running = false;
+
+    this.metrics = {
+      runs: 0,
+      scans: 0,
+      failures: 0,
+      lastRunAt: null
+    };
+  }
+
+  /**
+   * Scan every configured URL once, bounded by the concurrency limit
+   */
+  async runOnce() {
+    if (this.running) {
+      logger.debug('Cache preload already in progress, skipping run');
+      return;
+    }
+
+    this.running = true;
+    this.metrics.runs++;
+    this.metrics.lastRunAt = new Date().toISOString();
+
+    try {
+      const queue = [...this.urls];
+      const workers = [];
+
+      for (let i = 0; i < Math.min(this.concurrency, queue.length); i++) {
+        workers.push((async () => {
+          while (queue.length > 0) {
+            const url = queue.shift();
+            try {
+              const result = await this.scan(url);
+              this.cache.setResult(this.cache.key('url', url, {}), result);
+              this.metrics.scans++;
+            } catch (error) {
+              this.metrics.failures++;
+              logger.warn({ url, error: error.message }, 'Cache preload scan failed');
+            }
+          }
+        })());
+      }
+
+      await Promise.all(workers);
+      logger.info({ urls: this.urls.length }, 'Cache preload completed');
+    } finally {
+      this.running = false;
+    }
+  }
+
+  start() {
+    if (this.timer || this.urls.length === 0 || !this.cache.enabled) {
+      return;
+    }
+
+    logger.info({
+      urls: this.urls.length,
+      interval: this.interval,
+      concurrency: this.concurrency
+    }, 'Starting cache preloader');
+
+    this.runOnce();
+    this.timer = setInterval(() => this.runOnce(), this.interval);
+    this.timer.unref();
+  }
+
+  stop() {
+    if (this.timer) {
+      clearInterval(this.timer);
+      this.timer = null;
+    }
+  }
+
+  getStats() {
+    return {
+      urls: this.urls.length,
+      interval: this.interval,
+      concurrency: this.concurrency,
+      running: this.running,
+      metrics: { ...this.metrics }
+    };
+  }
+}
+
+module.exports = { CachePreloader };
@@ -9,6 +9,10 @@
  * - OPEN: Service is failing, requests fail immediately with fallback
  * - HALF_OPEN: Testing if service has recovered
  *
+ * With a healthCheck option, an OPEN circuit probes the service every
+ * healthCheckInterval ms and closes as soon as a probe succeeds, instead of
+ * waiting for resetTimeout.
+ *
  * Use Cases:
  * - AI/ML service calls (OpenAI, Claude, etc.)
  * - External API integrations
@@ -37,6 +41,13 @@ class CircuitBreaker {
     this.successThreshold = options.successThreshold || 2;
     this.timeout = options.timeout || 60000; // 60 seconds
     this.resetTimeout = options.resetTimeout || 30000; // 30 seconds
+    // Async function resolving truthy when the service is healthy
+    this.healthCheck = options.healthCheck || null;
+    this.healthCheckInterval = options.healthCheckInterval || 5000; // 5 seconds
+    this.healthCheckTimer = null;
+    // Errors that say nothing about the service's health (e.g. our own
+    // queue timeouts) are passed through without counting as failures
+    this.isFailure = options.isFailure || (() => true);
 
     // Metrics
     this.metrics = {
@@ -45,6 +56,7 @@ class CircuitBreaker {
       totalFailures: 0,
       totalFallbacks: 0,
       totalRejections: 0,
+      totalProbes: 0,
       stateChanges: 0
     };
 
@@ -87,7 +99,10 @@ class CircuitBreaker {
           return await fallback();
         }
 
-        throw new Error(`Circuit breaker "${this.name}" is OPEN. Service is unavailable.`);
+        const error = new Error(`Circuit breaker "${this.name}" is OPEN. Service is unavailable.`);
+        error.circuitOpen = true;
+        error.retryAfter = Math.max(0, this.lastStateChange + this.resetTimeout - Date.now());
+        throw error;
       }
     }
 
@@ -97,6 +112,9 @@ class CircuitBreaker {
       this.onSuccess();
       return result;
     } catch (error) {
+      if (!this.isFailure(error)) {
+        throw error;
+      }
       this.onFailure(error);
 
       if (fallback) {
@@ -117,12 +135,22 @@ class CircuitBreaker {
    * Execute function with timeout
    */
   async executeWithTimeout(fn) {
-    return Promise.race([
-      fn(),
-      new Promise((_, reject) =>
-        setTimeout(() => reject(new Error('Request timeout')), this.timeout)
-      )
-    ]);
+    let timer;
+    try {
+      return await Promise.race([
+        fn(),
+        new Promise((_, reject) => {
+          timer = setTimeout(() => {
+            const error = new Error('Request timeout');
+            // fn keeps running; callers can clean up what it yields late
+            error.breakerTimeout = true;
+            reject(error);
+          }, this.timeout);
+        })
+      ]);
+    } finally {
+      clearTimeout(timer);
+    }
   }
 
   /**
@@ -176,6 +204,42 @@ class CircuitBreaker {
     return Date.now() - this.lastStateChange >= this.resetTimeout;
   }
 
+  /**
+   * Probe the service's health while the circuit is open
+   */
+  startHealthChecks() {
+    if (!this.healthCheck || this.healthCheckTimer) return;
+
+    let probing = false;
+    this.healthCheckTimer = setInterval(async () => {
+      if (probing) return;
+      probing = true;
+      this.metrics.totalProbes++;
+
+      try {
+        const healthy = await this.executeWithTimeout(this.healthCheck);
+        if (healthy && this.state !== 'CLOSED') {
+          logger.info({ circuitBreaker: this.name }, 'Health check succeeded, closing circuit');
+          this.transitionTo('CLOSED');
+        }
+      } catch (error) {
+        logger.debug({ circuitBreaker: this.name, error: error.message }, 'Health check failed');
+      } finally {
+        probing = false;
+      }
+    }, this.healthCheckInterval);
+
+    // Never keep the process alive just for health checks
+    if (this.healthCheckTimer.unref) {
+      this.healthCheckTimer.unref();
+    }
+  }
+
+  stopHealthChecks() {
+    clearInterval(this.healthCheckTimer);
+    this.healthCheckTimer = null;
+  }
+
   /**
    * Transition to a new state
    */
@@ -192,6 +256,12 @@ class CircuitBreaker {
       this.successes = 0;
     }
 
+    if (newState === 'OPEN') {
+      this.startHealthChecks();
+    } else {
+      this.stopHealthChecks();
+    }
+
     logger.info({
       circuitBreaker: this.name,
       oldState,
@@ -200,7 +270,7 @@ class CircuitBreaker {
       successes: this.successes
     }, 'Circuit breaker state changed');
 
-    this.emit(newState.toLowerCase().replace('_', ''));
+    this.emit({ CLOSED: 'close', OPEN: 'open', HALF_OPEN: 'halfOpen' }[newState]);
   }
 
   /**
@@ -234,7 +304,8 @@ class CircuitBreaker {
         failureThreshold: this.failureThreshold,
         successThreshold: this.successThreshold,
         timeout: this.timeout,
-        resetTimeout: this.resetTimeout
+        resetTimeout: this.resetTimeout,
+        healthCheckInterval: this.healthCheck ? this.healthCheckInterval : null
       }
     };
   }
@@ -263,6 +334,7 @@ class CircuitBreaker {
       totalFailures: 0,
       totalFallbacks: 0,
       totalRejections: 0,
+      totalProbes: 0,
       stateChanges: this.metrics.stateChanges
     };
   }
@@ -0,0 +1,175 @@
+/**
+ * Custom Checks
+ *
+ * Named accessibility checks maintained by the operator, run after axe when
+ * a scan lists them in options.customChecks. Clients can only reference
+ * registered checks by name; they can't send code to run.
+ *
+ * Checks are registered with registerCheck(), or loaded at startup from the
+ * .js files in CUSTOM_CHECKS_DIR (the file name is the check name):
+ *
+ *   module.exports = {
+ *     description: 'Ensures external links warn that they open a new tab',
+ *     help: 'Links opening a new tab must say so',
+ *     helpUrl: 'https://intranet.example.com/a11y/new-tab-links',
+ *     impact: 'moderate',
+ *     tags: ['wcag2a', 'wcag322'],
+ *     // Runs in the page (may be async); returns the failing elements, or
+ *     // { element, message } for each
+ *     run: () => [...document.querySelectorAll('a[target="_blank"]')]
+ *       .filter(link => !/new (tab|window)/i.test(link.textContent))
+ *   };
+ *
+ * Results are reported like axe rules with the id "custom/<name>": a
+ * violation when elements fail, a pass when none do, and incomplete when
+ * the check throws.
+ */
+
+const fs = require('fs');
+const path = require('path');
+const pino = require('pino');
+const config = require('../config');
+
+const logger = pino({
+  level: process.env.LOG_LEVEL || 'info'
+});
+
+const CHECK_NAME_PATTERN = /^[a-z0-9][a-z0-9-]*$/;
+const IMPACTS = ['minor', 'moderate', 'serious', 'critical'];
+const MAX_NODE_HTML = 500;
+
+const checks = new Map();
+
+// Source of a run function as an expression; method shorthand ("run() {}")
+// isn't one on its own, while async arrows ("async () => ...") are
+function functionSource(run) {
+  const source = run.toString();
+  return /^(async\s+)?(?!(function|async)\b)[\w$]+\s*\(/.test(source)
+    ? source.replace(/^(async\s+)?/, '$1function ')
+    : source;
+}
+
+/**
+ * Register a named check: { description, help, helpUrl, impact, tags, run }
+ */
+function registerCheck(name, definition) {
+  if (!CHECK_NAME_PATTERN.test(name)) {
+    throw new Error(`Invalid custom check name: ${name}`);
+  }
+  if (typeof definition.run !== 'function') {
+    throw new Error(`Custom check ${name} has no run function`);
+  }
+  if (definition.impact && !IMPACTS.includes(definition.impact)) {
+    throw new Error(`Custom check ${name} has an invalid impact: ${definition.impact}`);
+  }
+
+  checks.set(name, {
+    description: definition.description || name,
+    help: definition.help || definition.description || name,
+    helpUrl: definition.helpUrl || null,
+    impact: definition.impact || 'moderate',
+    tags: ['custom', ...(definition.tags || [])],
+    source: functionSource(definition.run)
+  });
+}
+
+function hasCheck(name) {
+  return checks.has(name);
+}
+
+function checkNames() {
+  return [...checks.keys()];
+}
+
+function loadChecks(dir) {
+  fs.readdirSync(dir)
+    .filter(file => file.endsWith('.js'))
+    .forEach(file => {
+      registerCheck(path.basename(file, '.js'), require(path.resolve(dir, file)));
+    });
+  logger.info({ dir, checks: checkNames() }, 'Loaded custom checks');
+}
+
+// Runs in the page: call the check and describe the failing elements the
+// way axe describes nodes
+const PAGE_RUNNER = `(async check => {
+  const cssPath = element => {
+    const parts = [];
+    for (let node = element; node && node.nodeType === 1; node = node.parentElement) {
+      if (node.id) {
+        parts.unshift('#' + CSS.escape(node.id));
+        break;
+      }
+      const siblings = node.parentElement
+        ? [...node.parentElement.children].filter(sibling => sibling.tagName === node.tagName)
+        : [];
+      const tag = node.tagName.toLowerCase();
+      parts.unshift(siblings.length > 1 ? tag + ':nth-of-type(' + (siblings.indexOf(node) + 1) + ')' : tag);
+    }
+    return parts.join(' > ');
+  };
+
+  const found = await check();
+  return [...(found || [])].map(item => {
+    const element = item instanceof Element ? item : item.element;
+    return {
+      html: element.outerHTML.slice(0, ${MAX_NODE_HTML}),
+      target: [cssPath(element)],
+      message: item instanceof Element ? null : item.message || null
+    };
+  });
+})`;
+
+/**
+ * Run the named checks on a loaded page, adding their results to the axe
+ * results
+ */
+async function runCustomChecks(page, names, axeResults) {
+  for (const name of names) {
+    const check = checks.get(name);
+    const rule = {
+      id: `custom/${name}`,
+      description: check.description,
+      help: check.help,
+      helpUrl: check.helpUrl,
+      tags: check.tags
+    };
+
+    let failures;
+    try {
+      failures = await page.evaluate(`${PAGE_RUNNER}(${check.source})`);
+    } catch (error) {
+      logger.warn({ check: name, error: error.message }, 'Custom check failed');
+      axeResults.incomplete.push({ ...rule, impact: check.impact, nodes: [] });
+      continue;
+    }
+
+    if (failures.length === 0) {
+      axeResults.passes.push({ ...rule, nodes: [] });
+      continue;
+    }
+
+    axeResults.violations.push({
+      ...rule,
+      impact: check.impact,
+      nodes: failures.map(failure => ({
+        html: failure.html,
+        target: failure.target,
+        failureSummary: failure.message || check.help,
+        impact: check.impact
+      }))
+    });
+  }
+}
+
+if (config.customChecks.dir) {
+  loadChecks(config.customChecks.dir);
+}
+
+module.exports = {
+  registerCheck,
+  hasCheck,
+  checkNames,
+  loadChecks,
+  runCustomChecks
+};
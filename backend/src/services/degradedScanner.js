@@ -0,0 +1,246 @@
+/**
+ * Degraded-Mode HTML Scanner
+ *
+ * Checks a small subset of WCAG rules on raw HTML without a browser, so
+ * scans still return useful results while the browser pool is unavailable.
+ * Only static markup is seen: no scripts run, no styles apply, and ARIA
+ * relationships aren't resolved, so results are marked degraded.
+ *
+ * Rules: image-alt, html-has-lang, document-title, heading-order
+ */
+
+const ENGINE = { name: 'wcagai-degraded', version: '1.0.0' };
+
+const RULES = {
+  'image-alt': {
+    impact: 'critical',
+    description: 'Ensures <img> elements have alternate text or a role of none or presentation',
+    help: 'Images must have alternate text',
+    tags: ['cat.text-alternatives', 'wcag2a', 'wcag111']
+  },
+  'html-has-lang': {
+    impact: 'serious',
+    description: 'Ensures every HTML document has a lang attribute',
+    help: '<html> element must have a lang attribute',
+    tags: ['cat.language', 'wcag2a', 'wcag311']
+  },
+  'document-title': {
+    impact: 'serious',
+    description: 'Ensures each HTML document contains a non-empty <title> element',
+    help: 'Documents must have <title> element to aid in navigation',
+    tags: ['cat.text-alternatives', 'wcag2a', 'wcag242']
+  },
+  'heading-order': {
+    impact: 'moderate',
+    description: 'Ensures the order of headings is semantically correct',
+    help: 'Heading levels should only increase by one',
+    tags: ['cat.semantics', 'best-practice']
+  }
+};
+
+const TAG_PATTERN = /<(img|html|h[1-6])\b((?:[^>"']|"[^"]*"|'[^']*')*)>/gi;
+const ATTRIBUTE_PATTERN = /([^\s=/>]+)(?:\s*=\s*(?:"([^"]*)"|'([^']*)'|([^\s>]+)))?/g;
+
+function parseAttributes(source) {
+  const attributes = {};
+  for (const match of source.matchAll(ATTRIBUTE_PATTERN)) {
+    attributes[match[1].toLowerCase()] = match[2] ?? match[3] ?? match[4] ?? '';
+  }
+  return attributes;
+}
+
+function stripComments(html) {
+  return html.replace(/<!--[\s\S]*?-->/g, '');
+}
+
+function helpUrl(ruleId) {
+  return `https://dequeuniversity.com/rules/axe/4.8/${ruleId}`;
+}
+
+function node(html, target, failureSummary, impact) {
+  return { html: html.slice(0, 250), target: [target], failureSummary, impact };
+}
+
+/**
+ * Run the degraded rule subset against an HTML string
+ *
+ * @returns {Object} Result in the shape of a full scan result
+ */
+function scanHtmlDegraded(html, url = '[HTML Content]', metadata = {}) {
+  const startTime = Date.now();
+  const source = stripComments(html);
+  const failures = Object.fromEntries(Object.keys(RULES).map(id => [id, []]));
+  const applicable = new Set(['html-has-lang', 'document-title']);
+
+  const tags = [...source.matchAll(TAG_PATTERN)].map(match => ({
+    html: match[0],
+    name: match[1].toLowerCase(),
+    attributes: parseAttributes(match[2])
+  }));
+
+  // Without a DOM, targets are approximated by each tag's position among
+  // tags of the same name
+  const counts = {};
+  let previousLevel = 0;
+  let htmlTag = null;
+
+  for (const tag of tags) {
+    counts[tag.name] = (counts[tag.name] || 0) + 1;
+
+    if (tag.name === 'img') {
+      applicable.add('image-alt');
+      const role = (tag.attributes.role || '').toLowerCase();
+      const hasName = 'alt' in tag.attributes ||
+        tag.attributes['aria-label'] || tag.attributes['aria-labelledby'] ||
+        role === 'none' || role === 'presentation';
+      if (!hasName) {
+        failures['image-alt'].push(node(
+          tag.html,
+          `img:nth-of-type(${counts.img})`,
+          'Fix any of the following:\n  Element does not have an alt attribute',
+          RULES['image-alt'].impact
+        ));
+      }
+    } else if (tag.name === 'html') {
+      htmlTag = htmlTag || tag;
+    } else {
+      applicable.add('heading-order');
+      const level = parseInt(tag.name[1]);
+      if (previousLevel > 0 && level > previousLevel + 1) {
+        failures['heading-order'].push(node(
+          tag.html,
+          `${tag.name}:nth-of-type(${counts[tag.name]})`,
+          `Fix any of the following:\n  Heading order invalid (h${previousLevel} followed by h${level})`,
+          RULES['heading-order'].impact
+        ));
+      }
+      previousLevel = level;
+    }
+  }
+
+  if (!htmlTag || !(htmlTag.attributes.lang || htmlTag.attributes['xml:lang'] || '').trim()) {
+    failures['html-has-lang'].push(node(
+      htmlTag ? htmlTag.html : '<html>',
+      'html',
+      'Fix any of the following:\n  The <html> element does not have a lang attribute',
+      RULES['html-has-lang'].impact
+    ));
+  }
+
+  const title = source.match(/<title\b[^>]*>([\s\S]*?)<\/title>/i);
+  if (!title || !title[1].trim()) {
+    failures['document-title'].push(node(
+      title ? title[0] : '<html>',
+      title ? 'title' : 'html',
+      'Fix any of the following:\n  Document does not have a non-empty <title> element',
+      RULES['document-title'].impact
+    ));
+  }
+
+  const violations = [];
+  const passes = [];
+  for (const [id, rule] of Object.entries(RULES)) {
+    if (failures[id].length > 0) {
+      violations.push({
+        id,
+        impact: rule.impact,
+        description: rule.description,
+        help: rule.help,
+        helpUrl: helpUrl(id),
+        tags: rule.tags,
+        nodes: failures[id]
+      });
+    } else if (applicable.has(id)) {
+      passes.push({ id, description: rule.description, help: rule.help, tags: rule.tags, nodes: 1 });
+    }
+  }
+
+  const totalChecks = violations.length + passes.length;
+  const countImpact = impact => violations.filter(v => v.impact === impact).length;
+
+  return {
+    url,
+    timestamp: new Date().toISOString(),
+    scanTime: Date.now() - startTime,
+    summary: {
+      violations: violations.length,
+      passes: passes.length,
+      incomplete: 0,
+      complianceScore: totalChecks > 0 ? parseFloat(((passes.length / totalChecks) * 100).toFixed(2)) : 100,
+      violationsBySeverity: {
+        critical: countImpact('critical'),
+        serious: countImpact('serious'),
+        moderate: countImpact('moderate'),
+        minor: countImpact('minor')
+      }
+    },
+    violations,
+    passes,
+    incomplete: [],
+    testEngine: ENGINE,
+    testRunner: { name: 'wcagai' },
+    testEnvironment: {},
+    metadata: {
+      ...metadata,
+      degraded: true,
+      rulesChecked: Object.keys(RULES)
+    }
+  };
+}
+
+/**
+ * Fetch a page's HTML without a browser, the way the browser would have
+ * loaded it: options.method/body/contentType and options.acceptHeader are
+ * sent. Redirects are not followed, since their targets haven't passed SSRF
+ * validation. Pages over maxBytes fail rather than being read into memory.
+ */
+async function fetchHtml(url, { timeout, maxBytes, method = 'GET', body, contentType, acceptHeader } = {}) {
+  const headers = { 'User-Agent': 'WCAGAI-Scanner (degraded mode)' };
+  if (acceptHeader) {
+    headers.Accept = acceptHeader;
+  }
+  if (method === 'POST') {
+    headers['Content-Type'] = contentType || 'application/x-www-form-urlencoded';
+  }
+
+  const response = await fetch(url, {
+    method,
+    body: method === 'POST' ? body || '' : undefined,
+    redirect: 'manual',
+    signal: AbortSignal.timeout(timeout),
+    headers
+  });
+
+  if (!response.ok) {
+    await response.body?.cancel();
+    throw new Error(`Degraded scan fetch failed with HTTP ${response.status}`);
+  }
+
+  const declared = parseInt(response.headers.get('content-length'));
+  if (declared > maxBytes) {
+    await response.body.cancel();
+    throw new Error(`Degraded scan fetch exceeded ${maxBytes} bytes`);
+  }
+
+  // Content-Length may be missing or wrong; count what actually arrives
+  const chunks = [];
+  let size = 0;
+  const reader = response.body.getReader();
+  for (;;) {
+    const { done, value } = await reader.read();
+    if (done) break;
+    size += value.length;
+    if (size > maxBytes) {
+      await reader.cancel();
+      throw new Error(`Degraded scan fetch exceeded ${maxBytes} bytes`);
+    }
+    chunks.push(value);
+  }
+  return Buffer.concat(chunks).toString('utf8');
+}
+
+module.exports = {
+  DEGRADED_RULES: Object.keys(RULES),
+  scanHtmlDegraded,
+  fetchHtml
+};
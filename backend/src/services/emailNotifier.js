@@ -0,0 +1,138 @@
+/**
+ * Scan Summary Emails
+ *
+ * Emails a summary of completed scans and bulk scans to EMAIL_TO, for
+ * scheduled audits. By default only scans over the violation threshold
+ * (more than EMAIL_VIOLATION_THRESHOLD violations on a page) are reported;
+ * EMAIL_NOTIFY=all reports every scan. Sending never blocks or fails a
+ * scan; delivery errors are logged.
+ */
+
+const pino = require('pino');
+const config = require('../config');
+const { SmtpClient } = require('./smtpClient');
+
+const logger = pino({
+  level: process.env.LOG_LEVEL || 'info'
+});
+
+// Pages listed in a bulk scan email, worst first
+const MAX_LISTED_PAGES = 50;
+
+class EmailNotifier {
+  constructor(options = {}) {
+    const smtpUrl = options.smtpUrl !== undefined ? options.smtpUrl : config.email.smtpUrl;
+    this.client = options.client || (smtpUrl ? new SmtpClient(smtpUrl) : null);
+    this.from = options.from || config.email.from;
+    this.to = options.to || config.email.to;
+    this.notify = options.notify || config.email.notify;
+    this.violationThreshold = options.violationThreshold !== undefined
+      ? options.violationThreshold
+      : config.email.violationThreshold;
+    this.metrics = {
+      sent: 0,
+      failed: 0
+    };
+  }
+
+  get enabled() {
+    return this.client !== null && this.to.length > 0;
+  }
+
+  isBreach(summary) {
+    return summary.violations > this.violationThreshold;
+  }
+
+  /**
+   * Email a single scan's summary, if it breached the threshold or every
+   * scan is reported
+   */
+  notifyScan(scanId, result) {
+    if (!this.enabled) return;
+
+    const breach = this.isBreach(result.summary);
+    if (!breach && this.notify !== 'all') return;
+
+    const { summary } = result;
+    const severity = summary.violationsBySeverity || {};
+    const text = [
+      `Accessibility scan of ${result.url} completed at ${result.timestamp}.`,
+      '',
+      `Violations: ${summary.violations}` +
+        ` (critical ${severity.critical || 0}, serious ${severity.serious || 0},` +
+        ` moderate ${severity.moderate || 0}, minor ${severity.minor || 0})`,
+      `Passes: ${summary.passes}`,
+      `Needs review: ${summary.incomplete}`,
+      `Compliance score: ${summary.complianceScore}%`,
+      '',
+      breach ? `Threshold of ${this.violationThreshold} violations exceeded.` : null,
+      ...(result.violations || []).map(violation =>
+        `- ${violation.help} (${violation.id}, ${violation.impact}, ${violation.nodes.length} elements)`
+      ),
+      '',
+      `Scan ID: ${scanId}`
+    ].filter(line => line !== null);
+
+    this.send(scanId, {
+      subject: `${breach ? '[Threshold exceeded] ' : ''}Accessibility scan: ${summary.violations} violations on ${result.url}`,
+      text: text.join('\n')
+    });
+  }
+
+  /**
+   * Email a finished bulk scan's summary, if any page breached the
+   * threshold or every scan is reported
+   */
+  notifyBulk(batchId, batch) {
+    if (!this.enabled) return;
+
+    const breaches = batch.results
+      .filter(page => this.isBreach(page.summary))
+      .sort((a, b) => b.summary.violations - a.summary.violations);
+    if (breaches.length === 0 && this.notify !== 'all') return;
+
+    const totalViolations = batch.results.reduce((sum, page) => sum + page.summary.violations, 0);
+    const listed = (breaches.length > 0 ? breaches : batch.results).slice(0, MAX_LISTED_PAGES);
+    const text = [
+      `Bulk accessibility scan ${batchId} ${batch.status.replace(/_/g, ' ')}.`,
+      '',
+      `Pages scanned: ${batch.results.length}`,
+      `Pages failed: ${batch.errors.length}`,
+      `Total violations: ${totalViolations}`,
+      `Pages over the threshold of ${this.violationThreshold} violations: ${breaches.length}`,
+      '',
+      ...listed.map(page =>
+        `- ${page.url}: ${page.summary.violations} violations, score ${page.summary.complianceScore}%`
+      ),
+      listed.length < (breaches.length || batch.results.length) ? '- ...' : null,
+      ...batch.errors.map(error => `- ${error.url}: failed (${error.error})`)
+    ].filter(line => line !== null);
+
+    this.send(batchId, {
+      subject: `${breaches.length > 0 ? '[Threshold exceeded] ' : ''}Bulk accessibility scan: ` +
+        `${breaches.length} of ${batch.results.length} pages over threshold`,
+      text: text.join('\n')
+    });
+  }
+
+  send(id, message) {
+    Promise.resolve()
+      .then(() => this.client.send({ from: this.from, to: this.to, ...message }))
+      .then(() => {
+        this.metrics.sent++;
+        logger.info({ id, recipients: this.to.length }, 'Scan summary email sent');
+      })
+      .catch(error => {
+        this.metrics.failed++;
+        logger.warn({ id, error: error.message }, 'Failed to send scan summary email');
+      });
+  }
+}
+
+// Singleton instance
+const emailNotifier = new EmailNotifier();
+
+module.exports = {
+  EmailNotifier,
+  emailNotifier
+};
@@ -0,0 +1,76 @@
+/**
+ * Request Hedging
+ *
+ * Cuts tail latency by starting a duplicate attempt when the first one is
+ * slower than a delay, using whichever finishes first and aborting the
+ * other. Only use it for idempotent work: both attempts may run to the end.
+ *
+ * A first attempt failing before the hedge starts fails immediately
+ * (retries are the caller's concern); once both run, the result is only a
+ * failure if both fail.
+ */
+
+/**
+ * @param {Function} run - (signal, attempt) => Promise; attempt is 0 or 1
+ * @param {Object} options
+ * @param {number} options.delay - ms before starting the hedge
+ * @param {AbortSignal} [options.signal] - aborts both attempts
+ * @param {Function} [options.shouldHedge] - checked when the delay expires
+ * @returns {Promise<{result, attempt: number}>}
+ */
+function hedge(run, { delay, signal, shouldHedge = () => true }) {
+  return new Promise((resolve, reject) => {
+    const controllers = [];
+    let settled = false;
+    let hedged = false;
+    let failures = 0;
+    let timer = null;
+
+    const abortOthers = winner => controllers.forEach(c => c !== winner && c.abort());
+    const onAbort = () => abortOthers(null);
+    if (signal) {
+      signal.addEventListener('abort', onAbort, { once: true });
+    }
+
+    const finish = () => {
+      settled = true;
+      clearTimeout(timer);
+      if (signal) {
+        signal.removeEventListener('abort', onAbort);
+      }
+    };
+
+    const launch = attempt => {
+      const controller = new AbortController();
+      controllers.push(controller);
+      if (signal && signal.aborted) {
+        controller.abort();
+      }
+
+      Promise.resolve()
+        .then(() => run(controller.signal, attempt))
+        .then(result => {
+          if (settled) return;
+          finish();
+          abortOthers(controller);
+          resolve({ result, attempt });
+        }, error => {
+          failures++;
+          if (settled) return;
+          if (!hedged || failures === 2) {
+            finish();
+            reject(error);
+          }
+        });
+    };
+
+    launch(0);
+    timer = setTimeout(() => {
+      if (settled || !shouldHedge()) return;
+      hedged = true;
+      launch(1);
+    }, delay);
+  });
+}
+
+module.exports = { hedge };
@@ -0,0 +1,138 @@
+/**
+ * HTML Input Encoding Detection
+ *
+ * HTML submitted as raw bytes (options.inputEncoding = "base64") may be in
+ * any charset. Assuming UTF-8 corrupts non-UTF-8 content and skews
+ * text-based rules, so the charset is detected and the bytes are transcoded
+ * to a UTF-8 string before rendering.
+ *
+ * Detection order (as in the HTML spec's encoding sniffing):
+ * 1. Byte order mark
+ * 2. Charset declared by the client (options.charset)
+ * 3. UTF-16 without a BOM, from the NUL bytes of its ASCII markup
+ * 4. <meta charset> / <meta http-equiv="Content-Type"> in the first 1024 bytes
+ * 5. UTF-8 if the bytes are valid UTF-8, otherwise windows-1252
+ *
+ * UTF-16 sniffing relies on the markup being mostly ASCII; UTF-16 documents
+ * that are mostly non-Latin text need a BOM or options.charset.
+ */
+
+const BOMS = [
+  { bytes: [0xef, 0xbb, 0xbf], charset: 'utf-8' },
+  { bytes: [0xfe, 0xff], charset: 'utf-16be' },
+  { bytes: [0xff, 0xfe], charset: 'utf-16le' }
+];
+
+const META_CHARSET_PATTERN = /<meta[^>]+charset\s*=\s*["']?\s*([a-zA-Z0-9_.:-]+)/i;
+
+function sniffBom(buffer) {
+  const bom = BOMS.find(({ bytes }) => bytes.every((byte, i) => buffer[i] === byte));
+  return bom ? { charset: bom.charset, length: bom.bytes.length } : null;
+}
+
+// In UTF-16, ASCII characters have a NUL high byte: the second byte of each
+// pair in little-endian, the first in big-endian. 8-bit charsets never
+// contain NUL bytes in HTML.
+function sniffUtf16(buffer) {
+  const sample = buffer.subarray(0, 1024);
+  const pairs = Math.floor(sample.length / 2);
+  let even = 0;
+  let odd = 0;
+
+  for (let i = 0; i < pairs * 2; i++) {
+    if (sample[i] === 0) {
+      if (i % 2 === 0) even++;
+      else odd++;
+    }
+  }
+
+  if (pairs === 0) return null;
+  if (odd >= pairs / 2 && even < odd / 4) return 'utf-16le';
+  if (even >= pairs / 2 && odd < even / 4) return 'utf-16be';
+  return null;
+}
+
+function sniffMetaCharset(buffer) {
+  const head = buffer.subarray(0, 1024).toString('latin1');
+  const match = head.match(META_CHARSET_PATTERN);
+  return match ? match[1].toLowerCase() : null;
+}
+
+function isSupportedCharset(charset) {
+  try {
+    new TextDecoder(charset);
+    return true;
+  } catch (error) {
+    return false;
+  }
+}
+
+function isValidUtf8(buffer) {
+  try {
+    new TextDecoder('utf-8', { fatal: true }).decode(buffer);
+    return true;
+  } catch (error) {
+    return false;
+  }
+}
+
+/**
+ * Detect the charset of raw HTML bytes
+ *
+ * @returns {{charset: string, detectedBy: string, bomLength: number}}
+ */
+function detectCharset(buffer, declaredCharset = null) {
+  const bom = sniffBom(buffer);
+  if (bom) {
+    return { charset: bom.charset, detectedBy: 'bom', bomLength: bom.length };
+  }
+
+  if (declaredCharset) {
+    if (!isSupportedCharset(declaredCharset)) {
+      throw new Error(`Unsupported charset: ${declaredCharset}`);
+    }
+    return { charset: declaredCharset.toLowerCase(), detectedBy: 'declared', bomLength: 0 };
+  }
+
+  const utf16 = sniffUtf16(buffer);
+  if (utf16) {
+    return { charset: utf16, detectedBy: 'sniffed', bomLength: 0 };
+  }
+
+  const metaCharset = sniffMetaCharset(buffer);
+  if (metaCharset && isSupportedCharset(metaCharset)) {
+    return { charset: metaCharset, detectedBy: 'meta', bomLength: 0 };
+  }
+
+  return isValidUtf8(buffer)
+    ? { charset: 'utf-8', detectedBy: 'default', bomLength: 0 }
+    : { charset: 'windows-1252', detectedBy: 'sniffed', bomLength: 0 };
+}
+
+/**
+ * Decode raw HTML bytes to a string
+ *
+ * @returns {{html: string, charset: string, detectedBy: string}}
+ */
+function decodeHtml(buffer, declaredCharset = null) {
+  const { charset, detectedBy, bomLength } = detectCharset(buffer, declaredCharset);
+  const html = new TextDecoder(charset).decode(buffer.subarray(bomLength));
+  return { html, charset, detectedBy };
+}
+
+/**
+ * Resolve the HTML string for a scan request from its input and options
+ */
+function decodeHtmlInput(input, options = {}) {
+  if (options.inputEncoding !== 'base64') {
+    // Already a decoded string, just drop a stray BOM
+    return { html: input.replace(/^\uFEFF/, ''), charset: 'utf-8', detectedBy: 'string' };
+  }
+  return decodeHtml(Buffer.from(input, 'base64'), options.charset);
+}
+
+module.exports = {
+  detectCharset,
+  decodeHtml,
+  decodeHtmlInput
+};
@@ -0,0 +1,68 @@
+/**
+ * Streaming JSON Response Writer
+ *
+ * Writes a response object incrementally instead of serializing it into one
+ * buffer first, so clients can start parsing large scan results (megabytes
+ * of violation nodes) while the rest is still being sent. Top-level arrays
+ * are written one element at a time; the assembled output is identical to
+ * JSON.stringify(body).
+ */
+
+// Elements serialized between flushes
+const CHUNK_SIZE = 50;
+
+function write(res, chunk) {
+  return new Promise((resolve, reject) => {
+    if (res.destroyed) {
+      return reject(new Error('Response closed while streaming'));
+    }
+    if (res.write(chunk)) {
+      return resolve();
+    }
+    res.once('drain', resolve);
+  });
+}
+
+function flush(res) {
+  // Set by the compression middleware, which otherwise buffers output
+  if (typeof res.flush === 'function') {
+    res.flush();
+  }
+}
+
+/**
+ * Stream an object as a JSON response
+ */
+async function streamJson(res, body) {
+  res.type('application/json');
+
+  const entries = Object.entries(body).filter(([, value]) => value !== undefined);
+  await write(res, '{');
+
+  for (let i = 0; i < entries.length; i++) {
+    const [key, value] = entries[i];
+    let out = `${i > 0 ? ',' : ''}${JSON.stringify(key)}:`;
+
+    if (!Array.isArray(value)) {
+      await write(res, out + JSON.stringify(value));
+      continue;
+    }
+
+    out += '[';
+    for (let j = 0; j < value.length; j++) {
+      // JSON.stringify writes null for undefined array elements
+      out += (j > 0 ? ',' : '') + (JSON.stringify(value[j]) ?? 'null');
+      if ((j + 1) % CHUNK_SIZE === 0) {
+        await write(res, out);
+        flush(res);
+        out = '';
+      }
+    }
+    await write(res, out + ']');
+    flush(res);
+  }
+
+  res.end('}');
+}
+
+module.exports = { streamJson };
@@ -9,17 +9,69 @@ const promClient = require('prom-client');
 // Create a Registry
 const register = new promClient.Registry();
 
+// OpenMetrics Registry, served to scrapers that ask for OpenMetrics. It
+// exposes the same metrics plus exemplars linking observations to traces.
+const openMetricsRegister = new promClient.Registry(promClient.openMetricsContentType);
+
 // Add default metrics (CPU, memory, etc.)
 promClient.collectDefaultMetrics({ register });
 
+// Label Cardinality Protection
+//
+// Every distinct label value creates a new time series, so labels must only
+// take values from bounded sets. Unknown values are aggregated into "other".
+
+const OTHER_LABEL = 'other';
+
+// Allowed values per label name, as a list or a pattern
+const ALLOWED_LABEL_VALUES = {
+  type: ['url', 'html'],
+  // Scan outcomes and HTTP status codes
+  status: /^(success|error|canceled|timeout|[1-5]\d\d)$/,
+  method: ['GET', 'POST', 'PUT', 'PATCH', 'DELETE', 'OPTIONS', 'HEAD'],
+  severity: ['critical', 'serious', 'moderate', 'minor']
+};
+
+function isAllowedLabelValue(name, value) {
+  const allowed = ALLOWED_LABEL_VALUES[name];
+  if (!allowed) return true;
+  if (allowed instanceof RegExp) return allowed.test(String(value));
+  return allowed.includes(value);
+}
+
+/**
+ * Map label values outside their allowed set to "other"
+ */
+function sanitizeLabels(labels) {
+  const sanitized = {};
+  for (const [name, value] of Object.entries(labels)) {
+    sanitized[name] = isAllowedLabelValue(name, value) ? value : OTHER_LABEL;
+  }
+  return sanitized;
+}
+
+/**
+ * Route label for a request: the matched route template (e.g.
+ * /api/scan/bulk/:batchId) rather than the raw path, or "other" when no
+ * route matched
+ */
+function routeLabel(req) {
+  if (!req.route) {
+    return OTHER_LABEL;
+  }
+  return `${req.baseUrl || ''}${req.route.path}`;
+}
+
 // Custom Metrics
 
-// Scan Duration Histogram
+// Scan Duration Histogram (with trace ID exemplars)
 const scanDuration = new promClient.Histogram({
   name: 'wcagai_scan_duration_seconds',
   help: 'Duration of accessibility scans in seconds',
   labelNames: ['type', 'status'],
-  buckets: [0.5, 1, 2, 5, 10, 30, 60]
+  buckets: [0.5, 1, 2, 5, 10, 30, 60],
+  enableExemplars: true,
+  registers: [openMetricsRegister]
 });
 register.registerMetric(scanDuration);
 
@@ -47,6 +99,16 @@ const browserPoolGauge = new promClient.Gauge({
 });
 register.registerMetric(browserPoolGauge);
 
+// Time scans wait for a browser: 0 when one is free, otherwise until the
+// queued request is served or times out
+const browserAcquireWait = new promClient.Histogram({
+  name: 'wcagai_browser_acquire_wait_seconds',
+  help: 'Time spent waiting to acquire a browser from the pool in seconds',
+  labelNames: ['priority'],
+  buckets: [0.01, 0.05, 0.1, 0.5, 1, 2, 5, 10, 30]
+});
+register.registerMetric(browserAcquireWait);
+
 // Circuit Breaker Gauge
 const circuitBreakerGauge = new promClient.Gauge({
   name: 'wcagai_circuit_breaker_state',
@@ -72,6 +134,43 @@ const errorCounter = new promClient.Counter({
 });
 register.registerMetric(errorCounter);
 
+// Scan requests rejected by the per-client rate limit
+const rateLimitedCounter = new promClient.Counter({
+  name: 'wcagai_rate_limited_total',
+  help: 'Total number of scan requests rejected by the rate limit'
+});
+register.registerMetric(rateLimitedCounter);
+
+// Scans that used up SCAN_TIMEOUT_WARN_FRACTION of their timeout
+const scanTimeoutWarningCounter = new promClient.Counter({
+  name: 'wcagai_scan_timeout_warnings_total',
+  help: 'Total number of scans that approached their timeout'
+});
+register.registerMetric(scanTimeoutWarningCounter);
+
+// Scans in progress (single, batch, bulk and cache preload)
+const activeScansGauge = new promClient.Gauge({
+  name: 'wcagai_active_scans',
+  help: 'Number of scans in progress'
+});
+register.registerMetric(activeScansGauge);
+
+// Result Cache Lookups (hit, stale, miss, or error when Redis is unavailable)
+const cacheCounter = new promClient.Counter({
+  name: 'wcagai_cache_total',
+  help: 'Total number of result cache lookups',
+  labelNames: ['result']
+});
+register.registerMetric(cacheCounter);
+
+// Stored reports removed by the retention janitor (age) or entry cap (count)
+const reportsPrunedCounter = new promClient.Counter({
+  name: 'wcagai_reports_pruned_total',
+  help: 'Total number of stored scan reports pruned',
+  labelNames: ['reason']
+});
+register.registerMetric(reportsPrunedCounter);
+
 // Update browser pool metrics
 function updateBrowserPoolMetrics(stats) {
   browserPoolGauge.set({ status: 'available' }, stats.poolSize);
@@ -85,22 +184,55 @@ function updateCircuitBreakerMetrics(name, state) {
   circuitBreakerGauge.set({ name }, stateValue);
 }
 
-// Metrics endpoint handler
+// Record a scan duration, linking the observation to its trace
+function observeScanDuration(labels, seconds, traceId) {
+  scanDuration.observe({
+    labels: sanitizeLabels(labels),
+    value: seconds,
+    // OpenMetrics limits exemplar label sets to 128 characters
+    exemplarLabels: traceId ? { traceId: String(traceId).slice(0, 64) } : {}
+  });
+}
+
+// Mirror every metric into the OpenMetrics registry (keep this after all
+// metric definitions)
+register.getMetricsAsArray().forEach(metric => {
+  if (!openMetricsRegister.getSingleMetric(metric.name)) {
+    openMetricsRegister.registerMetric(metric);
+  }
+});
+
+// Metrics endpoint handler: OpenMetrics when the scraper accepts it,
+// Prometheus text format otherwise
 async function metricsHandler(req, res) {
-  res.setHeader('Content-Type', register.contentType);
-  res.send(await register.metrics());
+  const registry = req.accepts(['text/plain', 'application/openmetrics-text']) === 'application/openmetrics-text'
+    ? openMetricsRegister
+    : register;
+
+  res.setHeader('Content-Type', registry.contentType);
+  res.send(await registry.metrics());
 }
 
 module.exports = {
   register,
+  openMetricsRegister,
+  sanitizeLabels,
+  routeLabel,
   scanDuration,
   scanCounter,
   violationsGauge,
   browserPoolGauge,
+  browserAcquireWait,
   circuitBreakerGauge,
   httpRequestDuration,
   errorCounter,
+  rateLimitedCounter,
+  activeScansGauge,
+  scanTimeoutWarningCounter,
+  cacheCounter,
+  reportsPrunedCounter,
   updateBrowserPoolMetrics,
   updateCircuitBreakerMetrics,
+  observeScanDuration,
   metricsHandler
 };
@@ -0,0 +1,67 @@
+/**
+ * MessagePack Encoding
+ *
+ * Compact binary encoding of scan responses for high-throughput clients
+ * (Accept: application/msgpack), with @msgpack/msgpack. Values are encoded
+ * with JSON semantics, so a MessagePack response decodes to the same
+ * document as the JSON one: undefined values and functions are omitted,
+ * and objects with toJSON() (e.g. Dates) are encoded via that method.
+ * Buffers (e.g. screenshots) are encoded as binary rather than through
+ * their toJSON().
+ */
+
+const msgpack = require('@msgpack/msgpack');
+
+const CONTENT_TYPE = 'application/msgpack';
+
+// The value JSON.stringify() would write, keeping Buffers as binary
+function jsonValue(value) {
+  if (Buffer.isBuffer(value)) {
+    return value;
+  }
+  if (value !== null && typeof value === 'object' && typeof value.toJSON === 'function') {
+    value = value.toJSON();
+  }
+
+  if (Array.isArray(value)) {
+    return value.map(item => {
+      const encoded = jsonValue(item);
+      return encoded === undefined ? null : encoded;
+    });
+  }
+  if (value !== null && typeof value === 'object') {
+    const object = {};
+    for (const [key, item] of Object.entries(value)) {
+      const encoded = jsonValue(item);
+      if (encoded !== undefined) {
+        object[key] = encoded;
+      }
+    }
+    return object;
+  }
+  if (typeof value === 'function' || typeof value === 'symbol') {
+    return undefined;
+  }
+  if (typeof value === 'number' && !Number.isFinite(value)) {
+    return null;
+  }
+  return value;
+}
+
+/**
+ * Encode value as MessagePack, in a Buffer ready to send
+ */
+function encode(value) {
+  const encoded = msgpack.encode(jsonValue(value));
+  return Buffer.from(encoded.buffer, encoded.byteOffset, encoded.byteLength);
+}
+
+function decode(buf) {
+  return msgpack.decode(buf);
+}
+
+module.exports = {
+  CONTENT_TYPE,
+  encode,
+  decode
+};
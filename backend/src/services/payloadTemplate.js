@@ -0,0 +1,83 @@
+/**
+ * Payload Templates
+ *
+ * Shapes outgoing messages (result queue / webhook payloads) for receivers
+ * expecting a different format. A template is a JSON document whose string
+ * values may reference fields of the data with {{path.to.field}}:
+ *
+ *   {
+ *     "text": "{{url}} has {{summary.violations}} accessibility violations",
+ *     "count": "{{summary.violations}}",
+ *     "rules": "{{violations}}"
+ *   }
+ *
+ * A string that is a single placeholder is replaced by the referenced value
+ * itself (number, object, array); placeholders within longer strings are
+ * interpolated as text. Missing fields render as null / an empty string.
+ */
+
+const fs = require('fs');
+
+const PLACEHOLDER = /\{\{\s*([\w.]+)\s*\}\}/g;
+const SINGLE_PLACEHOLDER = /^\{\{\s*([\w.]+)\s*\}\}$/;
+
+function lookup(data, path) {
+  return path.split('.').reduce(
+    (value, key) => (value === null || value === undefined ? undefined : value[key]),
+    data
+  );
+}
+
+function renderText(template, data) {
+  return template.replace(PLACEHOLDER, (match, path) => {
+    const value = lookup(data, path);
+    if (value === null || value === undefined) return '';
+    return typeof value === 'object' ? JSON.stringify(value) : String(value);
+  });
+}
+
+function renderValue(template, data) {
+  if (typeof template === 'string') {
+    const single = template.match(SINGLE_PLACEHOLDER);
+    if (single) {
+      const value = lookup(data, single[1]);
+      return value === undefined ? null : value;
+    }
+    return renderText(template, data);
+  }
+
+  if (Array.isArray(template)) {
+    return template.map(item => renderValue(item, data));
+  }
+
+  if (template && typeof template === 'object') {
+    return Object.fromEntries(
+      Object.entries(template).map(([key, value]) => [key, renderValue(value, data)])
+    );
+  }
+
+  return template;
+}
+
+/**
+ * Compile a JSON template into a function rendering it for the given data
+ */
+function compileTemplate(source) {
+  let template;
+  try {
+    template = JSON.parse(source);
+  } catch (error) {
+    throw new Error(`Invalid payload template: ${error.message}`);
+  }
+  return data => renderValue(template, data);
+}
+
+function loadTemplate(path) {
+  return compileTemplate(fs.readFileSync(path, 'utf8'));
+}
+
+module.exports = {
+  compileTemplate,
+  loadTemplate,
+  renderValue
+};
@@ -0,0 +1,75 @@
+/**
+ * Report Bundle
+ *
+ * Packages a stored scan report (see reportStore.js) as a zip archive for
+ * GET /api/report/:scanId/bundle: the full results, the scan's metadata
+ * and any captured artifacts. The zip is built with archiver, which
+ * deflates each file as a stream, so the download starts immediately and
+ * compressing large screenshots doesn't block the event loop.
+ *
+ * Options that can carry secrets (storage values such as auth tokens, POST
+ * bodies and host overrides) are written to metadata.json as "[redacted]".
+ */
+
+const archiver = require('archiver');
+
+const SECRET_OPTIONS = ['localStorage', 'sessionStorage', 'body', 'hostOverrides'];
+
+// Scan options with secret-bearing values replaced
+function redactOptions(options = {}) {
+  const redacted = { ...options };
+  SECRET_OPTIONS
+    .filter(option => redacted[option] !== undefined)
+    .forEach(option => { redacted[option] = '[redacted]'; });
+  return redacted;
+}
+
+/**
+ * Files of a report's bundle, as [{ name, data }]
+ */
+function bundleFiles(scanId, report) {
+  const { result, artifacts } = report;
+  const files = [
+    { name: 'results.json', data: JSON.stringify(result, null, 2) },
+    {
+      name: 'metadata.json',
+      data: JSON.stringify({
+        scanId,
+        correlationId: report.correlationId,
+        type: report.type,
+        url: result.url,
+        timestamp: result.timestamp,
+        scanTime: report.scanTime,
+        options: redactOptions(report.options),
+        summary: result.summary,
+        testEngine: result.testEngine,
+        testEnvironment: result.testEnvironment,
+        metadata: result.metadata
+      }, null, 2)
+    }
+  ];
+  if (artifacts && artifacts.screenshot) {
+    files.push({ name: 'screenshot.png', data: artifacts.screenshot });
+  }
+  if (artifacts && artifacts.html) {
+    files.push({ name: 'rendered.html', data: artifacts.html });
+  }
+  return files;
+}
+
+/**
+ * Stream a report's bundle as a zip, dated with the scan's timestamp
+ */
+function createBundleStream(scanId, report) {
+  const archive = archiver('zip');
+  const date = new Date(report.result.timestamp);
+  bundleFiles(scanId, report).forEach(({ name, data }) => archive.append(data, { name, date }));
+  archive.finalize();
+  return archive;
+}
+
+module.exports = {
+  redactOptions,
+  bundleFiles,
+  createBundleStream
+};
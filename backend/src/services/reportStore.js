@@ -0,0 +1,177 @@
+/**
+ * Scan Report Store
+ *
+ * Keeps recent single-scan reports in memory by scanId so they can be
+ * retrieved after the scan response was sent (e.g. as a download bundle).
+ * Reports are kept for REPORT_RETENTION ms, at most REPORT_STORE_MAX_ENTRIES
+ * of them; the oldest are evicted first.
+ *
+ * Screenshots dominate memory use, so at most REPORT_MAX_SCREENSHOTS are
+ * kept; beyond that the least recently used report loses its screenshot.
+ *
+ * A background janitor prunes expired reports every REPORT_PRUNE_INTERVAL
+ * ms, so their artifacts are released even if nobody asks for them again.
+ * Pruned reports are counted in wcagai_reports_pruned_total by reason (age
+ * or count).
+ */
+
+const pino = require('pino');
+const config = require('../config');
+const { reportsPrunedCounter } = require('./metrics');
+
+const logger = pino({
+  level: process.env.LOG_LEVEL || 'info'
+});
+
+class ReportStore {
+  constructor(options = {}) {
+    this.retention = options.retention || config.reports.retention;
+    this.maxEntries = options.maxEntries || config.reports.maxEntries;
+    this.maxScreenshots = options.maxScreenshots !== undefined
+      ? options.maxScreenshots
+      : config.reports.maxScreenshots;
+    this.pruneInterval = options.pruneInterval !== undefined
+      ? options.pruneInterval
+      : config.reports.pruneInterval;
+    this.reports = new Map();
+    this.timer = null;
+    // scanIds of reports holding a screenshot, least recently used first
+    this.screenshots = new Set();
+    this.metrics = {
+      screenshotsEvicted: 0,
+      expired: 0,
+      evicted: 0
+    };
+  }
+
+  /**
+   * Store a report: { scanId, correlationId, type, owner, options, result, artifacts }.
+   * owner identifies the submitting client for isOwner().
+   */
+  save(scanId, report) {
+    this.delete(scanId);
+    this.reports.set(scanId, {
+      ...report,
+      artifacts: { ...report.artifacts },
+      scanId,
+      storedAt: Date.now()
+    });
+
+    let evicted = 0;
+    while (this.reports.size > this.maxEntries) {
+      const oldestId = this.reports.keys().next().value;
+      this.delete(oldestId);
+      evicted++;
+    }
+    if (evicted > 0) {
+      this.metrics.evicted += evicted;
+      reportsPrunedCounter.inc({ reason: 'count' }, evicted);
+    }
+
+    // After evicting whole reports, whose screenshots go with them
+    if (report.artifacts && report.artifacts.screenshot) {
+      this.screenshots.add(scanId);
+      this.evictScreenshots();
+    }
+  }
+
+  /**
+   * Remove reports past the retention window
+   *
+   * @returns {number} Number of reports pruned
+   */
+  prune(now = Date.now()) {
+    let pruned = 0;
+    // Reports are kept in insertion order (save() re-inserts), so the
+    // expired ones are all at the front
+    for (const [scanId, report] of this.reports) {
+      if (report.storedAt + this.retention > now) break;
+      this.delete(scanId);
+      pruned++;
+    }
+
+    if (pruned > 0) {
+      this.metrics.expired += pruned;
+      reportsPrunedCounter.inc({ reason: 'age' }, pruned);
+      logger.debug({ pruned, remaining: this.reports.size }, 'Pruned expired reports');
+    }
+    return pruned;
+  }
+
+  // Run prune() in the background (REPORT_PRUNE_INTERVAL=0 disables it)
+  startJanitor() {
+    if (this.timer || !(this.pruneInterval > 0)) {
+      return;
+    }
+
+    this.timer = setInterval(() => this.prune(), this.pruneInterval);
+    this.timer.unref();
+  }
+
+  stopJanitor() {
+    if (this.timer) {
+      clearInterval(this.timer);
+      this.timer = null;
+    }
+  }
+
+  // Drop screenshots of the least recently used reports beyond the cap
+  evictScreenshots() {
+    while (this.screenshots.size > this.maxScreenshots) {
+      const scanId = this.screenshots.values().next().value;
+      this.screenshots.delete(scanId);
+      delete this.reports.get(scanId).artifacts.screenshot;
+      this.metrics.screenshotsEvicted++;
+    }
+  }
+
+  get(scanId) {
+    const report = this.reports.get(scanId);
+    if (!report) return null;
+
+    if (report.storedAt + this.retention <= Date.now()) {
+      this.delete(scanId);
+      this.metrics.expired++;
+      reportsPrunedCounter.inc({ reason: 'age' });
+      return null;
+    }
+
+    // Mark the screenshot as recently used
+    if (this.screenshots.delete(scanId)) {
+      this.screenshots.add(scanId);
+    }
+
+    return report;
+  }
+
+  /**
+   * Whether client submitted the scan; reports saved without an owner
+   * belong to everyone
+   */
+  isOwner(scanId, client) {
+    const report = this.reports.get(scanId);
+    return Boolean(report) && (report.owner === undefined || report.owner === client);
+  }
+
+  delete(scanId) {
+    this.screenshots.delete(scanId);
+    return this.reports.delete(scanId);
+  }
+
+  getStats() {
+    return {
+      size: this.reports.size,
+      maxEntries: this.maxEntries,
+      retention: this.retention,
+      screenshots: this.screenshots.size,
+      maxScreenshots: this.maxScreenshots,
+      pruneInterval: this.pruneInterval,
+      metrics: { ...this.metrics }
+    };
+  }
+}
+
+// Singleton instance
+const reportStore = new ReportStore();
+
+module.exports = { ReportStore, reportStore };
@@ -0,0 +1,75 @@
+/**
+ * Response Schema Versioning
+ *
+ * Clients pick a response schema with the Accept-Version header ("1", "v1",
+ * "2", ...); without it they get the latest. Older versions are derived
+ * from the same internal result so integrations built against them keep
+ * working as the response evolves.
+ *
+ * - v1: the original scan response, without fields added since
+ * - v2: adds metadata and the optional report sections (standards, wcag22,
+ *   comparison)
+ */
+
+const { ERROR_CODES } = require('../errorCodes');
+
+const LATEST_VERSION = 2;
+const SUPPORTED_VERSIONS = [1, 2];
+
+// Top-level fields introduced after v1
+const V2_FIELDS = ['metadata', 'standards', 'wcag22', 'comparison'];
+
+/**
+ * Parse the requested version; null when it isn't supported
+ */
+function negotiateVersion(header) {
+  if (header === undefined || header === '') {
+    return LATEST_VERSION;
+  }
+
+  const match = String(header).trim().match(/^v?(\d+)$/i);
+  const version = match ? parseInt(match[1]) : null;
+  return SUPPORTED_VERSIONS.includes(version) ? version : null;
+}
+
+/**
+ * Shape a scan response body for the given version
+ */
+function formatForVersion(body, version) {
+  if (version >= 2) {
+    return body;
+  }
+
+  const legacy = { ...body };
+  V2_FIELDS.forEach(field => delete legacy[field]);
+  return legacy;
+}
+
+/**
+ * Middleware rejecting unsupported versions with 406; the negotiated
+ * version is exposed as req.apiVersion and echoed in API-Version
+ */
+function apiVersion(req, res, next) {
+  const version = negotiateVersion(req.get('accept-version'));
+
+  if (version === null) {
+    return res.status(406).json({
+      error: 'Not Acceptable',
+      message: `Unsupported Accept-Version: ${req.get('accept-version')}`,
+      supportedVersions: SUPPORTED_VERSIONS,
+      code: ERROR_CODES.UNSUPPORTED_VERSION
+    });
+  }
+
+  req.apiVersion = version;
+  res.setHeader('API-Version', String(version));
+  next();
+}
+
+module.exports = {
+  LATEST_VERSION,
+  SUPPORTED_VERSIONS,
+  negotiateVersion,
+  formatForVersion,
+  apiVersion
+};
@@ -0,0 +1,258 @@
+/**
+ * Scan Result Cache
+ *
+ * TTL cache for scan results so repeated scans of the same input are served
+ * without launching a browser page. Entries are kept in memory, or in Redis
+ * when REDIS_URL is set so they are shared across instances and restarts.
+ *
+ * Entries are keyed on a SHA-256 of type + input + options. The cache is
+ * disabled when RESULT_CACHE_TTL is 0 (the default). Failed scans are cached
+ * separately for RESULT_CACHE_ERROR_TTL, also 0 by default.
+ *
+ * With RESULT_CACHE_STALE_WINDOW, results are kept that much longer past
+ * their TTL and served stale while a background rescan refreshes them
+ * (stale-while-revalidate), so repeat scans stay fast without serving
+ * results older than TTL + stale window.
+ */
+
+const crypto = require('crypto');
+const pino = require('pino');
+const config = require('../config');
+const { canonicalizeUrl } = require('./urlCanonicalizer');
+const { RedisClient } = require('./redisClient');
+const { cacheCounter } = require('./metrics');
+const { ERROR_CODES } = require('../errorCodes');
+
+const logger = pino({
+  level: process.env.LOG_LEVEL || 'info'
+});
+
+// Options that change what a scan finds. Cache control, report, artifact
+// and scheduling options, and keys the schema doesn't know, leave the
+// result alone and are not part of the cache key.
+const SCAN_KEY_OPTIONS = [
+  'viewport', 'waitUntil', 'maxLoadWait', 'inputEncoding', 'charset',
+  'dismissConsent', 'consentSelectors', 'hostOverrides', 'localStorage', 'sessionStorage',
+  'captureConsole', 'mixedContent', 'blockResources', 'accessibilityTree', 'geolocation',
+  'timezone', 'mockDate', 'reducedMotion', 'forcedColors', 'xpath',
+  'runOnly', 'disableRules', 'customChecks', 'referrer', 'acceptHeader',
+  'method', 'body', 'contentType'
+];
+
+class ResultCache {
+  constructor(options = {}) {
+    this.ttl = options.ttl !== undefined ? options.ttl : config.cache.ttl;
+    this.maxEntries = options.maxEntries || config.cache.maxEntries;
+    this.minTtl = options.minTtl || config.cache.minTtl;
+    this.maxTtl = options.maxTtl || config.cache.maxTtl;
+    this.errorTtl = options.errorTtl !== undefined ? options.errorTtl : config.cache.errorTtl;
+    this.staleWindow = options.staleWindow !== undefined ? options.staleWindow : config.cache.staleWindow;
+    this.entries = new Map();
+    // Keys with a background refresh in progress
+    this.revalidating = new Set();
+
+    const redisUrl = options.redisUrl !== undefined ? options.redisUrl : config.cache.redisUrl;
+    this.redis = redisUrl ? new RedisClient(redisUrl, { commandTimeout: config.cache.redisTimeout }) : null;
+    this.redisPrefix = options.redisPrefix || config.cache.redisPrefix;
+  }
+
+  get enabled() {
+    return this.ttl > 0;
+  }
+
+  /**
+   * Build the cache key for a scan request from its input and the options
+   * in SCAN_KEY_OPTIONS. URLs are canonicalized so equivalent URLs share an
+   * entry.
+   */
+  key(type, input, options = {}) {
+    const scanOptions = {};
+    for (const name of SCAN_KEY_OPTIONS) {
+      if (options[name] !== undefined) {
+        scanOptions[name] = options[name];
+      }
+    }
+    const keyInput = type === 'url' ? canonicalizeUrl(input) : input;
+    return crypto
+      .createHash('sha256')
+      .update(JSON.stringify([type, keyInput, scanOptions]))
+      .digest('hex');
+  }
+
+  /**
+   * TTL for a result, honoring a per-request override clamped to bounds
+   */
+  effectiveTtl(requestedTtl) {
+    if (requestedTtl === undefined || requestedTtl === null) {
+      return this.ttl;
+    }
+    return Math.min(Math.max(requestedTtl, this.minTtl), this.maxTtl);
+  }
+
+  /**
+   * Cached value for key, or null. Redis errors are logged and treated as a
+   * miss, so an unavailable Redis never fails a scan.
+   */
+  async get(key) {
+    if (!this.enabled) return null;
+
+    const value = this.redis ? await this.getFromRedis(key) : this.getFromMemory(key);
+    // undefined: the lookup failed, already counted as an error
+    if (value === undefined) return null;
+
+    cacheCounter.inc({ result: value === null ? 'miss' : this.isStale(value) ? 'stale' : 'hit' });
+    return value;
+  }
+
+  getFromMemory(key) {
+    const entry = this.entries.get(key);
+    if (!entry) {
+      return null;
+    }
+
+    if (entry.expiresAt <= Date.now()) {
+      this.entries.delete(key);
+      return null;
+    }
+
+    return entry.value;
+  }
+
+  async getFromRedis(key) {
+    try {
+      const stored = await this.redis.command('GET', this.redisPrefix + key);
+      return stored === null ? null : JSON.parse(stored);
+    } catch (error) {
+      cacheCounter.inc({ result: 'error' });
+      logger.warn({ error: error.message }, 'Redis cache read failed');
+      return undefined;
+    }
+  }
+
+  /**
+   * Whether a cached result is past its TTL, kept only for the stale window
+   */
+  isStale(value) {
+    const expiresAt = value.metadata && value.metadata.cacheExpiresAt;
+    return this.staleWindow > 0 && Boolean(expiresAt) && Date.parse(expiresAt) <= Date.now();
+  }
+
+  /**
+   * Refresh a stale result in the background with scan(), at most once per
+   * key at a time on this instance. A failed refresh is logged and leaves
+   * the stale result to expire at the end of the stale window.
+   */
+  revalidate(key, scan, requestedTtl) {
+    if (this.revalidating.has(key)) return;
+    this.revalidating.add(key);
+
+    scan()
+      .then(result => {
+        if (!result.metadata.degraded) {
+          this.setResult(key, result, requestedTtl);
+        }
+      })
+      .catch(error => {
+        logger.warn({ error: error.message }, 'Background cache refresh failed');
+      })
+      .finally(() => {
+        this.revalidating.delete(key);
+      });
+  }
+
+  async set(key, value, ttl = this.ttl) {
+    if (!this.enabled) return;
+
+    if (this.redis) {
+      try {
+        await this.redis.command('SET', this.redisPrefix + key, JSON.stringify(value), 'PX', ttl);
+      } catch (error) {
+        cacheCounter.inc({ result: 'error' });
+        logger.warn({ error: error.message }, 'Redis cache write failed');
+      }
+      return;
+    }
+
+    // Re-insert so Map order tracks recency of writes
+    this.entries.delete(key);
+    this.entries.set(key, {
+      value,
+      expiresAt: Date.now() + ttl
+    });
+
+    // Evict oldest entries beyond the size bound
+    while (this.entries.size > this.maxEntries) {
+      const oldestKey = this.entries.keys().next().value;
+      this.entries.delete(oldestKey);
+    }
+  }
+
+  /**
+   * Cache a scan result for its effective TTL. The expiry is recorded in
+   * metadata.cacheExpiresAt, on the cached copy and on the returned result,
+   * so clients know how long it stays valid. The entry itself is kept for
+   * the stale window beyond that.
+   */
+  setResult(key, result, requestedTtl) {
+    if (!this.enabled) return result;
+
+    const ttl = this.effectiveTtl(requestedTtl);
+    const cached = {
+      ...result,
+      metadata: { ...result.metadata, cacheExpiresAt: new Date(Date.now() + ttl).toISOString() }
+    };
+    this.set(key, cached, ttl + this.staleWindow).catch(error => {
+      logger.warn({ error: error.message }, 'Result cache write failed');
+    });
+    return cached;
+  }
+
+  /**
+   * Cache a failed scan for errorTtl, so repeat requests for an unreachable
+   * target fail fast without holding the failure long enough to mask
+   * recovery. Cancellations and our own browser outages and overload say
+   * nothing about the target and aren't cached, and neither are timeouts:
+   * the deadline is the caller's own options.timeout, which isn't part of
+   * the key.
+   */
+  async setError(key, error) {
+    if (this.errorTtl <= 0 || error.name === 'AbortError' || error.browserUnavailable ||
+      [ERROR_CODES.OVERLOADED, ERROR_CODES.SCAN_TIMEOUT].includes(error.code)) return;
+
+    const { message, code, scheme, realm, timeout } = error;
+    await this.set(key, { error: { message, code, scheme, realm, timeout } }, this.errorTtl);
+  }
+
+  async delete(key) {
+    this.entries.delete(key);
+    if (this.redis) {
+      await this.redis.command('DEL', this.redisPrefix + key).catch(error => {
+        logger.warn({ error: error.message }, 'Redis cache delete failed');
+      });
+    }
+  }
+
+  clear() {
+    this.entries.clear();
+  }
+
+  getStats() {
+    return {
+      enabled: this.enabled,
+      store: this.redis ? 'redis' : 'memory',
+      size: this.entries.size,
+      maxEntries: this.maxEntries,
+      ttl: this.ttl,
+      minTtl: this.minTtl,
+      maxTtl: this.maxTtl,
+      errorTtl: this.errorTtl,
+      staleWindow: this.staleWindow,
+      revalidating: this.revalidating.size
+    };
+  }
+}
+
+// Singleton instance
+const resultCache = new ResultCache();
+
+module.exports = { ResultCache, resultCache };
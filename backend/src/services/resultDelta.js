@@ -0,0 +1,130 @@
+/**
+ * Delta-Encoded Scan Results
+ *
+ * Polling clients that rescan the same page can ask for only what changed
+ * since a result they already hold. Every full /api/scan JSON response is
+ * identified by the SHA-256 of its body (X-Result-Hash) and remembered, the
+ * newest DELTA_MAX_BASELINES of them. A request passing ?deltaFrom=<hash>
+ * of a remembered response gets an RFC 6902 JSON Patch turning that
+ * response into the new one; otherwise it gets the full response.
+ *
+ * Patches only use add, remove and replace. Arrays are compared by index,
+ * so a rule inserted near the start of violations shows up as replacements
+ * of the rules after it; the patch is still correct, just less compact.
+ */
+
+const crypto = require('crypto');
+const config = require('../config');
+
+/**
+ * Escape an object key as a JSON Pointer reference token (RFC 6901)
+ */
+function escapeToken(key) {
+  return String(key).replace(/~/g, '~0').replace(/\//g, '~1');
+}
+
+function isObject(value) {
+  return value !== null && typeof value === 'object' && !Array.isArray(value);
+}
+
+/**
+ * Append to ops the operations turning `from` into `to` at path. Both are
+ * plain JSON values (no undefined, functions or class instances).
+ */
+function diffValues(from, to, path, ops) {
+  if (from === to) return;
+
+  if (Array.isArray(from) && Array.isArray(to)) {
+    const common = Math.min(from.length, to.length);
+    for (let i = 0; i < common; i++) {
+      diffValues(from[i], to[i], `${path}/${i}`, ops);
+    }
+    for (let i = common; i < to.length; i++) {
+      ops.push({ op: 'add', path: `${path}/${i}`, value: to[i] });
+    }
+    // Remove from the end so earlier indexes stay valid
+    for (let i = from.length - 1; i >= common; i--) {
+      ops.push({ op: 'remove', path: `${path}/${i}` });
+    }
+    return;
+  }
+
+  if (isObject(from) && isObject(to)) {
+    Object.keys(from).forEach(key => {
+      const keyPath = `${path}/${escapeToken(key)}`;
+      if (!Object.prototype.hasOwnProperty.call(to, key)) {
+        ops.push({ op: 'remove', path: keyPath });
+      } else {
+        diffValues(from[key], to[key], keyPath, ops);
+      }
+    });
+    Object.keys(to).forEach(key => {
+      if (!Object.prototype.hasOwnProperty.call(from, key)) {
+        ops.push({ op: 'add', path: `${path}/${escapeToken(key)}`, value: to[key] });
+      }
+    });
+    return;
+  }
+
+  ops.push({ op: 'replace', path, value: to });
+}
+
+/**
+ * RFC 6902 JSON Patch turning one JSON document into another
+ */
+function jsonPatch(from, to) {
+  const ops = [];
+  diffValues(from, to, '', ops);
+  return ops;
+}
+
+class ResultDelta {
+  constructor(options = {}) {
+    this.maxBaselines = options.maxBaselines !== undefined
+      ? options.maxBaselines
+      : config.delta.maxBaselines;
+    // hash -> serialized response body, oldest first
+    this.baselines = new Map();
+  }
+
+  /**
+   * Remember a response body as a future baseline; returns its hash
+   */
+  remember(body) {
+    const serialized = JSON.stringify(body);
+    const hash = crypto.createHash('sha256').update(serialized).digest('hex');
+
+    if (this.maxBaselines > 0) {
+      this.baselines.delete(hash);
+      this.baselines.set(hash, serialized);
+      while (this.baselines.size > this.maxBaselines) {
+        this.baselines.delete(this.baselines.keys().next().value);
+      }
+    }
+    return hash;
+  }
+
+  /**
+   * Patch from the baseline with the given hash to body, or null when that
+   * baseline isn't remembered
+   */
+  patchFrom(hash, body) {
+    const baseline = this.baselines.get(hash);
+    if (baseline === undefined) {
+      return null;
+    }
+    return jsonPatch(JSON.parse(baseline), JSON.parse(JSON.stringify(body)));
+  }
+
+  getStats() {
+    return {
+      baselines: this.baselines.size,
+      maxBaselines: this.maxBaselines
+    };
+  }
+}
+
+// Singleton instance
+const resultDelta = new ResultDelta();
+
+module.exports = { ResultDelta, resultDelta, jsonPatch };
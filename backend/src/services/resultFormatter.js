@@ -0,0 +1,531 @@
+/**
+ * Scan Result Formatters
+ *
+ * Alternative output shapes for scan results, selected per request
+ */
+
+const config = require('../config');
+
+const POSITIONAL_PSEUDO_PATTERN = /:nth-(child|of-type|last-child|last-of-type)\([^)]*\)/g;
+
+/**
+ * Make an axe selector stable across scans: start it at the last element
+ * with an ID or a stable data attribute, and drop positional pseudo-classes
+ * (nth-child indices shift as content changes) wherever the element is
+ * otherwise identified.
+ */
+function normalizeSelector(selector, stableAttributes = config.selectorStableAttributes) {
+  const compounds = selector.split(/\s+/).filter(Boolean);
+  const isAnchor = compound => /#[^\s.#:[]/.test(compound) ||
+    stableAttributes.some(attribute => compound.includes(`[${attribute}=`));
+
+  let start = 0;
+  compounds.forEach((compound, i) => {
+    if (isAnchor(compound)) start = i;
+  });
+
+  return compounds
+    .slice(start)
+    .map(compound => {
+      const stripped = compound.replace(POSITIONAL_PSEUDO_PATTERN, '');
+      return stripped || compound;
+    })
+    .join(' ');
+}
+
+/**
+ * Build a single CSS selector string from an axe node target.
+ * Targets inside iframes/shadow DOM are arrays of selectors; we join them
+ * so each node is addressable with one string.
+ */
+function nodeSelector(node, { normalize = false } = {}) {
+  const selectors = Array.isArray(node.target) ? node.target.flat() : [node.target || ''];
+  return selectors
+    .map(selector => (normalize ? normalizeSelector(selector) : selector))
+    .join(' ');
+}
+
+/**
+ * Flatten violations into one record per affected node
+ */
+function flattenViolationNodes(violations = [], { normalizeSelectors = false } = {}) {
+  const records = [];
+
+  for (const violation of violations) {
+    for (const node of violation.nodes || []) {
+      records.push({
+        ruleId: violation.id,
+        impact: node.impact || violation.impact,
+        selector: nodeSelector(node, { normalize: normalizeSelectors }),
+        xpath: Array.isArray(node.xpath) ? node.xpath.flat().join(' ') : node.xpath,
+        html: node.html,
+        helpUrl: violation.helpUrl
+      });
+    }
+  }
+
+  return records;
+}
+
+/**
+ * Group violations repeated across the pages of a batch by rule and
+ * normalized selector. Issues on two or more pages usually come from a
+ * shared template and can be fixed once.
+ */
+function groupTemplateViolations(results = []) {
+  const groups = new Map();
+
+  for (const result of results) {
+    for (const violation of result.violations || []) {
+      for (const node of violation.nodes || []) {
+        const selector = nodeSelector(node, { normalize: true });
+        const key = `${violation.id}\u0000${selector}`;
+
+        if (!groups.has(key)) {
+          groups.set(key, {
+            ruleId: violation.id,
+            impact: node.impact || violation.impact,
+            help: violation.help,
+            helpUrl: violation.helpUrl,
+            selector,
+            pages: new Set()
+          });
+        }
+        groups.get(key).pages.add(result.url);
+      }
+    }
+  }
+
+  return [...groups.values()]
+    .filter(group => group.pages.size >= 2)
+    .map(group => ({ ...group, pages: [...group.pages], pageCount: group.pages.size }))
+    .sort((a, b) => b.pageCount - a.pageCount);
+}
+
+// Ticket priority (Jira's default scheme) for each axe impact
+const IMPACT_PRIORITY = {
+  critical: 'Highest',
+  serious: 'High',
+  moderate: 'Medium',
+  minor: 'Low'
+};
+
+// Affected elements listed in a ticket description before truncating
+const MAX_TICKET_SELECTORS = 25;
+
+/**
+ * One ticket-ready record per violation: title, description with help URL
+ * and affected selectors, and a priority derived from impact
+ */
+function violationTickets(result) {
+  return (result.violations || []).map(violation => {
+    const selectors = (violation.nodes || []).map(node => nodeSelector(node));
+    const listed = selectors.slice(0, MAX_TICKET_SELECTORS);
+    const wcagTags = (violation.tags || []).filter(tag => /^wcag\d/.test(tag));
+
+    const description = [
+      violation.description,
+      '',
+      `Page: ${result.url}`,
+      `Rule: ${violation.id} (${violation.impact || 'unknown'} impact)`,
+      wcagTags.length > 0 ? `WCAG: ${wcagTags.join(', ')}` : null,
+      `How to fix: ${violation.helpUrl}`,
+      '',
+      `Affected elements (${selectors.length}):`,
+      ...listed.map(selector => `* {{${selector}}}`),
+      selectors.length > listed.length ? `* ...and ${selectors.length - listed.length} more` : null
+    ].filter(line => line !== null).join('\n');
+
+    return {
+      title: `[Accessibility] ${violation.help} (${selectors.length} element${selectors.length === 1 ? '' : 's'})`,
+      description,
+      priority: IMPACT_PRIORITY[violation.impact] || 'Medium',
+      labels: ['accessibility', `axe-${violation.id}`, ...wcagTags],
+      ruleId: violation.id,
+      impact: violation.impact,
+      helpUrl: violation.helpUrl,
+      selectors
+    };
+  });
+}
+
+const CSV_COLUMNS = ['ruleId', 'impact', 'description', 'helpUrl', 'targetSelector'];
+
+// RFC 4180 field: quoted when it contains a comma, quote or line break,
+// with quotes doubled. Values a spreadsheet would read as a formula (page
+// content ends up in descriptions and selectors) are prefixed with ', per
+// the OWASP CSV injection guidance.
+function csvField(value) {
+  let text = value === null || value === undefined ? '' : String(value);
+  if (/^[=+\-@\t\r]/.test(text)) {
+    text = `'${text}`;
+  }
+  return /[",\r\n]/.test(text) ? `"${text.replace(/"/g, '""')}"` : text;
+}
+
+/**
+ * CSV of a scan's violations for spreadsheets: a header row, then one row
+ * per affected element
+ */
+function violationsCsv(result) {
+  const rows = (result.violations || []).flatMap(violation =>
+    (violation.nodes || []).map(node => [
+      violation.id,
+      violation.impact,
+      violation.description,
+      violation.helpUrl,
+      nodeSelector(node)
+    ])
+  );
+  return [CSV_COLUMNS, ...rows]
+    .map(row => row.map(csvField).join(','))
+    .join('\r\n') + '\r\n';
+}
+
+// result.url of HTML scans, which have no page URL
+const HTML_CONTENT_URL = '[HTML Content]';
+
+// SARIF result level by axe impact
+const IMPACT_LEVEL = {
+  critical: 'error',
+  serious: 'error',
+  moderate: 'warning',
+  minor: 'note'
+};
+
+/**
+ * SARIF 2.1.0 log of a scan's violations, for code scanning tools (e.g.
+ * GitHub code scanning). Each axe rule becomes a reporting rule, and each
+ * affected element a result located at the page URL, with its selector as
+ * logical location and its HTML as snippet. HTML scans have no page URL, so
+ * their results are located at urn:wcagaii:html-content.
+ */
+function violationsSarif(result, { scanId, correlationId } = {}) {
+  const violations = result.violations || [];
+  const engine = result.testEngine || { name: 'axe-core' };
+  const uri = result.url === HTML_CONTENT_URL ? 'urn:wcagaii:html-content' : result.url;
+
+  const rules = violations.map(violation => ({
+    id: violation.id,
+    shortDescription: { text: violation.help },
+    fullDescription: { text: violation.description },
+    helpUri: violation.helpUrl,
+    help: { text: `${violation.help}. See ${violation.helpUrl}` },
+    defaultConfiguration: { level: IMPACT_LEVEL[violation.impact] || 'warning' },
+    properties: {
+      tags: ['accessibility', ...(violation.tags || [])],
+      impact: violation.impact
+    }
+  }));
+
+  const results = violations.flatMap((violation, ruleIndex) =>
+    (violation.nodes || []).map(node => {
+      const selector = nodeSelector(node);
+      return {
+        ruleId: violation.id,
+        ruleIndex,
+        level: IMPACT_LEVEL[node.impact || violation.impact] || 'warning',
+        message: { text: `${violation.help}: ${selector}` },
+        locations: [{
+          physicalLocation: {
+            artifactLocation: { uri },
+            region: { snippet: { text: node.html || '' } }
+          },
+          logicalLocations: [{ fullyQualifiedName: selector, kind: 'element' }]
+        }],
+        // Identifies the same issue across scans, as there are no line numbers
+        partialFingerprints: { 'axeSelector/v1': `${violation.id}:${selector}` }
+      };
+    })
+  );
+
+  return {
+    $schema: 'https://json.schemastore.org/sarif-2.1.0.json',
+    version: '2.1.0',
+    runs: [{
+      tool: {
+        driver: {
+          name: engine.name,
+          version: engine.version,
+          informationUri: 'https://github.com/dequelabs/axe-core',
+          rules
+        }
+      },
+      invocations: [{
+        executionSuccessful: true,
+        endTimeUtc: result.timestamp
+      }],
+      results,
+      properties: { scanId, correlationId, url: result.url, summary: result.summary }
+    }]
+  };
+}
+
+// axe tags covered by each WCAG version. Later versions include the success
+// criteria of earlier ones, so conformance to 2.1 also requires 2.0 rules.
+const STANDARD_TAGS = {
+  wcag20: ['wcag2a', 'wcag2aa'],
+  wcag21: ['wcag2a', 'wcag2aa', 'wcag21a', 'wcag21aa'],
+  wcag22: ['wcag2a', 'wcag2aa', 'wcag21a', 'wcag21aa', 'wcag22aa']
+};
+
+// axe tags of the success criteria at each conformance level and below
+const LEVEL_TAGS = {
+  A: ['wcag2a', 'wcag21a', 'wcag22a'],
+  AA: ['wcag2a', 'wcag21a', 'wcag22a', 'wcag2aa', 'wcag21aa', 'wcag22aa'],
+  AAA: [
+    'wcag2a', 'wcag21a', 'wcag22a', 'wcag2aa', 'wcag21aa', 'wcag22aa',
+    'wcag2aaa', 'wcag21aaa', 'wcag22aaa'
+  ]
+};
+const ALL_LEVEL_TAGS = LEVEL_TAGS.AAA;
+
+/**
+ * Replace a result's rules, recomputing the summary counts, compliance
+ * score and violations by severity to match
+ */
+function withRules(result, { violations, passes, incomplete }) {
+  const totalChecks = violations.length + passes.length;
+  const countImpact = impact => violations.filter(v => v.impact === impact).length;
+
+  return {
+    ...result,
+    summary: {
+      ...result.summary,
+      violations: violations.length,
+      passes: passes.length,
+      incomplete: incomplete.length,
+      complianceScore: totalChecks > 0
+        ? parseFloat(((passes.length / totalChecks) * 100).toFixed(2))
+        : 100,
+      violationsBySeverity: {
+        critical: countImpact('critical'),
+        serious: countImpact('serious'),
+        moderate: countImpact('moderate'),
+        minor: countImpact('minor')
+      }
+    },
+    violations,
+    passes,
+    incomplete
+  };
+}
+
+/**
+ * Keep only the rules listed in runOnly (when given) and not listed in
+ * disableRules, recomputing the summary counts. Custom checks are kept.
+ */
+function filterRules(result, { runOnly, disableRules = [] }) {
+  const selected = rule => rule.id.startsWith('custom/') ||
+    ((!runOnly || runOnly.includes(rule.id)) && !disableRules.includes(rule.id));
+
+  return withRules(result, {
+    violations: (result.violations || []).filter(selected),
+    passes: (result.passes || []).filter(selected),
+    incomplete: (result.incomplete || []).filter(selected)
+  });
+}
+
+/**
+ * Echo a request's clientMetadata in the result's metadata.client
+ */
+function withClientMetadata(result, clientMetadata) {
+  if (!clientMetadata) {
+    return result;
+  }
+  return { ...result, metadata: { ...result.metadata, client: clientMetadata } };
+}
+
+/**
+ * Keep only the rules of a WCAG conformance level and below, recomputing
+ * the summary counts. Rules without a level tag (custom checks) are kept.
+ */
+function filterByWcagLevel(result, level) {
+  const tags = LEVEL_TAGS[level];
+  const atLevel = rule => {
+    const levelTags = (rule.tags || []).filter(tag => ALL_LEVEL_TAGS.includes(tag));
+    return levelTags.length === 0 || levelTags.some(tag => tags.includes(tag));
+  };
+
+  const filtered = withRules(result, {
+    violations: (result.violations || []).filter(atLevel),
+    passes: (result.passes || []).filter(atLevel),
+    incomplete: (result.incomplete || []).filter(atLevel)
+  });
+  return { ...filtered, summary: { ...filtered.summary, wcagLevel: level } };
+}
+
+/**
+ * Segment a scan result by WCAG version, with per-standard rule counts,
+ * affected node counts and compliance score
+ */
+function segmentByStandard(result, standards = Object.keys(STANDARD_TAGS)) {
+  const segments = {};
+
+  for (const standard of standards) {
+    const tags = STANDARD_TAGS[standard];
+    const inStandard = rule => (rule.tags || []).some(tag => tags.includes(tag));
+
+    const violations = (result.violations || []).filter(inStandard);
+    const passes = (result.passes || []).filter(inStandard);
+    const incomplete = (result.incomplete || []).filter(inStandard);
+    const totalChecks = violations.length + passes.length;
+
+    segments[standard] = {
+      violations: violations.length,
+      passes: passes.length,
+      incomplete: incomplete.length,
+      affectedNodes: violations.reduce((sum, v) => sum + (v.nodes || []).length, 0),
+      complianceScore: totalChecks > 0
+        ? parseFloat(((passes.length / totalChecks) * 100).toFixed(2))
+        : 100,
+      violationIds: violations.map(v => v.id)
+    };
+  }
+
+  return segments;
+}
+
+// Success criteria added in WCAG 2.2, with the axe tag of each. Most have no
+// automated rule and are reported as not tested, needing manual review.
+const WCAG22_NEW_CRITERIA = [
+  { criterion: '2.4.11', name: 'Focus Not Obscured (Minimum)', level: 'AA', tag: 'wcag2411' },
+  { criterion: '2.4.12', name: 'Focus Not Obscured (Enhanced)', level: 'AAA', tag: 'wcag2412' },
+  { criterion: '2.4.13', name: 'Focus Appearance', level: 'AAA', tag: 'wcag2413' },
+  { criterion: '2.5.7', name: 'Dragging Movements', level: 'AA', tag: 'wcag257' },
+  { criterion: '2.5.8', name: 'Target Size (Minimum)', level: 'AA', tag: 'wcag258' },
+  { criterion: '3.2.6', name: 'Consistent Help', level: 'A', tag: 'wcag326' },
+  { criterion: '3.3.7', name: 'Redundant Entry', level: 'A', tag: 'wcag337' },
+  { criterion: '3.3.8', name: 'Accessible Authentication (Minimum)', level: 'AA', tag: 'wcag338' },
+  { criterion: '3.3.9', name: 'Accessible Authentication (Enhanced)', level: 'AAA', tag: 'wcag339' }
+];
+
+/**
+ * Results for the success criteria new in WCAG 2.2. Each criterion's status
+ * is "failed", "incomplete", "passed" or "not_tested".
+ */
+function wcag22NewCriteria(result) {
+  const rulesWithTag = (rules = [], tag) => rules
+    .filter(rule => (rule.tags || []).includes(tag))
+    .map(rule => rule.id);
+
+  const criteria = WCAG22_NEW_CRITERIA.map(({ criterion, name, level, tag }) => {
+    const violations = rulesWithTag(result.violations, tag);
+    const incomplete = rulesWithTag(result.incomplete, tag);
+    const passes = rulesWithTag(result.passes, tag);
+
+    let status = 'not_tested';
+    if (violations.length > 0) status = 'failed';
+    else if (incomplete.length > 0) status = 'incomplete';
+    else if (passes.length > 0) status = 'passed';
+
+    return { criterion, name, level, status, violations, incomplete, passes };
+  });
+
+  const count = status => criteria.filter(c => c.status === status).length;
+
+  return {
+    summary: {
+      failed: count('failed'),
+      incomplete: count('incomplete'),
+      passed: count('passed'),
+      notTested: count('not_tested')
+    },
+    criteria
+  };
+}
+
+// Status of every rule in a result: failed, incomplete or passed
+function ruleStatuses(result) {
+  const statuses = new Map();
+  (result.passes || []).forEach(rule => statuses.set(rule.id, 'passed'));
+  (result.incomplete || []).forEach(rule => statuses.set(rule.id, 'incomplete'));
+  (result.violations || []).forEach(rule => statuses.set(rule.id, 'failed'));
+  return statuses;
+}
+
+function classifyTransition(from, to) {
+  if (to === 'failed') return 'regressed';
+  if (from === 'failed') return 'fixed';
+  return 'changed';
+}
+
+// Selectors of the nodes failing each rule
+function failingSelectors(result, options) {
+  const selectors = new Map();
+  (result.violations || []).forEach(violation => {
+    selectors.set(violation.id, new Set(
+      (violation.nodes || []).map(node => nodeSelector(node, { normalize: options.normalizeSelectors }))
+    ));
+  });
+  return selectors;
+}
+
+/**
+ * Compare a result with a baseline result, listing every rule whose status
+ * changed, and for rules failing in both the affected nodes that were added
+ * or removed. Rules missing from a result were inapplicable to that page.
+ */
+function compareWithBaseline(baseline, result, options = {}) {
+  const before = ruleStatuses(baseline);
+  const after = ruleStatuses(result);
+  const ruleIds = new Set([...before.keys(), ...after.keys()]);
+  const statusChanges = [];
+
+  for (const ruleId of ruleIds) {
+    const from = before.get(ruleId) || 'inapplicable';
+    const to = after.get(ruleId) || 'inapplicable';
+    if (from !== to) {
+      statusChanges.push({ ruleId, from, to, transition: classifyTransition(from, to) });
+    }
+  }
+
+  const nodesBefore = failingSelectors(baseline, options);
+  const nodesAfter = failingSelectors(result, options);
+  const nodeChanges = [];
+
+  for (const [ruleId, selectors] of nodesAfter) {
+    const previous = nodesBefore.get(ruleId);
+    if (!previous) continue;
+
+    const added = [...selectors].filter(selector => !previous.has(selector));
+    const removed = [...previous].filter(selector => !selectors.has(selector));
+    if (added.length > 0 || removed.length > 0) {
+      nodeChanges.push({ ruleId, added, removed });
+    }
+  }
+
+  const count = transition => statusChanges.filter(c => c.transition === transition).length;
+
+  return {
+    summary: {
+      regressed: count('regressed'),
+      fixed: count('fixed'),
+      changed: count('changed'),
+      unchanged: ruleIds.size - statusChanges.length,
+      nodesAdded: nodeChanges.reduce((sum, c) => sum + c.added.length, 0),
+      nodesRemoved: nodeChanges.reduce((sum, c) => sum + c.removed.length, 0)
+    },
+    statusChanges,
+    nodeChanges
+  };
+}
+
+module.exports = {
+  STANDARD_TAGS,
+  WCAG22_NEW_CRITERIA,
+  normalizeSelector,
+  nodeSelector,
+  flattenViolationNodes,
+  groupTemplateViolations,
+  violationTickets,
+  violationsSarif,
+  violationsCsv,
+  withRules,
+  filterRules,
+  withClientMetadata,
+  filterByWcagLevel,
+  segmentByStandard,
+  wcag22NewCriteria,
+  compareWithBaseline
+};
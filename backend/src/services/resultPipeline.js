@@ -0,0 +1,176 @@
+/**
+ * Result Transformation Pipeline
+ *
+ * Post-processes a scan result with built-in transforms, in the order a
+ * request lists them in options.pipeline. A stage is a transform name, or
+ * an object naming the transform with its parameters:
+ *
+ *   [
+ *     { "transform": "filter-by-impact", "minImpact": "serious" },
+ *     "dedup",
+ *     { "transform": "sort", "by": "nodes" },
+ *     { "transform": "redact", "fields": ["html"] },
+ *     "score"
+ *   ]
+ *
+ * Transforms:
+ * - filter-by-impact: keep violations and incomplete rules of minImpact
+ *   (default "serious") or higher, recomputing the summary
+ * - dedup: drop repeated nodes (same selector) within each rule
+ * - sort: order violations and incomplete rules by "impact" (default,
+ *   most severe first), "nodes" (most affected elements first) or "id"
+ * - redact: replace node fields ("html" by default, "failureSummary",
+ *   "xpath") with "[redacted]"
+ * - score: add summary.weightedScore, a compliance score weighting each
+ *   violation by impact (weights overridable per impact)
+ */
+
+const { withRules, nodeSelector } = require('./resultFormatter');
+
+const IMPACTS = ['minor', 'moderate', 'serious', 'critical'];
+const REDACTABLE_FIELDS = ['html', 'failureSummary', 'xpath'];
+const SORT_KEYS = ['impact', 'nodes', 'id'];
+const DEFAULT_WEIGHTS = { critical: 10, serious: 5, moderate: 2, minor: 1 };
+
+const impactRank = impact => IMPACTS.indexOf(impact);
+const nodeCount = rule => (Array.isArray(rule.nodes) ? rule.nodes.length : rule.nodes || 0);
+
+const TRANSFORMS = {
+  'filter-by-impact': {
+    validate: ({ minImpact }) =>
+      minImpact === undefined || IMPACTS.includes(minImpact)
+        ? null
+        : `minImpact must be one of ${IMPACTS.join(', ')}`,
+    apply: (result, { minImpact = 'serious' }) => {
+      const severe = rule => impactRank(rule.impact) >= impactRank(minImpact);
+      return withRules(result, {
+        violations: result.violations.filter(severe),
+        passes: result.passes,
+        incomplete: result.incomplete.filter(severe)
+      });
+    }
+  },
+
+  dedup: {
+    validate: () => null,
+    apply: result => ({
+      ...result,
+      violations: result.violations.map(violation => {
+        const seen = new Set();
+        return {
+          ...violation,
+          nodes: violation.nodes.filter(node => {
+            const selector = nodeSelector(node);
+            if (seen.has(selector)) return false;
+            seen.add(selector);
+            return true;
+          })
+        };
+      })
+    })
+  },
+
+  sort: {
+    validate: ({ by }) =>
+      by === undefined || SORT_KEYS.includes(by) ? null : `by must be one of ${SORT_KEYS.join(', ')}`,
+    apply: (result, { by = 'impact' }) => {
+      const compare = {
+        impact: (a, b) => impactRank(b.impact) - impactRank(a.impact) || a.id.localeCompare(b.id),
+        nodes: (a, b) => nodeCount(b) - nodeCount(a) || a.id.localeCompare(b.id),
+        id: (a, b) => a.id.localeCompare(b.id)
+      }[by];
+      return {
+        ...result,
+        violations: [...result.violations].sort(compare),
+        incomplete: [...result.incomplete].sort(compare)
+      };
+    }
+  },
+
+  redact: {
+    validate: ({ fields }) =>
+      fields === undefined ||
+      (Array.isArray(fields) && fields.length > 0 && fields.every(field => REDACTABLE_FIELDS.includes(field)))
+        ? null
+        : `fields must be a non-empty list of ${REDACTABLE_FIELDS.join(', ')}`,
+    apply: (result, { fields = ['html'] }) => ({
+      ...result,
+      violations: result.violations.map(violation => ({
+        ...violation,
+        nodes: violation.nodes.map(node => {
+          const redacted = { ...node };
+          fields
+            .filter(field => redacted[field] !== undefined && redacted[field] !== null)
+            .forEach(field => { redacted[field] = '[redacted]'; });
+          return redacted;
+        })
+      }))
+    })
+  },
+
+  score: {
+    validate: ({ weights }) =>
+      weights === undefined ||
+      (weights && typeof weights === 'object' && Object.entries(weights).every(
+        ([impact, weight]) => IMPACTS.includes(impact) && typeof weight === 'number' && weight >= 0
+      ))
+        ? null
+        : `weights must map ${IMPACTS.join(', ')} to non-negative numbers`,
+    apply: (result, { weights = {} }) => {
+      const weightOf = { ...DEFAULT_WEIGHTS, ...weights };
+      const penalty = result.violations.reduce((sum, violation) => sum + (weightOf[violation.impact] || 0), 0);
+      const total = result.passes.length + penalty;
+      return {
+        ...result,
+        summary: {
+          ...result.summary,
+          weightedScore: total > 0 ? parseFloat(((result.passes.length / total) * 100).toFixed(2)) : 100
+        }
+      };
+    }
+  }
+};
+
+const TRANSFORM_NAMES = Object.keys(TRANSFORMS);
+
+function parseStage(stage) {
+  if (typeof stage === 'string') {
+    return { name: stage, params: {} };
+  }
+  const { transform, ...params } = stage;
+  return { name: transform, params };
+}
+
+/**
+ * Why a pipeline stage is invalid, or null when it is valid
+ */
+function stageError(stage) {
+  const { name, params } = parseStage(stage);
+  if (!TRANSFORMS[name]) {
+    return `Unknown transform: ${name}. Must be one of ${TRANSFORM_NAMES.join(', ')}`;
+  }
+  const error = TRANSFORMS[name].validate(params);
+  return error ? `${name}: ${error}` : null;
+}
+
+/**
+ * Apply the pipeline's transforms to a result in order, recording the
+ * transforms applied in metadata.pipeline
+ */
+function applyPipeline(result, stages) {
+  const stagesApplied = stages.map(parseStage);
+  const transformed = stagesApplied.reduce(
+    (current, { name, params }) => TRANSFORMS[name].apply(current, params),
+    { ...result, violations: result.violations || [], passes: result.passes || [], incomplete: result.incomplete || [] }
+  );
+  return {
+    ...transformed,
+    metadata: { ...transformed.metadata, pipeline: stagesApplied.map(stage => stage.name) }
+  };
+}
+
+module.exports = {
+  TRANSFORM_NAMES,
+  stageError,
+  applyPipeline
+};
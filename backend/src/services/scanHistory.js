@@ -0,0 +1,173 @@
+/**
+ * Scan History
+ *
+ * Records completed single and batch scans so recent results can be
+ * listed (GET /api/scans) and fetched again (GET /api/scans/:scanId)
+ * without rescanning. Enabled with SCAN_HISTORY_ENABLED=true.
+ *
+ * Entries are kept in memory, the newest SCAN_HISTORY_MAX_ENTRIES of them,
+ * unless REDIS_URL is set: then they are stored in Redis, shared by all
+ * instances and kept across restarts. There, a sorted set holds the newest
+ * SCAN_HISTORY_MAX_ENTRIES summaries and each full result expires after
+ * SCAN_HISTORY_RETENTION ms. Redis write errors are logged, so scans never
+ * fail because history is unavailable.
+ *
+ * Listings are paged by cursor: every entry gets an increasing sequence
+ * number, and a cursor (opaque to clients) holds the last one returned, so
+ * scans recorded meanwhile never shift or repeat later pages.
+ *
+ * Each scan belongs to the client that submitted it (see clientId()), and
+ * is only listed and returned to that client. In Redis every client has its
+ * own sorted set, keyed by a hash of the client ID so API keys never appear
+ * in key names, and keeps its newest SCAN_HISTORY_MAX_ENTRIES scans.
+ */
+
+const crypto = require('crypto');
+const pino = require('pino');
+const config = require('../config');
+const { RedisClient } = require('./redisClient');
+
+const logger = pino({
+  level: process.env.LOG_LEVEL || 'info'
+});
+
+class ScanHistory {
+  constructor(options = {}) {
+    this.enabled = options.enabled !== undefined ? options.enabled : config.history.enabled;
+    this.maxEntries = options.maxEntries || config.history.maxEntries;
+    this.retention = options.retention || config.history.retention;
+    const redisUrl = options.redisUrl !== undefined ? options.redisUrl : config.cache.redisUrl;
+    this.redis = this.enabled && redisUrl
+      ? new RedisClient(redisUrl, { commandTimeout: config.cache.redisTimeout })
+      : null;
+    this.redisPrefix = options.redisPrefix || config.history.redisPrefix;
+    // scanId -> { seq, summary, response }, oldest first
+    this.entries = new Map();
+    this.seq = 0;
+  }
+
+  /**
+   * Sequence number in a listing cursor, or null when it isn't one
+   */
+  parseCursor(cursor) {
+    const seq = Number(Buffer.from(String(cursor), 'base64url').toString());
+    return Number.isSafeInteger(seq) && seq > 0 ? seq : null;
+  }
+
+  formatCursor(seq) {
+    return Buffer.from(String(seq)).toString('base64url');
+  }
+
+  // Redis key prefix of an owner's entries
+  ownerPrefix(owner) {
+    const hash = owner === undefined
+      ? 'none'
+      : crypto.createHash('sha256').update(String(owner)).digest('hex').slice(0, 32);
+    return `${this.redisPrefix}${hash}:`;
+  }
+
+  /**
+   * Record a completed scan: its full response and a summary for listings.
+   * owner identifies the submitting client; only it can list or get the scan.
+   */
+  async record(scanId, { type, input, owner, response }) {
+    if (!this.enabled) return;
+
+    const summary = {
+      scanId,
+      timestamp: response.timestamp,
+      type,
+      // HTML inputs can be megabytes; list them by the scan's URL field
+      input: type === 'url' ? input : '[HTML]',
+      summary: response.summary
+    };
+
+    if (this.redis) {
+      const prefix = this.ownerPrefix(owner);
+      try {
+        const seq = await this.redis.command('INCR', `${this.redisPrefix}seq`);
+        await Promise.all([
+          this.redis.command('SET', `${prefix}scan:${scanId}`, JSON.stringify(response), 'PX', this.retention),
+          this.redis.command('ZADD', `${prefix}scans`, seq, JSON.stringify(summary)),
+          this.redis.command('ZREMRANGEBYRANK', `${prefix}scans`, 0, -this.maxEntries - 1)
+        ]);
+      } catch (error) {
+        logger.warn({ scanId, error: error.message }, 'Redis scan history write failed');
+      }
+      return;
+    }
+
+    this.entries.delete(scanId);
+    this.entries.set(scanId, { seq: ++this.seq, owner, summary, response });
+    while (this.entries.size > this.maxEntries) {
+      this.entries.delete(this.entries.keys().next().value);
+    }
+  }
+
+  /**
+   * A page of owner's scan summaries, newest first, starting after cursor
+   * (a nextCursor of an earlier page; none for the first page)
+   *
+   * @returns {Promise<{total, scans, nextCursor}>} nextCursor is null on the last page
+   */
+  async list({ owner, cursor = null, limit = 20 } = {}) {
+    const before = cursor === null ? Infinity : this.parseCursor(cursor);
+    let total;
+    let page;
+
+    if (this.redis) {
+      // One extra entry tells whether another page follows
+      const scansKey = `${this.ownerPrefix(owner)}scans`;
+      const [count, reply] = await Promise.all([
+        this.redis.command('ZCARD', scansKey),
+        this.redis.command(
+          'ZREVRANGEBYSCORE', scansKey, before === Infinity ? '+inf' : `(${before}`, '-inf',
+          'WITHSCORES', 'LIMIT', 0, limit + 1
+        )
+      ]);
+      total = count;
+      page = [];
+      for (let i = 0; i < reply.length; i += 2) {
+        page.push({ summary: JSON.parse(reply[i]), seq: Number(reply[i + 1]) });
+      }
+    } else {
+      const entries = [...this.entries.values()].filter(entry => entry.owner === owner).reverse();
+      total = entries.length;
+      page = entries.filter(entry => entry.seq < before).slice(0, limit + 1);
+    }
+
+    const scans = page.slice(0, limit);
+    return {
+      total,
+      scans: scans.map(entry => entry.summary),
+      nextCursor: page.length > limit ? this.formatCursor(scans[scans.length - 1].seq) : null
+    };
+  }
+
+  /**
+   * Full response of a scan owner recorded, or null
+   */
+  async get(scanId, owner) {
+    if (this.redis) {
+      const stored = await this.redis.command('GET', `${this.ownerPrefix(owner)}scan:${scanId}`);
+      return stored === null ? null : JSON.parse(stored);
+    }
+
+    const entry = this.entries.get(scanId);
+    return entry && entry.owner === owner ? entry.response : null;
+  }
+
+  getStats() {
+    return {
+      enabled: this.enabled,
+      store: this.redis ? 'redis' : 'memory',
+      size: this.redis ? undefined : this.entries.size,
+      maxEntries: this.maxEntries
+    };
+  }
+}
+
+// Singleton instance
+const scanHistory = new ScanHistory();
+
+module.exports = { ScanHistory, scanHistory };
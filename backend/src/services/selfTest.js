@@ -0,0 +1,48 @@
+/**
+ * Self-Test Scan
+ *
+ * Scans a bundled HTML fixture with a known violation through the full
+ * scan path (browser pool, page, axe), so uptime checks of /api/selftest
+ * exercise real scanning rather than just process liveness.
+ */
+
+const fs = require('fs');
+const path = require('path');
+const pino = require('pino');
+
+const logger = pino({
+  level: process.env.LOG_LEVEL || 'info'
+});
+
+const SELFTEST_HTML = fs.readFileSync(path.join(__dirname, '../fixtures/selftest.html'), 'utf8');
+const SELFTEST_EXPECTED_RULE = 'image-alt';
+
+/**
+ * Run the self-test with scanHTML(html) => scan result
+ *
+ * @returns {Promise<{passed: boolean, scanTime: number, violations?: number, error?: string}>}
+ */
+async function runSelfTest(scanHTML) {
+  const startTime = Date.now();
+
+  try {
+    const result = await scanHTML(SELFTEST_HTML);
+    const passed = result.violations.some(v => v.id === SELFTEST_EXPECTED_RULE);
+
+    return {
+      passed,
+      scanTime: Date.now() - startTime,
+      violations: result.summary.violations,
+      ...(passed ? {} : { error: `Expected "${SELFTEST_EXPECTED_RULE}" violation was not reported` })
+    };
+  } catch (error) {
+    logger.error({ error: error.message }, 'Self-test scan failed');
+    return {
+      passed: false,
+      scanTime: Date.now() - startTime,
+      error: error.message
+    };
+  }
+}
+
+module.exports = { runSelfTest, SELFTEST_EXPECTED_RULE };
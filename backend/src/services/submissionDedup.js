@@ -0,0 +1,52 @@
+/**
+ * Duplicate Submission Detection
+ *
+ * Remembers recent bulk scan submissions by a hash of the submitting
+ * client and request, for BULK_DEDUP_WINDOW ms, so an identical submission
+ * (e.g. a client retrying) gets the batch ID of the first one instead of
+ * starting another scan. Disabled when the window is 0.
+ */
+
+const crypto = require('crypto');
+const config = require('../config');
+
+class SubmissionDedup {
+  constructor(options = {}) {
+    this.window = options.window !== undefined ? options.window : config.bulk.dedupWindow;
+    // hash -> { id, expiresAt }, in submission order
+    this.submissions = new Map();
+  }
+
+  get enabled() {
+    return this.window > 0;
+  }
+
+  /**
+   * Hash identifying a submission: the client and everything it asked for
+   */
+  hash(client, ...request) {
+    return crypto
+      .createHash('sha256')
+      .update(JSON.stringify([client, ...request.map(part => part === undefined ? null : part)]))
+      .digest('hex');
+  }
+
+  /**
+   * ID of an identical submission still within the window, or null
+   */
+  find(hash, now = Date.now()) {
+    for (const [key, submission] of this.submissions) {
+      if (submission.expiresAt > now) break;
+      this.submissions.delete(key);
+    }
+    const submission = this.submissions.get(hash);
+    return submission ? submission.id : null;
+  }
+
+  remember(hash, id, now = Date.now()) {
+    this.submissions.delete(hash);
+    this.submissions.set(hash, { id, expiresAt: now + this.window });
+  }
+}
+
+module.exports = { SubmissionDedup };
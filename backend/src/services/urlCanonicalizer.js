@@ -0,0 +1,48 @@
+/**
+ * URL Canonicalization
+ *
+ * Collapses equivalent URLs to one form before they are used as cache keys,
+ * so https://Example.com:443/?b=2&a=1&utm_source=x and
+ * https://example.com/?a=1&b=2 share a cache entry.
+ *
+ * - Lowercases the scheme and host
+ * - Removes default ports
+ * - Strips tracking parameters (configurable, "*" suffix matches a prefix)
+ * - Sorts the remaining query parameters by name
+ */
+
+const config = require('../config');
+
+function isStrippedParam(name, stripParams) {
+  const lowerName = name.toLowerCase();
+  return stripParams.some(pattern => {
+    const lowerPattern = pattern.toLowerCase();
+    return lowerPattern.endsWith('*')
+      ? lowerName.startsWith(lowerPattern.slice(0, -1))
+      : lowerName === lowerPattern;
+  });
+}
+
+/**
+ * Canonicalize a URL string. Unparseable input is returned unchanged.
+ */
+function canonicalizeUrl(input, stripParams = config.cache.stripParams) {
+  let parsed;
+  try {
+    // WHATWG URL parsing lowercases scheme/host and drops default ports
+    parsed = new URL(input);
+  } catch (error) {
+    return input;
+  }
+
+  const params = [...parsed.searchParams.entries()]
+    .filter(([name]) => !isStrippedParam(name, stripParams))
+    // Stable sort by name keeps the order of repeated parameters
+    .sort(([a], [b]) => a.localeCompare(b));
+
+  parsed.search = new URLSearchParams(params).toString();
+
+  return parsed.toString();
+}
+
+module.exports = { canonicalizeUrl };
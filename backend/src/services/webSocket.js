@@ -0,0 +1,80 @@
+/**
+ * WebSocket Connections
+ *
+ * Accepts WebSocket upgrades handed over by the HTTP server (see the
+ * 'upgrade' handler in server.js) with the ws library, which implements
+ * the protocol: framing, masking, fragmentation, ping/pong and the closing
+ * handshake. Messages over maxMessageBytes close the connection with 1009.
+ *
+ *   acceptWebSocket(req, socket, head, { maxMessageBytes }, ws => {
+ *     ws.on('message', (data, isBinary) => ...);
+ *     ws.send(JSON.stringify({ hello: 'world' }));
+ *     ws.on('close', code => ...);
+ *     ws.close(1000);
+ *   });
+ */
+
+const { WebSocketServer } = require('ws');
+
+const CLOSE_CODES = {
+  normal: 1000,
+  goingAway: 1001,
+  protocolError: 1002,
+  unsupportedData: 1003,
+  noStatus: 1005,
+  policyViolation: 1008,
+  messageTooBig: 1009,
+  internalError: 1011
+};
+
+/**
+ * Whether a request asks for a WebSocket connection this server can accept
+ */
+function isWebSocketUpgrade(req) {
+  return String(req.headers.upgrade || '').toLowerCase() === 'websocket' &&
+    typeof req.headers['sec-websocket-key'] === 'string' &&
+    req.headers['sec-websocket-version'] === '13';
+}
+
+/**
+ * Whether an upgrade request may connect: browsers always send their page's
+ * Origin, which must be one of allowedOrigins; other clients send none
+ */
+function isAllowedOrigin(req, allowedOrigins) {
+  const origin = req.headers.origin;
+  return origin === undefined || allowedOrigins.includes(origin);
+}
+
+/**
+ * Complete the opening handshake on an upgrade request's socket
+ *
+ * @param {http.IncomingMessage} req - Upgrade request (see isWebSocketUpgrade)
+ * @param {net.Socket} socket - Its socket
+ * @param {Buffer} head - Bytes received after the request headers
+ * @param {Object} options.headers - Extra headers for the 101 response
+ * @param {number} options.maxMessageBytes - Largest message accepted
+ * @param {Function} onConnection - Called with the ws WebSocket once open
+ */
+function acceptWebSocket(req, socket, head, options, onConnection) {
+  const server = new WebSocketServer({
+    noServer: true,
+    clientTracking: false,
+    maxPayload: options.maxMessageBytes || 1024 * 1024
+  });
+  server.on('headers', headers => {
+    Object.entries(options.headers || {}).forEach(([name, value]) => headers.push(`${name}: ${value}`));
+  });
+
+  server.handleUpgrade(req, socket, head, ws => {
+    // Protocol errors close the connection; 'close' reports them
+    ws.on('error', () => {});
+    onConnection(ws);
+  });
+}
+
+module.exports = {
+  CLOSE_CODES,
+  isWebSocketUpgrade,
+  isAllowedOrigin,
+  acceptWebSocket
+};
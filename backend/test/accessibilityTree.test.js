@@ -0,0 +1,78 @@
+const { test } = require('node:test');
+const assert = require('node:assert/strict');
+const { scanner, useFakeBrowser } = require('./helpers/fakeBrowser');
+const { ScanRequestSchema, coerceOptions } = require('../src/schemas/validation');
+const config = require('../src/config');
+
+const tree = {
+  role: 'RootWebArea',
+  name: 'Shop',
+  children: [
+    { role: 'heading', name: 'Deals', level: 1 },
+    {
+      role: 'navigation',
+      name: 'Main',
+      children: [{ role: 'link', name: 'Home' }, { role: 'link', name: 'Cart' }]
+    },
+    { role: 'img', name: 'x'.repeat(600) }
+  ]
+};
+
+function maxNodes(t, value) {
+  const previous = config.maxAccessibilityTreeNodes;
+  config.maxAccessibilityTreeNodes = value;
+  t.after(() => { config.maxAccessibilityTreeNodes = previous; });
+}
+
+test('reports the accessibility tree when asked for it', async t => {
+  useFakeBrowser(t, { accessibilityTree: tree });
+
+  const result = await scanner.scanURL('https://example.com/', { accessibilityTree: true });
+  const without = await scanner.scanHTML('<p>Hello</p>', {});
+
+  const { root, nodes, truncated } = result.metadata.accessibilityTree;
+  assert.equal(nodes, 6);
+  assert.equal(truncated, false);
+  assert.deepEqual(root.children.slice(0, 2), tree.children.slice(0, 2));
+  // Long names are shortened
+  assert.equal(root.children[2].name, 'x'.repeat(500));
+  assert.equal(without.metadata.accessibilityTree, undefined);
+});
+
+test('keeps the first nodes in document order up to the cap', async t => {
+  maxNodes(t, 4);
+  useFakeBrowser(t, { accessibilityTree: tree });
+
+  const result = await scanner.scanHTML('<p>Hello</p>', { accessibilityTree: true });
+
+  assert.deepEqual(result.metadata.accessibilityTree, {
+    root: {
+      role: 'RootWebArea',
+      name: 'Shop',
+      children: [
+        { role: 'heading', name: 'Deals', level: 1 },
+        { role: 'navigation', name: 'Main', children: [{ role: 'link', name: 'Home' }] }
+      ]
+    },
+    nodes: 4,
+    truncated: true
+  });
+});
+
+test('reports an empty tree as null', async t => {
+  useFakeBrowser(t, { accessibilityTree: null });
+
+  const result = await scanner.scanHTML('<p>Hello</p>', { accessibilityTree: true });
+
+  assert.deepEqual(result.metadata.accessibilityTree, { root: null, nodes: 0, truncated: false });
+});
+
+test('validates and coerces the accessibilityTree option', () => {
+  const parse = options => ScanRequestSchema.safeParse({ type: 'url', input: 'https://example.com/', options });
+
+  assert.equal(parse({ accessibilityTree: true }).success, true);
+  assert.equal(parse({ accessibilityTree: 'yes' }).success, false);
+  const options = { accessibilityTree: 'true' };
+  coerceOptions(options);
+  assert.deepEqual(options, { accessibilityTree: true });
+});
@@ -0,0 +1,86 @@
+const { test } = require('node:test');
+const assert = require('node:assert/strict');
+const { isValidApiKey, requireApiKey } = require('../src/middleware/apiKeyAuth');
+
+// Run the middleware for a request as express would
+function submit(middleware, { key, method = 'GET', path = '/api/scan', headers = {} } = {}) {
+  const req = {
+    method,
+    path,
+    ip: '203.0.113.7',
+    headers: { ...headers, ...(key !== undefined && { 'x-api-key': key }) },
+    get(name) { return this.headers[name.toLowerCase()]; }
+  };
+  const res = {
+    statusCode: 200,
+    headers: {},
+    set(name, value) { this.headers[name] = value; return this; },
+    status(code) { this.statusCode = code; return this; },
+    json(payload) { this.body = payload; return this; }
+  };
+  let passed = false;
+  middleware(req, res, () => { passed = true; });
+  return { res, passed };
+}
+
+test('leaves the API open without configured keys', () => {
+  assert.equal(submit(requireApiKey([])).passed, true);
+  assert.equal(submit(requireApiKey([]), { key: 'anything' }).passed, true);
+});
+
+test('rejects requests without a key with 401', () => {
+  const { res, passed } = submit(requireApiKey(['key-a', 'key-b']));
+
+  assert.equal(passed, false);
+  assert.equal(res.statusCode, 401);
+  assert.equal(res.headers['WWW-Authenticate'], 'API-Key header="X-API-Key"');
+  assert.deepEqual(res.body, { error: 'Unauthorized', message: 'Missing X-API-Key header', code: 'UNAUTHORIZED' });
+});
+
+test('rejects wrong, empty and partial keys', () => {
+  const middleware = requireApiKey(['key-a', 'key-b']);
+
+  for (const key of ['key-c', '', 'key-', 'key-a ', 'KEY-A']) {
+    const { res, passed } = submit(middleware, { key });
+    assert.equal(passed, false, key);
+    assert.equal(res.statusCode, 401, key);
+  }
+  assert.equal(submit(middleware, { key: 'key-c' }).res.body.message, 'Invalid API key');
+});
+
+test('accepts any configured key', () => {
+  const middleware = requireApiKey(['key-a', 'key-b']);
+
+  assert.equal(submit(middleware, { key: 'key-a' }).passed, true);
+  assert.equal(submit(middleware, { key: 'key-b' }).passed, true);
+});
+
+test('guards every kind of /api request, WebSocket handshakes included', () => {
+  const middleware = requireApiKey(['key-a']);
+  const requests = [
+    { method: 'POST', path: '/api/scan' },
+    { method: 'POST', path: '/api/scan/batch' },
+    { method: 'POST', path: '/api/scan/bulk' },
+    { method: 'GET', path: '/api/scan/bulk/bulk_1' },
+    { method: 'DELETE', path: '/api/scan/bulk/bulk_1' },
+    { method: 'GET', path: '/api/scans' },
+    { method: 'GET', path: '/api/report/scan_1/html' },
+    { method: 'GET', path: '/api/selftest' },
+    { method: 'GET', path: '/api/pool/stats' },
+    { method: 'GET', path: '/api/circuit-breakers' },
+    { method: 'GET', path: '/api/scan/stream', headers: { upgrade: 'websocket' } }
+  ];
+
+  for (const request of requests) {
+    assert.equal(submit(middleware, request).res.statusCode, 401, request.path);
+    assert.equal(submit(middleware, { ...request, key: 'key-a' }).passed, true, request.path);
+  }
+});
+
+test('isValidApiKey only accepts exact, non-empty matches', () => {
+  assert.equal(isValidApiKey('key-a', ['key-a']), true);
+  assert.equal(isValidApiKey('key-a', []), false);
+  assert.equal(isValidApiKey('', ['']), false);
+  assert.equal(isValidApiKey(undefined, ['key-a']), false);
+  assert.equal(isValidApiKey(['key-a'], ['key-a']), false);
+});
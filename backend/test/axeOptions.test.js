@@ -0,0 +1,98 @@
+const { test } = require('node:test');
+const assert = require('node:assert/strict');
+const { scanner, axe, axeResults, useFakeBrowser } = require('./helpers/fakeBrowser');
+const { flattenViolationNodes } = require('../src/services/resultFormatter');
+const { ScanRequestSchema } = require('../src/schemas/validation');
+
+function imageAltViolation(nodes) {
+  return {
+    id: 'image-alt',
+    impact: 'critical',
+    description: 'Ensures <img> elements have alternate text',
+    help: 'Images must have alternate text',
+    helpUrl: 'https://dequeuniversity.com/rules/axe/4.8/image-alt',
+    tags: ['wcag2a'],
+    nodes
+  };
+}
+
+test('asks axe for XPaths and reports them with each node', async t => {
+  useFakeBrowser(t);
+  axe.results = axeResults([imageAltViolation([
+    { html: '<img src="a.png">', target: ['#hero > img'], xpath: ['/html/body/div[1]/img'] },
+    { html: '<img src="b.png">', target: [['iframe#ads', 'img']], xpath: [['/html/body/iframe', '/html/body/img[2]']] }
+  ])]);
+
+  const result = await scanner.scanURL('https://example.com/', { xpath: true });
+
+  assert.equal(axe.runs[0].options.xpath, true);
+  assert.deepEqual(result.violations[0].nodes.map(node => node.xpath), [
+    ['/html/body/div[1]/img'],
+    [['/html/body/iframe', '/html/body/img[2]']]
+  ]);
+
+  const records = flattenViolationNodes(result.violations);
+  assert.deepEqual(records.map(record => [record.selector, record.xpath]), [
+    ['#hero > img', '/html/body/div[1]/img'],
+    ['iframe#ads img', '/html/body/iframe /html/body/img[2]']
+  ]);
+});
+
+test('does not ask for XPaths by default', async t => {
+  useFakeBrowser(t);
+  axe.results = axeResults([imageAltViolation([{ html: '<img>', target: ['img'] }])]);
+
+  const result = await scanner.scanHTML('<img>', {});
+
+  assert.equal(axe.runs[0].options.xpath, false);
+  assert.equal(result.violations[0].nodes[0].xpath, undefined);
+});
+
+const rule = (id, tags = ['wcag2a']) => ({ ...imageAltViolation([{ html: '<p>', target: ['p'] }]), id, tags });
+
+test('runs the WCAG rule set by default', async t => {
+  useFakeBrowser(t);
+
+  await scanner.scanHTML('<img>', {});
+
+  assert.deepEqual(axe.runs[0].options.runOnly, {
+    type: 'tag',
+    values: ['wcag2a', 'wcag2aa', 'wcag21a', 'wcag21aa', 'wcag22aa']
+  });
+  assert.equal(axe.runs[0].options.rules, undefined);
+});
+
+test('runs only the listed rules, without the disabled ones', async t => {
+  useFakeBrowser(t);
+  // Rules the engine reported anyway are dropped from the result
+  axe.results = axeResults([rule('image-alt'), rule('color-contrast'), rule('region'), rule('custom/skip-link', [])]);
+
+  const result = await scanner.scanURL('https://example.com/', {
+    runOnly: ['image-alt', 'color-contrast'],
+    disableRules: ['color-contrast']
+  });
+
+  assert.deepEqual(axe.runs[0].options.runOnly, { type: 'rule', values: ['image-alt', 'color-contrast'] });
+  assert.deepEqual(axe.runs[0].options.rules, { 'color-contrast': { enabled: false } });
+  assert.deepEqual(result.violations.map(v => v.id), ['image-alt', 'custom/skip-link']);
+  assert.equal(result.summary.violations, 2);
+});
+
+test('fails scans naming unknown rules as invalid input, without retrying', async t => {
+  useFakeBrowser(t, { delays: { analyze: () => { throw new Error('unknown rule `no-such-rule` in options.runOnly'); } } });
+
+  await assert.rejects(
+    scanner.scanURL('https://example.com/', { runOnly: ['no-such-rule'] }),
+    error => error.code === 'INVALID_INPUT' && error.retryable === false
+  );
+  assert.equal(axe.runs.length, 1);
+});
+
+test('accepts only axe rule IDs in runOnly and disableRules', () => {
+  const parse = options => ScanRequestSchema.safeParse({ type: 'url', input: 'https://example.com/', options });
+
+  assert.equal(parse({ runOnly: ['image-alt'], disableRules: ['region', 'color-contrast'] }).success, true);
+  assert.equal(parse({ runOnly: [] }).success, false);
+  assert.equal(parse({ runOnly: ['Image Alt'] }).success, false);
+  assert.equal(parse({ disableRules: ['region;drop'] }).success, false);
+});
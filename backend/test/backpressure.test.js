@@ -0,0 +1,51 @@
+const { test } = require('node:test');
+const assert = require('node:assert/strict');
+const http = require('http');
+const { once } = require('events');
+const { backpressureHeaders } = require('../src/middleware/backpressure');
+
+// Serve the middleware in front of handler, with a pool reporting stats
+async function listen(t, stats, handler, { reservedSize = 0 } = {}) {
+  const middleware = backpressureHeaders({
+    getStats: () => ({ maxSize: 4, reservedSize, ...stats }),
+    capacityFor: priority => (priority === 'high' ? 4 : 4 - reservedSize)
+  });
+  const server = http.createServer((req, res) => middleware(req, res, () => handler(req, res)));
+  server.listen(0, '127.0.0.1');
+  await once(server, 'listening');
+  t.after(() => server.close());
+  return `http://127.0.0.1:${server.address().port}/`;
+}
+
+async function headers(url) {
+  const response = await fetch(url);
+  await response.text();
+  return {
+    queueDepth: response.headers.get('x-scanner-queue-depth'),
+    capacityRemaining: response.headers.get('x-scanner-capacity-remaining')
+  };
+}
+
+test('reports queue depth and remaining capacity on every response', async t => {
+  const url = await listen(t, { activeCount: 1, queueSize: 0 }, (req, res) => res.end('ok'));
+
+  assert.deepEqual(await headers(url), { queueDepth: '0', capacityRemaining: '3' });
+});
+
+test('reads the load when the response is written, not when the request arrived', async t => {
+  const stats = { activeCount: 0, queueSize: 0 };
+  const url = await listen(t, stats, (req, res) => {
+    // The scan ran meanwhile and the pool filled up
+    Object.assign(stats, { activeCount: 6, queueSize: 5 });
+    res.writeHead(200, { 'Content-Type': 'text/plain' });
+    res.end('ok');
+  });
+
+  assert.deepEqual(await headers(url), { queueDepth: '5', capacityRemaining: '0' });
+});
+
+test('leaves browsers reserved for high priority out of the remaining capacity', async t => {
+  const url = await listen(t, { activeCount: 1, queueSize: 0 }, (req, res) => res.end('ok'), { reservedSize: 2 });
+
+  assert.deepEqual(await headers(url), { queueDepth: '0', capacityRemaining: '1' });
+});
@@ -0,0 +1,69 @@
+const { test } = require('node:test');
+const assert = require('node:assert/strict');
+const { runBatch, batchSummary } = require('../src/services/batchScan');
+const { BatchScanRequestSchema } = require('../src/schemas/validation');
+
+const wait = ms => new Promise(resolve => setTimeout(resolve, ms));
+
+test('keeps results in request order whatever order scans finish in', async () => {
+  const finished = [];
+  const results = await runBatch([30, 5, 15, 0], async (delay, index) => {
+    await wait(delay);
+    finished.push(index);
+    return { scanId: `scan_${index}`, violations: [] };
+  }, { concurrency: 4 });
+
+  assert.deepEqual(finished, [3, 1, 2, 0]);
+  assert.deepEqual(results.map(result => result.scanId), ['scan_0', 'scan_1', 'scan_2', 'scan_3']);
+});
+
+test('runs no more scans at a time than the concurrency', async () => {
+  let running = 0;
+  let peak = 0;
+  const requests = Array.from({ length: 7 }, (_, i) => i);
+
+  await runBatch(requests, async () => {
+    peak = Math.max(peak, ++running);
+    await wait(5);
+    running--;
+    return {};
+  }, { concurrency: 3 });
+
+  assert.equal(peak, 3);
+});
+
+test('reports failed scans in their own entries', async () => {
+  const reported = [];
+  const results = await runBatch(['https://a.example/', 'https://b.example/'], async url =>
+    url.includes('b.')
+      ? { scanId: 'scan_b', error: 'Scan failed', code: 'SCAN_FAILED' }
+      : { scanId: 'scan_a', violations: [] },
+  { concurrency: 2, onResult: (index, result) => reported.push([index, result.scanId]) });
+
+  assert.equal(results[0].error, undefined);
+  assert.equal(results[1].code, 'SCAN_FAILED');
+  assert.deepEqual(reported.sort(), [[0, 'scan_a'], [1, 'scan_b']]);
+  assert.deepEqual(batchSummary(results), { total: 2, succeeded: 1, failed: 1 });
+});
+
+test('starts no new scans once the batch is aborted', async () => {
+  const controller = new AbortController();
+  const started = [];
+
+  await assert.rejects(runBatch([0, 1, 2, 3], async index => {
+    started.push(index);
+    if (index === 1) controller.abort();
+    return {};
+  }, { concurrency: 1, signal: controller.signal }), { name: 'AbortError' });
+
+  assert.deepEqual(started, [0, 1]);
+});
+
+test('accepts between 1 and 100 requests per batch', () => {
+  const request = { type: 'url', input: 'https://example.com/' };
+
+  assert.equal(BatchScanRequestSchema.safeParse({ requests: [request, { type: 'html', input: '<p>hi</p>' }] }).success, true);
+  assert.equal(BatchScanRequestSchema.safeParse({ requests: [] }).success, false);
+  assert.equal(BatchScanRequestSchema.safeParse({ requests: Array(101).fill(request) }).success, false);
+  assert.equal(BatchScanRequestSchema.safeParse({ requests: [{ type: 'pdf', input: 'x' }] }).success, false);
+});
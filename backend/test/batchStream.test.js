@@ -0,0 +1,180 @@
+const { test } = require('node:test');
+const assert = require('node:assert/strict');
+const http = require('http');
+const config = require('../src/config');
+const { acceptWebSocket } = require('../src/services/webSocket');
+const { streamBatchScan } = require('../src/services/batchStream');
+const { runBatch } = require('../src/services/batchScan');
+const { MemoryTokenBucketStore, setRateLimitStore } = require('../src/middleware/rateLimit');
+const { connectWebSocket } = require('./helpers/webSocketClient');
+
+const wait = ms => new Promise(resolve => setTimeout(resolve, ms));
+
+// Serve /api/scan/stream with scanBatch standing in for the scanner
+async function useStreamServer(t, scanBatch) {
+  const server = http.createServer((req, res) => res.writeHead(426).end());
+  server.on('upgrade', (req, socket, head) => {
+    req.correlationId = 'corr-stream';
+    req.ip = '203.0.113.7';
+    req.get = name => req.headers[name.toLowerCase()];
+    acceptWebSocket(req, socket, head, {
+      maxMessageBytes: config.webSocket.maxMessageBytes,
+      headers: { 'X-Correlation-ID': req.correlationId }
+    }, ws => streamBatchScan(req, ws, scanBatch));
+  });
+  await new Promise(resolve => server.listen(0, '127.0.0.1', resolve));
+  t.after(() => new Promise(resolve => server.close(resolve)));
+  return server.address().port;
+}
+
+// Scans that take request.options.delay ms; "fail" inputs fail
+function fakeScanBatch(requests, warnings, context, onResult) {
+  return runBatch(requests, async (request, index) => {
+    await wait(request.options.delay);
+    return request.input.includes('fail')
+      ? { scanId: `scan_${index}`, error: 'Scan failed', code: 'SCAN_FAILED' }
+      : { scanId: `scan_${index}`, violations: new Array(index + 1).fill({}) };
+  }, { concurrency: 4, signal: context.signal, onResult });
+}
+
+const scan = (input, delay) => ({ type: 'url', input, options: { delay } });
+
+test('streams a result per scan as it finishes, then a summary', async t => {
+  const port = await useStreamServer(t, fakeScanBatch);
+  const ws = await connectWebSocket(port, '/api/scan/stream');
+  assert.equal(ws.headers['x-correlation-id'], 'corr-stream');
+
+  ws.send({
+    requests: [
+      scan('https://a.example/', 40),
+      scan('https://fail.example/', 0),
+      scan('https://c.example/', 20)
+    ]
+  });
+  const { code } = await ws.closed;
+
+  assert.equal(code, 1000);
+  assert.deepEqual(ws.messages, [
+    { type: 'result', index: 1, scanId: 'scan_1', status: 'failed', violationsCount: null, error: 'Scan failed', code: 'SCAN_FAILED' },
+    { type: 'result', index: 2, scanId: 'scan_2', status: 'succeeded', violationsCount: 3 },
+    { type: 'result', index: 0, scanId: 'scan_0', status: 'succeeded', violationsCount: 1 },
+    { type: 'summary', correlationId: 'corr-stream', summary: { total: 3, succeeded: 2, failed: 1 } }
+  ]);
+});
+
+test('rejects a message that is not JSON', async t => {
+  const port = await useStreamServer(t, fakeScanBatch);
+  const ws = await connectWebSocket(port, '/api/scan/stream');
+
+  ws.send('not json');
+  const { code, reason } = await ws.closed;
+
+  assert.equal(code, 1008);
+  assert.equal(reason, 'Batch request must be JSON');
+  assert.deepEqual(ws.messages, [
+    { type: 'error', error: 'Batch request must be JSON', code: 'INVALID_INPUT' }
+  ]);
+});
+
+test('rejects a binary message', async t => {
+  const port = await useStreamServer(t, fakeScanBatch);
+  const ws = await connectWebSocket(port, '/api/scan/stream');
+
+  ws.sendFrame(0x2, Buffer.from([1, 2, 3]));
+  assert.deepEqual(await ws.closed, { code: 1003, reason: 'Binary messages are not supported' });
+  assert.deepEqual(ws.messages, [
+    { type: 'error', error: 'Binary messages are not supported', code: 'INVALID_INPUT' }
+  ]);
+});
+
+test('rejects an invalid batch request with validation details', async t => {
+  let scanned = false;
+  const port = await useStreamServer(t, () => { scanned = true; });
+  const ws = await connectWebSocket(port, '/api/scan/stream');
+
+  ws.send({ requests: [] });
+  const { code } = await ws.closed;
+
+  assert.equal(code, 1008);
+  assert.equal(scanned, false);
+  assert.equal(ws.messages.length, 1);
+  assert.equal(ws.messages[0].type, 'error');
+  assert.equal(ws.messages[0].error, 'Validation Error');
+  assert.equal(ws.messages[0].code, 'INVALID_INPUT');
+  assert.ok(ws.messages[0].details.length > 0);
+});
+
+test('charges the rate limit a token per scan', async t => {
+  const rateLimit = { ...config.rateLimit };
+  Object.assign(config.rateLimit, { enabled: true, windowMs: 60000, maxRequests: 2, burst: 2 });
+  setRateLimitStore(new MemoryTokenBucketStore());
+  t.after(() => {
+    Object.assign(config.rateLimit, rateLimit);
+    setRateLimitStore(new MemoryTokenBucketStore());
+  });
+
+  const port = await useStreamServer(t, fakeScanBatch);
+  const first = await connectWebSocket(port, '/api/scan/stream');
+  first.send({ requests: [scan('https://a.example/', 0), scan('https://b.example/', 0)] });
+  assert.equal((await first.closed).code, 1000);
+
+  const ws = await connectWebSocket(port, '/api/scan/stream');
+  ws.send({ requests: [scan('https://c.example/', 0)] });
+  const { code } = await ws.closed;
+
+  assert.equal(code, 1008);
+  assert.equal(ws.messages.length, 1);
+  assert.equal(ws.messages[0].code, 'RATE_LIMITED');
+  assert.equal(ws.messages[0].retryAfter, 30);
+});
+
+test('closes the connection when no request arrives in time', async t => {
+  const messageTimeout = config.webSocket.messageTimeout;
+  config.webSocket.messageTimeout = 20;
+  t.after(() => { config.webSocket.messageTimeout = messageTimeout; });
+
+  const port = await useStreamServer(t, fakeScanBatch);
+  const ws = await connectWebSocket(port, '/api/scan/stream');
+  const { code } = await ws.closed;
+
+  assert.equal(code, 1008);
+  assert.deepEqual(ws.messages, [
+    { type: 'error', error: 'No batch request received', code: 'INVALID_INPUT' }
+  ]);
+});
+
+test('cancels outstanding scans when the client disconnects', async t => {
+  let signal;
+  let started = 0;
+  const port = await useStreamServer(t, (requests, warnings, context, onResult) => {
+    signal = context.signal;
+    return runBatch(requests, async () => {
+      started++;
+      await wait(20);
+      return { scanId: `scan_${started}`, violations: [] };
+    }, { concurrency: 1, signal: context.signal, onResult });
+  });
+  const ws = await connectWebSocket(port, '/api/scan/stream');
+
+  ws.send({ requests: [scan('https://a.example/'), scan('https://b.example/'), scan('https://c.example/')] });
+  const first = await ws.nextMessage();
+  assert.equal(first.type, 'result');
+  ws.socket.destroy();
+
+  await wait(60);
+  assert.equal(signal.aborted, true);
+  assert.ok(started < 3);
+});
+
+test('reports a failed batch as an internal error', async t => {
+  const port = await useStreamServer(t, async () => { throw new Error('pool exploded'); });
+  const ws = await connectWebSocket(port, '/api/scan/stream');
+
+  ws.send({ requests: [scan('https://a.example/', 0)] });
+  const { code } = await ws.closed;
+
+  assert.equal(code, 1011);
+  assert.deepEqual(ws.messages, [
+    { type: 'error', error: 'Internal Server Error', code: 'INTERNAL_ERROR' }
+  ]);
+});
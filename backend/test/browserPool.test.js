@@ -0,0 +1,137 @@
+const { test } = require('node:test');
+const assert = require('node:assert/strict');
+const { BrowserPool } = require('../src/services/browserPool');
+const { browserPoolGauge, browserAcquireWait } = require('../src/services/metrics');
+
+// Pool whose browsers are fakes created on demand
+function fakePool(options = {}) {
+  const pool = new BrowserPool({ minSize: 0, maxSize: 2, reservedSize: 0, ...options });
+  let created = 0;
+  pool.createBrowser = async function () {
+    const browser = {
+      id: ++created,
+      _poolMetadata: { createdAt: Date.now(), acquireCount: 0, lastAcquired: null, healthy: true },
+      isConnected: () => true,
+      pages: async () => [],
+      close: async () => {}
+    };
+    this.pool.push(browser);
+    this.metrics.totalCreated++;
+    return browser;
+  };
+  return pool;
+}
+
+test('a canceled request leaves the queue without a browser', async () => {
+  const pool = fakePool({ maxSize: 1 });
+  const busy = await pool.acquire(1000);
+  const controller = new AbortController();
+  controller.abort();
+
+  await assert.rejects(pool.acquire(1000, 'normal', controller.signal), { name: 'AbortError' });
+  assert.equal(pool.queue.length, 0);
+
+  await pool.release(busy);
+  assert.equal(pool.activeCount, 0);
+});
+
+test('canceling a queued request frees its place', async () => {
+  const pool = fakePool({ maxSize: 1 });
+  const busy = await pool.acquire(1000);
+  const controller = new AbortController();
+
+  const waiting = pool.acquire(1000, 'normal', controller.signal);
+  assert.equal(pool.queue.length, 1);
+  controller.abort();
+
+  await assert.rejects(waiting, { name: 'AbortError' });
+  assert.equal(pool.queue.length, 0);
+  await pool.release(busy);
+  assert.equal(pool.pool.length, 1);
+});
+
+test('normal requests cannot use reserved browsers', async () => {
+  const pool = fakePool({ maxSize: 3, reservedSize: 1 });
+  await pool.acquire(1000);
+  await pool.acquire(1000);
+
+  assert.equal(pool.capacityFor('normal'), 2);
+  await assert.rejects(pool.acquire(20), { queueTimeout: true });
+
+  const reserved = await pool.acquire(1000, 'high');
+  assert.equal(pool.activeCount, 3);
+  await pool.release(reserved);
+});
+
+test('released browsers go to queued high-priority requests first', async () => {
+  const pool = fakePool({ maxSize: 2, reservedSize: 1 });
+  const first = await pool.acquire(1000, 'high');
+  const second = await pool.acquire(1000, 'high');
+  const served = [];
+
+  const normal = pool.acquire(1000, 'normal').then(browser => served.push(['normal', browser]));
+  const high = pool.acquire(1000, 'high').then(browser => served.push(['high', browser]));
+  assert.equal(pool.queue.length, 2);
+
+  await pool.release(first);
+  await high;
+  assert.deepEqual(served, [['high', first]]);
+
+  // Two browsers active leaves no room for normal requests yet
+  await pool.release(second);
+  assert.equal(pool.queue.length, 1);
+  const [, browser] = served[0];
+  await pool.release(browser);
+  await normal;
+  assert.deepEqual(served.map(([priority]) => priority), ['high', 'normal']);
+  assert.equal(pool.activeCount, 1);
+});
+
+async function poolGauge() {
+  const { values } = await browserPoolGauge.get();
+  return Object.fromEntries(values.map(({ labels, value }) => [labels.status, value]));
+}
+
+async function acquireWaits(priority) {
+  const { values } = await browserAcquireWait.get();
+  const sample = suffix => values.find(value =>
+    value.metricName === `wcagai_browser_acquire_wait_seconds_${suffix}` && value.labels.priority === priority);
+  return { count: sample('count') ? sample('count').value : 0, sum: sample('sum') ? sample('sum').value : 0 };
+}
+
+test('keeps the pool size gauges current as browsers are acquired and queued', async () => {
+  const pool = fakePool({ maxSize: 1 });
+
+  const busy = await pool.acquire(1000);
+  assert.deepEqual(await poolGauge(), { available: 0, active: 1, queued: 0 });
+
+  const waiting = pool.acquire(1000);
+  assert.deepEqual(await poolGauge(), { available: 0, active: 1, queued: 1 });
+
+  await pool.release(busy);
+  await pool.release(await waiting);
+  assert.deepEqual(await poolGauge(), { available: 1, active: 0, queued: 0 });
+});
+
+test('records how long requests waited for a browser', async () => {
+  browserAcquireWait.reset();
+  const pool = fakePool({ maxSize: 1 });
+
+  const busy = await pool.acquire(1000, 'high');
+  assert.deepEqual(await acquireWaits('high'), { count: 1, sum: 0 });
+
+  const waiting = pool.acquire(1000, 'high');
+  await new Promise(resolve => setTimeout(resolve, 50));
+  await pool.release(busy);
+  await pool.release(await waiting);
+
+  const waits = await acquireWaits('high');
+  assert.equal(waits.count, 2);
+  assert.ok(waits.sum >= 0.04, `waited ${waits.sum}s`);
+
+  // Requests that time out in the queue count their wait too
+  const held = await pool.acquire(1000);
+  await assert.rejects(pool.acquire(20), { queueTimeout: true });
+  assert.equal((await acquireWaits('normal')).count, 2);
+  await pool.release(held);
+});
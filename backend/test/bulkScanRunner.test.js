@@ -0,0 +1,159 @@
+const { test } = require('node:test');
+const assert = require('node:assert/strict');
+const { BulkScanRunner } = require('../src/services/bulkScanRunner');
+
+const urls = Array.from({ length: 5 }, (_, i) => `https://example.com/page-${i}`);
+
+// Scan taking ms per page that gives up when its signal aborts
+function slowScan(ms) {
+  const scanned = [];
+  const scan = (url, options, { signal }) => new Promise((resolve, reject) => {
+    const timer = setTimeout(() => {
+      scanned.push(url);
+      resolve({ url, violations: [], metadata: {} });
+    }, ms);
+    signal.addEventListener('abort', () => {
+      clearTimeout(timer);
+      reject(Object.assign(new Error('Scan canceled'), { name: 'AbortError' }));
+    }, { once: true });
+  });
+  return { scan, scanned };
+}
+
+test('stops at the maximum duration and keeps partial results', async () => {
+  const { scan, scanned } = slowScan(100);
+  const runner = new BulkScanRunner({ scan, maxDuration: 250, dedupContent: false });
+
+  const status = await runner.run('batch-1', urls, {}, { concurrency: 1 });
+
+  assert.equal(status.status, 'timed_out');
+  assert.equal(status.results.length, 2);
+  assert.deepEqual(status.results.map(result => result.url), scanned);
+  assert.deepEqual(status.errors, [{
+    url: urls[2],
+    error: 'Bulk scan exceeded its maximum duration',
+    code: undefined,
+    scheme: undefined
+  }]);
+  assert.equal(status.progress, 3);
+  assert.equal(runner.get('batch-1'), status);
+});
+
+test('completes batches that finish within the maximum duration', async () => {
+  const { scan } = slowScan(10);
+  const runner = new BulkScanRunner({ scan, maxDuration: 1000, dedupContent: false });
+
+  const status = await runner.run('batch-2', urls, {}, { concurrency: 2 });
+
+  assert.equal(status.status, 'completed');
+  assert.equal(status.results.length, urls.length);
+  assert.equal(status.progress, urls.length);
+});
+
+test('cancels a running batch, aborting scans in flight and skipping queued URLs', async () => {
+  const { scan, scanned } = slowScan(50);
+  const runner = new BulkScanRunner({ scan, maxDuration: 0, dedupContent: false });
+
+  const running = runner.run('batch-3', urls, {}, { concurrency: 2 });
+  await new Promise(resolve => setTimeout(resolve, 75));
+  assert.equal(runner.cancel('batch-3'), true);
+  const status = await running;
+
+  assert.equal(status.status, 'canceled');
+  assert.deepEqual(status.results.map(result => result.url), scanned);
+  assert.deepEqual(scanned, urls.slice(0, 2));
+  assert.deepEqual(status.errors.map(error => [error.url, error.error]), [
+    [urls[2], 'Bulk scan was canceled'],
+    [urls[3], 'Bulk scan was canceled']
+  ]);
+  assert.equal(status.progress, 4);
+});
+
+test('cancels a batch before its first scan finishes', async () => {
+  const { scan, scanned } = slowScan(50);
+  const runner = new BulkScanRunner({ scan, maxDuration: 0, dedupContent: false });
+
+  const running = runner.run('batch-4', urls, {}, { concurrency: 1 });
+  assert.equal(runner.cancel('batch-4'), true);
+  const status = await running;
+
+  assert.equal(status.status, 'canceled');
+  assert.deepEqual(scanned, []);
+  assert.equal(status.errors.length, 1);
+});
+
+test('leaves finished batches unchanged when canceled', async () => {
+  const { scan } = slowScan(1);
+  const runner = new BulkScanRunner({ scan, maxDuration: 0, dedupContent: false });
+
+  const status = await runner.run('batch-5', urls, {}, { concurrency: 5 });
+
+  assert.equal(runner.cancel('batch-5'), false);
+  assert.equal(runner.get('batch-5'), status);
+  assert.equal(status.status, 'completed');
+  assert.equal(runner.cancel('batch-unknown'), false);
+});
+
+test('records the client that submitted a batch', async () => {
+  const { scan } = slowScan(1);
+  const runner = new BulkScanRunner({ scan, maxDuration: 0, dedupContent: false });
+
+  await runner.run('batch-6', urls, {}, { owner: 'key:abc' });
+  await runner.run('batch-7', urls, {});
+
+  assert.equal(runner.isOwner('batch-6', 'key:abc'), true);
+  assert.equal(runner.isOwner('batch-6', 'ip:10.0.0.1'), false);
+  assert.equal(runner.isOwner('batch-7', 'ip:10.0.0.1'), true);
+});
+
+test('counts the batches each client has processing until they end', async () => {
+  const { scan } = slowScan(20);
+  const runner = new BulkScanRunner({ scan, maxDuration: 0, dedupContent: false });
+
+  const first = runner.run('batch-8', urls.slice(0, 1), {}, { owner: 'key:abc' });
+  const second = runner.run('batch-9', urls, {}, { owner: 'key:abc' });
+  runner.run('batch-10', urls.slice(0, 1), {}, { owner: 'ip:10.0.0.1' });
+
+  assert.equal(runner.activeCount('key:abc'), 2);
+  assert.equal(runner.activeCount('ip:10.0.0.1'), 1);
+  assert.equal(runner.activeCount('key:other'), 0);
+
+  await first;
+  assert.equal(runner.activeCount('key:abc'), 1);
+
+  runner.cancel('batch-9');
+  await second;
+  assert.equal(runner.activeCount('key:abc'), 0);
+});
+
+test('frees a client\'s capacity when a batch fails', async () => {
+  const runner = new BulkScanRunner({
+    scan: async url => ({ url, violations: [], metadata: {} }),
+    onResult: () => {
+      throw new Error('Publisher exploded');
+    },
+    maxDuration: 0,
+    dedupContent: false
+  });
+
+  await assert.rejects(runner.run('batch-11', urls, {}, { owner: 'key:abc' }), /Publisher exploded/);
+  assert.equal(runner.activeCount('key:abc'), 0);
+});
+
+test('reports template issues alongside per-page results when asked', async () => {
+  const scan = async url => ({
+    url,
+    violations: [{ id: 'image-alt', nodes: [{ target: ['#logo > img'] }] }],
+    metadata: {}
+  });
+  const runner = new BulkScanRunner({ scan, maxDuration: 0, dedupContent: false });
+
+  const grouped = await runner.run('batch-12', urls.slice(0, 3), { groupTemplateIssues: true });
+  const plain = await runner.run('batch-13', urls.slice(0, 3), {});
+
+  assert.equal(grouped.results.length, 3);
+  assert.deepEqual(grouped.templateIssues.map(issue => [issue.ruleId, issue.selector, issue.pageCount]), [
+    ['image-alt', '#logo > img', 3]
+  ]);
+  assert.equal(plain.templateIssues, undefined);
+});
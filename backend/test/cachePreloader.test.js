@@ -0,0 +1,98 @@
+const { test } = require('node:test');
+const assert = require('node:assert/strict');
+const { CachePreloader } = require('../src/services/cachePreloader');
+
+const urls = ['https://example.com/', 'https://example.com/pricing', 'https://example.com/about'];
+
+// Cache recording what the preloader stored under which key
+function fakeCache() {
+  return {
+    enabled: true,
+    stored: [],
+    key: (type, input) => `${type}:${input}`,
+    setResult(key, result) {
+      this.stored.push(key);
+      return result;
+    }
+  };
+}
+
+const sleep = ms => new Promise(resolve => setTimeout(resolve, ms));
+
+test('scans every configured URL on start and again each interval', async t => {
+  const scanned = [];
+  const cache = fakeCache();
+  const preloader = new CachePreloader({
+    urls,
+    interval: 100,
+    concurrency: 2,
+    cache,
+    scan: async url => {
+      scanned.push(url);
+      return { url };
+    }
+  });
+  t.after(() => preloader.stop());
+
+  preloader.start();
+  await sleep(50);
+  assert.deepEqual(scanned, urls);
+  assert.deepEqual(cache.stored, urls.map(url => `url:${url}`));
+
+  await sleep(100);
+  assert.deepEqual(scanned, [...urls, ...urls]);
+  assert.equal(preloader.getStats().metrics.runs, 2);
+});
+
+test('runs at most the concurrency limit of scans at once', async () => {
+  let running = 0;
+  let peak = 0;
+  const preloader = new CachePreloader({
+    urls: [...urls, 'https://example.com/contact'],
+    interval: 60000,
+    concurrency: 2,
+    cache: fakeCache(),
+    scan: async url => {
+      peak = Math.max(peak, ++running);
+      await sleep(10);
+      running--;
+      return { url };
+    }
+  });
+
+  await preloader.runOnce();
+
+  assert.equal(peak, 2);
+  assert.equal(preloader.getStats().metrics.scans, 4);
+});
+
+test('counts failed scans and keeps going', async () => {
+  const cache = fakeCache();
+  const preloader = new CachePreloader({
+    urls,
+    interval: 60000,
+    concurrency: 1,
+    cache,
+    scan: async url => {
+      if (url.endsWith('/pricing')) throw new Error('Scan failed');
+      return { url };
+    }
+  });
+
+  await preloader.runOnce();
+
+  assert.equal(preloader.getStats().metrics.failures, 1);
+  assert.equal(cache.stored.length, 2);
+});
+
+test('does not start without URLs or with the cache disabled', () => {
+  let scans = 0;
+  const scan = async () => { scans++; };
+
+  new CachePreloader({ urls: [], interval: 10, concurrency: 1, cache: fakeCache(), scan }).start();
+  const disabled = new CachePreloader({ urls, interval: 10, concurrency: 1, cache: { ...fakeCache(), enabled: false }, scan });
+  disabled.start();
+
+  assert.equal(scans, 0);
+  assert.equal(disabled.timer, null);
+});
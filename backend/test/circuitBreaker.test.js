@@ -0,0 +1,125 @@
+const { test } = require('node:test');
+const assert = require('node:assert/strict');
+const { scanner, useFakeBrowser } = require('./helpers/fakeBrowser');
+const { CircuitBreaker, manager } = require('../src/services/circuitBreaker');
+
+const wait = ms => new Promise(resolve => setTimeout(resolve, ms));
+const failing = () => Promise.reject(new Error('Service down'));
+
+async function trip(breaker) {
+  for (let i = 0; i < breaker.failureThreshold; i++) {
+    await assert.rejects(breaker.execute(failing), /Service down/);
+  }
+  assert.equal(breaker.state, 'OPEN');
+}
+
+test('closes an open circuit as soon as a health probe succeeds', async t => {
+  let healthy = false;
+  const breaker = new CircuitBreaker({
+    failureThreshold: 2,
+    resetTimeout: 60000,
+    healthCheck: async () => healthy,
+    healthCheckInterval: 20
+  });
+  t.after(() => breaker.stopHealthChecks());
+
+  await trip(breaker);
+  await wait(70);
+  assert.equal(breaker.state, 'OPEN');
+  assert.ok(breaker.metrics.totalProbes >= 2);
+
+  healthy = true;
+  await wait(40);
+  assert.equal(breaker.state, 'CLOSED');
+  assert.equal(breaker.healthCheckTimer, null);
+  assert.equal(await breaker.execute(async () => 'ok'), 'ok');
+});
+
+test('keeps the circuit open while probes fail or time out', async t => {
+  let probe = failing;
+  const breaker = new CircuitBreaker({
+    failureThreshold: 1,
+    resetTimeout: 60000,
+    timeout: 30,
+    healthCheck: () => probe(),
+    healthCheckInterval: 10
+  });
+  t.after(() => breaker.stopHealthChecks());
+
+  await trip(breaker);
+  await wait(40);
+  assert.equal(breaker.state, 'OPEN');
+
+  probe = () => new Promise(() => {});
+  await wait(80);
+  assert.equal(breaker.state, 'OPEN');
+  await assert.rejects(breaker.execute(async () => 'ok'), error => error.circuitOpen);
+});
+
+test('does not probe without a health check', async () => {
+  const breaker = new CircuitBreaker({ failureThreshold: 1, resetTimeout: 60000 });
+
+  await trip(breaker);
+
+  assert.equal(breaker.healthCheckTimer, null);
+  assert.equal(breaker.getStatus().config.healthCheckInterval, null);
+});
+
+test('opens after repeated failures, half-opens after the reset timeout and closes on success', async () => {
+  const states = [];
+  const breaker = new CircuitBreaker({ failureThreshold: 3, successThreshold: 2, resetTimeout: 30 });
+  ['open', 'halfOpen', 'close'].forEach(event => breaker.on(event, () => states.push(event)));
+
+  await trip(breaker);
+  await assert.rejects(breaker.execute(async () => 'ok'), error => error.circuitOpen && error.retryAfter <= 30);
+  assert.equal(breaker.metrics.totalRejections, 1);
+
+  await wait(40);
+  assert.equal(await breaker.execute(async () => 'ok'), 'ok');
+  assert.equal(breaker.state, 'HALF_OPEN');
+  assert.equal(await breaker.execute(async () => 'ok'), 'ok');
+  assert.equal(breaker.state, 'CLOSED');
+  assert.deepEqual(states, ['open', 'halfOpen', 'close']);
+});
+
+test('reopens when a half-open trial fails', async () => {
+  const breaker = new CircuitBreaker({ failureThreshold: 2, resetTimeout: 30 });
+
+  await trip(breaker);
+  await wait(40);
+  await assert.rejects(breaker.execute(failing), /Service down/);
+
+  assert.equal(breaker.state, 'OPEN');
+  await assert.rejects(breaker.execute(async () => 'ok'), error => error.circuitOpen);
+});
+
+test('passes through errors that are not failures without counting them', async () => {
+  const breaker = new CircuitBreaker({ failureThreshold: 1, isFailure: error => !error.queueTimeout });
+  const queueTimeout = Object.assign(new Error('Timed out waiting for a browser'), { queueTimeout: true });
+
+  await assert.rejects(breaker.execute(() => Promise.reject(queueTimeout)), /Timed out waiting/);
+
+  assert.equal(breaker.state, 'CLOSED');
+  assert.equal(breaker.failures, 0);
+});
+
+test('flags calls it stopped waiting for', async () => {
+  const breaker = new CircuitBreaker({ timeout: 10 });
+
+  await assert.rejects(breaker.execute(() => new Promise(() => {})), error => error.breakerTimeout === true);
+});
+
+test('fails scans fast with BROWSER_UNAVAILABLE while the browser breaker is open', async t => {
+  const browserBreaker = manager.getBreaker('browser');
+  t.after(() => browserBreaker.close());
+  const browser = useFakeBrowser(t);
+
+  browserBreaker.open();
+  browserBreaker.stopHealthChecks();
+
+  await assert.rejects(
+    scanner.scanURL('https://example.com/', {}),
+    { code: 'BROWSER_UNAVAILABLE', browserUnavailable: true }
+  );
+  assert.equal(browser.acquired, 0);
+});
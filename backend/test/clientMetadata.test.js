@@ -0,0 +1,65 @@
+const { test } = require('node:test');
+const assert = require('node:assert/strict');
+const { ScanRequestSchema, BulkScanRequestSchema } = require('../src/schemas/validation');
+const { withClientMetadata } = require('../src/services/resultFormatter');
+const { BulkScanRunner } = require('../src/services/bulkScanRunner');
+const { ScanHistory } = require('../src/services/scanHistory');
+const config = require('../src/config');
+
+const clientMetadata = { build: 1234, commit: 'a1b2c3d', pr: 'https://github.com/example/site/pull/7', tags: ['nightly'] };
+
+test('accepts free-form objects within the size limit', () => {
+  const scan = ScanRequestSchema.safeParse({ type: 'url', input: 'https://example.com/', clientMetadata });
+  assert.equal(scan.success, true);
+  assert.deepEqual(scan.data.clientMetadata, clientMetadata);
+
+  const bulk = BulkScanRequestSchema.safeParse({ urls: ['https://example.com/'], clientMetadata });
+  assert.equal(bulk.success, true);
+});
+
+test('rejects oversized or non-object clientMetadata', () => {
+  const { maxClientMetadataBytes } = config.optionLimits;
+  const oversized = ScanRequestSchema.safeParse({
+    type: 'url',
+    input: 'https://example.com/',
+    clientMetadata: { notes: 'x'.repeat(maxClientMetadataBytes) }
+  });
+  assert.equal(oversized.success, false);
+  assert.equal(oversized.error.issues[0].message, `clientMetadata exceeds maximum size of ${maxClientMetadataBytes} bytes`);
+
+  for (const value of ['build-1234', ['a1b2c3d'], 42]) {
+    assert.equal(ScanRequestSchema.safeParse({ type: 'url', input: 'https://example.com/', clientMetadata: value }).success, false);
+  }
+});
+
+test('echoes clientMetadata verbatim under metadata.client', () => {
+  const result = { url: 'https://example.com/', metadata: { cache: 'miss', duration: 120 } };
+
+  assert.deepEqual(withClientMetadata(result, clientMetadata).metadata, {
+    cache: 'miss',
+    duration: 120,
+    client: clientMetadata
+  });
+  assert.equal(withClientMetadata(result, undefined), result);
+});
+
+test('echoes clientMetadata on every page of a bulk scan', async () => {
+  const scan = async url => ({ url, violations: [], metadata: { duration: 10 } });
+  const runner = new BulkScanRunner({ scan, maxDuration: 1000, dedupContent: false });
+
+  const status = await runner.run('batch-1', ['https://example.com/a', 'https://example.com/b'], {}, { clientMetadata });
+
+  assert.equal(status.results.length, 2);
+  for (const page of status.results) {
+    assert.deepEqual(page.metadata, { duration: 10, client: clientMetadata });
+  }
+});
+
+test('keeps clientMetadata in the scan history', async () => {
+  const history = new ScanHistory({ enabled: true, redisUrl: null, maxEntries: 10 });
+  const result = withClientMetadata({ url: 'https://example.com/', summary: { violations: 0 }, metadata: {} }, clientMetadata);
+
+  await history.record('scan_1', { type: 'url', input: 'https://example.com/', response: { scanId: 'scan_1', ...result } });
+
+  assert.deepEqual((await history.get('scan_1')).metadata.client, clientMetadata);
+});
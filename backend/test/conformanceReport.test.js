@@ -0,0 +1,81 @@
+const { test } = require('node:test');
+const assert = require('node:assert/strict');
+const { SUCCESS_CRITERIA, buildConformanceReport } = require('../src/services/conformanceReport');
+
+const rule = (id, tags, nodes = 1) => ({ id, tags, nodes: Array.from({ length: nodes }, () => ({})) });
+
+const imageAlt = nodes => rule('image-alt', ['wcag2a', 'wcag111'], nodes);
+const colorContrast = nodes => rule('color-contrast', ['wcag2aa', 'wcag143'], nodes);
+const documentTitle = rule('document-title', ['wcag2a', 'wcag242']);
+const htmlLang = rule('html-has-lang', ['wcag2a', 'wcag311']);
+
+const pages = [
+  {
+    url: 'https://example.com/',
+    violations: [imageAlt(2), colorContrast(1)],
+    passes: [documentTitle],
+    incomplete: [],
+    testEngine: { name: 'axe-core', version: '4.8.2' }
+  },
+  {
+    url: 'https://example.com/about',
+    violations: [imageAlt(3)],
+    passes: [documentTitle, colorContrast(0)],
+    incomplete: [htmlLang]
+  }
+];
+
+function criterion(report, id) {
+  return report.tables.flatMap(table => table.criteria).find(c => c.criterion === id);
+}
+
+test('lays out one table per level with every success criterion', () => {
+  const report = buildConformanceReport(pages);
+
+  assert.deepEqual(report.tables.map(table => table.title), [
+    'Table 1: Success Criteria, Level A',
+    'Table 2: Success Criteria, Level AA'
+  ]);
+  assert.equal(report.tables[0].criteria.length, SUCCESS_CRITERIA.A.length);
+  assert.equal(report.tables[1].criteria.length, SUCCESS_CRITERIA.AA.length);
+  assert.deepEqual(
+    buildConformanceReport(pages, { levels: ['A', 'AA', 'AAA'] }).tables.map(table => table.level),
+    ['A', 'AA', 'AAA']
+  );
+});
+
+test('derives each criterion from the pages it failed, passed or needs review on', () => {
+  const report = buildConformanceReport(pages);
+
+  assert.deepEqual(criterion(report, '1.1.1'), {
+    criterion: '1.1.1',
+    name: 'Non-text Content',
+    level: 'A',
+    conformance: 'Does Not Support',
+    remarks: 'Fails on all 2 pages: image-alt (5 elements)',
+    failedPages: ['https://example.com/', 'https://example.com/about']
+  });
+  assert.equal(criterion(report, '1.4.3').conformance, 'Partially Supports');
+  assert.equal(criterion(report, '1.4.3').remarks, 'Fails on 1 of 2 pages: color-contrast (1 elements)');
+  assert.equal(criterion(report, '2.4.2').conformance, 'Supports');
+  assert.equal(criterion(report, '3.1.1').conformance, 'Not Evaluated');
+  assert.equal(criterion(report, '3.1.1').remarks, 'Automated checks were inconclusive; needs manual review');
+  assert.equal(criterion(report, '2.1.1').remarks, 'Not covered by automated checks; needs manual review');
+});
+
+test('summarizes the conformance levels and the scope of the scan', () => {
+  const report = buildConformanceReport(pages);
+  const criteria = SUCCESS_CRITERIA.A.length + SUCCESS_CRITERIA.AA.length;
+
+  assert.deepEqual(report.summary, {
+    supports: 1,
+    partiallySupports: 1,
+    doesNotSupport: 1,
+    notEvaluated: criteria - 3
+  });
+  assert.deepEqual(report.scope, { pages: pages.map(page => page.url), pagesEvaluated: 2 });
+  assert.equal(report.productName, 'example.com');
+  assert.equal(report.draft, true);
+  assert.match(report.evaluationMethods, /^Automated testing with axe-core 4\.8\.2\./);
+  assert.equal(buildConformanceReport(pages, { productName: 'Example Store' }).productName, 'Example Store');
+});
@@ -0,0 +1,48 @@
+const { test } = require('node:test');
+const assert = require('node:assert/strict');
+const { scanner, useFakeBrowser } = require('./helpers/fakeBrowser');
+
+function button(visible = true) {
+  return {
+    clicks: 0,
+    isIntersectingViewport: async () => visible,
+    async click() { this.clicks++; }
+  };
+}
+
+test('clicks the first visible consent button and reports it', async t => {
+  const accept = button();
+  const browser = useFakeBrowser(t, {
+    elements: { '#hidden-accept': button(false), '.cookie-accept': accept }
+  });
+
+  const result = await scanner.scanURL('https://example.com/', {
+    dismissConsent: true,
+    consentSelectors: ['#missing', '#hidden-accept', '.cookie-accept', '#never-tried']
+  });
+
+  assert.equal(result.metadata.consentDismissed, true);
+  assert.equal(accept.clicks, 1);
+  assert.deepEqual(browser.pages[0].called('$').map(([selector]) => selector), ['#missing', '#hidden-accept', '.cookie-accept']);
+});
+
+test('reports when no consent banner was found', async t => {
+  useFakeBrowser(t);
+
+  const result = await scanner.scanURL('https://example.com/', {
+    dismissConsent: true,
+    consentSelectors: ['#onetrust-accept-btn-handler']
+  });
+
+  assert.equal(result.metadata.consentDismissed, false);
+});
+
+test('leaves banners alone unless asked', async t => {
+  const accept = button();
+  const browser = useFakeBrowser(t, { elements: { '.cookie-accept': accept } });
+
+  const result = await scanner.scanURL('https://example.com/', {});
+
+  assert.equal(result.metadata.consentDismissed, undefined);
+  assert.equal(browser.pages[0].called('$').length, 0);
+});
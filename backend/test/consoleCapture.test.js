@@ -0,0 +1,73 @@
+const { test } = require('node:test');
+const assert = require('node:assert/strict');
+const { scanner, useFakeBrowser } = require('./helpers/fakeBrowser');
+const config = require('../src/config');
+
+const consoleMessage = (type, text) => ({ type: () => type, text: () => text });
+
+// Page behavior logging count console errors and a warning, then throwing
+// an uncaught exception, while it loads
+function erroringPage(count) {
+  return {
+    delays: {
+      goto: async page => {
+        for (let i = 0; i < count; i++) {
+          page.emit('console', consoleMessage('error', `Failed to load widget ${i}`));
+        }
+        page.emit('console', consoleMessage('warning', 'Deprecated API'));
+        page.emit('pageerror', new Error('app is not defined'));
+      }
+    }
+  };
+}
+
+function withMaxConsoleErrors(t, max) {
+  const previous = config.maxConsoleErrors;
+  config.maxConsoleErrors = max;
+  t.after(() => {
+    config.maxConsoleErrors = previous;
+  });
+}
+
+test('reports console errors and uncaught exceptions in metadata', async t => {
+  useFakeBrowser(t, erroringPage(2));
+
+  const result = await scanner.scanURL('https://example.com/', { captureConsole: true });
+
+  assert.deepEqual(result.metadata.consoleErrors, [
+    { source: 'console', message: 'Failed to load widget 0' },
+    { source: 'console', message: 'Failed to load widget 1' },
+    { source: 'exception', message: 'app is not defined' }
+  ]);
+  assert.equal(result.metadata.consoleErrorsDropped, 0);
+});
+
+test('caps captured errors and counts the rest', async t => {
+  withMaxConsoleErrors(t, 3);
+  useFakeBrowser(t, erroringPage(5));
+
+  const result = await scanner.scanURL('https://example.com/', { captureConsole: true });
+
+  assert.equal(result.metadata.consoleErrors.length, 3);
+  assert.equal(result.metadata.consoleErrorsDropped, 3);
+});
+
+test('truncates long messages', async t => {
+  useFakeBrowser(t, {
+    delays: {
+      goto: async page => page.emit('console', consoleMessage('error', 'x'.repeat(5000)))
+    }
+  });
+
+  const result = await scanner.scanURL('https://example.com/', { captureConsole: true });
+
+  assert.equal(result.metadata.consoleErrors[0].message.length, 1000);
+});
+
+test('captures nothing unless requested', async t => {
+  useFakeBrowser(t, erroringPage(2));
+
+  const result = await scanner.scanURL('https://example.com/', {});
+
+  assert.equal(result.metadata.consoleErrors, undefined);
+});
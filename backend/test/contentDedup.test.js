@@ -0,0 +1,32 @@
+const { test } = require('node:test');
+const assert = require('node:assert/strict');
+const { scanner, axe, useFakeBrowser } = require('./helpers/fakeBrowser');
+
+test('scans identical content reached under two URLs once', async t => {
+  useFakeBrowser(t, { html: '<html><body><h1>Home</h1></body></html>' });
+  const fingerprints = new Map();
+
+  const [first, second] = await Promise.all([
+    scanner.scanURL('https://example.com/', {}, { fingerprints }),
+    scanner.scanURL('https://example.com/index.html', {}, { fingerprints })
+  ]);
+
+  assert.equal(axe.runs.length, 1);
+  assert.ok(first.violations);
+  assert.equal(second.url, 'https://example.com/index.html');
+  assert.equal(second.duplicateOf, 'https://example.com/');
+  assert.match(second.contentHash, /^[0-9a-f]{64}$/);
+});
+
+test('scans pages with different content separately', async t => {
+  const browser = useFakeBrowser(t, { html: '<p>one</p>' });
+  const fingerprints = new Map();
+
+  await scanner.scanURL('https://example.com/a', {}, { fingerprints });
+  browser.behavior.html = '<p>two</p>';
+  const second = await scanner.scanURL('https://example.com/b', {}, { fingerprints });
+
+  assert.equal(axe.runs.length, 2);
+  assert.equal(second.duplicateOf, undefined);
+  assert.equal(fingerprints.size, 2);
+});
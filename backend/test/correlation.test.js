@@ -0,0 +1,73 @@
+const { test } = require('node:test');
+const assert = require('node:assert/strict');
+const { scanner, useFakeBrowser } = require('./helpers/fakeBrowser');
+const { correlationIdMiddleware } = require('../src/middleware/correlationId');
+const config = require('../src/config');
+
+function correlate(headers = {}) {
+  const req = { headers, method: 'POST', path: '/api/scan', ip: '127.0.0.1' };
+  const responseHeaders = {};
+  const res = { setHeader: (name, value) => { responseHeaders[name] = value; } };
+  correlationIdMiddleware(req, res, () => {});
+  return { req, responseHeaders };
+}
+
+function forwardCorrelationId(t) {
+  const previous = config.correlation.forward;
+  config.correlation.forward = true;
+  t.after(() => {
+    config.correlation.forward = previous;
+  });
+}
+
+test('reuses a client request ID and echoes it back', () => {
+  const { req, responseHeaders } = correlate({ 'x-request-id': 'client-123' });
+
+  assert.equal(req.correlationId, 'client-123');
+  assert.equal(responseHeaders['X-Correlation-ID'], 'client-123');
+  assert.equal(responseHeaders['X-Request-ID'], 'client-123');
+});
+
+test('generates a request ID when the client sent none or an unsafe one', () => {
+  const generated = correlate();
+  const unsafe = correlate({ 'x-correlation-id': 'id\nforged log line' });
+
+  assert.match(generated.req.correlationId, /^req_\d+_[0-9a-f]{16}$/);
+  assert.match(unsafe.req.correlationId, /^req_/);
+  assert.equal(unsafe.responseHeaders['X-Correlation-ID'], unsafe.req.correlationId);
+});
+
+test('forwards the request ID to the scanned site when enabled', async t => {
+  forwardCorrelationId(t);
+  const browser = useFakeBrowser(t);
+
+  await scanner.scanURL('https://example.com/', {}, { correlationId: 'client-123' });
+
+  const headers = browser.pages[0].called('setExtraHTTPHeaders').map(([value]) => value);
+  assert.ok(headers.some(value => value[config.correlation.requestHeader] === 'client-123'));
+});
+
+test('does not forward the request ID by default', async t => {
+  const browser = useFakeBrowser(t);
+
+  await scanner.scanURL('https://example.com/', {}, { correlationId: 'client-123' });
+
+  const headers = browser.pages[0].called('setExtraHTTPHeaders').map(([value]) => value);
+  assert.ok(headers.every(value => !Object.values(value).includes('client-123')));
+});
+
+test('reports the scanned site\'s own request ID as backendRequestId', async t => {
+  useFakeBrowser(t, { response: { status: 200, headers: { 'x-amzn-requestid': 'amzn-1', 'cf-ray': 'ray-1' } } });
+
+  const result = await scanner.scanURL('https://example.com/', {}, { correlationId: 'client-123' });
+
+  assert.equal(result.metadata.backendRequestId, 'amzn-1');
+});
+
+test('leaves backendRequestId out when the site sent none', async t => {
+  useFakeBrowser(t, { response: { status: 200, headers: { 'content-type': 'text/html' } } });
+
+  const result = await scanner.scanURL('https://example.com/', {});
+
+  assert.equal(result.metadata.backendRequestId, undefined);
+});
@@ -0,0 +1,134 @@
+const { test } = require('node:test');
+const assert = require('node:assert/strict');
+const fs = require('fs');
+const os = require('os');
+const path = require('path');
+const vm = require('vm');
+const { registerCheck, hasCheck, checkNames, loadChecks, runCustomChecks } = require('../src/services/customChecks');
+const { ScanRequestSchema } = require('../src/schemas/validation');
+
+// Just enough DOM for the page runner: elements with ids, tags and parents
+class Element {
+  constructor(tagName, { id = '', parent = null, html = `<${tagName}>` } = {}) {
+    this.nodeType = 1;
+    this.tagName = tagName.toUpperCase();
+    this.id = id;
+    this.outerHTML = html;
+    this.children = [];
+    this.parentElement = parent;
+    if (parent) parent.children.push(this);
+  }
+}
+
+function fakeDocument() {
+  const body = new Element('body');
+  const nav = new Element('nav', { id: 'menu', parent: body });
+  const links = [
+    new Element('a', { parent: nav, html: '<a target="_blank">Docs</a>' }),
+    new Element('a', { parent: nav, html: '<a target="_blank">Blog (opens in new tab)</a>' })
+  ];
+  const footerLink = new Element('a', { parent: new Element('footer', { parent: body }), html: '<a target="_blank">Status</a>' });
+  return { links, footerLink };
+}
+
+// Page evaluating scripts against globals, returning their results
+// serialized as page.evaluate does
+function fakePage(globals) {
+  const context = vm.createContext({ Element, CSS: { escape: value => value }, ...globals });
+  return { evaluate: async script => JSON.parse(JSON.stringify(await vm.runInContext(script, context))) };
+}
+
+const emptyResults = () => ({ violations: [], passes: [], incomplete: [] });
+
+test('reports failing elements as a violation with axe-style nodes', async () => {
+  registerCheck('new-tab-links', {
+    description: 'Ensures links opening a new tab say so',
+    help: 'Links opening a new tab must say so',
+    impact: 'serious',
+    tags: ['wcag2a', 'wcag322'],
+    run: () => [pageDocument.links[0], { element: pageDocument.footerLink, message: 'Footer link opens a new tab silently' }]
+  });
+  const results = emptyResults();
+
+  await runCustomChecks(fakePage({ pageDocument: fakeDocument() }), ['new-tab-links'], results);
+
+  assert.equal(results.violations.length, 1);
+  const [violation] = results.violations;
+  assert.equal(violation.id, 'custom/new-tab-links');
+  assert.equal(violation.impact, 'serious');
+  assert.deepEqual(violation.tags, ['custom', 'wcag2a', 'wcag322']);
+  assert.deepEqual(violation.nodes, [
+    {
+      html: '<a target="_blank">Docs</a>',
+      target: ['#menu > a:nth-of-type(1)'],
+      failureSummary: 'Links opening a new tab must say so',
+      impact: 'serious'
+    },
+    {
+      html: '<a target="_blank">Status</a>',
+      target: ['body > footer > a'],
+      failureSummary: 'Footer link opens a new tab silently',
+      impact: 'serious'
+    }
+  ]);
+});
+
+test('reports a pass when nothing fails and incomplete when the check throws', async () => {
+  registerCheck('always-passes', { run: async () => [] });
+  registerCheck('always-throws', {
+    run() { throw new Error('document.querySelector is not a function'); }
+  });
+  const results = emptyResults();
+
+  await runCustomChecks(fakePage({}), ['always-passes', 'always-throws'], results);
+
+  assert.deepEqual(results.passes.map(rule => rule.id), ['custom/always-passes']);
+  assert.deepEqual(results.incomplete.map(rule => [rule.id, rule.impact]), [['custom/always-throws', 'moderate']]);
+  assert.equal(results.violations.length, 0);
+});
+
+test('rejects invalid check definitions', () => {
+  assert.throws(() => registerCheck('Bad Name', { run: () => [] }), /Invalid custom check name/);
+  assert.throws(() => registerCheck('no-run', {}), /has no run function/);
+  assert.throws(() => registerCheck('bad-impact', { run: () => [], impact: 'urgent' }), /invalid impact/);
+  assert.equal(hasCheck('no-run'), false);
+});
+
+test('loads checks from a directory, named after their files', t => {
+  const dir = fs.mkdtempSync(path.join(os.tmpdir(), 'custom-checks-'));
+  t.after(() => fs.rmSync(dir, { recursive: true, force: true }));
+  fs.writeFileSync(path.join(dir, 'skip-links.js'), 'module.exports = { impact: "minor", run: () => [] };');
+  fs.writeFileSync(path.join(dir, 'README.md'), 'Not a check');
+
+  loadChecks(dir);
+
+  assert.ok(checkNames().includes('skip-links'));
+  assert.ok(!checkNames().includes('README'));
+});
+
+test('accepts only registered checks by name', () => {
+  registerCheck('heading-order-strict', { run: () => [] });
+  const parse = customChecks => ScanRequestSchema.safeParse({ type: 'url', input: 'https://example.com/', options: { customChecks } });
+
+  assert.equal(parse(['heading-order-strict']).success, true);
+  const unknown = parse(['heading-order-strict', 'rm-rf']);
+  assert.equal(unknown.success, false);
+  assert.equal(unknown.error.issues[0].message, 'Unknown custom checks: rm-rf');
+  assert.equal(parse(Array(21).fill('heading-order-strict')).success, false);
+});
+
+test('runs checks written as functions, arrows or methods', async () => {
+  const definitions = {
+    'plain-function': { run: function () { return [found]; } },
+    'arrow': { run: () => [found] },
+    'async-arrow': { run: async () => [found] },
+    'method': { run() { return [found]; } },
+    'async-method': { async run() { return [found]; } }
+  };
+  Object.entries(definitions).forEach(([name, definition]) => registerCheck(name, definition));
+  const results = emptyResults();
+
+  await runCustomChecks(fakePage({ found: new Element('img') }), Object.keys(definitions), results);
+
+  assert.deepEqual(results.violations.map(rule => rule.id), Object.keys(definitions).map(name => `custom/${name}`));
+});
@@ -0,0 +1,120 @@
+const { test } = require('node:test');
+const assert = require('node:assert/strict');
+const http = require('http');
+const { once } = require('events');
+const { scanner, axe, useFakeBrowser } = require('./helpers/fakeBrowser');
+const { scanHtmlDegraded, fetchHtml, DEGRADED_RULES } = require('../src/services/degradedScanner');
+const config = require('../src/config');
+
+const PAGE = '<html><head><title>Shop</title></head><body><h1>Shop</h1><h3>Deals</h3><img src="a.png"><img src="b.png" alt=""></body></html>';
+
+// Serve every request with handler, recording method, headers and body
+async function serve(t, handler) {
+  const requests = [];
+  const server = http.createServer(async (req, res) => {
+    let body = '';
+    for await (const chunk of req) body += chunk;
+    requests.push({ method: req.method, headers: req.headers, body });
+    handler(req, res);
+  });
+  server.listen(0, '127.0.0.1');
+  await once(server, 'listening');
+  t.after(() => server.close());
+  return { url: `http://127.0.0.1:${server.address().port}/`, requests };
+}
+
+// Fail browser acquisition with error, as the pool would
+function failAcquire(t, error) {
+  useFakeBrowser(t);
+  const { browserPool } = scanner;
+  const acquire = browserPool.acquire;
+  browserPool.acquire = async () => { throw error; };
+  t.after(() => { browserPool.acquire = acquire; });
+}
+
+function configure(t, section, values) {
+  const previous = { ...config[section] };
+  Object.assign(config[section], values);
+  t.after(() => Object.assign(config[section], previous));
+}
+
+test('checks the limited rule subset on raw HTML', () => {
+  const result = scanHtmlDegraded(PAGE, 'https://example.com/', { degradedReason: 'Browser launch failed' });
+
+  assert.deepEqual(result.violations.map(v => [v.id, v.nodes.map(node => node.target[0])]), [
+    ['image-alt', ['img:nth-of-type(1)']],
+    ['html-has-lang', ['html']],
+    ['heading-order', ['h3:nth-of-type(1)']]
+  ]);
+  assert.deepEqual(result.passes.map(p => p.id), ['document-title']);
+  assert.equal(result.metadata.degraded, true);
+  assert.equal(result.metadata.degradedReason, 'Browser launch failed');
+  assert.deepEqual(result.metadata.rulesChecked, DEGRADED_RULES);
+});
+
+test('falls back to the rule subset when browsers fail to launch', async t => {
+  configure(t, 'degradedMode', { enabled: true });
+  failAcquire(t, new Error('Failed to launch the browser process'));
+
+  const result = await scanner.scanHTML(PAGE, {});
+
+  assert.equal(result.metadata.degraded, true);
+  assert.equal(result.metadata.degradedReason, 'Failed to launch the browser process');
+  assert.equal(result.testEngine.name, 'wcagai-degraded');
+  assert.equal(axe.runs.length, 0);
+});
+
+test('sheds scans when the pool is only busy', async t => {
+  configure(t, 'degradedMode', { enabled: true });
+  failAcquire(t, Object.assign(new Error('Browser acquire timeout after 10ms'), { queueTimeout: true }));
+
+  await assert.rejects(scanner.scanHTML(PAGE, {}), error => error.code === 'OVERLOADED' && !error.browserUnavailable);
+});
+
+test('fetches URL scans with the scan\'s method, body and Accept header', async t => {
+  configure(t, 'degradedMode', { enabled: true });
+  configure(t, 'security', { blockPrivateIPs: false });
+  failAcquire(t, new Error('Failed to launch the browser process'));
+  const { url, requests } = await serve(t, (req, res) => res.end(PAGE));
+
+  const result = await scanner.scanURL(url, {
+    method: 'POST',
+    body: 'q=shoes',
+    acceptHeader: 'text/html',
+    timeout: 5000
+  });
+
+  assert.equal(result.metadata.degraded, true);
+  assert.equal(result.violations.length, 3);
+  assert.equal(requests.length, 1);
+  assert.equal(requests[0].method, 'POST');
+  assert.equal(requests[0].body, 'q=shoes');
+  assert.equal(requests[0].headers.accept, 'text/html');
+  assert.equal(requests[0].headers['content-type'], 'application/x-www-form-urlencoded');
+});
+
+test('stops reading pages over the byte limit', async t => {
+  const { url } = await serve(t, (req, res) => {
+    // Chunked, so the size is only known by reading it
+    res.write('<html>'.padEnd(600, ' '));
+    res.end('</html>'.padEnd(600, ' '));
+  });
+
+  await assert.rejects(fetchHtml(url, { timeout: 5000, maxBytes: 1000 }), /exceeded 1000 bytes/);
+  assert.equal((await fetchHtml(url, { timeout: 5000, maxBytes: 2000 })).length, 1200);
+});
+
+test('rejects pages declaring a length over the byte limit', async t => {
+  const { url } = await serve(t, (req, res) => {
+    res.setHeader('Content-Length', 5000);
+    res.end('x'.repeat(5000));
+  });
+
+  await assert.rejects(fetchHtml(url, { timeout: 5000, maxBytes: 1000 }), /exceeded 1000 bytes/);
+});
+
+test('gives up on slow pages at the timeout', async t => {
+  const { url } = await serve(t, (req, res) => setTimeout(() => res.end(PAGE), 500));
+
+  await assert.rejects(fetchHtml(url, { timeout: 50, maxBytes: 1000 }), error => error.name === 'TimeoutError');
+});
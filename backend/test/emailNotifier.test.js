@@ -0,0 +1,220 @@
+const { test } = require('node:test');
+const assert = require('node:assert/strict');
+const net = require('net');
+const { once, EventEmitter } = require('events');
+const { EmailNotifier } = require('../src/services/emailNotifier');
+const { SmtpClient } = require('../src/services/smtpClient');
+
+// Decode a header value's RFC 2047 encoded-words
+function decodeHeader(value) {
+  return value.replace(/=\?UTF-8\?([BQ])\?([^?]*)\?=\s*/gi, (_, encoding, text) => encoding.toUpperCase() === 'B'
+    ? Buffer.from(text, 'base64').toString('utf8')
+    : Buffer.from(text.replace(/_/g, ' ').replace(/=([0-9A-F]{2})/gi, (__, hex) => String.fromCharCode(parseInt(hex, 16))), 'latin1').toString('utf8'));
+}
+
+// Decode a message body by its Content-Transfer-Encoding
+function decodeBody(body, encoding = '7bit') {
+  if (/base64/i.test(encoding)) {
+    return Buffer.from(body.replace(/\r\n/g, ''), 'base64').toString('utf8');
+  }
+  if (/quoted-printable/i.test(encoding)) {
+    const bytes = body.replace(/=\r\n/g, '').replace(/=([0-9A-F]{2})/gi, (_, hex) => String.fromCharCode(parseInt(hex, 16)));
+    return Buffer.from(bytes, 'latin1').toString('utf8').replace(/\r\n/g, '\n');
+  }
+  return body.replace(/\r\n/g, '\n');
+}
+
+// Local SMTP server that accepts every message and records its envelope,
+// decoded headers and body. It offers no STARTTLS.
+async function useFakeSmtp(t, { rejectRecipients = false, credentials = '' } = {}) {
+  const smtp = new EventEmitter();
+  smtp.messages = [];
+  smtp.commands = [];
+
+  const server = net.createServer(socket => {
+    let buffer = '';
+    let data = null;
+    let envelope = { auth: null, from: null, to: [] };
+    socket.on('error', () => {});
+    socket.write('220 fake.smtp ESMTP\r\n');
+
+    socket.on('data', chunk => {
+      buffer += chunk.toString('utf8');
+      if (data !== null) {
+        const end = buffer.indexOf('\r\n.\r\n');
+        if (end === -1) return;
+        const message = buffer.slice(0, end).replace(/^\.\./gm, '.');
+        const split = message.indexOf('\r\n\r\n');
+        const head = message.slice(0, split).replace(/\r\n[ \t]+/g, ' ');
+        const headers = Object.fromEntries(head.split('\r\n').map(line => {
+          const [name, value] = line.split(/: (.*)/s);
+          return [name, decodeHeader(value)];
+        }));
+        const text = decodeBody(message.slice(split + 4), headers['Content-Transfer-Encoding']);
+        buffer = buffer.slice(end + 5);
+        data = null;
+        smtp.messages.push({ ...envelope, headers, text });
+        envelope = { auth: null, from: null, to: [] };
+        socket.write('250 queued\r\n');
+        smtp.emit('message', smtp.messages[smtp.messages.length - 1]);
+      }
+
+      let index;
+      while (data === null && (index = buffer.indexOf('\r\n')) !== -1) {
+        const line = buffer.slice(0, index);
+        buffer = buffer.slice(index + 2);
+        const [verb] = line.split(' ');
+        smtp.commands.push(verb);
+        if (verb === 'EHLO') socket.write('250-fake.smtp\r\n250 AUTH PLAIN\r\n');
+        else if (verb === 'AUTH') { envelope.auth = Buffer.from(line.split(' ')[2], 'base64').toString(); socket.write('235 ok\r\n'); }
+        else if (verb === 'MAIL') { envelope.from = line.match(/<(.*?)>/)[1]; socket.write('250 ok\r\n'); }
+        else if (verb === 'RCPT') {
+          if (rejectRecipients) { socket.write('550 no such user\r\n'); continue; }
+          envelope.to.push(line.match(/<(.*?)>/)[1]);
+          socket.write('250 ok\r\n');
+        } else if (verb === 'DATA') { data = ''; socket.write('354 go ahead\r\n'); }
+        else if (verb === 'QUIT') { socket.end('221 bye\r\n'); }
+        else socket.write('502 unknown\r\n');
+      }
+    });
+  });
+
+  server.listen(0, '127.0.0.1');
+  await once(server, 'listening');
+  t.after(() => server.close());
+  smtp.url = `smtp://${credentials ? `${credentials}@` : ''}127.0.0.1:${server.address().port}`;
+  return smtp;
+}
+
+const scanResult = violations => ({
+  url: 'https://example.com/',
+  timestamp: '2026-01-01T00:00:00.000Z',
+  summary: {
+    violations: violations.length,
+    passes: 12,
+    incomplete: 1,
+    complianceScore: 80,
+    violationsBySeverity: { critical: violations.length }
+  },
+  violations
+});
+
+const imageAlt = {
+  id: 'image-alt',
+  impact: 'critical',
+  help: 'Images must have alternate text',
+  nodes: [{}, {}]
+};
+
+test('emails a scan summary when the threshold is breached', async t => {
+  const smtp = await useFakeSmtp(t);
+  const notifier = new EmailNotifier({
+    smtpUrl: smtp.url,
+    from: 'audits@example.com',
+    to: ['a11y@example.com', 'dev@example.com'],
+    notify: 'breach',
+    violationThreshold: 0
+  });
+
+  notifier.notifyScan('scan-1', scanResult([imageAlt]));
+  const [message] = await once(smtp, 'message');
+
+  assert.equal(message.from, 'audits@example.com');
+  assert.deepEqual(message.to, ['a11y@example.com', 'dev@example.com']);
+  assert.equal(message.headers.Subject, '[Threshold exceeded] Accessibility scan: 1 violations on https://example.com/');
+  assert.equal(message.headers.To, 'a11y@example.com, dev@example.com');
+  assert.match(message.text, /^Accessibility scan of https:\/\/example\.com\/ completed at 2026-01-01T00:00:00\.000Z\./);
+  assert.match(message.text, /Violations: 1 \(critical 1, serious 0, moderate 0, minor 0\)/);
+  assert.match(message.text, /Threshold of 0 violations exceeded\./);
+  assert.match(message.text, /- Images must have alternate text \(image-alt, critical, 2 elements\)/);
+  assert.match(message.text, /Scan ID: scan-1$/);
+});
+
+test('emails a bulk scan summary listing the pages over the threshold', async t => {
+  const smtp = await useFakeSmtp(t);
+  const notifier = new EmailNotifier({ smtpUrl: smtp.url, to: ['a11y@example.com'], violationThreshold: 2 });
+  const page = (url, violations) => ({ url, summary: { violations, complianceScore: 100 - violations } });
+
+  notifier.notifyBulk('batch-1', {
+    status: 'completed_with_errors',
+    results: [page('https://example.com/a', 1), page('https://example.com/b', 3), page('https://example.com/c', 9)],
+    errors: [{ url: 'https://example.com/d', error: 'Navigation timeout' }]
+  });
+  const [message] = await once(smtp, 'message');
+
+  assert.equal(message.headers.Subject, '[Threshold exceeded] Bulk accessibility scan: 2 of 3 pages over threshold');
+  assert.equal(message.text, [
+    'Bulk accessibility scan batch-1 completed with errors.',
+    '',
+    'Pages scanned: 3',
+    'Pages failed: 1',
+    'Total violations: 13',
+    'Pages over the threshold of 2 violations: 2',
+    '',
+    '- https://example.com/c: 9 violations, score 91%',
+    '- https://example.com/b: 3 violations, score 97%',
+    '- https://example.com/d: failed (Navigation timeout)'
+  ].join('\n'));
+});
+
+test('only emails scans under the threshold when notifying on every scan', async t => {
+  const sent = [];
+  const client = { send: async message => { sent.push(message); } };
+  const breachOnly = new EmailNotifier({ client, to: ['a11y@example.com'], notify: 'breach', violationThreshold: 5 });
+  const every = new EmailNotifier({ client, to: ['a11y@example.com'], notify: 'all', violationThreshold: 5 });
+
+  breachOnly.notifyScan('scan-1', scanResult([imageAlt]));
+  every.notifyScan('scan-2', scanResult([imageAlt]));
+  await new Promise(resolve => setImmediate(resolve));
+
+  assert.equal(sent.length, 1);
+  assert.equal(sent[0].subject, 'Accessibility scan: 1 violations on https://example.com/');
+  assert.doesNotMatch(sent[0].text, /Threshold/);
+});
+
+test('is disabled without an SMTP server or recipients', () => {
+  assert.equal(new EmailNotifier({ smtpUrl: null, to: ['a11y@example.com'] }).enabled, false);
+  assert.equal(new EmailNotifier({ smtpUrl: 'smtp://127.0.0.1:1', to: [] }).enabled, false);
+  assert.equal(new EmailNotifier({ smtpUrl: 'smtp://127.0.0.1:1', to: ['a11y@example.com'] }).enabled, true);
+});
+
+test('counts failed deliveries without throwing', async t => {
+  const smtp = await useFakeSmtp(t, { rejectRecipients: true });
+  const notifier = new EmailNotifier({ smtpUrl: smtp.url, to: ['nobody@example.com'] });
+
+  assert.doesNotThrow(() => notifier.notifyScan('scan-1', scanResult([imageAlt])));
+  await assert.rejects(
+    new SmtpClient(smtp.url).send({ from: 'a@example.com', to: ['nobody@example.com'], subject: 'x', text: 'x' }),
+    /550 no such user/
+  );
+
+  await new Promise(resolve => setTimeout(resolve, 50));
+  assert.deepEqual(notifier.metrics, { sent: 0, failed: 1 });
+  assert.equal(smtp.messages.length, 0);
+});
+
+test('encodes non-ASCII subjects and bodies', async t => {
+  const smtp = await useFakeSmtp(t);
+
+  await new SmtpClient(smtp.url).send({
+    from: 'a@example.com',
+    to: ['b@example.com'],
+    subject: 'Prüfung',
+    text: 'Grüße\n.done'
+  });
+
+  assert.equal(smtp.messages[0].headers.Subject, 'Prüfung');
+  assert.match(smtp.messages[0].headers['Content-Type'], /charset=utf-8/i);
+  assert.equal(smtp.messages[0].text, 'Grüße\n.done');
+});
+
+test('refuses to send credentials without TLS', async t => {
+  const smtp = await useFakeSmtp(t, { credentials: 'scanner:s%40cret' });
+
+  await assert.rejects(
+    new SmtpClient(smtp.url).send({ from: 'a@example.com', to: ['b@example.com'], subject: 'x', text: 'x' }),
+    /STARTTLS/i
+  );
+  assert.equal(smtp.commands.includes('AUTH'), false);
+  assert.equal(smtp.messages.length, 0);
+});
@@ -0,0 +1,59 @@
+const { test } = require('node:test');
+const assert = require('node:assert/strict');
+const fs = require('fs');
+const path = require('path');
+const { ERROR_CODES } = require('../src/errorCodes');
+const { ssrfProtection } = require('../src/middleware/ssrfProtection');
+
+// Error table rows of docs/API.md: | status | `CODE` | error | description |
+function documentedCodes() {
+  const docs = fs.readFileSync(path.join(__dirname, '../../docs/API.md'), 'utf8');
+  return [...docs.matchAll(/^\| (\d{3}) \| `([A-Z_]+)` \|/gm)].map(([, status, code]) => ({ status: Number(status), code }));
+}
+
+// Run the middleware against a request, as express would
+async function run(middleware, body) {
+  const res = {
+    statusCode: 200,
+    status(code) { this.statusCode = code; return this; },
+    json(payload) { this.body = payload; return this; }
+  };
+  let passed = false;
+  await middleware({ body, headers: {}, ip: '203.0.113.7' }, res, () => { passed = true; });
+  return { res, passed };
+}
+
+test('codes are stable strings equal to their names', () => {
+  assert.ok(Object.isFrozen(ERROR_CODES));
+  for (const [name, code] of Object.entries(ERROR_CODES)) {
+    assert.equal(code, name);
+  }
+});
+
+test('every code is documented with the status it is returned with', () => {
+  const source = fs.readFileSync(require.resolve('../src/errorCodes'), 'utf8');
+  const documented = documentedCodes();
+
+  for (const code of Object.values(ERROR_CODES)) {
+    // The comment above each code starts with its status
+    const status = Number(new RegExp(`// (\\d{3}): [^\\n]*\\n\\s*${code}:`).exec(source)[1]);
+    assert.ok(
+      documented.some(row => row.code === code && row.status === status),
+      `${code} (${status}) missing from the docs/API.md error table`
+    );
+  }
+  assert.ok(documented.every(row => ERROR_CODES[row.code]), 'docs/API.md lists an unknown code');
+});
+
+test('URL rejections carry their code', async () => {
+  const invalid = await run(ssrfProtection, { type: 'url', input: 'ftp://example.com/file' });
+  assert.equal(invalid.passed, false);
+  assert.equal(invalid.res.statusCode, 400);
+  assert.equal(invalid.res.body.code, ERROR_CODES.INVALID_INPUT);
+
+  const internal = await run(ssrfProtection, { type: 'url', input: 'http://127.0.0.1:8080/admin' });
+  assert.equal(internal.passed, false);
+  assert.equal(internal.res.statusCode, 403);
+  assert.equal(internal.res.body.code, ERROR_CODES.SSRF_PROTECTION);
+  assert.equal(typeof internal.res.body.message, 'string');
+});
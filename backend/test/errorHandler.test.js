@@ -0,0 +1,71 @@
+const { test } = require('node:test');
+const assert = require('node:assert/strict');
+const { errorHandler } = require('../src/middleware/errorHandler');
+const config = require('../src/config');
+
+const logger = { warn: () => {}, error: () => {} };
+
+// Errors as the body parsers raise them
+function parserError(status, message, type) {
+  return Object.assign(new Error(message), { status, statusCode: status, expose: true, type });
+}
+
+function handle(err, { headersSent = false } = {}) {
+  const res = {
+    statusCode: 200,
+    headersSent,
+    status(code) { this.statusCode = code; return this; },
+    json(payload) { this.body = payload; return this; }
+  };
+  let passed = null;
+  errorHandler(logger)(err, { correlationId: 'req-1' }, res, error => { passed = error; });
+  return { res, passed };
+}
+
+test('rejects bodies in unsupported encodings with 415 UNSUPPORTED_ENCODING', () => {
+  const { res } = handle(parserError(415, 'unsupported content encoding "br"', 'encoding.unsupported'));
+
+  assert.equal(res.statusCode, 415);
+  assert.deepEqual(res.body, {
+    error: 'Unsupported Media Type',
+    message: 'unsupported content encoding "br"',
+    code: 'UNSUPPORTED_ENCODING'
+  });
+});
+
+test('rejects bodies over the size limit with 413 PAYLOAD_TOO_LARGE', () => {
+  const { res } = handle(parserError(413, 'request entity too large', 'entity.too.large'));
+
+  assert.equal(res.statusCode, 413);
+  assert.equal(res.body.code, 'PAYLOAD_TOO_LARGE');
+  assert.equal(res.body.message, `Request body exceeds the maximum size of ${config.security.maxRequestSize}`);
+});
+
+test('reports malformed and corrupt bodies as invalid input', () => {
+  const malformed = handle(parserError(400, 'Unexpected token } in JSON at position 12', 'entity.parse.failed'));
+  const corrupt = handle(parserError(400, 'incorrect header check'));
+
+  for (const { res } of [malformed, corrupt]) {
+    assert.equal(res.statusCode, 400);
+    assert.equal(res.body.error, 'Bad Request');
+    assert.equal(res.body.code, 'INVALID_INPUT');
+  }
+  assert.equal(corrupt.res.body.message, 'incorrect header check');
+});
+
+test('hides unexpected errors behind 500 INTERNAL_ERROR', () => {
+  const { res } = handle(new Error('Cannot read properties of undefined'));
+  const unexposed = handle(Object.assign(new Error('secret'), { status: 400, expose: false }));
+
+  assert.equal(res.statusCode, 500);
+  assert.equal(res.body.code, 'INTERNAL_ERROR');
+  assert.equal(unexposed.res.statusCode, 500);
+});
+
+test('leaves responses already sent to express', () => {
+  const err = new Error('aborted');
+  const { res, passed } = handle(err, { headersSent: true });
+
+  assert.equal(passed, err);
+  assert.equal(res.body, undefined);
+});
@@ -0,0 +1,82 @@
+const { test } = require('node:test');
+const assert = require('node:assert/strict');
+const fs = require('fs');
+const os = require('os');
+const path = require('path');
+const dns = require('dns').promises;
+const { GeoIpDatabase, findBlockedCountry, setGeoIpLookup } = require('../src/middleware/geoBlocking');
+
+const countries = {
+  '203.0.113.10': 'KP',
+  '198.51.100.20': 'US',
+  '2001:db8::10': 'IR'
+};
+
+// Resolve hostnames from a table instead of DNS
+function stubDns(t, records) {
+  const { resolve4, resolve6 } = dns;
+  const resolver = family => async hostname => {
+    const addresses = (records[hostname] || []).filter(address => address.includes(':') === (family === 6));
+    if (addresses.length === 0) {
+      throw Object.assign(new Error(`queryA ENODATA ${hostname}`), { code: 'ENODATA' });
+    }
+    return addresses;
+  };
+  dns.resolve4 = resolver(4);
+  dns.resolve6 = resolver(6);
+  t.after(() => {
+    dns.resolve4 = resolve4;
+    dns.resolve6 = resolve6;
+  });
+}
+
+function stubLookup(t) {
+  setGeoIpLookup(ip => countries[ip] || null);
+  t.after(() => setGeoIpLookup(null));
+}
+
+test('blocks hosts resolving to a blocked country', async t => {
+  stubLookup(t);
+  stubDns(t, { 'blocked.example': ['203.0.113.10'], 'allowed.example': ['198.51.100.20'] });
+
+  assert.equal(await findBlockedCountry('blocked.example', ['KP']), 'KP');
+  assert.equal(await findBlockedCountry('allowed.example', ['KP']), null);
+});
+
+test('checks IPv6 addresses of hosts and literals', async t => {
+  stubLookup(t);
+  stubDns(t, { 'dual.example': ['198.51.100.20', '2001:db8::10'] });
+
+  assert.equal(await findBlockedCountry('dual.example', ['IR']), 'IR');
+  assert.equal(await findBlockedCountry('[2001:db8::10]', ['IR']), 'IR');
+  assert.equal(await findBlockedCountry('203.0.113.10', ['IR']), null);
+});
+
+test('allows unresolvable hosts and deployments without a blocklist', async t => {
+  stubLookup(t);
+  stubDns(t, { 'blocked.example': ['203.0.113.10'] });
+
+  assert.equal(await findBlockedCountry('missing.example', ['KP']), null);
+  assert.equal(await findBlockedCountry('blocked.example', []), null);
+});
+
+test('loads IPv4 and IPv6 networks from the CSV database', t => {
+  const dir = fs.mkdtempSync(path.join(os.tmpdir(), 'geoip-'));
+  t.after(() => fs.rmSync(dir, { recursive: true, force: true }));
+  const file = path.join(dir, 'geoip.csv');
+  fs.writeFileSync(file, [
+    'network,country_code',
+    '203.0.113.0/24,kp',
+    '2001:db8::/32,IR',
+    ''
+  ].join('\n'));
+
+  const database = GeoIpDatabase.fromFile(file);
+
+  assert.equal(database.lookup('203.0.113.200'), 'KP');
+  assert.equal(database.lookup('203.0.114.1'), null);
+  assert.equal(database.lookup('::ffff:203.0.113.5'), 'KP');
+  assert.equal(database.lookup('2001:db8:ffff::1'), 'IR');
+  assert.equal(database.lookup('2001:db9::1'), null);
+  assert.equal(database.lookup('not-an-ip'), null);
+});
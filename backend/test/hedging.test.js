@@ -0,0 +1,88 @@
+const { test } = require('node:test');
+const assert = require('node:assert/strict');
+const { hedge } = require('../src/services/hedging');
+
+// Attempt taking ms[attempt] to resolve (or reject with fail[attempt]),
+// recording which attempts started and which were aborted
+function attempts(ms, fail = []) {
+  const started = [];
+  const aborted = [];
+  const run = (signal, attempt) => new Promise((resolve, reject) => {
+    started.push(attempt);
+    const timer = setTimeout(() => {
+      if (fail[attempt]) reject(new Error(`attempt ${attempt} failed`));
+      else resolve(`result ${attempt}`);
+    }, ms[attempt]);
+    signal.addEventListener('abort', () => {
+      aborted.push(attempt);
+      clearTimeout(timer);
+      reject(new Error('aborted'));
+    }, { once: true });
+  });
+  return { run, started, aborted };
+}
+
+test('uses the hedge when it finishes first and aborts the slow attempt', async () => {
+  const { run, started, aborted } = attempts([200, 10]);
+
+  const { result, attempt } = await hedge(run, { delay: 20 });
+
+  assert.equal(result, 'result 1');
+  assert.equal(attempt, 1);
+  assert.deepEqual(started, [0, 1]);
+  assert.deepEqual(aborted, [0]);
+});
+
+test('does not hedge attempts finishing within the delay', async () => {
+  const { run, started } = attempts([5, 5]);
+
+  const { attempt } = await hedge(run, { delay: 50 });
+  await new Promise(resolve => setTimeout(resolve, 60));
+
+  assert.equal(attempt, 0);
+  assert.deepEqual(started, [0]);
+});
+
+test('keeps the first attempt when it still wins', async () => {
+  const { run, aborted } = attempts([40, 200]);
+
+  const { attempt } = await hedge(run, { delay: 10 });
+
+  assert.equal(attempt, 0);
+  assert.deepEqual(aborted, [1]);
+});
+
+test('skips the hedge when shouldHedge declines', async () => {
+  const { run, started } = attempts([60, 5]);
+
+  const { attempt } = await hedge(run, { delay: 10, shouldHedge: () => false });
+
+  assert.equal(attempt, 0);
+  assert.deepEqual(started, [0]);
+});
+
+test('fails only once both hedged attempts fail', async () => {
+  const { run } = attempts([40, 10], [false, true]);
+  assert.equal((await hedge(run, { delay: 10 })).attempt, 0);
+
+  const both = attempts([40, 10], [true, true]);
+  await assert.rejects(hedge(both.run, { delay: 10 }), /attempt 0 failed/);
+});
+
+test('fails immediately when the first attempt fails before the hedge', async () => {
+  const { run, started } = attempts([5], [true]);
+
+  await assert.rejects(hedge(run, { delay: 50 }), /attempt 0 failed/);
+  assert.deepEqual(started, [0]);
+});
+
+test('aborts both attempts when the caller aborts', async () => {
+  const { run, aborted } = attempts([200, 200]);
+  const controller = new AbortController();
+
+  const hedged = hedge(run, { delay: 10, signal: controller.signal });
+  setTimeout(() => controller.abort(), 30);
+
+  await assert.rejects(hedged, /aborted/);
+  assert.deepEqual(aborted.sort(), [0, 1]);
+});
@@ -0,0 +1,273 @@
+/**
+ * Scanner test harness: loads the scanner with an empty browser pool, a
+ * stand-in for axe and fake puppeteer browsers that record what a scan did
+ * to them. Require it before anything that loads the config.
+ */
+
+const { EventEmitter } = require('events');
+
+process.env.MIN_POOL_SIZE = '0';
+
+// Results the stand-in axe returns, and the run options it was given
+const axe = {
+  results: null,
+  runs: []
+};
+
+function axeResults(violations = []) {
+  return {
+    violations,
+    passes: [],
+    incomplete: [],
+    testEngine: { name: 'axe-core', version: '4.8.2' },
+    testRunner: { name: 'axe' },
+    testEnvironment: { userAgent: 'test', windowWidth: 1920, windowHeight: 1080, orientationType: 'landscape-primary' }
+  };
+}
+
+class FakeAxe {
+  constructor(page) {
+    this.page = page;
+  }
+
+  options(runOptions) {
+    this.runOptions = runOptions;
+    return this;
+  }
+
+  async analyze() {
+    axe.runs.push({ page: this.page, options: this.runOptions });
+    await this.page.delay('analyze');
+    return axe.results || axeResults();
+  }
+}
+
+const axeModule = require.resolve('@axe-core/puppeteer');
+require.cache[axeModule] = { id: axeModule, filename: axeModule, loaded: true, exports: { AxePuppeteer: FakeAxe } };
+
+class FakeContext {
+  constructor(browser, incognito) {
+    this.browser = browser;
+    this.incognito = incognito;
+    this.closed = false;
+    this.permissions = [];
+  }
+
+  isIncognito() { return this.incognito; }
+
+  async newPage() {
+    const page = new FakePage(this);
+    this.browser.pages.push(page);
+    return page;
+  }
+
+  async clearPermissionOverrides() {
+    this.permissions = [];
+  }
+
+  async overridePermissions(origin, permissions) {
+    this.permissions.push({ origin, permissions });
+  }
+
+  async close() {
+    this.closed = true;
+  }
+}
+
+/**
+ * A page that records every call as [method, ...args] in page.calls.
+ * browser.behavior shapes it: response ({ status, headers }), html, and
+ * delays (method -> ms, or a function returning a promise) for goto,
+ * setContent, waitForTimeout, content and analyze.
+ */
+class FakePage extends EventEmitter {
+  constructor(context) {
+    super();
+    this.context = context;
+    this.behavior = context.browser.behavior;
+    this.calls = [];
+    this.closed = false;
+    this.currentUrl = 'about:blank';
+    this.accessibility = {
+      snapshot: async () => ('accessibilityTree' in this.behavior
+        ? this.behavior.accessibilityTree
+        : { role: 'RootWebArea', name: '' })
+    };
+    this.frame = { url: () => this.currentUrl };
+  }
+
+  record(method, ...args) {
+    this.calls.push([method, ...args]);
+  }
+
+  called(method) {
+    return this.calls.filter(call => call[0] === method).map(call => call.slice(1));
+  }
+
+  async delay(method) {
+    const delay = (this.behavior.delays || {})[method];
+    if (typeof delay === 'function') {
+      await delay(this);
+    } else if (delay) {
+      await new Promise(resolve => setTimeout(resolve, delay));
+    }
+    if (this.closed) {
+      throw new Error('Target closed');
+    }
+  }
+
+  browserContext() { return this.context; }
+  mainFrame() { return this.frame; }
+  url() { return this.currentUrl; }
+
+  async setViewport(viewport) { this.record('setViewport', viewport); }
+  async setUserAgent(userAgent) { this.record('setUserAgent', userAgent); }
+  async setGeolocation(geolocation) { this.record('setGeolocation', geolocation); }
+  async emulateTimezone(timezone) { this.record('emulateTimezone', timezone); }
+  async emulateMediaFeatures(features) { this.record('emulateMediaFeatures', features); }
+  async setExtraHTTPHeaders(headers) { this.record('setExtraHTTPHeaders', headers); }
+  async setRequestInterception(enabled) { this.record('setRequestInterception', enabled); }
+  async authenticate(credentials) { this.record('authenticate', credentials); }
+
+  async evaluateOnNewDocument(fn, ...args) {
+    this.record('evaluateOnNewDocument', fn, ...args);
+  }
+
+  async evaluate(fn, ...args) {
+    this.record('evaluate', fn, ...args);
+    return this.behavior.evaluate ? this.behavior.evaluate(fn, ...args) : undefined;
+  }
+
+  async goto(url, options) {
+    this.record('goto', url, options);
+    this.currentUrl = url;
+    await this.delay('goto');
+    const { status = 200, headers = {} } = this.behavior.response || {};
+    return {
+      status: () => status,
+      ok: () => status >= 200 && status < 300,
+      headers: () => headers
+    };
+  }
+
+  async setContent(html, options) {
+    this.record('setContent', html, options);
+    await this.delay('setContent');
+  }
+
+  async waitForFunction(fn, options) {
+    this.record('waitForFunction', options);
+    await this.delay('waitForFunction');
+  }
+
+  async waitForTimeout(ms) {
+    this.record('waitForTimeout', ms);
+    await this.delay('waitForTimeout');
+  }
+
+  async $(selector) {
+    this.record('$', selector);
+    return (this.behavior.elements || {})[selector] || null;
+  }
+
+  async content() {
+    await this.delay('content');
+    return this.behavior.html || '<html><body></body></html>';
+  }
+
+  async screenshot(options) {
+    this.record('screenshot', options);
+    return Buffer.from('png');
+  }
+
+  async close() {
+    this.closed = true;
+  }
+}
+
+/**
+ * An intercepted request for page.emit('request', ...): records how it was
+ * resolved in request.resolution ({ action: 'continue', overrides } or
+ * { action: 'abort', reason })
+ */
+class FakeRequest {
+  constructor(page, { url, resourceType = 'document', navigation = resourceType === 'document', headers = {}, frame } = {}) {
+    this.page = page;
+    this.requestUrl = url;
+    this.type = resourceType;
+    this.navigation = navigation;
+    this.requestHeaders = headers;
+    this.requestFrame = frame || page.mainFrame();
+    this.resolution = null;
+  }
+
+  url() { return this.requestUrl; }
+  resourceType() { return this.type; }
+  isNavigationRequest() { return this.navigation; }
+  frame() { return this.requestFrame; }
+  headers() { return this.requestHeaders; }
+  isInterceptResolutionHandled() { return this.resolution !== null; }
+
+  continue(overrides) {
+    this.resolution = { action: 'continue', overrides };
+  }
+
+  abort(reason) {
+    this.resolution = { action: 'abort', reason };
+  }
+}
+
+class FakeBrowser {
+  constructor(behavior = {}) {
+    this.behavior = behavior;
+    this.pages = [];
+    this.contexts = [];
+    this.defaultContext = new FakeContext(this, false);
+  }
+
+  isConnected() { return true; }
+
+  async newPage() {
+    return this.defaultContext.newPage();
+  }
+
+  async createIncognitoBrowserContext() {
+    const context = new FakeContext(this, true);
+    this.contexts.push(context);
+    return context;
+  }
+
+  async close() {}
+}
+
+const scanner = require('../../src/scanner');
+
+/**
+ * Serve every scan from one fake browser until the test ends; acquires and
+ * releases are counted on it
+ */
+function useFakeBrowser(t, behavior = {}) {
+  const { browserPool } = scanner;
+  const browser = new FakeBrowser(behavior);
+  browser.acquired = 0;
+  browser.released = 0;
+
+  const { acquire, release } = browserPool;
+  browserPool.acquire = async () => {
+    browser.acquired++;
+    return browser;
+  };
+  browserPool.release = async () => {
+    browser.released++;
+  };
+
+  axe.results = null;
+  axe.runs = [];
+  t.after(() => {
+    browserPool.acquire = acquire;
+    browserPool.release = release;
+  });
+  return browser;
+}
+
+module.exports = { scanner, axe, axeResults, useFakeBrowser, FakeBrowser, FakePage, FakeRequest };
@@ -0,0 +1,117 @@
+/**
+ * In-process Redis stand-in for cache tests: a local RESP server keeping
+ * strings in memory, with the GET, SET (PX), DEL and PTTL the result cache
+ * uses, and the INFO clients check readiness with. Keys expire like Redis'
+ * own.
+ */
+
+const net = require('net');
+const { once } = require('events');
+
+/**
+ * Parse one command (an array of bulk strings) from buffer
+ *
+ * @returns {{value, offset}|null} The command's arguments and the offset
+ *   after it, or null when the buffer doesn't hold a whole command yet
+ */
+function parseCommand(buffer) {
+  let lineEnd = buffer.indexOf('\r\n');
+  if (lineEnd === -1) return null;
+
+  const count = parseInt(buffer.toString('utf8', 1, lineEnd));
+  const args = [];
+  let offset = lineEnd + 2;
+  for (let i = 0; i < count; i++) {
+    lineEnd = buffer.indexOf('\r\n', offset);
+    if (lineEnd === -1) return null;
+    const length = parseInt(buffer.toString('utf8', offset + 1, lineEnd));
+    const start = lineEnd + 2;
+    if (buffer.length < start + length + 2) return null;
+    args.push(buffer.toString('utf8', start, start + length));
+    offset = start + length + 2;
+  }
+  return { value: args, offset };
+}
+
+function bulk(value) {
+  return value === null ? '$-1\r\n' : `$${Buffer.byteLength(value)}\r\n${value}\r\n`;
+}
+
+class FakeRedis {
+  constructor() {
+    // key -> { value, expiresAt }
+    this.store = new Map();
+    this.commands = [];
+    this.server = net.createServer(socket => this.serve(socket));
+  }
+
+  async start() {
+    this.server.listen(0, '127.0.0.1');
+    await once(this.server, 'listening');
+    this.url = `redis://127.0.0.1:${this.server.address().port}`;
+    return this;
+  }
+
+  close() {
+    this.server.close();
+  }
+
+  lookup(key) {
+    const entry = this.store.get(key);
+    if (entry && entry.expiresAt !== null && entry.expiresAt <= Date.now()) {
+      this.store.delete(key);
+      return null;
+    }
+    return entry || null;
+  }
+
+  execute([name, ...args]) {
+    this.commands.push([name, ...args]);
+    switch (name.toUpperCase()) {
+      case 'GET': {
+        const entry = this.lookup(args[0]);
+        return bulk(entry ? entry.value : null);
+      }
+      case 'SET': {
+        const px = args.findIndex(arg => arg.toUpperCase() === 'PX');
+        const expiresAt = px === -1 ? null : Date.now() + Number(args[px + 1]);
+        this.store.set(args[0], { value: args[1], expiresAt });
+        return '+OK\r\n';
+      }
+      case 'DEL':
+        return `:${args.filter(key => this.lookup(key) && this.store.delete(key)).length}\r\n`;
+      case 'INFO':
+        return bulk('# Server\r\nredis_version:7.2.0\r\n# Persistence\r\nloading:0\r\n');
+      case 'PTTL': {
+        const entry = this.lookup(args[0]);
+        return `:${!entry ? -2 : entry.expiresAt === null ? -1 : entry.expiresAt - Date.now()}\r\n`;
+      }
+      default:
+        return `-ERR unknown command '${name}'\r\n`;
+    }
+  }
+
+  serve(socket) {
+    let buffer = Buffer.alloc(0);
+    socket.on('error', () => {});
+    socket.on('data', data => {
+      buffer = Buffer.concat([buffer, data]);
+      let reply;
+      while ((reply = parseCommand(buffer))) {
+        buffer = buffer.subarray(reply.offset);
+        socket.write(this.execute(reply.value));
+      }
+    });
+  }
+}
+
+/**
+ * Start a FakeRedis that is closed when the test ends
+ */
+async function useFakeRedis(t) {
+  const redis = await new FakeRedis().start();
+  t.after(() => redis.close());
+  return redis;
+}
+
+module.exports = { FakeRedis, useFakeRedis };
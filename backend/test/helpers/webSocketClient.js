@@ -0,0 +1,152 @@
+/**
+ * WebSocket test client: just enough of RFC 6455 to drive the scan progress
+ * stream from tests.
+ *
+ *   const ws = await connectWebSocket(port, '/api/scan/stream');
+ *   ws.send({ requests: [...] });
+ *   const { code } = await ws.closed;
+ *   ws.messages // JSON messages received, in order
+ */
+
+const crypto = require('crypto');
+const http = require('http');
+
+// Build a client frame; clients mask their frames unless told otherwise
+function frame(opcode, payload, { masked = true, fin = true } = {}) {
+  const lengthBytes = payload.length < 126 ? 0 : payload.length < 65536 ? 2 : 8;
+  const header = Buffer.alloc(2 + lengthBytes + (masked ? 4 : 0));
+  header[0] = (fin ? 0x80 : 0) | opcode;
+  if (lengthBytes === 0) {
+    header[1] = payload.length;
+  } else if (lengthBytes === 2) {
+    header[1] = 126;
+    header.writeUInt16BE(payload.length, 2);
+  } else {
+    header[1] = 127;
+    header.writeBigUInt64BE(BigInt(payload.length), 2);
+  }
+  if (!masked) return Buffer.concat([header, payload]);
+
+  header[1] |= 0x80;
+  const mask = crypto.randomBytes(4);
+  mask.copy(header, 2 + lengthBytes);
+  const body = Buffer.from(payload);
+  for (let i = 0; i < body.length; i++) {
+    body[i] ^= mask[i % 4];
+  }
+  return Buffer.concat([header, body]);
+}
+
+/**
+ * Open a WebSocket connection to a local server
+ *
+ * @returns {Promise<{socket, headers, messages, frames, closed, send, sendFrame, close}>}
+ */
+function connectWebSocket(port, path) {
+  return new Promise((resolve, reject) => {
+    const req = http.request({
+      host: '127.0.0.1',
+      port,
+      path,
+      headers: {
+        Connection: 'Upgrade',
+        Upgrade: 'websocket',
+        'Sec-WebSocket-Key': crypto.randomBytes(16).toString('base64'),
+        'Sec-WebSocket-Version': '13'
+      }
+    });
+    req.on('error', reject);
+    req.on('response', res => reject(new Error(`Expected an upgrade, got ${res.statusCode}`)));
+    req.on('upgrade', (res, socket, head) => resolve(new WebSocketClient(socket, head, res.headers)));
+    req.end();
+  });
+}
+
+class WebSocketClient {
+  constructor(socket, head, headers) {
+    this.socket = socket;
+    this.headers = headers;
+    // Every frame received, as { opcode, payload }
+    this.frames = [];
+    // Text messages received, parsed as JSON
+    this.messages = [];
+    this.buffer = Buffer.from(head);
+    this.closeFrame = null;
+    this.waiters = [];
+
+    this.closed = new Promise(resolve => {
+      socket.on('close', () => {
+        const payload = this.closeFrame;
+        resolve(payload && payload.length >= 2
+          ? { code: payload.readUInt16BE(0), reason: payload.subarray(2).toString('utf8') }
+          : { code: null, reason: '' });
+      });
+    });
+    socket.on('error', () => {});
+    socket.on('data', chunk => {
+      this.buffer = Buffer.concat([this.buffer, chunk]);
+      this.parseFrames();
+    });
+    this.parseFrames();
+  }
+
+  send(message) {
+    const text = typeof message === 'string' ? message : JSON.stringify(message);
+    this.socket.write(frame(0x1, Buffer.from(text, 'utf8')));
+  }
+
+  sendFrame(opcode, payload, options) {
+    this.socket.write(frame(opcode, payload, options));
+  }
+
+  close(code = 1000) {
+    const payload = Buffer.alloc(2);
+    payload.writeUInt16BE(code, 0);
+    this.socket.write(frame(0x8, payload));
+  }
+
+  // Resolve with the next JSON message (or one already received, unread)
+  nextMessage() {
+    this.read = this.read || 0;
+    if (this.read < this.messages.length) {
+      return Promise.resolve(this.messages[this.read++]);
+    }
+    return new Promise(resolve => this.waiters.push(resolve));
+  }
+
+  parseFrames() {
+    while (this.buffer.length >= 2) {
+      let length = this.buffer[1] & 0x7F;
+      let offset = 2;
+      if (length === 126) {
+        if (this.buffer.length < 4) return;
+        length = this.buffer.readUInt16BE(2);
+        offset = 4;
+      } else if (length === 127) {
+        if (this.buffer.length < 10) return;
+        length = Number(this.buffer.readBigUInt64BE(2));
+        offset = 10;
+      }
+      if (this.buffer.length < offset + length) return;
+
+      const opcode = this.buffer[0] & 0x0F;
+      const payload = this.buffer.subarray(offset, offset + length);
+      this.buffer = this.buffer.subarray(offset + length);
+      this.frames.push({ opcode, payload });
+
+      if (opcode === 0x1) {
+        this.messages.push(JSON.parse(payload.toString('utf8')));
+        if (this.waiters.length > 0) {
+          this.read = (this.read || 0) + 1;
+          this.waiters.shift()(this.messages[this.messages.length - 1]);
+        }
+      } else if (opcode === 0x8) {
+        // Answer the server's close; it ends the connection
+        this.closeFrame = payload;
+        this.socket.end(frame(0x8, payload.subarray(0, 2)));
+      }
+    }
+  }
+}
+
+module.exports = { connectWebSocket, frame };
@@ -0,0 +1,68 @@
+const { test } = require('node:test');
+const assert = require('node:assert/strict');
+const { scanner, useFakeBrowser, FakeBrowser } = require('./helpers/fakeBrowser');
+
+// Serve scans with hostOverrides from dedicated fake browsers, recording
+// the launch arguments and whether each was closed
+function useDedicatedBrowsers(t) {
+  const pooled = useFakeBrowser(t);
+  const { browserPool } = scanner;
+  const launches = [];
+  const launchDedicated = browserPool.launchDedicated;
+  browserPool.launchDedicated = async args => {
+    const browser = new FakeBrowser();
+    browser.close = async () => { browser.closed = true; };
+    launches.push({ args, browser });
+    return browser;
+  };
+  t.after(() => { browserPool.launchDedicated = launchDedicated; });
+  return { pooled, launches };
+}
+
+test('routes overridden hostnames to the given IPs in a browser of their own', async t => {
+  const { pooled, launches } = useDedicatedBrowsers(t);
+
+  await scanner.scanURL('https://staging.example.com/', {
+    hostOverrides: { 'staging.example.com': '203.0.113.10', 'api.staging.example.com': '2001:db8::10' }
+  });
+
+  assert.equal(launches.length, 1);
+  assert.deepEqual(launches[0].args, [
+    '--host-resolver-rules=MAP staging.example.com 203.0.113.10,MAP api.staging.example.com [2001:db8::10]'
+  ]);
+  assert.deepEqual(launches[0].browser.pages[0].called('goto')[0][0], 'https://staging.example.com/');
+  assert.equal(launches[0].browser.closed, true);
+  assert.equal(pooled.acquired, 0);
+});
+
+test('refuses overrides to private or metadata IPs without launching a browser', async t => {
+  const { launches } = useDedicatedBrowsers(t);
+
+  await assert.rejects(
+    scanner.scanURL('https://staging.example.com/', { hostOverrides: { 'staging.example.com': '169.254.169.254' } }),
+    /staging\.example\.com/
+  );
+  assert.equal(launches.length, 0);
+});
+
+test('uses pooled browsers without overrides', async t => {
+  const { pooled, launches } = useDedicatedBrowsers(t);
+
+  await scanner.scanURL('https://example.com/', { hostOverrides: {} });
+
+  assert.equal(launches.length, 0);
+  assert.equal(pooled.acquired, 1);
+});
+
+test('sheds scans with OVERLOADED when every dedicated browser is in use', async t => {
+  useFakeBrowser(t);
+  const { browserPool } = scanner;
+  const dedicatedCount = browserPool.dedicatedCount;
+  browserPool.dedicatedCount = browserPool.maxDedicated;
+  t.after(() => { browserPool.dedicatedCount = dedicatedCount; });
+
+  await assert.rejects(
+    scanner.scanURL('https://staging.example.com/', { hostOverrides: { 'staging.example.com': '203.0.113.10' } }),
+    error => error.code === 'OVERLOADED' && error.retryable === false && !error.browserUnavailable
+  );
+});
@@ -0,0 +1,65 @@
+const { test } = require('node:test');
+const assert = require('node:assert/strict');
+const { detectCharset, decodeHtml, decodeHtmlInput } = require('../src/services/htmlEncoding');
+
+const html = '<html><head><title>Café</title></head><body><p>Crème brûlée – 5 €</p></body></html>';
+
+// UTF-16 big-endian bytes (Node only encodes little-endian)
+function utf16be(text) {
+  return Buffer.from(text, 'utf16le').swap16();
+}
+
+test('transcodes Latin-1 bytes without a declared charset', () => {
+  const bytes = Buffer.from(html.replace(' – 5 €', ''), 'latin1');
+  const decoded = decodeHtml(bytes);
+
+  assert.equal(decoded.charset, 'windows-1252');
+  assert.equal(decoded.detectedBy, 'sniffed');
+  assert.match(decoded.html, /Café.*Crème brûlée/);
+});
+
+test('uses a <meta charset> declaration', () => {
+  const source = '<meta charset="iso-8859-1"><p>Déjà vu</p>';
+  const decoded = decodeHtml(Buffer.from(source, 'latin1'));
+
+  assert.equal(decoded.detectedBy, 'meta');
+  assert.equal(decoded.html, source);
+});
+
+test('transcodes UTF-16 with a byte order mark', () => {
+  const le = decodeHtml(Buffer.concat([Buffer.from([0xff, 0xfe]), Buffer.from(html, 'utf16le')]));
+  const be = decodeHtml(Buffer.concat([Buffer.from([0xfe, 0xff]), utf16be(html)]));
+
+  assert.deepEqual([le.charset, le.detectedBy, le.html], ['utf-16le', 'bom', html]);
+  assert.deepEqual([be.charset, be.detectedBy, be.html], ['utf-16be', 'bom', html]);
+});
+
+test('detects UTF-16 without a byte order mark', () => {
+  assert.equal(decodeHtml(Buffer.from(html, 'utf16le')).html, html);
+  assert.equal(decodeHtml(utf16be(html)).html, html);
+  assert.equal(detectCharset(Buffer.from(html, 'utf16le')).charset, 'utf-16le');
+  assert.equal(detectCharset(utf16be(html)).charset, 'utf-16be');
+});
+
+test('prefers the BOM over a declared charset, and a declared charset over sniffing', () => {
+  const withBom = Buffer.concat([Buffer.from([0xef, 0xbb, 0xbf]), Buffer.from(html)]);
+  assert.equal(decodeHtml(withBom, 'iso-8859-1').html, html);
+
+  assert.equal(detectCharset(Buffer.from(html), 'ISO-8859-1').charset, 'iso-8859-1');
+});
+
+test('leaves valid UTF-8 alone', () => {
+  const decoded = decodeHtml(Buffer.from(html));
+  assert.deepEqual([decoded.charset, decoded.html], ['utf-8', html]);
+});
+
+test('rejects unsupported declared charsets', () => {
+  assert.throws(() => decodeHtml(Buffer.from(html), 'klingon-8'), /Unsupported charset: klingon-8/);
+});
+
+test('decodes base64 input and passes strings through', () => {
+  const input = Buffer.from(html, 'utf16le').toString('base64');
+
+  assert.equal(decodeHtmlInput(input, { inputEncoding: 'base64' }).html, html);
+  assert.equal(decodeHtmlInput(`\uFEFF${html}`).html, html);
+});
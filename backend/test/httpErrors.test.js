@@ -0,0 +1,132 @@
+const { test } = require('node:test');
+const assert = require('node:assert/strict');
+const { scanner, axe, useFakeBrowser } = require('./helpers/fakeBrowser');
+const config = require('../src/config');
+const { BulkScanRunner } = require('../src/services/bulkScanRunner');
+
+function configure(t, values) {
+  const previous = {
+    failOnHttpError: config.failOnHttpError,
+    retryBackoff: config.retryBackoff
+  };
+  Object.assign(config, values);
+  t.after(() => Object.assign(config, previous));
+}
+
+const fastRetries = { retryBackoff: { baseDelay: 1, maxDelay: 1 } };
+
+test('scans error pages but reports their HTTP status', async t => {
+  const browser = useFakeBrowser(t, { response: { status: 503 } });
+
+  const result = await scanner.scanURL('https://example.com/', {});
+
+  assert.equal(result.metadata.httpStatus, 503);
+  assert.equal(axe.runs.length, 1);
+  assert.equal(browser.acquired, 1);
+});
+
+test('leaves httpStatus out for successful responses', async t => {
+  useFakeBrowser(t, { response: { status: 200 } });
+
+  const result = await scanner.scanURL('https://example.com/', {});
+
+  assert.equal(result.metadata.httpStatus, undefined);
+});
+
+test('retries server errors when failing on HTTP errors', async t => {
+  configure(t, { failOnHttpError: true, ...fastRetries });
+  const browser = useFakeBrowser(t, { response: { status: 502 } });
+
+  await assert.rejects(
+    scanner.scanURL('https://example.com/', {}),
+    new RegExp(`Scan failed after ${config.maxRetriesPerScan} retries: Target responded with HTTP 502`)
+  );
+
+  assert.equal(browser.acquired, config.maxRetriesPerScan);
+  assert.equal(browser.released, config.maxRetriesPerScan);
+  assert.equal(axe.runs.length, 0);
+});
+
+test('fails client errors without retrying when failing on HTTP errors', async t => {
+  configure(t, { failOnHttpError: true, ...fastRetries });
+  const browser = useFakeBrowser(t, { response: { status: 404 } });
+
+  await assert.rejects(scanner.scanURL('https://example.com/', {}), /^Error: Scan failed: Target responded with HTTP 404$/);
+
+  assert.equal(browser.acquired, 1);
+});
+
+test('succeeds once a server error clears on retry', async t => {
+  configure(t, { failOnHttpError: true, ...fastRetries });
+  const behavior = { response: { status: 500 } };
+  const browser = useFakeBrowser(t, behavior);
+  browser.behavior.delays = {
+    goto: async () => {
+      if (browser.acquired === 2) behavior.response = { status: 200 };
+    }
+  };
+
+  const result = await scanner.scanURL('https://example.com/', {});
+
+  assert.equal(browser.acquired, 2);
+  assert.equal(result.metadata.retries, 1);
+  assert.equal(result.metadata.httpStatus, undefined);
+});
+
+test('reports a 401 challenge as AUTH_REQUIRED with its scheme and realm', async t => {
+  configure(t, fastRetries);
+  const browser = useFakeBrowser(t, {
+    response: { status: 401, headers: { 'www-authenticate': 'Basic realm="Staging", charset="UTF-8"' } }
+  });
+
+  await assert.rejects(
+    scanner.scanURL('https://example.com/', {}),
+    error => {
+      assert.equal(error.code, 'AUTH_REQUIRED');
+      assert.equal(error.scheme, 'Basic');
+      assert.equal(error.realm, 'Staging');
+      assert.equal(error.message, 'Target requires Basic authentication');
+      return true;
+    }
+  );
+  // Not retried and the login page isn't scanned
+  assert.equal(browser.pages.length, 1);
+  assert.equal(axe.runs.length, 0);
+});
+
+test('reports challenges without a realm by scheme alone', async t => {
+  useFakeBrowser(t, { response: { status: 401, headers: { 'www-authenticate': 'Bearer error="invalid_token"' } } });
+
+  await assert.rejects(
+    scanner.scanURL('https://example.com/', {}),
+    { code: 'AUTH_REQUIRED', scheme: 'Bearer', realm: undefined }
+  );
+});
+
+test('treats a 401 without a challenge as an ordinary HTTP error', async t => {
+  useFakeBrowser(t, { response: { status: 401 } });
+
+  const result = await scanner.scanURL('https://example.com/', {});
+
+  assert.equal(result.metadata.httpStatus, 401);
+  assert.equal(axe.runs.length, 1);
+});
+
+test('records the challenge scheme for bulk scan pages', async () => {
+  const runner = new BulkScanRunner({
+    scan: async () => {
+      throw Object.assign(new Error('Target requires Digest authentication'), { code: 'AUTH_REQUIRED', scheme: 'Digest' });
+    },
+    maxDuration: 0,
+    dedupContent: false
+  });
+
+  const status = await runner.run('batch_1', ['https://example.com/'], {});
+
+  assert.deepEqual(status.errors, [{
+    url: 'https://example.com/',
+    error: 'Target requires Digest authentication',
+    code: 'AUTH_REQUIRED',
+    scheme: 'Digest'
+  }]);
+});
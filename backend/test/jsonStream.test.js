@@ -0,0 +1,77 @@
+const { test } = require('node:test');
+const assert = require('node:assert/strict');
+const { Writable } = require('stream');
+const { streamJson } = require('../src/services/jsonStream');
+
+// Response collecting each chunk written; a slow one applies backpressure
+function fakeResponse({ slow = false } = {}) {
+  const res = new Writable({
+    highWaterMark: slow ? 16 : 16384,
+    write(chunk, encoding, callback) {
+      res.chunks.push(chunk.toString());
+      setImmediate(callback, null);
+    }
+  });
+  res.chunks = [];
+  res.flushes = 0;
+  res.type = contentType => { res.contentType = contentType; };
+  res.flush = () => { res.flushes++; };
+  return res;
+}
+
+function scanResult(nodeCount) {
+  return {
+    scanId: 'scan_1',
+    url: 'https://example.com/',
+    summary: { violations: 1 },
+    violations: Array.from({ length: nodeCount }, (_, i) => ({
+      id: 'image-alt',
+      target: [`img:nth-child(${i + 1})`],
+      html: `<img src="${i}.png">`
+    })),
+    metadata: undefined,
+    warnings: []
+  };
+}
+
+test('streams a large result in chunks that assemble into the same JSON', async () => {
+  const res = fakeResponse();
+  const body = scanResult(180);
+
+  await streamJson(res, body);
+  await new Promise(resolve => res.on('finish', resolve));
+
+  const text = res.chunks.join('');
+  assert.equal(res.contentType, 'application/json');
+  assert.equal(text, JSON.stringify(body));
+  assert.deepEqual(JSON.parse(text), JSON.parse(JSON.stringify(body)));
+  // Header fields, three full chunks of 50, the rest, and the closing brace
+  assert.ok(res.chunks.length >= 6, `${res.chunks.length} chunks`);
+  assert.ok(res.flushes >= 4);
+});
+
+test('waits for the client to drain before writing more', async () => {
+  const res = fakeResponse({ slow: true });
+  const body = scanResult(120);
+
+  await streamJson(res, body);
+  await new Promise(resolve => res.on('finish', resolve));
+
+  assert.deepEqual(JSON.parse(res.chunks.join('')), JSON.parse(JSON.stringify(body)));
+});
+
+test('writes undefined array elements as null, like JSON.stringify', async () => {
+  const res = fakeResponse();
+
+  await streamJson(res, { values: [1, undefined, 3], empty: [] });
+  await new Promise(resolve => res.on('finish', resolve));
+
+  assert.equal(res.chunks.join(''), '{"values":[1,null,3],"empty":[]}');
+});
+
+test('fails when the client disconnects mid-stream', async () => {
+  const res = fakeResponse({ slow: true });
+  res.once('drain', () => res.destroy());
+
+  await assert.rejects(streamJson(res, scanResult(200)), /Response closed while streaming/);
+});
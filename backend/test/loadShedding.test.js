@@ -0,0 +1,60 @@
+const { test } = require('node:test');
+const assert = require('node:assert/strict');
+const { scanner } = require('./helpers/fakeBrowser');
+const config = require('../src/config');
+const { manager } = require('../src/services/circuitBreaker');
+
+// Occupy every browser of the real pool, so scans queue for one
+function saturatePool(t, acquireTimeout) {
+  const { browserPool } = scanner;
+  const previous = { activeCount: browserPool.activeCount, acquireTimeout: config.browserAcquireTimeout };
+  browserPool.activeCount = browserPool.maxSize;
+  config.browserAcquireTimeout = acquireTimeout;
+  t.after(() => {
+    browserPool.activeCount = previous.activeCount;
+    config.browserAcquireTimeout = previous.acquireTimeout;
+  });
+  return browserPool;
+}
+
+test('sheds scans with OVERLOADED when no browser frees up in time', async t => {
+  const browserPool = saturatePool(t, 30);
+  const started = Date.now();
+
+  await assert.rejects(scanner.scanHTML('<p>Hello</p>', {}), error => {
+    assert.equal(error.code, 'OVERLOADED');
+    assert.equal(error.retryable, false);
+    assert.match(error.message, /Browser acquire timeout after 30ms/);
+    return true;
+  });
+
+  // Shed after one wait, not retried
+  assert.ok(Date.now() - started < 1000);
+  assert.equal(browserPool.queue.length, 0);
+});
+
+test('a busy pool does not trip the browser circuit breaker', async t => {
+  saturatePool(t, 10);
+  const enabled = config.browserBreaker.enabled;
+  config.browserBreaker.enabled = true;
+  t.after(() => { config.browserBreaker.enabled = enabled; });
+  const breaker = manager.getBreaker('browser');
+
+  for (let i = 0; i < 10; i++) {
+    await assert.rejects(scanner.scanHTML('<p>Hello</p>', {}), { code: 'OVERLOADED' });
+  }
+  assert.equal(breaker.state, 'CLOSED');
+});
+
+test('stops waiting for a browser when the scan is canceled', async t => {
+  const browserPool = saturatePool(t, 5000);
+  const controller = new AbortController();
+
+  const scan = scanner.scanHTML('<p>Hello</p>', {}, { signal: controller.signal });
+  await new Promise(resolve => setImmediate(resolve));
+  assert.equal(browserPool.queue.length, 1);
+  controller.abort();
+
+  await assert.rejects(scan, error => error.code !== 'OVERLOADED');
+  assert.equal(browserPool.queue.length, 0);
+});
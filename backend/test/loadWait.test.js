@@ -0,0 +1,81 @@
+const { test } = require('node:test');
+const assert = require('node:assert/strict');
+const { scanner, useFakeBrowser } = require('./helpers/fakeBrowser');
+const { ScanRequestSchema, coerceOptions } = require('../src/schemas/validation');
+const config = require('../src/config');
+
+function timeoutError() {
+  const error = new Error('Waiting failed: 100ms exceeded');
+  error.name = 'TimeoutError';
+  return error;
+}
+
+test('waits for the network to go idle without maxLoadWait', async t => {
+  const browser = useFakeBrowser(t);
+
+  const result = await scanner.scanURL('https://example.com/', {});
+
+  const page = browser.pages[0];
+  assert.equal(page.called('goto')[0][1].waitUntil, 'networkidle2');
+  assert.deepEqual(page.called('waitForFunction'), []);
+  assert.equal(result.metadata.loadWaitExceeded, undefined);
+});
+
+test('waits up to maxLoadWait for the load event once the DOM is ready', async t => {
+  const browser = useFakeBrowser(t);
+
+  const result = await scanner.scanURL('https://example.com/', { maxLoadWait: 2000 });
+
+  const page = browser.pages[0];
+  assert.equal(page.called('goto')[0][1].waitUntil, 'domcontentloaded');
+  assert.deepEqual(page.called('waitForFunction'), [[{ timeout: 2000 }]]);
+  assert.equal(result.metadata.loadWaitExceeded, undefined);
+});
+
+test('scans a page that never fires load, marking it', async t => {
+  useFakeBrowser(t, {
+    delays: { waitForFunction: async () => { throw timeoutError(); } }
+  });
+
+  const result = await scanner.scanURL('https://example.com/spa', { maxLoadWait: 100 });
+
+  assert.equal(result.metadata.loadWaitExceeded, true);
+  assert.deepEqual(result.violations, []);
+});
+
+test('applies to HTML scans too', async t => {
+  const browser = useFakeBrowser(t);
+
+  await scanner.scanHTML('<html><body><h1>Hi</h1></body></html>', { maxLoadWait: 500 });
+
+  const page = browser.pages[0];
+  assert.equal(page.called('setContent')[0][1].waitUntil, 'domcontentloaded');
+  assert.deepEqual(page.called('waitForFunction'), [[{ timeout: 500 }]]);
+});
+
+test('clamps maxLoadWait to MAX_LOAD_WAIT and the scan timeout', async t => {
+  const maxLoadWait = config.maxLoadWait;
+  config.maxLoadWait = 3000;
+  t.after(() => { config.maxLoadWait = maxLoadWait; });
+  const browser = useFakeBrowser(t);
+
+  await scanner.scanURL('https://example.com/a', { maxLoadWait: 60000 });
+  await scanner.scanURL('https://example.com/b', { maxLoadWait: 60000, timeout: 10000 });
+  config.maxLoadWait = 60000;
+  await scanner.scanURL('https://example.com/c', { maxLoadWait: 60000, timeout: 10000 });
+
+  const waits = browser.pages.map(page => page.called('waitForFunction')[0][0].timeout);
+  assert.deepEqual(waits, [3000, 3000, 10000]);
+});
+
+test('validates and coerces maxLoadWait', () => {
+  const request = options => ({ type: 'url', input: 'https://example.com/', options });
+
+  assert.equal(ScanRequestSchema.safeParse(request({ maxLoadWait: 0 })).success, true);
+  assert.equal(ScanRequestSchema.safeParse(request({ maxLoadWait: -1 })).success, false);
+  assert.equal(ScanRequestSchema.safeParse(request({ maxLoadWait: 1.5 })).success, false);
+
+  const options = { maxLoadWait: '5000' };
+  coerceOptions(options);
+  assert.equal(options.maxLoadWait, 5000);
+});
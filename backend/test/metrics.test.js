@@ -0,0 +1,60 @@
+const { test } = require('node:test');
+const assert = require('node:assert/strict');
+const { sanitizeLabels, routeLabel, observeScanDuration, metricsHandler } = require('../src/services/metrics');
+
+test('maps unknown label values to "other"', () => {
+  assert.deepEqual(
+    sanitizeLabels({ type: 'pdf', status: 'exploded', method: 'PROPFIND', severity: 'catastrophic' }),
+    { type: 'other', status: 'other', method: 'other', severity: 'other' }
+  );
+});
+
+test('keeps label values from their allowed sets', () => {
+  assert.deepEqual(
+    sanitizeLabels({ type: 'url', status: 'timeout', method: 'POST', severity: 'serious' }),
+    { type: 'url', status: 'timeout', method: 'POST', severity: 'serious' }
+  );
+  assert.deepEqual(sanitizeLabels({ type: 'html', status: 404 }), { type: 'html', status: 404 });
+  assert.deepEqual(sanitizeLabels({ status: 600 }), { status: 'other' });
+});
+
+test('leaves labels without an allowed set alone', () => {
+  assert.deepEqual(sanitizeLabels({ name: 'browser' }), { name: 'browser' });
+});
+
+test('labels requests by route template, not raw path', () => {
+  assert.equal(routeLabel({ baseUrl: '', route: { path: '/api/scan/bulk/:batchId' } }), '/api/scan/bulk/:batchId');
+  assert.equal(routeLabel({ baseUrl: '/api', route: { path: '/scans' } }), '/api/scans');
+  assert.equal(routeLabel({ path: '/wp-login.php' }), 'other');
+});
+
+// Scrape the metrics handler with an Accept header
+async function scrape(accept) {
+  const req = { accepts: types => types.find(type => accept.includes(type)) || false };
+  const res = {
+    headers: {},
+    setHeader(name, value) { this.headers[name.toLowerCase()] = value; },
+    send(body) { this.body = body; }
+  };
+  await metricsHandler(req, res);
+  return res;
+}
+
+test('serves OpenMetrics with trace ID exemplars when asked for it', async () => {
+  observeScanDuration({ type: 'url', status: 'success' }, 1.5, 'trace-abc');
+
+  const res = await scrape('application/openmetrics-text; version=1.0.0');
+
+  assert.match(res.headers['content-type'], /^application\/openmetrics-text/);
+  assert.match(res.body, /# \{traceId="trace-abc"\} 1\.5/);
+  assert.match(res.body, /# EOF\n$/);
+});
+
+test('serves the Prometheus text format without exemplars by default', async () => {
+  observeScanDuration({ type: 'url', status: 'success' }, 2.5, 'trace-def');
+
+  const res = await scrape('text/plain');
+
+  assert.match(res.headers['content-type'], /^text\/plain/);
+  assert.doesNotMatch(res.body, /traceId/);
+});
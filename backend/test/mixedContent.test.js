@@ -0,0 +1,80 @@
+const { test } = require('node:test');
+const assert = require('node:assert/strict');
+const { scanner, useFakeBrowser, FakeRequest } = require('./helpers/fakeBrowser');
+const { ScanRequestSchema } = require('../src/schemas/validation');
+
+const consoleMessage = text => ({ type: () => 'warning', text: () => text });
+
+const blocked = "Mixed Content: The page at 'https://example.com/' was loaded over HTTPS, but requested an insecure script 'http://cdn.example.com/app.js'. This request has been blocked; the content must be served over HTTPS.";
+const upgraded = "Mixed Content: The page at 'https://example.com/' was loaded over HTTPS, but requested an insecure image 'http://img.example.com/logo.png'. This content was automatically upgraded to HTTPS.";
+
+// Page behavior sending the given subresource requests and console
+// messages while the page loads
+function loading({ requests = [], messages = [] }) {
+  return {
+    delays: {
+      goto: async page => {
+        const httpsFrame = { url: () => page.url() };
+        const httpFrame = { url: () => 'http://ads.example.net/frame' };
+        requests.forEach(({ insecureFrame, ...spec }) => {
+          page.emit('request', new FakeRequest(page, { navigation: false, ...spec, frame: insecureFrame ? httpFrame : httpsFrame }));
+        });
+        messages.forEach(text => page.emit('console', consoleMessage(text)));
+      }
+    }
+  };
+}
+
+test('reports insecure subresources the page loaded, blocked or upgraded', async t => {
+  useFakeBrowser(t, loading({
+    requests: [
+      { url: 'http://img.example.com/photo.jpg', resourceType: 'image' },
+      { url: 'https://img.example.com/secure.jpg', resourceType: 'image' },
+      { url: 'http://img.example.com/logo.png', resourceType: 'image' }
+    ],
+    messages: [blocked, upgraded, 'Some unrelated warning']
+  }));
+
+  const result = await scanner.scanURL('https://example.com/', { mixedContent: true });
+
+  assert.deepEqual(result.metadata.mixedContent, [
+    { url: 'http://img.example.com/photo.jpg', type: 'image', status: 'loaded' },
+    { url: 'http://img.example.com/logo.png', type: 'image', status: 'upgraded' },
+    { url: 'http://cdn.example.com/app.js', type: 'script', status: 'blocked' }
+  ]);
+});
+
+test('ignores http requests of http frames and pages', async t => {
+  useFakeBrowser(t, loading({
+    requests: [{ url: 'http://ads.example.net/pixel.gif', resourceType: 'image', insecureFrame: true }]
+  }));
+
+  const result = await scanner.scanURL('https://example.com/', { mixedContent: true });
+  assert.deepEqual(result.metadata.mixedContent, []);
+
+  const plain = await scanner.scanURL('http://example.com/', { mixedContent: true });
+  assert.deepEqual(plain.metadata.mixedContent, []);
+});
+
+test('reports nothing unless requested', async t => {
+  useFakeBrowser(t, loading({ messages: [blocked] }));
+
+  const result = await scanner.scanURL('https://example.com/', {});
+
+  assert.equal(result.metadata.mixedContent, undefined);
+});
+
+test('caps the resources reported', async t => {
+  const requests = Array.from({ length: 150 }, (_, i) => ({ url: `http://img.example.com/${i}.png`, resourceType: 'image' }));
+  useFakeBrowser(t, loading({ requests }));
+
+  const result = await scanner.scanURL('https://example.com/', { mixedContent: true });
+
+  assert.equal(result.metadata.mixedContent.length, 100);
+});
+
+test('accepts mixedContent as a boolean', () => {
+  const parse = mixedContent => ScanRequestSchema.safeParse({ type: 'url', input: 'https://example.com/', options: { mixedContent } });
+  assert.equal(parse(true).success, true);
+  assert.equal(parse('sometimes').success, false);
+});
@@ -0,0 +1,55 @@
+const { test } = require('node:test');
+const assert = require('node:assert/strict');
+const { encode, decode } = require('../src/services/msgpack');
+
+const response = {
+  success: true,
+  scanId: 'scan_1705314600000_abc123def',
+  results: {
+    url: 'https://example.com/',
+    timestamp: new Date('2024-01-15T10:30:00.000Z'),
+    scanTime: 2345,
+    summary: {
+      violations: 2,
+      passes: 40,
+      incomplete: 0,
+      complianceScore: 95.24,
+      violationsBySeverity: { critical: 1, serious: 1, moderate: 0, minor: 0 }
+    },
+    violations: [{
+      id: 'image-alt',
+      impact: 'critical',
+      description: 'Ensures <img> elements have alternate text – “alt”',
+      tags: ['wcag2a', 'wcag111'],
+      nodes: [{ html: '<img src="a.png">', target: ['#hero > img'], impact: undefined }]
+    }],
+    metadata: { retries: 0, httpStatus: null, offsets: [-1, -200, -40000, 300, 70000, 5000000000, 0.5] }
+  },
+  cached: false
+};
+
+test('round-trips a scan response with JSON semantics', () => {
+  assert.deepEqual(decode(encode(response)), JSON.parse(JSON.stringify(response)));
+});
+
+test('encodes long strings, arrays and maps with sized headers', () => {
+  const value = {
+    text: 'x'.repeat(70000),
+    list: Array.from({ length: 20 }, (_, i) => i),
+    map: Object.fromEntries(Array.from({ length: 20 }, (_, i) => [`k${i}`, i]))
+  };
+  assert.deepEqual(decode(encode(value)), value);
+});
+
+test('encodes buffers as binary instead of their toJSON()', () => {
+  const screenshot = Buffer.from([0x89, 0x50, 0x4e, 0x47, 0x00, 0xff]);
+  const encoded = encode({ screenshot });
+
+  assert.equal(encoded[encoded.length - screenshot.length - 2], 0xc4);
+  assert.deepEqual(Buffer.from(decode(encoded).screenshot), screenshot);
+});
+
+test('rejects truncated data', () => {
+  const encoded = encode(response);
+  assert.throws(() => decode(encoded.subarray(0, encoded.length - 3)));
+});
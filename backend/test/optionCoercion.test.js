@@ -0,0 +1,89 @@
+const { test } = require('node:test');
+const assert = require('node:assert/strict');
+const {
+  ScanRequestSchema,
+  coerceOptions,
+  coerceRequestOptions,
+  validateRequest
+} = require('../src/schemas/validation');
+
+// Run the coercion and validation middleware as the scan route does
+function submit(body) {
+  const req = { body };
+  const res = {
+    statusCode: 200,
+    status(code) { this.statusCode = code; return this; },
+    json(payload) { this.body = payload; return this; }
+  };
+  let passed = false;
+  coerceRequestOptions(req, res, () => {
+    validateRequest(ScanRequestSchema)(req, res, () => { passed = true; });
+  });
+  return { req, res, passed };
+}
+
+test('coerces recoverable type mismatches and reports each one', () => {
+  const options = {
+    timeout: '30000',
+    xpath: 'true',
+    screenshot: 0,
+    waitUntil: ' Load ',
+    wcagLevel: 'aa',
+    runOnly: 'image-alt',
+    viewport: '1280x720'
+  };
+
+  const warnings = coerceOptions(options);
+
+  assert.deepEqual(options, {
+    timeout: 30000,
+    xpath: true,
+    screenshot: false,
+    waitUntil: 'load',
+    wcagLevel: 'AA',
+    runOnly: ['image-alt'],
+    viewport: { width: 1280, height: 720 }
+  });
+  assert.equal(warnings.length, 7);
+  assert.ok(warnings.includes('options.timeout: coerced "30000" to 30000'));
+  assert.ok(warnings.includes('options.viewport: coerced "1280x720" to {"width":1280,"height":720}'));
+});
+
+test('coerces viewports given as a pair or with numeric strings', () => {
+  const pair = { viewport: [375, 667] };
+  const strings = { viewport: { width: '1024', height: '768' } };
+
+  coerceOptions(pair);
+  coerceOptions(strings);
+
+  assert.deepEqual(pair.viewport, { width: 375, height: 667 });
+  assert.deepEqual(strings.viewport, { width: 1024, height: 768 });
+});
+
+test('leaves well-typed options alone without warnings', () => {
+  const options = { timeout: 30000, xpath: true, viewport: { width: 1280, height: 720 }, wcagLevel: 'AA' };
+
+  assert.deepEqual(coerceOptions(options), []);
+  assert.deepEqual(coerceOptions(undefined), []);
+  assert.deepEqual(coerceOptions(['not', 'options']), []);
+});
+
+test('accepts coerced requests with the warnings attached', () => {
+  const { req, res, passed } = submit({ type: 'url', input: 'https://example.com', options: { timeout: '5000', wcagLevel: 'aaa' } });
+
+  assert.equal(passed, true);
+  assert.equal(res.statusCode, 200);
+  assert.equal(req.body.options.timeout, 5000);
+  assert.equal(req.optionWarnings.length, 2);
+});
+
+test('rejects values that cannot be coerced with a 400', () => {
+  for (const options of [{ timeout: 'soon' }, { viewport: 'large' }, { wcagLevel: 2 }, { xpath: 'yes' }]) {
+    const { res, passed } = submit({ type: 'url', input: 'https://example.com', options });
+
+    assert.equal(passed, false, JSON.stringify(options));
+    assert.equal(res.statusCode, 400);
+    assert.equal(res.body.code, 'INVALID_INPUT');
+    assert.ok(res.body.details.every(detail => detail.field.startsWith('options.')));
+  }
+});
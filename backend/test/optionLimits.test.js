@@ -0,0 +1,57 @@
+const { test } = require('node:test');
+const assert = require('node:assert/strict');
+const { ScanRequestSchema, validateRequest } = require('../src/schemas/validation');
+const config = require('../src/config');
+
+// Validate a scan request as the scan route does
+function submit(options) {
+  const req = { body: { type: 'url', input: 'https://example.com/', options } };
+  const res = {
+    statusCode: 200,
+    status(code) { this.statusCode = code; return this; },
+    json(payload) { this.body = payload; return this; }
+  };
+  validateRequest(ScanRequestSchema)(req, res, () => {});
+  return res;
+}
+
+const { maxSelectorLength, maxStringLength, maxBodyLength } = config.optionLimits;
+
+test('rejects oversized free-text options with a 400 naming the field', () => {
+  const cases = [
+    ['consentSelectors.0', { consentSelectors: ['#'.repeat(maxSelectorLength + 1)] }, `consentSelectors exceeds maximum length of ${maxSelectorLength} characters`],
+    ['referrer', { referrer: `https://example.com/${'a'.repeat(maxStringLength)}` }, `referrer exceeds maximum length of ${maxStringLength} characters`],
+    ['acceptHeader', { acceptHeader: `text/html,${'a'.repeat(300)}` }, 'acceptHeader exceeds maximum length of 256 characters'],
+    ['body', { method: 'POST', body: 'x'.repeat(maxBodyLength + 1) }, `body exceeds maximum length of ${maxBodyLength} characters`],
+    ['customChecks.0', { customChecks: ['c'.repeat(101)] }, 'customChecks exceeds maximum length of 100 characters']
+  ];
+
+  for (const [field, options, message] of cases) {
+    const res = submit(options);
+
+    assert.equal(res.statusCode, 400, field);
+    assert.equal(res.body.code, 'INVALID_INPUT');
+    assert.ok(
+      res.body.details.some(detail => detail.field === `options.${field}` && detail.message === message),
+      JSON.stringify(res.body.details)
+    );
+  }
+});
+
+test('rejects megabyte values in option arrays', () => {
+  const res = submit({ runOnly: ['a'.repeat(1024 * 1024)] });
+
+  assert.equal(res.statusCode, 400);
+  assert.equal(res.body.details[0].field, 'options.runOnly.0');
+  assert.equal(res.body.details[0].message, 'runOnly exceeds maximum length of 100 characters');
+});
+
+test('accepts free-text options at their maximum length', () => {
+  const res = submit({
+    consentSelectors: ['#'.repeat(maxSelectorLength)],
+    method: 'POST',
+    body: 'x'.repeat(maxBodyLength)
+  });
+
+  assert.equal(res.statusCode, 200);
+});
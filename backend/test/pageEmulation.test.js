@@ -0,0 +1,157 @@
+const { test } = require('node:test');
+const assert = require('node:assert/strict');
+const vm = require('vm');
+const { scanner, useFakeBrowser } = require('./helpers/fakeBrowser');
+const { ScanRequestSchema } = require('../src/schemas/validation');
+
+// Index of a page's first call to method
+const callIndex = (page, method) => page.calls.findIndex(([name]) => name === method);
+
+function parseOptions(options) {
+  return ScanRequestSchema.safeParse({ type: 'url', input: 'https://example.com/', options });
+}
+
+test('emulates prefers-reduced-motion before the page loads', async t => {
+  const browser = useFakeBrowser(t);
+
+  await scanner.scanURL('https://example.com/', { reducedMotion: 'reduce' });
+
+  const [page] = browser.pages;
+  assert.deepEqual(page.called('emulateMediaFeatures'), [[[{ name: 'prefers-reduced-motion', value: 'reduce' }]]]);
+  assert.ok(callIndex(page, 'emulateMediaFeatures') < callIndex(page, 'goto'));
+});
+
+test('leaves media features alone by default', async t => {
+  const browser = useFakeBrowser(t);
+
+  await scanner.scanHTML('<p>Hello</p>', {});
+
+  assert.equal(browser.pages[0].called('emulateMediaFeatures').length, 0);
+});
+
+test('accepts only known reducedMotion values', () => {
+  assert.equal(parseOptions({ reducedMotion: 'no-preference' }).success, true);
+  assert.equal(parseOptions({ reducedMotion: 'always' }).success, false);
+});
+
+test('emulates forced-colors alongside reduced motion', async t => {
+  const browser = useFakeBrowser(t);
+
+  await scanner.scanURL('https://example.com/', { reducedMotion: 'reduce', forcedColors: 'active' });
+
+  const [page] = browser.pages;
+  assert.deepEqual(page.called('emulateMediaFeatures'), [[[
+    { name: 'prefers-reduced-motion', value: 'reduce' },
+    { name: 'forced-colors', value: 'active' }
+  ]]]);
+  assert.ok(callIndex(page, 'emulateMediaFeatures') < callIndex(page, 'goto'));
+});
+
+test('accepts only known forcedColors values', () => {
+  assert.equal(parseOptions({ forcedColors: 'active' }).success, true);
+  assert.equal(parseOptions({ forcedColors: 'none' }).success, true);
+  assert.equal(parseOptions({ forcedColors: 'high-contrast' }).success, false);
+  assert.equal(parseOptions({ forcedColors: true }).success, false);
+});
+
+test('sets the geolocation and grants it to the scanned origin', async t => {
+  const browser = useFakeBrowser(t);
+
+  await scanner.scanURL('https://example.com/store', { geolocation: { latitude: 48.8566, longitude: 2.3522 } });
+
+  const [page] = browser.pages;
+  assert.deepEqual(page.called('setGeolocation'), [[{ accuracy: 100, latitude: 48.8566, longitude: 2.3522 }]]);
+  assert.deepEqual(browser.defaultContext.permissions, [{ origin: 'https://example.com', permissions: ['geolocation'] }]);
+  assert.ok(callIndex(page, 'setGeolocation') < callIndex(page, 'goto'));
+});
+
+test('does not grant geolocation to HTML scans', async t => {
+  const browser = useFakeBrowser(t);
+
+  await scanner.scanHTML('<p>Hello</p>', { geolocation: { latitude: 0, longitude: 0, accuracy: 5 } });
+
+  assert.deepEqual(browser.pages[0].called('setGeolocation'), [[{ accuracy: 5, latitude: 0, longitude: 0 }]]);
+  assert.deepEqual(browser.defaultContext.permissions, []);
+});
+
+test('clears geolocation grants left by earlier scans', async t => {
+  const browser = useFakeBrowser(t);
+  browser.defaultContext.permissions.push({ origin: 'https://other.example', permissions: ['geolocation'] });
+
+  await scanner.scanURL('https://example.com/', {});
+
+  assert.deepEqual(browser.defaultContext.permissions, []);
+});
+
+test('validates geolocation coordinate ranges', () => {
+  assert.equal(parseOptions({ geolocation: { latitude: -90, longitude: 180 } }).success, true);
+
+  const cases = [
+    [{ latitude: 90.5, longitude: 0 }, 'latitude must be between -90 and 90'],
+    [{ latitude: 0, longitude: -181 }, 'longitude must be between -180 and 180'],
+    [{ latitude: 0, longitude: 0, accuracy: -1 }, null],
+    [{ latitude: 0 }, null]
+  ];
+  for (const [geolocation, message] of cases) {
+    const parsed = parseOptions({ geolocation });
+    assert.equal(parsed.success, false, JSON.stringify(geolocation));
+    if (message) {
+      assert.equal(parsed.error.issues[0].message, message);
+    }
+  }
+});
+
+test('emulates the time zone before the page loads', async t => {
+  const browser = useFakeBrowser(t);
+
+  await scanner.scanURL('https://example.com/', { timezone: 'America/New_York' });
+
+  const [page] = browser.pages;
+  assert.deepEqual(page.called('emulateTimezone'), [['America/New_York']]);
+  assert.ok(callIndex(page, 'emulateTimezone') < callIndex(page, 'goto'));
+});
+
+test('accepts only IANA time zone names', () => {
+  assert.equal(parseOptions({ timezone: 'Europe/Berlin' }).success, true);
+  assert.equal(parseOptions({ timezone: 'UTC' }).success, true);
+
+  for (const timezone of ['Mars/Olympus_Mons', 'GMT+25', '', 'x'.repeat(65)]) {
+    assert.equal(parseOptions({ timezone }).success, false, timezone);
+  }
+  assert.equal(
+    parseOptions({ timezone: 'Mars/Olympus_Mons' }).error.issues[0].message,
+    'timezone must be an IANA time zone name'
+  );
+});
+
+test('starts the page clock at mockDate and reports it', async t => {
+  const browser = useFakeBrowser(t);
+
+  const result = await scanner.scanURL('https://example.com/', { mockDate: '2024-01-15T09:30:00Z' });
+
+  const [page] = browser.pages;
+  const [[script, start]] = page.called('evaluateOnNewDocument').filter(([, arg]) => typeof arg === 'number');
+  assert.equal(start, Date.UTC(2024, 0, 15, 9, 30));
+  assert.equal(result.metadata.mockDate, '2024-01-15T09:30:00.000Z');
+  assert.ok(callIndex(page, 'evaluateOnNewDocument') < callIndex(page, 'goto'));
+
+  // Run the script as the page would
+  const context = vm.createContext({});
+  context.window = context;
+  vm.runInContext(`(${script})(${start})`, context);
+  const PageDate = context.Date;
+  assert.ok(Math.abs(PageDate.now() - start) < 1000);
+  assert.equal(new PageDate().getUTCFullYear(), 2024);
+  assert.equal(new PageDate(0).getTime(), 0);
+  assert.equal(PageDate.parse('2000-01-01T00:00:00Z'), 946684800000);
+  assert.ok(new PageDate() instanceof PageDate);
+});
+
+test('accepts mockDate as an ISO 8601 timestamp or epoch milliseconds', () => {
+  for (const mockDate of ['2024-01-15', '2024-01-15T09:30:00Z', '2024-01-15T09:30:00.250+02:00', 1705311000000, 0]) {
+    assert.equal(parseOptions({ mockDate }).success, true, String(mockDate));
+  }
+  for (const mockDate of ['yesterday', '2024-13-45', '15/01/2024', -1, 1.5, 253402300800000]) {
+    assert.equal(parseOptions({ mockDate }).success, false, String(mockDate));
+  }
+});
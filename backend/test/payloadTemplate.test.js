@@ -0,0 +1,58 @@
+const { test } = require('node:test');
+const assert = require('node:assert/strict');
+const { compileTemplate } = require('../src/services/payloadTemplate');
+
+const result = {
+  scanId: 'scan_1',
+  url: 'https://example.com/',
+  summary: { violations: 2, critical: 1 },
+  violations: [{ id: 'image-alt' }, { id: 'color-contrast' }]
+};
+
+test('replaces single placeholders with the referenced values', () => {
+  const render = compileTemplate(JSON.stringify({
+    count: '{{summary.violations}}',
+    rules: '{{ violations }}',
+    summary: '{{summary}}'
+  }));
+
+  assert.deepEqual(render(result), {
+    count: 2,
+    rules: result.violations,
+    summary: result.summary
+  });
+});
+
+test('interpolates placeholders within longer strings as text', () => {
+  const render = compileTemplate('{"text": "{{url}} has {{summary.violations}} violations: {{summary}}"}');
+
+  assert.deepEqual(render(result), {
+    text: 'https://example.com/ has 2 violations: {"violations":2,"critical":1}'
+  });
+});
+
+test('renders nested objects and arrays, leaving other values alone', () => {
+  const render = compileTemplate(JSON.stringify({
+    blocks: [{ type: 'section', text: { value: 'Scan {{scanId}}' } }, '{{url}}'],
+    urgent: true,
+    priority: 3,
+    none: null
+  }));
+
+  assert.deepEqual(render(result), {
+    blocks: [{ type: 'section', text: { value: 'Scan scan_1' } }, 'https://example.com/'],
+    urgent: true,
+    priority: 3,
+    none: null
+  });
+});
+
+test('renders missing fields as null or an empty string', () => {
+  const render = compileTemplate('{"batch": "{{batchId}}", "text": "batch [{{batchId}}] of {{metadata.client.name}}"}');
+
+  assert.deepEqual(render(result), { batch: null, text: 'batch [] of ' });
+});
+
+test('rejects templates that are not JSON', () => {
+  assert.throws(() => compileTemplate('{"text": {{url}}}'), /^Error: Invalid payload template/);
+});
@@ -0,0 +1,117 @@
+const { test } = require('node:test');
+const assert = require('node:assert/strict');
+const config = require('../src/config');
+const { MemoryTokenBucketStore, clientId, rateLimit, setRateLimitStore } = require('../src/middleware/rateLimit');
+
+const limits = { rate: 1 / 1000, burst: 3 };
+
+test('allows a burst, then refills over time', async () => {
+  const store = new MemoryTokenBucketStore();
+  const now = 1000000;
+
+  for (let i = 0; i < 3; i++) {
+    assert.equal((await store.take('client', 1, limits, now)).allowed, true);
+  }
+  const limited = await store.take('client', 1, limits, now);
+  assert.equal(limited.allowed, false);
+  assert.equal(limited.retryAfter, 1000);
+
+  assert.equal((await store.take('client', 1, limits, now + 1000)).allowed, true);
+});
+
+test('keeps a bucket per client', async () => {
+  const store = new MemoryTokenBucketStore();
+  await store.take('a', 3, limits, 0);
+
+  assert.equal((await store.take('a', 1, limits, 0)).allowed, false);
+  assert.equal((await store.take('b', 1, limits, 0)).allowed, true);
+});
+
+test('reports when a request larger than the burst could run', async () => {
+  const store = new MemoryTokenBucketStore();
+  await store.take('client', 2, limits, 0);
+
+  const result = await store.take('client', 10, limits, 0);
+  assert.equal(result.allowed, false);
+  assert.equal(result.retryAfter, 2000);
+});
+
+test('identifies clients by configured API key, otherwise by IP', t => {
+  const apiKeys = config.apiKeys;
+  config.apiKeys = ['good-key'];
+  t.after(() => { config.apiKeys = apiKeys; });
+
+  const request = key => ({ ip: '203.0.113.7', get: () => key });
+  assert.equal(clientId(request('good-key')), 'key:good-key');
+  assert.equal(clientId(request('made-up-key')), 'ip:203.0.113.7');
+  assert.equal(clientId(request(undefined)), 'ip:203.0.113.7');
+});
+
+// Run the middleware for a client as express would
+async function submit(middleware, ip = '203.0.113.7') {
+  const res = {
+    statusCode: 200,
+    headers: {},
+    set(name, value) { this.headers[name] = value; return this; },
+    status(code) { this.statusCode = code; return this; },
+    json(payload) { this.body = payload; return this; }
+  };
+  let passed = false;
+  await middleware({ ip, path: '/api/scan', get: () => undefined }, res, () => { passed = true; });
+  return { res, passed };
+}
+
+function configureRateLimit(t, values) {
+  const previous = config.rateLimit;
+  config.rateLimit = { ...previous, enabled: true, ...values };
+  setRateLimitStore(new MemoryTokenBucketStore());
+  t.after(() => {
+    config.rateLimit = previous;
+    setRateLimitStore(new MemoryTokenBucketStore());
+  });
+}
+
+test('rejects scans over the limit with 429 and Retry-After', async t => {
+  configureRateLimit(t, { windowMs: 60000, maxRequests: 2, burst: 2 });
+  const middleware = rateLimit();
+
+  assert.equal((await submit(middleware)).res.headers['X-RateLimit-Remaining'], '1');
+  assert.equal((await submit(middleware)).passed, true);
+  const { res, passed } = await submit(middleware);
+
+  assert.equal(passed, false);
+  assert.equal(res.statusCode, 429);
+  assert.equal(res.body.code, 'RATE_LIMITED');
+  assert.equal(res.headers['Retry-After'], '30');
+  assert.equal((await submit(middleware, '198.51.100.1')).passed, true);
+});
+
+test('charges batch requests one token per scan', async t => {
+  configureRateLimit(t, { windowMs: 60000, maxRequests: 5, burst: 5 });
+
+  assert.equal((await submit(rateLimit(() => 4))).passed, true);
+  assert.equal((await submit(rateLimit(() => 2))).passed, false);
+  assert.equal((await submit(rateLimit(() => 1))).passed, true);
+});
+
+test('allows requests when disabled or when the store fails', async t => {
+  configureRateLimit(t, { enabled: false, windowMs: 60000, maxRequests: 1, burst: 1 });
+  assert.equal((await submit(rateLimit(() => 10))).passed, true);
+
+  config.rateLimit.enabled = true;
+  setRateLimitStore({ take: async () => { throw new Error('Redis down'); } });
+  const { res, passed } = await submit(rateLimit());
+  assert.equal(passed, true);
+  assert.equal(res.headers['X-RateLimit-Remaining'], undefined);
+});
+
+test('sweeps buckets that have refilled', async () => {
+  const store = new MemoryTokenBucketStore({ sweepInterval: 1000 });
+  const now = Date.now();
+  await store.take('a', 1, limits, now);
+  await store.take('b', 3, limits, now);
+
+  await store.take('c', 1, limits, now + 1500);
+
+  assert.deepEqual([...store.buckets.keys()].sort(), ['b', 'c']);
+});
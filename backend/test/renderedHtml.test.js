@@ -0,0 +1,43 @@
+const { test } = require('node:test');
+const assert = require('node:assert/strict');
+const { scanner, useFakeBrowser } = require('./helpers/fakeBrowser');
+const config = require('../src/config');
+
+function configureCap(t, maxHtmlBytes) {
+  const previous = config.reports.maxHtmlBytes;
+  config.reports.maxHtmlBytes = maxHtmlBytes;
+  t.after(() => { config.reports.maxHtmlBytes = previous; });
+}
+
+const rendered = '<html><body><main>Rendered by script</main></body></html>';
+
+test('stores the rendered HTML when requested', async t => {
+  useFakeBrowser(t, { html: rendered });
+  const artifacts = {};
+
+  await scanner.scanURL('https://example.com/', { renderedHtml: true }, { artifacts });
+
+  assert.equal(artifacts.html, rendered);
+  assert.equal(artifacts.htmlTruncated, false);
+});
+
+test('stores no HTML unless requested', async t => {
+  useFakeBrowser(t, { html: rendered });
+  const artifacts = {};
+
+  await scanner.scanURL('https://example.com/', {}, { artifacts });
+
+  assert.equal(artifacts.html, undefined);
+});
+
+test('caps the stored HTML without splitting a character', async t => {
+  configureCap(t, 8);
+  useFakeBrowser(t, { html: '<p>Grüße aus Köln</p>' });
+  const artifacts = {};
+
+  await scanner.scanHTML('<p>Grüße aus Köln</p>', { renderedHtml: true }, { artifacts });
+
+  // The 8-byte cap falls between the two bytes of "ß"
+  assert.equal(artifacts.html, '<p>Grü');
+  assert.equal(artifacts.htmlTruncated, true);
+});
@@ -0,0 +1,128 @@
+const { test } = require('node:test');
+const assert = require('node:assert/strict');
+const zlib = require('zlib');
+const { createBundleStream } = require('../src/services/reportBundle');
+
+const CRC_TABLE = new Int32Array(256).map((_, n) => {
+  let c = n;
+  for (let k = 0; k < 8; k++) {
+    c = c & 1 ? 0xedb88320 ^ (c >>> 1) : c >>> 1;
+  }
+  return c;
+});
+
+function crc32(buffer) {
+  let crc = -1;
+  for (let i = 0; i < buffer.length; i++) {
+    crc = CRC_TABLE[(crc ^ buffer[i]) & 0xff] ^ (crc >>> 8);
+  }
+  return (crc ^ -1) >>> 0;
+}
+
+async function collect(stream) {
+  const chunks = [];
+  for await (const chunk of stream) {
+    chunks.push(chunk);
+  }
+  return { archive: Buffer.concat(chunks), chunks: chunks.length };
+}
+
+// Read a zip's entries through its central directory, checking each CRC
+function readZip(archive) {
+  const end = archive.lastIndexOf(Buffer.from([0x50, 0x4b, 0x05, 0x06]));
+  const count = archive.readUInt16LE(end + 10);
+  let position = archive.readUInt32LE(end + 16);
+  const entries = {};
+
+  for (let i = 0; i < count; i++) {
+    assert.equal(archive.readUInt32LE(position), 0x02014b50);
+    const method = archive.readUInt16LE(position + 10);
+    const crc = archive.readUInt32LE(position + 16);
+    const compressedSize = archive.readUInt32LE(position + 20);
+    const nameLength = archive.readUInt16LE(position + 28);
+    const extraLength = archive.readUInt16LE(position + 30);
+    const commentLength = archive.readUInt16LE(position + 32);
+    const offset = archive.readUInt32LE(position + 42);
+    const name = archive.toString('utf8', position + 46, position + 46 + nameLength);
+
+    assert.equal(archive.readUInt32LE(offset), 0x04034b50);
+    const dataStart = offset + 30 + archive.readUInt16LE(offset + 26) + archive.readUInt16LE(offset + 28);
+    const stored = archive.subarray(dataStart, dataStart + compressedSize);
+    const data = method === 8 ? zlib.inflateRawSync(stored) : stored;
+    assert.equal(crc32(data), crc, name);
+
+    entries[name] = data;
+    position += 46 + nameLength + extraLength + commentLength;
+  }
+  return entries;
+}
+
+const report = {
+  type: 'url',
+  correlationId: 'req_1',
+  scanTime: 3456,
+  options: { screenshot: true },
+  result: {
+    url: 'https://example.com/',
+    timestamp: '2024-01-15T10:00:00.000Z',
+    summary: { violations: 1 },
+    violations: [{ id: 'image-alt', nodes: [{ target: ['img'] }] }],
+    metadata: { retries: 0 }
+  }
+};
+
+test('bundles the results, metadata and artifacts', async () => {
+  const screenshot = Buffer.from([0x89, 0x50, 0x4e, 0x47, 0x00, 0xff]);
+  const { archive, chunks } = await collect(createBundleStream('scan_1', {
+    ...report,
+    artifacts: { screenshot, html: '<html><body>Rendered</body></html>' }
+  }));
+
+  const entries = readZip(archive);
+  assert.deepEqual(Object.keys(entries), ['results.json', 'metadata.json', 'screenshot.png', 'rendered.html']);
+  assert.deepEqual(JSON.parse(entries['results.json']), report.result);
+  assert.deepEqual(JSON.parse(entries['metadata.json']), {
+    scanId: 'scan_1',
+    correlationId: 'req_1',
+    type: 'url',
+    url: 'https://example.com/',
+    timestamp: '2024-01-15T10:00:00.000Z',
+    scanTime: 3456,
+    options: { screenshot: true },
+    summary: { violations: 1 },
+    metadata: { retries: 0 }
+  });
+  assert.deepEqual(entries['screenshot.png'], screenshot);
+  assert.equal(entries['rendered.html'].toString(), '<html><body>Rendered</body></html>');
+  // Streamed entry by entry rather than as one buffer
+  assert.ok(chunks > 4);
+});
+
+test('leaves out artifacts that were not captured', async () => {
+  const { archive } = await collect(createBundleStream('scan_2', report));
+
+  assert.deepEqual(Object.keys(readZip(archive)), ['results.json', 'metadata.json']);
+});
+
+test('redacts options that can hold secrets from the metadata', async () => {
+  const { archive } = await collect(createBundleStream('scan_3', {
+    ...report,
+    options: {
+      screenshot: true,
+      localStorage: { token: 'secret' },
+      sessionStorage: { session: 'secret' },
+      method: 'POST',
+      body: 'password=secret',
+      hostOverrides: { 'staging.example.com': '203.0.113.10' }
+    }
+  }));
+
+  assert.deepEqual(JSON.parse(readZip(archive)['metadata.json']).options, {
+    screenshot: true,
+    localStorage: '[redacted]',
+    sessionStorage: '[redacted]',
+    method: 'POST',
+    body: '[redacted]',
+    hostOverrides: '[redacted]'
+  });
+});
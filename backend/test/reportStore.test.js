@@ -0,0 +1,140 @@
+const { test } = require('node:test');
+const assert = require('node:assert/strict');
+const { ReportStore } = require('../src/services/reportStore');
+const { reportsPrunedCounter } = require('../src/services/metrics');
+
+function report(name, screenshot = true) {
+  return {
+    type: 'url',
+    result: { url: `https://example.com/${name}` },
+    artifacts: screenshot ? { screenshot: Buffer.from(name), html: `<p>${name}</p>` } : {}
+  };
+}
+
+const hasScreenshot = (store, scanId) => Boolean(store.get(scanId).artifacts.screenshot);
+
+test('drops the oldest screenshot once the cap is exceeded', () => {
+  const store = new ReportStore({ maxScreenshots: 2, maxEntries: 10, retention: 60000, pruneInterval: 0 });
+
+  store.save('scan_1', report('one'));
+  store.save('scan_2', report('two'));
+  store.save('scan_3', report('three'));
+
+  assert.equal(store.metrics.screenshotsEvicted, 1);
+  assert.equal(hasScreenshot(store, 'scan_1'), false);
+  assert.equal(hasScreenshot(store, 'scan_2'), true);
+  assert.equal(hasScreenshot(store, 'scan_3'), true);
+  // The rest of the report is kept
+  assert.equal(store.get('scan_1').artifacts.html, '<p>one</p>');
+  assert.equal(store.get('scan_1').result.url, 'https://example.com/one');
+});
+
+test('evicts the least recently used screenshot, not the oldest saved', () => {
+  const store = new ReportStore({ maxScreenshots: 2, maxEntries: 10, retention: 60000, pruneInterval: 0 });
+
+  store.save('scan_1', report('one'));
+  store.save('scan_2', report('two'));
+  store.get('scan_1');
+  store.save('scan_3', report('three'));
+
+  assert.equal(hasScreenshot(store, 'scan_1'), true);
+  assert.equal(hasScreenshot(store, 'scan_2'), false);
+});
+
+test('does not count reports without screenshots against the cap', () => {
+  const store = new ReportStore({ maxScreenshots: 1, maxEntries: 10, retention: 60000, pruneInterval: 0 });
+
+  store.save('scan_1', report('one'));
+  store.save('scan_2', report('two', false));
+  store.save('scan_3', report('three', false));
+
+  assert.equal(store.metrics.screenshotsEvicted, 0);
+  assert.equal(hasScreenshot(store, 'scan_1'), true);
+});
+
+test('does not alter the caller\'s artifacts when evicting', () => {
+  const store = new ReportStore({ maxScreenshots: 1, maxEntries: 10, retention: 60000, pruneInterval: 0 });
+  const first = report('one');
+
+  store.save('scan_1', first);
+  store.save('scan_2', report('two'));
+
+  assert.ok(first.artifacts.screenshot);
+});
+
+test('frees a screenshot slot when its report is evicted', () => {
+  const store = new ReportStore({ maxScreenshots: 2, maxEntries: 2, retention: 60000, pruneInterval: 0 });
+
+  store.save('scan_1', report('one'));
+  store.save('scan_2', report('two'));
+  store.save('scan_3', report('three'));
+
+  assert.equal(store.get('scan_1'), null);
+  assert.equal(store.screenshots.size, 2);
+  assert.equal(store.metrics.screenshotsEvicted, 0);
+});
+
+// Reports pruned under each reason since a snapshot
+async function prunedCounts() {
+  const { values } = await reportsPrunedCounter.get();
+  return Object.fromEntries(values.map(({ labels, value }) => [labels.reason, value]));
+}
+
+test('prunes only reports past the retention window', async () => {
+  const store = new ReportStore({ maxEntries: 10, retention: 1000, pruneInterval: 0 });
+  const before = await prunedCounts();
+
+  store.save('scan_1', report('one', false));
+  store.save('scan_2', report('two'));
+  store.save('scan_3', report('three'));
+  store.reports.get('scan_1').storedAt -= 2000;
+  store.reports.get('scan_2').storedAt -= 1500;
+
+  assert.equal(store.prune(), 2);
+  assert.deepEqual([...store.reports.keys()], ['scan_3']);
+  assert.equal(store.screenshots.has('scan_2'), false);
+  assert.equal(store.metrics.expired, 2);
+  assert.equal((await prunedCounts()).age - (before.age || 0), 2);
+  assert.equal(store.prune(), 0);
+});
+
+test('counts reports evicted over the entry cap', async () => {
+  const store = new ReportStore({ maxEntries: 2, retention: 60000, pruneInterval: 0 });
+  const before = await prunedCounts();
+
+  ['one', 'two', 'three', 'four'].forEach((name, i) => store.save(`scan_${i}`, report(name, false)));
+
+  assert.deepEqual([...store.reports.keys()], ['scan_2', 'scan_3']);
+  assert.equal(store.metrics.evicted, 2);
+  assert.equal((await prunedCounts()).count - (before.count || 0), 2);
+});
+
+test('the janitor prunes in the background until stopped', async t => {
+  const store = new ReportStore({ maxEntries: 10, retention: 30, pruneInterval: 10 });
+  t.after(() => store.stopJanitor());
+
+  store.save('scan_1', report('one'));
+  store.startJanitor();
+  store.startJanitor();
+  await new Promise(resolve => setTimeout(resolve, 60));
+
+  assert.equal(store.reports.size, 0);
+  store.stopJanitor();
+  assert.equal(store.timer, null);
+
+  const disabled = new ReportStore({ pruneInterval: 0 });
+  disabled.startJanitor();
+  assert.equal(disabled.timer, null);
+});
+
+test('reports belong to the client that saved them', () => {
+  const store = new ReportStore({ maxEntries: 10, retention: 60000, pruneInterval: 0 });
+
+  store.save('scan_1', { ...report('one'), owner: 'ip:10.0.0.1' });
+  store.save('scan_2', report('two'));
+
+  assert.equal(store.isOwner('scan_1', 'ip:10.0.0.1'), true);
+  assert.equal(store.isOwner('scan_1', 'ip:10.0.0.2'), false);
+  assert.equal(store.isOwner('scan_2', 'ip:10.0.0.2'), true);
+  assert.equal(store.isOwner('scan_missing', 'ip:10.0.0.1'), false);
+});
@@ -0,0 +1,184 @@
+const { test } = require('node:test');
+const assert = require('node:assert/strict');
+const { scanner, useFakeBrowser, FakeRequest } = require('./helpers/fakeBrowser');
+const { ScanRequestSchema } = require('../src/schemas/validation');
+
+function parseOptions(options) {
+  return ScanRequestSchema.safeParse({ type: 'url', input: 'https://example.com/search', options });
+}
+
+// Page behavior sending the given requests while the page loads; the
+// requests are returned for inspection
+function sendingRequests(...specs) {
+  const requests = [];
+  const behavior = {
+    delays: {
+      goto: async page => {
+        for (const spec of specs) {
+          const request = new FakeRequest(page, spec);
+          requests.push(request);
+          page.emit('request', request);
+        }
+      }
+    }
+  };
+  return { behavior, requests };
+}
+
+test('loads the page with a POST of the given body', async t => {
+  const { behavior, requests } = sendingRequests(
+    { url: 'https://example.com/search', headers: { accept: 'text/html' } },
+    { url: 'https://example.com/results', headers: { accept: 'text/html' } },
+    { url: 'https://example.com/app.js', resourceType: 'script' }
+  );
+  const browser = useFakeBrowser(t, behavior);
+
+  await scanner.scanURL('https://example.com/search', { method: 'POST', body: 'q=shoes&page=2' });
+
+  assert.deepEqual(browser.pages[0].called('setRequestInterception'), [[true]]);
+  const [navigation, redirect, script] = requests;
+  assert.deepEqual(navigation.resolution, {
+    action: 'continue',
+    overrides: {
+      method: 'POST',
+      postData: 'q=shoes&page=2',
+      headers: { accept: 'text/html', 'content-type': 'application/x-www-form-urlencoded' }
+    }
+  });
+  // The redirect after the POST is followed with a GET
+  assert.deepEqual(redirect.resolution, { action: 'continue', overrides: { headers: { accept: 'text/html' } } });
+  assert.deepEqual(script.resolution, { action: 'continue', overrides: undefined });
+});
+
+test('sends the given content type with the body', async t => {
+  const { behavior, requests } = sendingRequests({ url: 'https://example.com/search' });
+  useFakeBrowser(t, behavior);
+
+  await scanner.scanURL('https://example.com/search', {
+    method: 'POST',
+    body: '{"q":"shoes"}',
+    contentType: 'application/json'
+  });
+
+  assert.equal(requests[0].resolution.overrides.postData, '{"q":"shoes"}');
+  assert.equal(requests[0].resolution.overrides.headers['content-type'], 'application/json');
+});
+
+test('leaves requests alone for GET scans', async t => {
+  const browser = useFakeBrowser(t);
+
+  await scanner.scanURL('https://example.com/search', { method: 'GET' });
+
+  assert.equal(browser.pages[0].called('setRequestInterception').length, 0);
+});
+
+test('validates method and body', () => {
+  assert.equal(parseOptions({ method: 'POST', body: 'q=shoes' }).success, true);
+  assert.equal(parseOptions({ method: 'post', body: 'q=shoes' }).success, false);
+  assert.equal(parseOptions({ method: 'PUT' }).success, false);
+
+  const bodyWithoutPost = parseOptions({ body: 'q=shoes' });
+  assert.equal(bodyWithoutPost.success, false);
+  assert.deepEqual(bodyWithoutPost.error.issues.map(issue => [issue.path.join('.'), issue.message]), [
+    ['options.body', 'body requires method "POST"']
+  ]);
+});
+
+test('loads the page with the given referrer', async t => {
+  const browser = useFakeBrowser(t);
+
+  await scanner.scanURL('https://example.com/landing', { referrer: 'https://news.example.org/article' });
+  await scanner.scanURL('https://example.com/landing', {});
+
+  const [withReferrer, without] = browser.pages.map(page => page.called('goto')[0][1]);
+  assert.equal(withReferrer.referer, 'https://news.example.org/article');
+  assert.equal(without.referer, undefined);
+});
+
+test('accepts only http and https referrers', () => {
+  assert.equal(parseOptions({ referrer: 'https://news.example.org/article?utm_source=feed' }).success, true);
+  assert.equal(parseOptions({ referrer: 'http://example.org' }).success, true);
+
+  for (const referrer of ['news.example.org', 'javascript:alert(1)', 'ftp://example.org/', '']) {
+    assert.equal(parseOptions({ referrer }).success, false, referrer);
+  }
+});
+
+test('sends the given Accept header with the page request and its redirects', async t => {
+  const { behavior, requests } = sendingRequests(
+    { url: 'https://example.com/article', headers: { accept: 'text/html', 'user-agent': 'WCAGAI' } },
+    { url: 'https://example.com/amp/article', headers: { accept: 'text/html' } },
+    { url: 'https://example.com/style.css', resourceType: 'stylesheet', headers: { accept: 'text/css' } }
+  );
+  const browser = useFakeBrowser(t, behavior);
+
+  await scanner.scanURL('https://example.com/article', { acceptHeader: 'text/html;q=0.9, application/xhtml+xml' });
+
+  assert.deepEqual(browser.pages[0].called('setRequestInterception'), [[true]]);
+  const [navigation, redirect, stylesheet] = requests;
+  assert.deepEqual(navigation.resolution, {
+    action: 'continue',
+    overrides: { headers: { accept: 'text/html;q=0.9, application/xhtml+xml', 'user-agent': 'WCAGAI' } }
+  });
+  assert.equal(redirect.resolution.overrides.headers.accept, 'text/html;q=0.9, application/xhtml+xml');
+  assert.deepEqual(stylesheet.resolution, { action: 'continue', overrides: undefined });
+});
+
+test('accepts only media type lists as acceptHeader', () => {
+  for (const acceptHeader of ['text/html', 'application/xhtml+xml,text/html;q=0.9,*/*;q=0.8', 'text/html; charset="utf-8"']) {
+    assert.equal(parseOptions({ acceptHeader }).success, true, acceptHeader);
+  }
+
+  for (const acceptHeader of ['html', 'text/html,', 'text/html\r\nX-Injected: 1', 'text/html;q', '']) {
+    assert.equal(parseOptions({ acceptHeader }).success, false, acceptHeader);
+  }
+});
+
+test('aborts subresources of the blocked categories and counts them', async t => {
+  const { behavior, requests } = sendingRequests(
+    { url: 'https://example.com/' },
+    { url: 'https://example.com/hero.jpg', resourceType: 'image' },
+    { url: 'https://example.com/font.woff2', resourceType: 'font' },
+    { url: 'https://example.com/app.css', resourceType: 'stylesheet' },
+    { url: 'https://www.google-analytics.com/analytics.js', resourceType: 'script' },
+    { url: 'https://static.hotjar.com/c/hotjar.js', resourceType: 'script' },
+    { url: 'https://example.com/app.js', resourceType: 'script' },
+    { url: 'https://nothotjar.com/app.js', resourceType: 'script' }
+  );
+  useFakeBrowser(t, behavior);
+
+  const result = await scanner.scanURL('https://example.com/', { blockResources: ['image', 'font', 'analytics'] });
+
+  assert.deepEqual(requests.map(request => request.resolution.action), [
+    'continue', 'abort', 'abort', 'continue', 'abort', 'abort', 'continue', 'continue'
+  ]);
+  assert.equal(requests[1].resolution.reason, 'blockedbyclient');
+  assert.equal(result.metadata.blockedRequests, 4);
+});
+
+test('blocks resources of HTML scans too', async t => {
+  const requests = [];
+  const browser = useFakeBrowser(t, {
+    delays: {
+      setContent: async page => {
+        const request = new FakeRequest(page, { url: 'https://cdn.example.com/video.mp4', resourceType: 'media' });
+        requests.push(request);
+        page.emit('request', request);
+      }
+    }
+  });
+
+  const result = await scanner.scanHTML('<video src="https://cdn.example.com/video.mp4"></video>', { blockResources: ['media'] });
+  const unblocked = await scanner.scanHTML('<p>Hello</p>', {});
+
+  assert.equal(requests[0].resolution.action, 'abort');
+  assert.equal(result.metadata.blockedRequests, 1);
+  assert.equal(unblocked.metadata.blockedRequests, undefined);
+  assert.equal(browser.pages[1].called('setRequestInterception').length, 0);
+});
+
+test('accepts only known resource categories', () => {
+  assert.equal(parseOptions({ blockResources: ['image', 'analytics'] }).success, true);
+  assert.equal(parseOptions({ blockResources: [] }).success, false);
+  assert.equal(parseOptions({ blockResources: ['script'] }).success, false);
+});
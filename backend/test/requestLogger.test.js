@@ -0,0 +1,80 @@
+const { test } = require('node:test');
+const assert = require('node:assert/strict');
+const { EventEmitter } = require('events');
+const { requestLogger } = require('../src/middleware/requestLogger');
+const { correlationIdMiddleware } = require('../src/middleware/correlationId');
+const { auditLogger } = require('../src/services/auditLogger');
+
+// Logger recording each line's level, fields and message
+function recordingLogger() {
+  const lines = [];
+  const logger = {};
+  for (const level of ['info', 'error']) {
+    logger[level] = (fields, message) => lines.push({ level, fields, message });
+  }
+  return { logger, lines };
+}
+
+// Run a request through correlation IDs and request logging, then finish
+// it with status
+function handle(t, logger, { headers = {}, path = '/api/scan', status = 200 } = {}) {
+  const audited = [];
+  const logApiAccess = auditLogger.logApiAccess;
+  auditLogger.logApiAccess = async data => { audited.push(data); };
+  t.after(() => { auditLogger.logApiAccess = logApiAccess; });
+
+  const req = { headers, method: 'POST', url: path, path, ip: '127.0.0.1', route: { path }, baseUrl: '' };
+  const res = Object.assign(new EventEmitter(), { headers: {}, setHeader(name, value) { this.headers[name] = value; } });
+  correlationIdMiddleware(req, res, () => {});
+  requestLogger(logger)(req, res, () => {});
+  res.statusCode = status;
+  res.emit('finish');
+  return { req, res, audited };
+}
+
+test('logs one line per request with its request ID and route', t => {
+  const { logger, lines } = recordingLogger();
+
+  const { audited } = handle(t, logger, { headers: { 'x-request-id': 'build-42' } });
+
+  assert.equal(lines.length, 1);
+  assert.equal(lines[0].level, 'info');
+  assert.equal(lines[0].message, 'Request completed');
+  assert.deepEqual({ ...lines[0].fields, duration: 0 }, {
+    correlationId: 'build-42',
+    method: 'POST',
+    url: '/api/scan',
+    route: '/api/scan',
+    status: 200,
+    duration: 0
+  });
+  assert.equal(audited[0].correlationId, 'build-42');
+});
+
+test('logs server errors at error level', t => {
+  const { logger, lines } = recordingLogger();
+
+  handle(t, logger, { status: 503 });
+  handle(t, logger, { status: 404 });
+
+  assert.deepEqual(lines.map(line => [line.level, line.fields.status]), [['error', 503], ['info', 404]]);
+});
+
+test('echoes X-Request-ID, preferring X-Correlation-ID when both are sent', t => {
+  const { logger } = recordingLogger();
+
+  const both = handle(t, logger, { headers: { 'x-correlation-id': 'corr-1', 'x-request-id': 'req-1' } });
+  assert.equal(both.res.headers['X-Request-ID'], 'corr-1');
+  assert.equal(both.res.headers['X-Correlation-ID'], 'corr-1');
+
+  const longest = 'a'.repeat(128);
+  assert.equal(handle(t, logger, { headers: { 'x-request-id': longest } }).req.correlationId, longest);
+  assert.notEqual(handle(t, logger, { headers: { 'x-request-id': `${longest}a` } }).req.correlationId, `${longest}a`);
+});
+
+test('only audits API requests', t => {
+  const { logger } = recordingLogger();
+
+  assert.equal(handle(t, logger, { path: '/health' }).audited.length, 0);
+  assert.equal(handle(t, logger, { path: '/api/scans' }).audited.length, 1);
+});
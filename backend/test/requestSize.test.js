@@ -0,0 +1,120 @@
+const { test } = require('node:test');
+const assert = require('node:assert/strict');
+const http = require('http');
+const { once } = require('events');
+const { requestSizeLimit, parseSize } = require('../src/middleware/requestSize');
+const config = require('../src/config');
+
+// Serve the middleware with the response helpers express would add; the
+// handler buffers whatever body gets past it
+async function listen(t, limit) {
+  const middleware = requestSizeLimit(limit);
+  const server = http.createServer((req, res) => {
+    res.status = code => { res.statusCode = code; return res; };
+    res.json = body => { res.setHeader('Content-Type', 'application/json'); res.end(JSON.stringify(body)); };
+
+    middleware(req, res, () => {
+      const chunks = [];
+      req.on('data', chunk => chunks.push(chunk));
+      req.on('end', () => {
+        if (!res.headersSent) res.json({ received: Buffer.concat(chunks).length });
+      });
+    });
+  });
+  server.listen(0, '127.0.0.1');
+  await once(server, 'listening');
+  t.after(() => server.close());
+  return server.address().port;
+}
+
+function send(port, headers) {
+  const req = http.request({ port, host: '127.0.0.1', method: 'POST', path: '/', headers });
+  req.on('error', () => {});
+  const response = once(req, 'response').then(async ([res]) => {
+    let body = '';
+    for await (const chunk of res) body += chunk;
+    return { status: res.statusCode, headers: res.headers, body: JSON.parse(body) };
+  });
+  return { req, response };
+}
+
+test('parses sizes as the body parsers accept them', () => {
+  assert.equal(parseSize(2048), 2048);
+  assert.equal(parseSize('512'), 512);
+  assert.equal(parseSize('10kb'), 10 * 1024);
+  assert.equal(parseSize('10mb'), 10 * 1024 * 1024);
+  assert.equal(parseSize('1.5MB'), 1.5 * 1024 * 1024);
+  assert.throws(() => parseSize('lots'), /Invalid request size/);
+});
+
+test('rejects an oversized Content-Length before reading the body', async t => {
+  const port = await listen(t, '1kb');
+  const { req, response } = send(port, { 'Content-Type': 'application/json', 'Content-Length': 10 * 1024 * 1024 });
+
+  // Only the headers are sent; the answer must not wait for the body
+  req.flushHeaders();
+  const res = await response;
+  req.destroy();
+
+  assert.equal(res.status, 413);
+  assert.equal(res.headers.connection, 'close');
+  assert.equal(res.body.code, 'PAYLOAD_TOO_LARGE');
+  assert.equal(res.body.message, 'Request body exceeds the maximum size of 1kb');
+});
+
+test('rejects a streamed body as soon as it passes the limit', async t => {
+  const port = await listen(t, '1kb');
+  const { req, response } = send(port, { 'Content-Type': 'application/json', 'Transfer-Encoding': 'chunked' });
+
+  // Keep streaming until the server answers
+  let sent = 0;
+  let answered = false;
+  response.then(() => { answered = true; }, () => {});
+  while (!answered && sent < 1024 * 1024) {
+    req.write(Buffer.alloc(256, 'a'));
+    sent += 256;
+    await new Promise(resolve => setTimeout(resolve, 1));
+  }
+  const res = await response;
+  req.destroy();
+
+  assert.equal(res.status, 413);
+  assert.equal(res.body.code, 'PAYLOAD_TOO_LARGE');
+  assert.ok(sent < 1024 * 1024, `answered after ${sent} bytes`);
+});
+
+test('passes bodies within the limit through untouched', async t => {
+  const port = await listen(t, '1kb');
+  const body = JSON.stringify({ html: 'x'.repeat(900) });
+
+  const declared = send(port, { 'Content-Type': 'application/json', 'Content-Length': Buffer.byteLength(body) });
+  declared.req.end(body);
+  const streamed = send(port, { 'Content-Type': 'application/json', 'Transfer-Encoding': 'chunked' });
+  streamed.req.write(body.slice(0, 400));
+  streamed.req.end(body.slice(400));
+
+  for (const res of [await declared.response, await streamed.response]) {
+    assert.equal(res.status, 200);
+    assert.equal(res.body.received, Buffer.byteLength(body));
+  }
+});
+
+test('limits bodies to MAX_REQUEST_SIZE by default', async t => {
+  const previous = config.security.maxRequestSize;
+  config.security.maxRequestSize = '2kb';
+  t.after(() => { config.security.maxRequestSize = previous; });
+
+  const middleware = requestSizeLimit();
+  const res = {
+    headers: {},
+    setHeader(name, value) { this.headers[name] = value; },
+    status(code) { this.statusCode = code; return this; },
+    json(payload) { this.body = payload; return this; }
+  };
+  let passed = false;
+  middleware({ headers: { 'content-length': String(2 * 1024 + 1) }, on: () => {} }, res, () => { passed = true; });
+
+  assert.equal(passed, false);
+  assert.equal(res.statusCode, 413);
+  assert.equal(res.body.message, 'Request body exceeds the maximum size of 2kb');
+});
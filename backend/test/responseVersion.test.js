@@ -0,0 +1,70 @@
+const { test } = require('node:test');
+const assert = require('node:assert/strict');
+const { apiVersion, formatForVersion, negotiateVersion, LATEST_VERSION } = require('../src/services/responseVersion');
+
+const body = {
+  scanId: 'scan_1',
+  url: 'https://example.com/',
+  summary: { violations: 1 },
+  violations: [{ id: 'image-alt' }],
+  metadata: { retries: 0 },
+  standards: { wcag21: { violations: 1 } },
+  wcag22: { summary: { failed: 0 } },
+  comparison: { summary: { regressed: 0 } }
+};
+
+function negotiate(header) {
+  const req = { get: name => (name === 'accept-version' ? header : undefined) };
+  const headers = {};
+  const res = {
+    statusCode: 200,
+    setHeader: (name, value) => { headers[name] = value; },
+    status(code) { this.statusCode = code; return this; },
+    json(payload) { this.body = payload; return this; }
+  };
+  let passed = false;
+  apiVersion(req, res, () => { passed = true; });
+  return { req, res, headers, passed };
+}
+
+test('accepts version numbers with or without a v prefix', () => {
+  assert.equal(negotiateVersion('1'), 1);
+  assert.equal(negotiateVersion('v2'), 2);
+  assert.equal(negotiateVersion(' V1 '), 1);
+  assert.equal(negotiateVersion(undefined), LATEST_VERSION);
+  assert.equal(negotiateVersion(''), LATEST_VERSION);
+});
+
+test('emits the v1 shape without fields added since', () => {
+  assert.deepEqual(formatForVersion(body, 1), {
+    scanId: 'scan_1',
+    url: 'https://example.com/',
+    summary: { violations: 1 },
+    violations: [{ id: 'image-alt' }]
+  });
+  assert.ok('metadata' in body);
+});
+
+test('emits the v2 shape unchanged', () => {
+  assert.equal(formatForVersion(body, 2), body);
+});
+
+test('exposes and echoes the negotiated version', () => {
+  const { req, headers, passed } = negotiate('v1');
+
+  assert.equal(passed, true);
+  assert.equal(req.apiVersion, 1);
+  assert.equal(headers['API-Version'], '1');
+  assert.equal(negotiate(undefined).req.apiVersion, LATEST_VERSION);
+});
+
+test('rejects unknown versions with 406', () => {
+  for (const header of ['3', '0', 'v1.5', 'latest']) {
+    const { res, passed } = negotiate(header);
+
+    assert.equal(passed, false, header);
+    assert.equal(res.statusCode, 406);
+    assert.equal(res.body.code, 'UNSUPPORTED_VERSION');
+    assert.deepEqual(res.body.supportedVersions, [1, 2]);
+  }
+});
@@ -0,0 +1,293 @@
+const { test } = require('node:test');
+const assert = require('node:assert/strict');
+const { ResultCache } = require('../src/services/resultCache');
+const { useFakeRedis } = require('./helpers/fakeRedis');
+const { cacheCounter } = require('../src/services/metrics');
+
+const result = violations => ({ violations, metadata: {} });
+
+function memoryCache(options = {}) {
+  return new ResultCache({ ttl: 60000, staleWindow: 0, redisUrl: '', ...options });
+}
+
+const wait = ms => new Promise(resolve => setTimeout(resolve, ms));
+
+// Cache backed by a fake Redis, disconnected when the test ends
+async function redisCache(t, options = {}) {
+  const redis = await useFakeRedis(t);
+  const cache = new ResultCache({ ttl: 60000, staleWindow: 0, redisUrl: redis.url, redisPrefix: 'test:', ...options });
+  t.after(() => cache.redis.close());
+  return { cache, redis };
+}
+
+// Expiry set on a cached result, relative to now
+function ttlOf(cached) {
+  return Date.parse(cached.metadata.cacheExpiresAt) - Date.now();
+}
+
+test('keys ignore cache control, report, scheduling and unknown options', () => {
+  const cache = memoryCache();
+  const key = cache.key('url', 'https://example.com/', { viewport: { width: 800, height: 600 } });
+
+  assert.equal(
+    cache.key('url', 'https://example.com/', {
+      viewport: { width: 800, height: 600 },
+      noCache: false,
+      cacheTtl: 5000,
+      wcagLevel: 'A',
+      priority: 'high',
+      timeout: 10000,
+      someFutureOption: true
+    }),
+    key
+  );
+  assert.notEqual(cache.key('url', 'https://example.com/', { viewport: { width: 1280, height: 720 } }), key);
+  assert.notEqual(cache.key('url', 'https://example.com/', { viewport: { width: 800, height: 600 }, runOnly: ['image-alt'] }), key);
+});
+
+test('keys do not depend on option order', () => {
+  const cache = memoryCache();
+  assert.equal(
+    cache.key('url', 'https://example.com/', { timezone: 'UTC', xpath: true }),
+    cache.key('url', 'https://example.com/', { xpath: true, timezone: 'UTC' })
+  );
+});
+
+test('serves a stored result until its TTL passes', async () => {
+  const cache = memoryCache({ ttl: 50 });
+  const key = cache.key('url', 'https://example.com/', {});
+  const stored = cache.setResult(key, result([]));
+
+  assert.deepEqual(await cache.get(key), stored);
+  await new Promise(resolve => setTimeout(resolve, 60));
+  assert.equal(await cache.get(key), null);
+});
+
+test('cacheTtl overrides the default TTL', () => {
+  const cache = memoryCache({ minTtl: 1000, maxTtl: 3600000 });
+
+  const longer = cache.setResult('long', result([]), 600000);
+  const shorter = cache.setResult('short', result([]), 5000);
+  const standard = cache.setResult('default', result([]));
+
+  assert.ok(Math.abs(ttlOf(longer) - 600000) < 1000);
+  assert.ok(Math.abs(ttlOf(shorter) - 5000) < 1000);
+  assert.ok(Math.abs(ttlOf(standard) - 60000) < 1000);
+  assert.ok(cache.entries.get('long').expiresAt - Date.now() > 590000);
+});
+
+test('cacheTtl is clamped to the configured bounds', () => {
+  const cache = memoryCache({ minTtl: 1000, maxTtl: 3600000 });
+
+  assert.equal(cache.effectiveTtl(10), 1000);
+  assert.equal(cache.effectiveTtl(0), 1000);
+  assert.equal(cache.effectiveTtl(86400000), 3600000);
+  assert.equal(cache.effectiveTtl(120000), 120000);
+  assert.equal(cache.effectiveTtl(undefined), 60000);
+});
+
+test('a disabled cache stores and serves nothing', async () => {
+  const cache = memoryCache({ ttl: 0 });
+  const stored = cache.setResult('key', result([]));
+
+  assert.equal(stored.metadata.cacheExpiresAt, undefined);
+  assert.equal(await cache.get('key'), null);
+  assert.equal(cache.entries.size, 0);
+});
+
+test('a failed cache write is logged, not thrown', async () => {
+  const cache = memoryCache();
+  cache.set = async () => { throw new Error('write failed'); };
+
+  const stored = cache.setResult('key', result([]));
+  assert.ok(stored.metadata.cacheExpiresAt);
+  // The rejection is handled; an unhandled one would fail the test run
+  await new Promise(resolve => setImmediate(resolve));
+});
+
+test('failed scans expire sooner than successful ones', async () => {
+  const cache = memoryCache({ errorTtl: 50 });
+  const failure = Object.assign(new Error('net::ERR_CONNECTION_REFUSED'), { code: 'SCAN_FAILED', stack: 'at goto' });
+
+  await cache.setError('failed', failure);
+  cache.setResult('succeeded', result([]));
+
+  assert.deepEqual(await cache.get('failed'), {
+    error: { message: 'net::ERR_CONNECTION_REFUSED', code: 'SCAN_FAILED', scheme: undefined, realm: undefined, timeout: undefined }
+  });
+  await wait(60);
+  assert.equal(await cache.get('failed'), null);
+  assert.ok(await cache.get('succeeded'));
+});
+
+test('failed scans expire sooner than successful ones in Redis', async t => {
+  const { cache, redis } = await redisCache(t, { errorTtl: 50 });
+
+  await cache.setError('failed', Object.assign(new Error('net::ERR_NAME_NOT_RESOLVED'), { code: 'SCAN_FAILED' }));
+  await cache.set('succeeded', result([]));
+
+  const ttls = redis.commands.filter(([name]) => name === 'SET').map(([, key, , , ttl]) => [key, Number(ttl)]);
+  assert.deepEqual(ttls, [['test:failed', 50], ['test:succeeded', 60000]]);
+  assert.deepEqual(await cache.get('failed'), { error: { message: 'net::ERR_NAME_NOT_RESOLVED', code: 'SCAN_FAILED' } });
+
+  await wait(60);
+  assert.equal(await cache.get('failed'), null);
+  assert.deepEqual(await cache.get('succeeded'), result([]));
+});
+
+test('does not cache failures with no error TTL or that say nothing about the target', async () => {
+  const uncached = memoryCache({ errorTtl: 0 });
+  await uncached.setError('failed', new Error('Navigation timeout'));
+  assert.equal(await uncached.get('failed'), null);
+
+  const cache = memoryCache({ errorTtl: 60000 });
+  const canceled = Object.assign(new Error('The operation was aborted'), { name: 'AbortError' });
+  const outage = Object.assign(new Error('Browser pool exhausted'), { browserUnavailable: true });
+  const overloaded = Object.assign(new Error('Browser acquire timeout after 30000ms'), { code: 'OVERLOADED', queueTimeout: true });
+  await cache.setError('canceled', canceled);
+  await cache.setError('outage', outage);
+  await cache.setError('overloaded', overloaded);
+  await cache.setError('timeout', Object.assign(new Error('Scan timeout'), { code: 'SCAN_TIMEOUT', timeout: 1000 }));
+
+  assert.equal(await cache.get('canceled'), null);
+  assert.equal(await cache.get('outage'), null);
+  assert.equal(await cache.get('overloaded'), null);
+  assert.equal(await cache.get('timeout'), null);
+});
+
+// Cache lookups counted under each result since a snapshot
+async function lookupCounts() {
+  const { values } = await cacheCounter.get();
+  return Object.fromEntries(values.map(({ labels, value }) => [labels.result, value]));
+}
+
+function countsSince(before, after) {
+  return Object.fromEntries(
+    Object.entries(after)
+      .map(([result, value]) => [result, value - (before[result] || 0)])
+      .filter(([, value]) => value > 0)
+  );
+}
+
+test('shares results between instances through Redis', async t => {
+  const { cache, redis } = await redisCache(t);
+  const other = new ResultCache({ ttl: 60000, staleWindow: 0, redisUrl: redis.url, redisPrefix: 'test:' });
+  t.after(() => other.redis.close());
+  const key = cache.key('url', 'https://example.com/', {});
+
+  const stored = cache.setResult(key, result([{ id: 'image-alt' }]));
+  await wait(20);
+
+  assert.deepEqual(await other.get(key), stored);
+  assert.ok(redis.store.has(`test:${key}`));
+  const [, , , px, ttl] = redis.commands.find(([name]) => name === 'SET');
+  assert.equal(px, 'PX');
+  assert.equal(Number(ttl), 60000);
+
+  await other.delete(key);
+  assert.equal(await cache.get(key), null);
+});
+
+test('counts cache hits and misses', async t => {
+  const { cache } = await redisCache(t);
+  const before = await lookupCounts();
+
+  await cache.get('missing');
+  await cache.set('present', result([]));
+  await cache.get('present');
+  await cache.get('present');
+
+  assert.deepEqual(countsSince(before, await lookupCounts()), { miss: 1, hit: 2 });
+});
+
+test('treats an unreachable Redis as a miss', async t => {
+  const redis = await useFakeRedis(t);
+  const { url } = redis;
+  redis.close();
+  await wait(10);
+
+  const cache = new ResultCache({ ttl: 60000, staleWindow: 0, redisUrl: url });
+  t.after(() => cache.redis.close());
+  const before = await lookupCounts();
+
+  await cache.set('key', result([]));
+  assert.equal(await cache.get('key'), null);
+  assert.deepEqual(countsSince(before, await lookupCounts()), { error: 2 });
+});
+
+test('reports when a cached result expires on the result and its cached copy', async () => {
+  const cache = memoryCache({ ttl: 120000 });
+  const scanned = result([{ id: 'image-alt' }]);
+
+  const stored = cache.setResult('key', scanned);
+  const served = await cache.get('key');
+
+  assert.equal(scanned.metadata.cacheExpiresAt, undefined);
+  assert.ok(Math.abs(ttlOf(stored) - 120000) < 1000);
+  assert.equal(served.metadata.cacheExpiresAt, stored.metadata.cacheExpiresAt);
+  assert.match(stored.metadata.cacheExpiresAt, /^\d{4}-\d{2}-\d{2}T\d{2}:\d{2}:\d{2}\.\d{3}Z$/);
+});
+
+test('keeps results past their TTL for the stale window, marked stale', async () => {
+  const cache = memoryCache({ ttl: 30, staleWindow: 60 });
+  const stored = cache.setResult('key', result([]));
+  assert.equal(cache.isStale(stored), false);
+
+  await wait(40);
+  const before = await lookupCounts();
+  const stale = await cache.get('key');
+  assert.deepEqual(stale, stored);
+  assert.equal(cache.isStale(stale), true);
+  assert.deepEqual(countsSince(before, await lookupCounts()), { stale: 1 });
+
+  await wait(60);
+  assert.equal(await cache.get('key'), null);
+});
+
+test('never treats results as stale without a stale window', () => {
+  const expired = { violations: [], metadata: { cacheExpiresAt: new Date(Date.now() - 1000).toISOString() } };
+
+  assert.equal(memoryCache({ staleWindow: 60000 }).isStale(expired), true);
+  assert.equal(memoryCache().isStale(expired), false);
+  assert.equal(memoryCache({ staleWindow: 60000 }).isStale(result([])), false);
+});
+
+test('refreshes a stale entry once at a time', async () => {
+  const cache = memoryCache({ staleWindow: 60000 });
+  let finishScan;
+  let scans = 0;
+  const scan = () => {
+    scans++;
+    return new Promise(resolve => { finishScan = resolve; });
+  };
+
+  cache.revalidate('key', scan, 120000);
+  cache.revalidate('key', scan, 120000);
+  assert.equal(scans, 1);
+  assert.equal(cache.getStats().revalidating, 1);
+
+  finishScan(result([{ id: 'image-alt' }]));
+  await wait(0);
+
+  const refreshed = await cache.get('key');
+  assert.equal(refreshed.violations[0].id, 'image-alt');
+  assert.equal(cache.isStale(refreshed), false);
+  assert.ok(Math.abs(ttlOf(refreshed) - 120000) < 1000);
+  assert.equal(cache.revalidating.size, 0);
+});
+
+test('keeps the stale entry when a refresh fails or is degraded', async () => {
+  const cache = memoryCache({ staleWindow: 60000 });
+  const stale = { violations: [], metadata: { cacheExpiresAt: new Date(Date.now() - 1000).toISOString() } };
+  await cache.set('key', stale, 60000);
+
+  cache.revalidate('key', () => Promise.reject(new Error('Navigation timeout')));
+  await wait(0);
+  assert.deepEqual(await cache.get('key'), stale);
+  assert.equal(cache.revalidating.size, 0);
+
+  cache.revalidate('key', async () => ({ violations: [], metadata: { degraded: true } }));
+  await wait(0);
+  assert.deepEqual(await cache.get('key'), stale);
+  assert.equal(cache.revalidating.size, 0);
+});
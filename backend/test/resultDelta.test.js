@@ -0,0 +1,81 @@
+const { test } = require('node:test');
+const assert = require('node:assert/strict');
+const crypto = require('crypto');
+const { ResultDelta, jsonPatch } = require('../src/services/resultDelta');
+
+// Apply an add/remove/replace JSON Patch, as a client would
+function applyPatch(document, ops) {
+  const root = { '': structuredClone(document) };
+  for (const { op, path, value } of ops) {
+    const tokens = ['', ...path.split('/').slice(1).map(token => token.replace(/~1/g, '/').replace(/~0/g, '~'))];
+    const key = tokens.pop();
+    const parent = tokens.reduce((node, token) => node[token], root);
+    if (op === 'remove') {
+      Array.isArray(parent) ? parent.splice(Number(key), 1) : delete parent[key];
+    } else if (op === 'add' && Array.isArray(parent)) {
+      parent.splice(Number(key), 0, value);
+    } else {
+      parent[key] = value;
+    }
+  }
+  return root[''];
+}
+
+const previous = {
+  scanId: 'scan_1',
+  summary: { violations: 2, passes: 10, complianceScore: 83.33 },
+  violations: [{ id: 'image-alt', nodes: [{ target: ['img'] }] }, { id: 'region', nodes: [] }],
+  metadata: { 'a/b': 1, 'c~d': 2, cache: 'miss' }
+};
+
+const next = {
+  scanId: 'scan_2',
+  summary: { violations: 1, passes: 11, complianceScore: 91.67 },
+  violations: [{ id: 'image-alt', nodes: [{ target: ['img'] }, { target: ['.logo'] }] }],
+  metadata: { 'a/b': 3, cache: 'miss', duration: 120 }
+};
+
+test('patches turn the previous response into the new one', () => {
+  const ops = jsonPatch(previous, next);
+
+  assert.deepEqual(applyPatch(previous, ops), next);
+  assert.deepEqual(ops.filter(op => op.path.startsWith('/metadata')), [
+    { op: 'replace', path: '/metadata/a~1b', value: 3 },
+    { op: 'remove', path: '/metadata/c~0d' },
+    { op: 'add', path: '/metadata/duration', value: 120 }
+  ]);
+  assert.deepEqual(ops.filter(op => op.path.startsWith('/violations')), [
+    { op: 'add', path: '/violations/0/nodes/1', value: { target: ['.logo'] } },
+    { op: 'remove', path: '/violations/1' }
+  ]);
+  assert.deepEqual(jsonPatch(next, next), []);
+});
+
+test('removes trailing array items from the end', () => {
+  const ops = jsonPatch({ list: [1, 2, 3, 4] }, { list: [1] });
+
+  assert.deepEqual(ops.map(op => op.path), ['/list/3', '/list/2', '/list/1']);
+  assert.deepEqual(applyPatch({ list: [1, 2, 3, 4] }, ops), { list: [1] });
+});
+
+test('patches from a remembered response by its hash', () => {
+  const delta = new ResultDelta({ maxBaselines: 10 });
+
+  const hash = delta.remember(previous);
+
+  assert.equal(hash, crypto.createHash('sha256').update(JSON.stringify(previous)).digest('hex'));
+  assert.deepEqual(applyPatch(previous, delta.patchFrom(hash, next)), next);
+  assert.equal(delta.patchFrom('0'.repeat(64), next), null);
+});
+
+test('remembers only the newest baselines', () => {
+  const delta = new ResultDelta({ maxBaselines: 2 });
+  const hashes = [1, 2, 3].map(n => delta.remember({ scanId: `scan_${n}` }));
+
+  assert.equal(delta.patchFrom(hashes[0], next), null);
+  assert.notEqual(delta.patchFrom(hashes[2], next), null);
+  assert.deepEqual(delta.getStats(), { baselines: 2, maxBaselines: 2 });
+
+  const disabled = new ResultDelta({ maxBaselines: 0 });
+  assert.equal(disabled.patchFrom(disabled.remember(previous), next), null);
+});
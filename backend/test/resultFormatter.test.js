@@ -0,0 +1,434 @@
+const { test } = require('node:test');
+const assert = require('node:assert/strict');
+const {
+  WCAG22_NEW_CRITERIA,
+  compareWithBaseline,
+  filterByWcagLevel,
+  flattenViolationNodes,
+  groupTemplateViolations,
+  normalizeSelector,
+  segmentByStandard,
+  violationTickets,
+  violationsCsv,
+  violationsSarif,
+  wcag22NewCriteria
+} = require('../src/services/resultFormatter');
+
+const scan = {
+  url: 'https://example.com/',
+  timestamp: '2024-01-15T10:30:00.000Z',
+  summary: { violations: 2 },
+  testEngine: { name: 'axe-core', version: '4.8.2' },
+  violations: [{
+    id: 'image-alt',
+    impact: 'critical',
+    description: 'Ensures <img> elements have "alt" text, or a role of none',
+    help: 'Images must have alternate text',
+    helpUrl: 'https://dequeuniversity.com/rules/axe/4.8/image-alt',
+    tags: ['wcag2a'],
+    nodes: [
+      { html: '<img src="a.png">', target: ['#hero > img'] },
+      { html: '<img src="b.png">', target: ['.logo'], impact: 'minor' }
+    ]
+  }, {
+    id: 'color-contrast',
+    impact: 'serious',
+    description: 'Ensures the contrast between foreground and background colors meets WCAG 2 AA',
+    help: 'Elements must have sufficient color contrast',
+    helpUrl: 'https://dequeuniversity.com/rules/axe/4.8/color-contrast',
+    tags: ['wcag2aa'],
+    nodes: [
+      { html: '<p class="muted">', target: [['iframe#embed', '.muted']] }
+    ]
+  }]
+};
+
+test('flattening yields one record per affected element', () => {
+  const records = flattenViolationNodes(scan.violations);
+  const nodes = scan.violations.reduce((sum, violation) => sum + violation.nodes.length, 0);
+
+  assert.equal(records.length, nodes);
+  const { ruleId, impact, selector, html, helpUrl } = records[0];
+  assert.deepEqual({ ruleId, impact, selector, html, helpUrl }, {
+    ruleId: 'image-alt',
+    impact: 'critical',
+    selector: '#hero > img',
+    html: '<img src="a.png">',
+    helpUrl: 'https://dequeuniversity.com/rules/axe/4.8/image-alt'
+  });
+  // Node impact overrides the rule's; iframe targets join into one selector
+  assert.equal(records[1].impact, 'minor');
+  assert.equal(records[2].selector, 'iframe#embed .muted');
+});
+
+test('flattening a result without violations yields no records', () => {
+  assert.deepEqual(flattenViolationNodes([]), []);
+  assert.deepEqual(flattenViolationNodes(), []);
+});
+
+// Rules tagged as axe tags them: by the WCAG version that introduced their
+// success criterion
+const tagged = {
+  violations: [
+    { id: 'image-alt', tags: ['wcag2a', 'wcag111'], nodes: [{}, {}] },
+    { id: 'autocomplete-valid', tags: ['wcag21aa', 'wcag135'], nodes: [{}] },
+    { id: 'target-size', tags: ['wcag22aa', 'wcag258'], nodes: [{}, {}, {}] }
+  ],
+  passes: [
+    { id: 'document-title', tags: ['wcag2a', 'wcag242'] },
+    { id: 'avoid-inline-spacing', tags: ['wcag21aa', 'wcag1412'] },
+    { id: 'region', tags: ['best-practice'] }
+  ],
+  incomplete: [
+    { id: 'color-contrast', tags: ['wcag2aa', 'wcag143'] }
+  ]
+};
+
+test('segments results by the WCAG version of each rule', () => {
+  const segments = segmentByStandard(tagged);
+
+  assert.deepEqual(Object.keys(segments), ['wcag20', 'wcag21', 'wcag22']);
+  assert.deepEqual(segments.wcag20, {
+    violations: 1,
+    passes: 1,
+    incomplete: 1,
+    affectedNodes: 2,
+    complianceScore: 50,
+    violationIds: ['image-alt']
+  });
+  assert.deepEqual(segments.wcag21, {
+    violations: 2,
+    passes: 2,
+    incomplete: 1,
+    affectedNodes: 3,
+    complianceScore: 50,
+    violationIds: ['image-alt', 'autocomplete-valid']
+  });
+  assert.deepEqual(segments.wcag22.violationIds, ['image-alt', 'autocomplete-valid', 'target-size']);
+  assert.equal(segments.wcag22.affectedNodes, 6);
+  assert.equal(segments.wcag22.complianceScore, 40);
+});
+
+test('segments only the requested standards', () => {
+  const segments = segmentByStandard(tagged, ['wcag22']);
+
+  assert.deepEqual(Object.keys(segments), ['wcag22']);
+});
+
+test('scores a standard with no applicable rules as fully compliant', () => {
+  const segments = segmentByStandard({ violations: [], passes: [{ id: 'region', tags: ['best-practice'] }] }, ['wcag20']);
+
+  assert.equal(segments.wcag20.complianceScore, 100);
+  assert.equal(segments.wcag20.passes, 0);
+});
+
+test('reports the WCAG 2.2 criteria from rules tagged with them', () => {
+  const report = wcag22NewCriteria({
+    violations: [{ id: 'target-size', tags: ['wcag22aa', 'wcag258'] }],
+    incomplete: [{ id: 'focus-obscured', tags: ['wcag22aa', 'wcag2411'] }],
+    passes: [
+      { id: 'target-size-inline', tags: ['wcag22aa', 'wcag258'] },
+      { id: 'consistent-help', tags: ['wcag22a', 'wcag326'] }
+    ]
+  });
+
+  const byCriterion = Object.fromEntries(report.criteria.map(c => [c.criterion, c]));
+  assert.deepEqual(byCriterion['2.5.8'], {
+    criterion: '2.5.8',
+    name: 'Target Size (Minimum)',
+    level: 'AA',
+    status: 'failed',
+    violations: ['target-size'],
+    incomplete: [],
+    passes: ['target-size-inline']
+  });
+  assert.equal(byCriterion['2.4.11'].status, 'incomplete');
+  assert.equal(byCriterion['3.2.6'].status, 'passed');
+  assert.equal(byCriterion['3.3.8'].status, 'not_tested');
+  assert.deepEqual(report.summary, {
+    failed: 1,
+    incomplete: 1,
+    passed: 1,
+    notTested: WCAG22_NEW_CRITERIA.length - 3
+  });
+});
+
+test('reports every WCAG 2.2 criterion as not tested for results without 2.2 rules', () => {
+  const report = wcag22NewCriteria(scan);
+
+  assert.equal(report.criteria.length, WCAG22_NEW_CRITERIA.length);
+  assert.ok(report.criteria.every(c => c.status === 'not_tested'));
+});
+
+const rule = (id, selectors = []) => ({ id, nodes: selectors.map(selector => ({ target: [selector] })) });
+
+test('classifies each rule\'s status transition against a baseline', () => {
+  const baseline = {
+    violations: [rule('image-alt', ['img.a']), rule('label', ['#email'])],
+    incomplete: [rule('color-contrast')],
+    passes: [rule('document-title'), rule('html-has-lang'), rule('region')]
+  };
+  const candidate = {
+    violations: [rule('image-alt', ['img.a']), rule('document-title', ['title'])],
+    incomplete: [rule('html-has-lang')],
+    passes: [rule('label'), rule('color-contrast'), rule('region'), rule('list')]
+  };
+
+  const comparison = compareWithBaseline(baseline, candidate);
+
+  const byRule = Object.fromEntries(comparison.statusChanges.map(c => [c.ruleId, c]));
+  assert.deepEqual(byRule['document-title'], { ruleId: 'document-title', from: 'passed', to: 'failed', transition: 'regressed' });
+  assert.deepEqual(byRule.label, { ruleId: 'label', from: 'failed', to: 'passed', transition: 'fixed' });
+  assert.deepEqual(byRule['color-contrast'], { ruleId: 'color-contrast', from: 'incomplete', to: 'passed', transition: 'changed' });
+  assert.deepEqual(byRule['html-has-lang'], { ruleId: 'html-has-lang', from: 'passed', to: 'incomplete', transition: 'changed' });
+  assert.deepEqual(byRule.list, { ruleId: 'list', from: 'inapplicable', to: 'passed', transition: 'changed' });
+  assert.equal(byRule['image-alt'], undefined);
+  assert.equal(byRule.region, undefined);
+  assert.deepEqual(comparison.summary, {
+    regressed: 1,
+    fixed: 1,
+    changed: 3,
+    unchanged: 2,
+    nodesAdded: 0,
+    nodesRemoved: 0
+  });
+});
+
+test('treats rules that become inapplicable after failing as fixed', () => {
+  const comparison = compareWithBaseline({ violations: [rule('video-caption', ['video'])] }, { violations: [] });
+
+  assert.deepEqual(comparison.statusChanges, [
+    { ruleId: 'video-caption', from: 'failed', to: 'inapplicable', transition: 'fixed' }
+  ]);
+});
+
+test('lists nodes added and removed for rules failing in both scans', () => {
+  const comparison = compareWithBaseline(
+    { violations: [rule('image-alt', ['img.a', 'img.b'])] },
+    { violations: [rule('image-alt', ['img.b', 'img.c', 'img.d'])] }
+  );
+
+  assert.deepEqual(comparison.statusChanges, []);
+  assert.deepEqual(comparison.nodeChanges, [{ ruleId: 'image-alt', added: ['img.c', 'img.d'], removed: ['img.a'] }]);
+  assert.equal(comparison.summary.nodesAdded, 2);
+  assert.equal(comparison.summary.nodesRemoved, 1);
+});
+
+test('normalizes selectors from the last stable anchor without positional indices', () => {
+  assert.equal(normalizeSelector('body > div:nth-child(3) > #main > ul > li:nth-child(2) > a'), '#main > ul > li > a');
+  assert.equal(normalizeSelector('div:nth-of-type(2) > [data-testid="cart"] > button'), '[data-testid="cart"] > button');
+  assert.equal(normalizeSelector('.list > li:nth-child(4)'), '.list > li');
+  // A bare positional selector has nothing else identifying it
+  assert.equal(normalizeSelector(':nth-child(2)'), ':nth-child(2)');
+  assert.equal(normalizeSelector('#logo'), '#logo');
+});
+
+test('normalized selectors remove spurious diffs from shifted content', () => {
+  const baseline = { violations: [rule('image-alt', ['body > div:nth-child(2) > #hero > img', 'ul > li:nth-child(3) > img'])] };
+  const shifted = { violations: [rule('image-alt', ['body > div:nth-child(3) > #hero > img', 'ul > li:nth-child(4) > img'])] };
+
+  const raw = compareWithBaseline(baseline, shifted);
+  const normalized = compareWithBaseline(baseline, shifted, { normalizeSelectors: true });
+
+  assert.equal(raw.summary.nodesAdded, 2);
+  assert.equal(raw.summary.nodesRemoved, 2);
+  assert.deepEqual(normalized.nodeChanges, []);
+
+  const records = flattenViolationNodes(shifted.violations, { normalizeSelectors: true });
+  assert.deepEqual(records.map(record => record.selector), ['#hero > img', 'ul > li > img']);
+});
+
+test('produces one ticket per violation with a priority from its impact', () => {
+  const tickets = violationTickets(scan);
+
+  assert.equal(tickets.length, 2);
+  assert.deepEqual(tickets[0], {
+    title: '[Accessibility] Images must have alternate text (2 elements)',
+    description: [
+      'Ensures <img> elements have "alt" text, or a role of none',
+      '',
+      'Page: https://example.com/',
+      'Rule: image-alt (critical impact)',
+      'WCAG: wcag2a',
+      'How to fix: https://dequeuniversity.com/rules/axe/4.8/image-alt',
+      '',
+      'Affected elements (2):',
+      '* {{#hero > img}}',
+      '* {{.logo}}'
+    ].join('\n'),
+    priority: 'Highest',
+    labels: ['accessibility', 'axe-image-alt', 'wcag2a'],
+    ruleId: 'image-alt',
+    impact: 'critical',
+    helpUrl: 'https://dequeuniversity.com/rules/axe/4.8/image-alt',
+    selectors: ['#hero > img', '.logo']
+  });
+  assert.equal(tickets[1].title, '[Accessibility] Elements must have sufficient color contrast (1 element)');
+  assert.equal(tickets[1].priority, 'High');
+  assert.deepEqual(tickets[1].selectors, ['iframe#embed .muted']);
+});
+
+test('truncates long element lists in ticket descriptions', () => {
+  const nodes = Array.from({ length: 30 }, (_, i) => ({ target: [`li:nth-child(${i + 1})`] }));
+  const [ticket] = violationTickets({ url: 'https://example.com/', violations: [{ id: 'list', help: 'Lists', helpUrl: 'https://example.com/help', nodes }] });
+
+  const lines = ticket.description.split('\n');
+  assert.equal(lines.filter(line => line.startsWith('* {{')).length, 25);
+  assert.equal(lines[lines.length - 1], '* ...and 5 more');
+  assert.equal(ticket.selectors.length, 30);
+  assert.equal(ticket.priority, 'Medium');
+  assert.ok(!ticket.description.includes('WCAG:'));
+});
+
+// A page of a batch whose violations are image-alt on the given selectors
+function page(url, selectors, extra = []) {
+  return { url, violations: [{ ...rule('image-alt', selectors), impact: 'critical', help: 'Images must have alternate text' }, ...extra] };
+}
+
+test('groups violations repeated across pages by rule and normalized selector', () => {
+  const groups = groupTemplateViolations([
+    page('https://example.com/a', ['#header > a > img', 'main > p:nth-child(2) > img'], [rule('label', ['#search'])]),
+    page('https://example.com/b', ['#header > a > img', 'main > p:nth-child(5) > img'], [rule('label', ['#search'])]),
+    page('https://example.com/c', ['#header > a > img', '#promo > img'])
+  ]);
+
+  assert.deepEqual(groups.map(group => [group.ruleId, group.selector, group.pageCount]), [
+    ['image-alt', '#header > a > img', 3],
+    ['image-alt', 'main > p > img', 2],
+    ['label', '#search', 2]
+  ]);
+  assert.deepEqual(groups[0].pages, ['https://example.com/a', 'https://example.com/b', 'https://example.com/c']);
+  assert.equal(groups[0].impact, 'critical');
+  assert.equal(groups[0].help, 'Images must have alternate text');
+});
+
+test('leaves issues found on a single page out of template groups', () => {
+  const groups = groupTemplateViolations([
+    page('https://example.com/a', ['#promo > img', '#promo > img']),
+    page('https://example.com/b', ['#hero > img'])
+  ]);
+
+  assert.deepEqual(groups, []);
+  assert.deepEqual(groupTemplateViolations(), []);
+});
+
+test('CSV has a header and one row per affected element', () => {
+  const lines = violationsCsv(scan).split('\r\n');
+
+  assert.equal(lines[0], 'ruleId,impact,description,helpUrl,targetSelector');
+  assert.equal(lines.length, 5); // three rows and the trailing line break
+  assert.equal(lines[4], '');
+  assert.ok(lines[1].startsWith('image-alt,critical,'));
+  assert.ok(lines[1].endsWith(',#hero > img'));
+  assert.ok(lines[2].endsWith(',.logo'));
+});
+
+test('CSV locates elements inside iframes by their selector path', () => {
+  const row = violationsCsv(scan).split('\r\n')[3];
+  assert.equal(row, `color-contrast,serious,Ensures the contrast between foreground and background colors meets WCAG 2 AA,https://dequeuniversity.com/rules/axe/4.8/color-contrast,iframe#embed .muted`);
+});
+
+test('CSV quotes fields with commas and doubles their quotes', () => {
+  const row = violationsCsv(scan).split('\r\n')[1];
+  assert.ok(row.includes('"Ensures <img> elements have ""alt"" text, or a role of none"'));
+  assert.equal(violationsCsv({ violations: [{ id: 'x', description: 'a\nb', nodes: [{ target: ['p'] }] }] }).split('\r\n')[1], 'x,,"a\nb",,p');
+});
+
+test('CSV prefixes fields spreadsheets would read as formulas', () => {
+  const row = violationsCsv({
+    violations: [{
+      id: 'x',
+      impact: '-1',
+      description: '=HYPERLINK("https://evil.example","click")',
+      helpUrl: '@SUM(A1)',
+      nodes: [{ target: ['+p'] }]
+    }]
+  }).split('\r\n')[1];
+
+  assert.equal(row, `x,'-1,"'=HYPERLINK(""https://evil.example"",""click"")",'@SUM(A1),'+p`);
+});
+
+test('CSV of a scan without violations is just the header', () => {
+  assert.equal(violationsCsv({ violations: [] }), 'ruleId,impact,description,helpUrl,targetSelector\r\n');
+});
+
+test('SARIF lists each rule once and each element as a result', () => {
+  const log = violationsSarif(scan, { scanId: 'scan_1', correlationId: 'abc' });
+  const [run] = log.runs;
+
+  assert.equal(log.version, '2.1.0');
+  assert.equal(run.tool.driver.name, 'axe-core');
+  assert.equal(run.tool.driver.version, '4.8.2');
+  assert.deepEqual(run.tool.driver.rules.map(rule => rule.id), ['image-alt', 'color-contrast']);
+  assert.deepEqual(run.results.map(result => [result.ruleId, result.ruleIndex]), [
+    ['image-alt', 0],
+    ['image-alt', 0],
+    ['color-contrast', 1]
+  ]);
+  assert.deepEqual(run.properties, { scanId: 'scan_1', correlationId: 'abc', url: scan.url, summary: scan.summary });
+  assert.equal(run.invocations[0].endTimeUtc, scan.timestamp);
+});
+
+test('SARIF levels follow node impact, falling back to the rule', () => {
+  const [first, second, third] = violationsSarif(scan).runs[0].results;
+
+  assert.equal(first.level, 'error');
+  assert.equal(second.level, 'note');
+  assert.equal(third.level, 'error');
+  assert.equal(violationsSarif(scan).runs[0].tool.driver.rules[1].defaultConfiguration.level, 'error');
+});
+
+test('SARIF locates elements by page URL and selector, including inside iframes', () => {
+  const [first, , framed] = violationsSarif(scan).runs[0].results;
+
+  assert.equal(first.locations[0].physicalLocation.artifactLocation.uri, 'https://example.com/');
+  assert.equal(first.locations[0].physicalLocation.region.snippet.text, '<img src="a.png">');
+  assert.equal(first.partialFingerprints['axeSelector/v1'], 'image-alt:#hero > img');
+  assert.equal(framed.locations[0].logicalLocations[0].fullyQualifiedName, 'iframe#embed .muted');
+  assert.equal(framed.message.text, 'Elements must have sufficient color contrast: iframe#embed .muted');
+});
+
+test('SARIF locates elements of HTML scans at a fixed URN', () => {
+  const [first] = violationsSarif({ ...scan, url: '[HTML Content]' }).runs[0].results;
+
+  assert.equal(first.locations[0].physicalLocation.artifactLocation.uri, 'urn:wcagaii:html-content');
+  assert.equal(first.locations[0].logicalLocations[0].fullyQualifiedName, '#hero > img');
+});
+
+test('SARIF of a scan without violations has no rules or results', () => {
+  const [run] = violationsSarif({ url: 'https://example.com/', violations: [] }).runs;
+
+  assert.deepEqual(run.tool.driver.rules, []);
+  assert.deepEqual(run.results, []);
+  assert.equal(run.tool.driver.name, 'axe-core');
+});
+
+test('filters rules by WCAG conformance level and recounts the summary', () => {
+  const leveled = {
+    ...scan,
+    violations: [
+      ...scan.violations,
+      { id: 'color-contrast-enhanced', impact: 'serious', tags: ['wcag2aaa'], nodes: [{ target: ['p'] }] },
+      { id: 'target-size', impact: 'serious', tags: ['wcag22aa'], nodes: [{ target: ['button'] }] },
+      { id: 'custom/new-tab-links', impact: 'moderate', tags: ['custom'], nodes: [{ target: ['a'] }] }
+    ],
+    passes: [{ id: 'document-title', tags: ['wcag2a'] }, { id: 'identical-links-same-purpose', tags: ['wcag2aaa'] }],
+    incomplete: []
+  };
+
+  const levelA = filterByWcagLevel(leveled, 'A');
+  assert.deepEqual(levelA.violations.map(rule => rule.id), ['image-alt', 'custom/new-tab-links']);
+  assert.deepEqual(levelA.passes.map(rule => rule.id), ['document-title']);
+  assert.equal(levelA.summary.wcagLevel, 'A');
+  assert.equal(levelA.summary.violations, 2);
+  assert.equal(levelA.summary.complianceScore, 33.33);
+  assert.deepEqual(levelA.summary.violationsBySeverity, { critical: 1, serious: 0, moderate: 1, minor: 0 });
+
+  assert.deepEqual(
+    filterByWcagLevel(leveled, 'AA').violations.map(rule => rule.id),
+    ['image-alt', 'color-contrast', 'target-size', 'custom/new-tab-links']
+  );
+  assert.equal(filterByWcagLevel(leveled, 'AAA').violations.length, 5);
+  // The unfiltered result is left alone
+  assert.equal(leveled.violations.length, 5);
+});
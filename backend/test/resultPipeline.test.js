@@ -0,0 +1,71 @@
+const { test } = require('node:test');
+const assert = require('node:assert/strict');
+const { applyPipeline, stageError } = require('../src/services/resultPipeline');
+const { ScanRequestSchema } = require('../src/schemas/validation');
+
+const node = (selector, html) => ({ target: [selector], html, failureSummary: 'Fix this' });
+
+const result = {
+  url: 'https://example.com/',
+  summary: { violations: 3, passes: 2, incomplete: 1, complianceScore: 40 },
+  violations: [
+    { id: 'region', impact: 'moderate', nodes: [node('main', '<main>')] },
+    { id: 'image-alt', impact: 'critical', nodes: [node('img', '<img src="a.png">'), node('img', '<img src="a.png">')] },
+    { id: 'color-contrast', impact: 'serious', nodes: [node('.a', '<p class="a">'), node('.b', '<p class="b">'), node('.c', '<p class="c">')] }
+  ],
+  passes: [{ id: 'document-title', nodes: [] }, { id: 'html-has-lang', nodes: [] }],
+  incomplete: [{ id: 'aria-valid-attr-value', impact: 'minor', nodes: [] }],
+  metadata: { cache: 'miss' }
+};
+
+test('applies a multi-stage pipeline in order', () => {
+  const transformed = applyPipeline(result, [
+    { transform: 'filter-by-impact', minImpact: 'serious' },
+    'dedup',
+    { transform: 'sort', by: 'nodes' },
+    { transform: 'redact', fields: ['html'] },
+    'score'
+  ]);
+
+  assert.deepEqual(transformed.violations.map(v => [v.id, v.nodes.length]), [['color-contrast', 3], ['image-alt', 1]]);
+  assert.deepEqual(transformed.incomplete, []);
+  assert.ok(transformed.violations.flatMap(v => v.nodes).every(n => n.html === '[redacted]' && n.failureSummary === 'Fix this'));
+  assert.equal(transformed.summary.violations, 2);
+  // 2 passes against a critical (10) and a serious (5) violation
+  assert.equal(transformed.summary.weightedScore, parseFloat((2 / 17 * 100).toFixed(2)));
+  assert.deepEqual(transformed.metadata, {
+    cache: 'miss',
+    pipeline: ['filter-by-impact', 'dedup', 'sort', 'redact', 'score']
+  });
+});
+
+test('each stage sees the output of the one before it', () => {
+  // Scoring before filtering still counts the filtered-out violation
+  const scoreFirst = applyPipeline(result, ['score', { transform: 'filter-by-impact', minImpact: 'critical' }]);
+  const filterFirst = applyPipeline(result, [{ transform: 'filter-by-impact', minImpact: 'critical' }, 'score']);
+  assert.equal(scoreFirst.summary.weightedScore, parseFloat((2 / 19 * 100).toFixed(2)));
+  assert.equal(filterFirst.summary.weightedScore, parseFloat((2 / 12 * 100).toFixed(2)));
+});
+
+test('sorts by impact by default and scores with overridden weights', () => {
+  const transformed = applyPipeline(result, ['sort', { transform: 'score', weights: { critical: 0, serious: 0, moderate: 0 } }]);
+
+  assert.deepEqual(transformed.violations.map(v => v.id), ['image-alt', 'color-contrast', 'region']);
+  assert.equal(transformed.summary.weightedScore, 100);
+  // The input result is left untouched
+  assert.deepEqual(result.violations.map(v => v.id), ['region', 'image-alt', 'color-contrast']);
+  assert.equal(result.violations[1].nodes.length, 2);
+});
+
+test('reports invalid stages', () => {
+  assert.equal(stageError('dedup'), null);
+  assert.equal(stageError({ transform: 'sort', by: 'id' }), null);
+  assert.equal(stageError('shuffle'), 'Unknown transform: shuffle. Must be one of filter-by-impact, dedup, sort, redact, score');
+  assert.equal(stageError({ transform: 'filter-by-impact', minImpact: 'severe' }), 'filter-by-impact: minImpact must be one of minor, moderate, serious, critical');
+  assert.equal(stageError({ transform: 'redact', fields: ['target'] }), 'redact: fields must be a non-empty list of html, failureSummary, xpath');
+  assert.equal(stageError({ transform: 'score', weights: { critical: -1 } }), 'score: weights must map minor, moderate, serious, critical to non-negative numbers');
+
+  const parsed = ScanRequestSchema.safeParse({ type: 'url', input: 'https://example.com/', options: { pipeline: ['dedup', 'shuffle'] } });
+  assert.equal(parsed.success, false);
+  assert.match(parsed.error.issues[0].message, /Unknown transform: shuffle/);
+});
@@ -0,0 +1,73 @@
+const { test } = require('node:test');
+const assert = require('node:assert/strict');
+const { scanner, useFakeBrowser } = require('./helpers/fakeBrowser');
+const config = require('../src/config');
+
+function configureBackoff(t, retryBackoff) {
+  const previous = config.retryBackoff;
+  config.retryBackoff = retryBackoff;
+  t.after(() => { config.retryBackoff = previous; });
+}
+
+// Page loads that fail the first `failures` times, recording when each began
+function flakyLoads(failures) {
+  const starts = [];
+  return {
+    starts,
+    gaps: () => starts.slice(1).map((start, i) => start - starts[i]),
+    goto: async () => {
+      starts.push(Date.now());
+      if (starts.length <= failures) {
+        throw new Error('net::ERR_CONNECTION_RESET');
+      }
+    }
+  };
+}
+
+test('doubles the delay between attempts, with jitter', async t => {
+  configureBackoff(t, { baseDelay: 40, maxDelay: 1000 });
+  const loads = flakyLoads(2);
+  useFakeBrowser(t, { delays: { goto: loads.goto } });
+
+  const result = await scanner.scanURL('https://example.com/', {});
+
+  assert.equal(result.metadata.retries, 2);
+  const [first, second] = loads.gaps();
+  // Half of each delay is fixed and up to half random: 20-40ms, then 40-80ms
+  assert.ok(first >= 19 && first < 40 + 25, `first delay ${first}ms`);
+  assert.ok(second >= 39 && second < 80 + 25, `second delay ${second}ms`);
+});
+
+test('caps the delay at the maximum', async t => {
+  configureBackoff(t, { baseDelay: 40, maxDelay: 40 });
+  const loads = flakyLoads(2);
+  useFakeBrowser(t, { delays: { goto: loads.goto } });
+
+  await scanner.scanURL('https://example.com/', {});
+
+  assert.ok(loads.gaps()[1] < 40 + 25, `second delay ${loads.gaps()[1]}ms`);
+});
+
+test('stops waiting to retry as soon as the scan is canceled', async t => {
+  configureBackoff(t, { baseDelay: 10000, maxDelay: 10000 });
+  const controller = new AbortController();
+  const loads = flakyLoads(Infinity);
+  const browser = useFakeBrowser(t, {
+    delays: {
+      goto: async page => {
+        setTimeout(() => controller.abort(), 10);
+        await loads.goto(page);
+      }
+    }
+  });
+
+  const started = Date.now();
+  await assert.rejects(
+    scanner.scanURL('https://example.com/', {}, { signal: controller.signal }),
+    { name: 'AbortError' }
+  );
+
+  assert.ok(Date.now() - started < 1000);
+  assert.equal(loads.starts.length, 1);
+  assert.equal(browser.released, browser.acquired);
+});
@@ -0,0 +1,80 @@
+const { test } = require('node:test');
+const assert = require('node:assert/strict');
+const { scanner, useFakeBrowser } = require('./helpers/fakeBrowser');
+const config = require('../src/config');
+
+function canceledSignal() {
+  const controller = new AbortController();
+  controller.abort();
+  return controller.signal;
+}
+
+test('a scan canceled before it starts never acquires a browser', async t => {
+  const browser = useFakeBrowser(t);
+
+  await assert.rejects(
+    scanner.scanURL('https://example.com/', {}, { signal: canceledSignal() }),
+    { name: 'AbortError' }
+  );
+  await assert.rejects(
+    scanner.scanHTML('<p>Hello</p>', {}, { signal: canceledSignal() }),
+    { name: 'AbortError' }
+  );
+
+  assert.equal(browser.acquired, 0);
+  assert.equal(browser.pages.length, 0);
+  assert.equal(scanner.activeScanCount(), 0);
+});
+
+test('a scan canceled mid-flight releases its browser without retrying', async t => {
+  const controller = new AbortController();
+  const browser = useFakeBrowser(t, {
+    delays: { goto: () => { controller.abort(); return new Promise(resolve => setTimeout(resolve, 20)); } }
+  });
+
+  await assert.rejects(
+    scanner.scanURL('https://example.com/', {}, { signal: controller.signal }),
+    { name: 'AbortError' }
+  );
+
+  assert.equal(browser.acquired, 1);
+  assert.equal(browser.released, 1);
+  assert.equal(browser.pages[0].closed, true);
+});
+
+test('fails a scan past options.timeout with SCAN_TIMEOUT, without retrying', async t => {
+  const browser = useFakeBrowser(t, { delays: { goto: 500 } });
+
+  const started = Date.now();
+  await assert.rejects(
+    scanner.scanURL('https://example.com/', { timeout: 30 }),
+    { code: 'SCAN_TIMEOUT', message: 'Scan timeout', timeout: 30 }
+  );
+
+  assert.ok(Date.now() - started < 400);
+  assert.equal(browser.acquired, 1);
+  assert.equal(browser.released, 1);
+  assert.equal(browser.pages[0].closed, true);
+  assert.equal(browser.pages[0].called('goto')[0][1].timeout, 30);
+});
+
+test('clamps options.timeout to MAX_SCAN_TIMEOUT', async t => {
+  const previous = config.maxScanTimeout;
+  config.maxScanTimeout = 40;
+  t.after(() => { config.maxScanTimeout = previous; });
+  const browser = useFakeBrowser(t, { delays: { setContent: 500 } });
+
+  await assert.rejects(scanner.scanHTML('<p>Hello</p>', { timeout: 60000 }), { code: 'SCAN_TIMEOUT', timeout: 40 });
+
+  assert.equal(browser.pages[0].called('setContent')[0][1].timeout, 40);
+});
+
+test('reports a caller giving up before the deadline as a cancellation', async t => {
+  const controller = new AbortController();
+  useFakeBrowser(t, { delays: { goto: () => { controller.abort(); return new Promise(resolve => setTimeout(resolve, 20)); } } });
+
+  await assert.rejects(
+    scanner.scanURL('https://example.com/', { timeout: 10000 }, { signal: controller.signal }),
+    { name: 'AbortError' }
+  );
+});
@@ -0,0 +1,121 @@
+const { test } = require('node:test');
+const assert = require('node:assert/strict');
+const { ScanHistory } = require('../src/services/scanHistory');
+
+async function historyWith(count, options = {}) {
+  const history = new ScanHistory({ enabled: true, redisUrl: '', maxEntries: 1000, ...options });
+  for (let i = 0; i < count; i++) {
+    await history.record(`scan_${i}`, { type: 'url', input: `https://example.com/${i}`, response: { summary: {} } });
+  }
+  return history;
+}
+
+async function listAll(history, limit) {
+  const ids = [];
+  let cursor = null;
+  do {
+    const page = await history.list({ cursor, limit });
+    ids.push(...page.scans.map(scan => scan.scanId));
+    cursor = page.nextCursor;
+  } while (cursor);
+  return ids;
+}
+
+test('pages through every scan, newest first, without overlap', async () => {
+  const history = await historyWith(250);
+  const ids = await listAll(history, 20);
+
+  assert.equal(ids.length, 250);
+  assert.equal(new Set(ids).size, 250);
+  assert.equal(ids[0], 'scan_249');
+  assert.equal(ids[249], 'scan_0');
+});
+
+test('scans recorded while paging do not shift later pages', async () => {
+  const history = await historyWith(30);
+
+  const first = await history.list({ limit: 10 });
+  await history.record('scan_new', { type: 'url', input: 'https://example.com/new', response: { summary: {} } });
+  const second = await history.list({ cursor: first.nextCursor, limit: 10 });
+
+  assert.equal(first.scans[9].scanId, 'scan_20');
+  assert.equal(second.scans[0].scanId, 'scan_19');
+  assert.equal(second.total, 31);
+});
+
+test('the last page has no next cursor', async () => {
+  const history = await historyWith(5);
+
+  assert.equal((await history.list({ limit: 5 })).nextCursor, null);
+  assert.equal((await history.list({ limit: 10 })).nextCursor, null);
+});
+
+test('rejects cursors it did not issue', async () => {
+  const history = await historyWith(3);
+
+  assert.equal(history.parseCursor('not-a-cursor'), null);
+  assert.equal(history.parseCursor(''), null);
+  const { nextCursor } = await history.list({ limit: 1 });
+  assert.equal(history.parseCursor(nextCursor), 3);
+});
+
+test('returns recorded responses and lists HTML scans without their input', async () => {
+  const history = await historyWith(0);
+  const response = { scanId: 'scan_html', timestamp: '2024-01-15T10:30:00.000Z', summary: { violations: 2 }, violations: [] };
+
+  await history.record('scan_html', { type: 'html', input: '<p>'.repeat(1000), response });
+
+  assert.deepEqual(await history.get('scan_html'), response);
+  assert.equal(await history.get('scan_missing'), null);
+  assert.deepEqual((await history.list()).scans, [{
+    scanId: 'scan_html',
+    timestamp: '2024-01-15T10:30:00.000Z',
+    type: 'html',
+    input: '[HTML]',
+    summary: { violations: 2 }
+  }]);
+});
+
+test('keeps only the newest maxEntries scans', async () => {
+  const history = await historyWith(5, { maxEntries: 3 });
+
+  assert.deepEqual(await listAll(history, 10), ['scan_4', 'scan_3', 'scan_2']);
+  assert.equal(await history.get('scan_0'), null);
+  assert.equal(history.getStats().size, 3);
+});
+
+test('records nothing when disabled', async () => {
+  const history = await historyWith(3, { enabled: false });
+
+  assert.equal((await history.list()).total, 0);
+  assert.equal(await history.get('scan_0'), null);
+});
+
+test('an unreachable Redis does not fail recording a scan', async t => {
+  const history = new ScanHistory({ enabled: true, redisUrl: 'redis://127.0.0.1:1' });
+  t.after(() => history.redis.close());
+
+  await history.record('scan_1', { type: 'url', input: 'https://example.com/', response: { summary: {} } });
+  assert.equal(history.getStats().store, 'redis');
+});
+
+test('lists and returns scans only to the client that recorded them', async () => {
+  const history = await historyWith(0);
+  await history.record('scan_a', { type: 'url', input: 'https://a.example/', owner: 'ip:10.0.0.1', response: { summary: {} } });
+  await history.record('scan_b', { type: 'url', input: 'https://b.example/', owner: 'ip:10.0.0.2', response: { summary: {} } });
+
+  const page = await history.list({ owner: 'ip:10.0.0.1' });
+  assert.deepEqual(page.scans.map(scan => scan.scanId), ['scan_a']);
+  assert.equal(page.total, 1);
+  assert.deepEqual(await history.get('scan_a', 'ip:10.0.0.1'), { summary: {} });
+  assert.equal(await history.get('scan_b', 'ip:10.0.0.1'), null);
+  assert.equal(await history.get('scan_a'), null);
+});
+
+test('keeps each client\'s Redis entries under a hash of its ID', () => {
+  const history = new ScanHistory({ enabled: true, redisUrl: '', redisPrefix: 'h:' });
+
+  assert.match(history.ownerPrefix('key:secret'), /^h:[a-f0-9]{32}:$/);
+  assert.notEqual(history.ownerPrefix('key:secret'), history.ownerPrefix('key:other'));
+  assert.doesNotMatch(history.ownerPrefix('key:secret'), /secret/);
+});
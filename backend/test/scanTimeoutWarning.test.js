@@ -0,0 +1,31 @@
+const { test } = require('node:test');
+const assert = require('node:assert/strict');
+const { scanner, useFakeBrowser } = require('./helpers/fakeBrowser');
+const { scanTimeoutWarningCounter } = require('../src/services/metrics');
+
+async function warnings() {
+  const { values } = await scanTimeoutWarningCounter.get();
+  return values.reduce((sum, { value }) => sum + value, 0);
+}
+
+test('warns once a scan passes the warning fraction of its timeout', async t => {
+  // Warns at 80% of 1000ms; the page loads in 850ms
+  useFakeBrowser(t, { delays: { goto: 850 } });
+  const before = await warnings();
+
+  const result = await scanner.scanURL('https://example.com/', { timeout: 1000 });
+
+  assert.equal(result.url, 'https://example.com/');
+  assert.equal(await warnings(), before + 1);
+});
+
+test('does not warn for scans finishing early', async t => {
+  useFakeBrowser(t, { delays: { goto: 50 } });
+  const before = await warnings();
+
+  await scanner.scanURL('https://example.com/', { timeout: 1000 });
+  // Past the point the warning would have fired
+  await new Promise(resolve => setTimeout(resolve, 900));
+
+  assert.equal(await warnings(), before);
+});
@@ -0,0 +1,40 @@
+const { test } = require('node:test');
+const assert = require('node:assert/strict');
+const { axe, axeResults, scanner, useFakeBrowser } = require('./helpers/fakeBrowser');
+const { runSelfTest, SELFTEST_EXPECTED_RULE } = require('../src/services/selfTest');
+
+const violation = { id: SELFTEST_EXPECTED_RULE, impact: 'critical', tags: [], nodes: [{ html: '<img src="logo.png">', target: ['img'] }] };
+
+test('passes when the fixture scan reports its known violation', async t => {
+  const browser = useFakeBrowser(t);
+  axe.results = axeResults([violation]);
+
+  const result = await runSelfTest(html => scanner.scanHTML(html));
+
+  assert.equal(result.passed, true);
+  assert.equal(result.violations, 1);
+  assert.equal(typeof result.scanTime, 'number');
+  assert.match(browser.pages[0].called('setContent')[0][0], /<img/);
+});
+
+test('fails when the known violation is missing', async t => {
+  useFakeBrowser(t);
+  axe.results = axeResults([]);
+
+  const result = await runSelfTest(html => scanner.scanHTML(html));
+
+  assert.equal(result.passed, false);
+  assert.match(result.error, /Expected "image-alt" violation/);
+});
+
+test('fails when no browser is available', async t => {
+  useFakeBrowser(t);
+  scanner.browserPool.acquire = async () => {
+    throw new Error('Failed to launch the browser process');
+  };
+
+  const result = await runSelfTest(html => scanner.scanHTML(html));
+
+  assert.equal(result.passed, false);
+  assert.match(result.error, /Failed to launch the browser process/);
+});
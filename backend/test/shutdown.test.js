@@ -0,0 +1,62 @@
+const { test } = require('node:test');
+const assert = require('node:assert/strict');
+const { scanner, useFakeBrowser } = require('./helpers/fakeBrowser');
+const { rejectWhileShuttingDown } = require('../src/middleware/shutdown');
+
+function submit(middleware) {
+  const res = {
+    statusCode: 200,
+    headers: {},
+    set(name, value) { this.headers[name] = value; return this; },
+    status(code) { this.statusCode = code; return this; },
+    json(payload) { this.body = payload; return this; }
+  };
+  let passed = false;
+  middleware({}, res, () => { passed = true; });
+  return { res, passed };
+}
+
+test('rejects new scans with 503 once shutting down', () => {
+  let shuttingDown = false;
+  const middleware = rejectWhileShuttingDown(() => shuttingDown);
+
+  assert.equal(submit(middleware).passed, true);
+
+  shuttingDown = true;
+  const { res, passed } = submit(middleware);
+  assert.equal(passed, false);
+  assert.equal(res.statusCode, 503);
+  assert.equal(res.body.code, 'SHUTTING_DOWN');
+  assert.equal(res.headers.Connection, 'close');
+});
+
+test('waits for in-flight scans to finish', async t => {
+  let finishLoad;
+  useFakeBrowser(t, { delays: { goto: () => new Promise(resolve => { finishLoad = resolve; }) } });
+
+  const scan = scanner.scanURL('https://example.com/', {});
+  await new Promise(resolve => setImmediate(resolve));
+  assert.equal(scanner.activeScanCount(), 1);
+
+  const idle = scanner.waitForIdle(5000);
+  finishLoad();
+
+  assert.equal(await idle, true);
+  assert.equal(scanner.activeScanCount(), 0);
+  assert.ok((await scan).violations);
+});
+
+test('gives up waiting after the timeout with scans still running', async t => {
+  let finishLoad;
+  useFakeBrowser(t, { delays: { setContent: () => new Promise(resolve => { finishLoad = resolve; }) } });
+
+  const scan = scanner.scanHTML('<p>Hello</p>', {});
+  await new Promise(resolve => setImmediate(resolve));
+
+  assert.equal(await scanner.waitForIdle(20), false);
+  assert.equal(scanner.activeScanCount(), 1);
+
+  finishLoad();
+  await scan;
+  assert.equal(await scanner.waitForIdle(20), true);
+});
@@ -0,0 +1,126 @@
+const { test } = require('node:test');
+const assert = require('node:assert/strict');
+const dns = require('dns');
+const { scanner, useFakeBrowser } = require('./helpers/fakeBrowser');
+const config = require('../src/config');
+const {
+  validateURL,
+  normalizeURL,
+  isPrivateIP,
+  isMetadataIP,
+  checkHostOverrides
+} = require('../src/middleware/ssrfProtection');
+
+// Allow private targets (BLOCK_PRIVATE_IPS=false) for one test
+function allowPrivateTargets(t) {
+  const blockPrivateIPs = config.security.blockPrivateIPs;
+  config.security.blockPrivateIPs = false;
+  t.after(() => { config.security.blockPrivateIPs = blockPrivateIPs; });
+}
+
+test('detects private IPv4 and IPv6 addresses', () => {
+  ['10.0.0.1', '172.16.5.4', '192.168.1.1', '127.0.0.1', '169.254.169.254', '::1', 'fc12::1', 'fe80::1%eth0']
+    .forEach(ip => assert.equal(isPrivateIP(ip), true, ip));
+  ['8.8.8.8', '172.32.0.1', '2001:db8::1'].forEach(ip => assert.equal(isPrivateIP(ip), false, ip));
+});
+
+test('unwraps IPv4-mapped IPv6 addresses', () => {
+  ['::ffff:10.0.0.1', '::ffff:a00:1', '[::ffff:a9fe:a9fe]', '0:0:0:0:0:ffff:a9fe:a9fe']
+    .forEach(ip => assert.equal(isPrivateIP(ip), true, ip));
+  assert.equal(isPrivateIP('::ffff:8.8.8.8'), false);
+  assert.equal(isMetadataIP('::ffff:169.254.169.254'), true);
+});
+
+test('rejects private IP literals', async () => {
+  await assert.rejects(validateURL('http://10.0.0.1/'), /private IP/);
+  await assert.rejects(validateURL('http://[::ffff:a00:1]/'), /private IP/);
+  await validateURL('http://8.8.8.8/');
+});
+
+test('checks every host override, not only the target', async () => {
+  await assert.rejects(
+    validateURL('http://8.8.8.8/', { 'cdn.example.com': '169.254.169.254' }),
+    /cdn\.example\.com/
+  );
+  assert.throws(() => checkHostOverrides({ 'a.example.com': '8.8.8.8', 'b.example.com': '::ffff:10.0.0.1' }), /b\.example\.com/);
+  checkHostOverrides({ 'a.example.com': '8.8.8.8' });
+});
+
+test('keeps metadata endpoints blocked when private targets are allowed', async t => {
+  allowPrivateTargets(t);
+
+  await validateURL('http://10.0.0.1/');
+  await validateURL('http://8.8.8.8/', { 'api.example.com': '10.0.0.5' });
+  await assert.rejects(validateURL('http://169.254.169.254/latest/meta-data/'));
+  await assert.rejects(validateURL('http://8.8.8.8/', { 'cdn.example.com': '::ffff:169.254.169.254' }));
+});
+
+test('rejects schemes other than http and https', async () => {
+  await assert.rejects(validateURL('file:///etc/passwd'));
+});
+
+// Answer DNS queries from records (hostname -> { A, AAAA, hosts }) for one
+// test; hosts entries are only found by dns.lookup, like /etc/hosts
+function stubDns(t, records) {
+  const { resolve4, resolve6, lookup } = dns.promises;
+  const answer = (hostname, type) => {
+    const addresses = (records[hostname] || {})[type] || [];
+    if (addresses.length === 0) {
+      return Promise.reject(Object.assign(new Error(`query ENOTFOUND ${hostname}`), { code: 'ENOTFOUND' }));
+    }
+    return Promise.resolve(addresses);
+  };
+  dns.promises.resolve4 = hostname => answer(hostname, 'A');
+  dns.promises.resolve6 = hostname => answer(hostname, 'AAAA');
+  dns.promises.lookup = async hostname => (await answer(hostname, 'hosts')).map(address => ({ address }));
+  t.after(() => Object.assign(dns.promises, { resolve4, resolve6, lookup }));
+}
+
+test('rejects hostnames resolving to private addresses', async t => {
+  stubDns(t, {
+    'intranet.example.com': { A: ['93.184.216.34', '10.1.2.3'] },
+    'v6.example.com': { AAAA: ['fd00::1'] },
+    'www.example.com': { A: ['93.184.216.34'], AAAA: ['2606:2800:220:1::1'] }
+  });
+
+  await assert.rejects(validateURL('https://intranet.example.com/'), /resolves to private IP/);
+  await assert.rejects(validateURL('https://v6.example.com/'), /resolves to private IP/);
+  await assert.rejects(validateURL('https://nowhere.example.com/'), /Could not resolve/);
+  await validateURL('https://www.example.com/');
+});
+
+test('checks resolved addresses for metadata services when private targets are allowed', async t => {
+  allowPrivateTargets(t);
+  stubDns(t, {
+    'dev.example.com': { A: ['10.1.2.3'] },
+    'rebind.example.com': { A: ['169.254.169.254'] },
+    'rebind6.example.com': { AAAA: ['::ffff:a9fe:a9fe'] },
+    'devbox': { hosts: ['192.168.1.20'] }
+  });
+
+  await validateURL('http://dev.example.com/');
+  await validateURL('http://localhost:3000/');
+  await validateURL('http://app.localhost/');
+  // Found in /etc/hosts only
+  await validateURL('http://devbox:8080/');
+  await assert.rejects(validateURL('http://rebind.example.com/'), /resolves to private IP/);
+  await assert.rejects(validateURL('http://rebind6.example.com/'), /resolves to private IP/);
+  await assert.rejects(validateURL('http://metadata.google.internal/'), /internal\/metadata endpoints/);
+});
+
+test('the scanner honors BLOCK_PRIVATE_IPS', async t => {
+  useFakeBrowser(t);
+
+  await assert.rejects(scanner.scanURL('http://10.0.0.1/', {}), /private\/internal URLs/);
+
+  allowPrivateTargets(t);
+  const result = await scanner.scanURL('http://10.0.0.1/', {});
+  assert.equal(result.url, 'http://10.0.0.1/');
+});
+
+test('normalizes URLs, keeping client-side routes', () => {
+  assert.equal(normalizeURL('HTTPS://Example.COM/Path?q=1#section'), 'https://example.com/Path?q=1');
+  assert.equal(normalizeURL('https://example.com/#/settings'), 'https://example.com/#/settings');
+  assert.equal(normalizeURL('https://example.com/#!/settings'), 'https://example.com/#!/settings');
+  assert.throws(() => normalizeURL('not a url'), { code: 'INVALID_INPUT' });
+});
@@ -0,0 +1,97 @@
+const { test } = require('node:test');
+const assert = require('node:assert/strict');
+const { scanner, useFakeBrowser } = require('./helpers/fakeBrowser');
+const { ScanRequestSchema } = require('../src/schemas/validation');
+const config = require('../src/config');
+
+const storage = {
+  localStorage: { onboardingDone: 'true', theme: 'dark' },
+  sessionStorage: { cartId: 'abc123' }
+};
+
+function parseOptions(options) {
+  return ScanRequestSchema.safeParse({ type: 'url', input: 'https://example.com/', options });
+}
+
+// Run a script registered with evaluateOnNewDocument against a fake top
+// window, returning the storage it wrote
+function runInWindow(fn, arg) {
+  const areas = { localStorage: {}, sessionStorage: {} };
+  const fakeWindow = {};
+  fakeWindow.top = fakeWindow;
+  for (const [area, values] of Object.entries(areas)) {
+    fakeWindow[area] = { setItem: (key, value) => { values[key] = value; } };
+  }
+
+  const previous = global.window;
+  global.window = fakeWindow;
+  try {
+    fn(arg);
+  } finally {
+    global.window = previous;
+  }
+  return areas;
+}
+
+test('serializes storage entries into the page before it loads', async t => {
+  const browser = useFakeBrowser(t);
+
+  await scanner.scanURL('https://example.com/', storage);
+
+  const [page] = browser.pages;
+  const [[fn, entries]] = page.called('evaluateOnNewDocument');
+  assert.deepEqual(JSON.parse(JSON.stringify(entries)), storage);
+  assert.deepEqual(runInWindow(fn, entries), storage);
+  assert.ok(page.calls.findIndex(([name]) => name === 'evaluateOnNewDocument') <
+    page.calls.findIndex(([name]) => name === 'goto'));
+});
+
+test('seeds storage in an incognito context closed after the scan', async t => {
+  const browser = useFakeBrowser(t);
+
+  await scanner.scanHTML('<p>Hello</p>', { localStorage: { onboardingDone: 'true' } });
+
+  const [page] = browser.pages;
+  assert.equal(browser.contexts.length, 1);
+  assert.equal(page.context, browser.contexts[0]);
+  assert.equal(browser.contexts[0].closed, true);
+  assert.equal(browser.defaultContext.closed, false);
+});
+
+test('closes the incognito context when the scan fails', async t => {
+  const browser = useFakeBrowser(t, {
+    delays: { setContent: async () => { throw new Error('Page crashed'); } }
+  });
+
+  await assert.rejects(scanner.scanHTML('<p>Hello</p>', { sessionStorage: { cartId: 'abc123' } }), /Page crashed/);
+
+  assert.equal(browser.contexts[0].closed, true);
+});
+
+test('scans without storage use the default context', async t => {
+  const browser = useFakeBrowser(t);
+
+  await scanner.scanHTML('<p>Hello</p>', {});
+
+  assert.equal(browser.contexts.length, 0);
+  assert.equal(browser.pages[0].context, browser.defaultContext);
+  assert.equal(browser.pages[0].called('evaluateOnNewDocument').length, 0);
+});
+
+test('limits the number and size of storage entries', () => {
+  const { maxEntries, maxBytes } = config.optionLimits.storage;
+  const tooMany = Object.fromEntries(Array.from({ length: maxEntries + 1 }, (_, i) => [`key${i}`, 'x']));
+  const tooLarge = { blob: 'x'.repeat(maxBytes) };
+
+  assert.equal(parseOptions(storage).success, true);
+
+  const many = parseOptions({ localStorage: tooMany });
+  assert.equal(many.success, false);
+  assert.equal(many.error.issues[0].message, `localStorage exceeds maximum of ${maxEntries} entries`);
+
+  const large = parseOptions({ sessionStorage: tooLarge });
+  assert.equal(large.success, false);
+  assert.equal(large.error.issues[0].message, `sessionStorage exceeds maximum size of ${maxBytes} bytes`);
+
+  assert.equal(parseOptions({ localStorage: { flag: true } }).success, false);
+});
@@ -0,0 +1,50 @@
+const { test } = require('node:test');
+const assert = require('node:assert/strict');
+const { SubmissionDedup } = require('../src/services/submissionDedup');
+
+const urls = ['https://example.com/', 'https://example.com/about'];
+
+test('returns the first batch ID for a duplicate submission within the window', () => {
+  const dedup = new SubmissionDedup({ window: 1000 });
+  const hash = dedup.hash('key:abc', urls, { wcagLevel: 'AA' });
+
+  assert.equal(dedup.find(hash, 0), null);
+  dedup.remember(hash, 'batch_1', 0);
+
+  assert.equal(dedup.find(dedup.hash('key:abc', urls, { wcagLevel: 'AA' }), 500), 'batch_1');
+  assert.equal(dedup.find(hash, 999), 'batch_1');
+  assert.equal(dedup.find(hash, 1000), null);
+});
+
+test('tells submissions apart by client and request', () => {
+  const dedup = new SubmissionDedup({ window: 1000 });
+  const hash = dedup.hash('key:abc', urls, {}, undefined);
+  dedup.remember(hash, 'batch_1', 0);
+
+  assert.equal(dedup.find(dedup.hash('key:xyz', urls, {}, undefined), 0), null);
+  assert.equal(dedup.find(dedup.hash('key:abc', [urls[0]], {}, undefined), 0), null);
+  assert.equal(dedup.find(dedup.hash('key:abc', urls, { wcagLevel: 'AAA' }, undefined), 0), null);
+  assert.equal(dedup.find(dedup.hash('key:abc', urls, {}, { build: 2 }), 0), null);
+  // A missing part hashes like an explicit null
+  assert.equal(dedup.find(dedup.hash('key:abc', urls, {}, null), 0), 'batch_1');
+});
+
+test('forgets expired submissions and restarts the window on resubmission', () => {
+  const dedup = new SubmissionDedup({ window: 100 });
+  const first = dedup.hash('key:abc', urls);
+  const second = dedup.hash('key:abc', [urls[1]]);
+
+  dedup.remember(first, 'batch_1', 0);
+  dedup.remember(second, 'batch_2', 50);
+  assert.equal(dedup.find(second, 120), 'batch_2');
+  assert.equal(dedup.submissions.size, 1);
+
+  dedup.remember(first, 'batch_3', 130);
+  assert.equal(dedup.find(first, 200), 'batch_3');
+  assert.equal(dedup.find(second, 200), null);
+});
+
+test('is disabled with a zero window', () => {
+  assert.equal(new SubmissionDedup({ window: 0 }).enabled, false);
+  assert.equal(new SubmissionDedup({ window: 5000 }).enabled, true);
+});
@@ -0,0 +1,43 @@
+const { test } = require('node:test');
+const assert = require('node:assert/strict');
+const { canonicalizeUrl } = require('../src/services/urlCanonicalizer');
+const { ResultCache } = require('../src/services/resultCache');
+
+const stripParams = ['utm_*', 'gclid'];
+
+test('collapses equivalent URLs to one form', () => {
+  const variants = [
+    'https://example.com/?a=1&b=2',
+    'HTTPS://Example.COM:443/?b=2&a=1',
+    'https://example.com/?utm_source=mail&a=1&utm_campaign=spring&b=2',
+    'https://example.com/?a=1&gclid=xyz&b=2'
+  ];
+
+  const canonical = new Set(variants.map(url => canonicalizeUrl(url, stripParams)));
+  assert.deepEqual([...canonical], ['https://example.com/?a=1&b=2']);
+});
+
+test('keeps what distinguishes pages', () => {
+  assert.notEqual(canonicalizeUrl('https://example.com/a', stripParams), canonicalizeUrl('https://example.com/b', stripParams));
+  assert.notEqual(canonicalizeUrl('https://example.com:8443/', stripParams), canonicalizeUrl('https://example.com/', stripParams));
+  // Repeated parameters keep their order
+  assert.equal(canonicalizeUrl('https://example.com/?tag=b&tag=a', stripParams), 'https://example.com/?tag=b&tag=a');
+});
+
+test('strips only the configured parameters', () => {
+  assert.equal(canonicalizeUrl('https://example.com/?fbclid=1&ref=2', ['fbclid']), 'https://example.com/?ref=2');
+  assert.equal(canonicalizeUrl('https://example.com/?utm_source=x', []), 'https://example.com/?utm_source=x');
+  assert.equal(canonicalizeUrl('https://example.com/?UTM_Source=x', ['utm_*']), 'https://example.com/');
+});
+
+test('returns unparseable input unchanged', () => {
+  assert.equal(canonicalizeUrl('not a url', stripParams), 'not a url');
+});
+
+test('equivalent URLs share a cache key', () => {
+  const cache = new ResultCache({ ttl: 60000, redisUrl: '' });
+  assert.equal(
+    cache.key('url', 'https://Example.com:443/?b=2&a=1&utm_source=mail', {}),
+    cache.key('url', 'https://example.com/?a=1&b=2', {})
+  );
+});
@@ -0,0 +1,73 @@
+const { test } = require('node:test');
+const assert = require('node:assert/strict');
+const http = require('http');
+const { isWebSocketUpgrade, isAllowedOrigin, acceptWebSocket } = require('../src/services/webSocket');
+const { connectWebSocket } = require('./helpers/webSocketClient');
+
+// Accept every upgrade; connections echo text messages back
+async function useEchoServer(t, options = {}) {
+  const server = http.createServer((req, res) => res.writeHead(426).end());
+  server.on('upgrade', (req, socket, head) => {
+    acceptWebSocket(req, socket, head, options, ws => {
+      ws.on('message', data => ws.send(data.toString('utf8')));
+    });
+  });
+  await new Promise(resolve => server.listen(0, '127.0.0.1', resolve));
+  t.after(() => new Promise(resolve => server.close(resolve)));
+  return server.address().port;
+}
+
+test('recognizes WebSocket upgrade requests', () => {
+  const headers = { upgrade: 'WebSocket', 'sec-websocket-key': 'dGhlIHNhbXBsZSBub25jZQ==', 'sec-websocket-version': '13' };
+  assert.equal(isWebSocketUpgrade({ headers }), true);
+  assert.equal(isWebSocketUpgrade({ headers: { ...headers, 'sec-websocket-version': '8' } }), false);
+  assert.equal(isWebSocketUpgrade({ headers: { ...headers, upgrade: 'h2c' } }), false);
+  assert.equal(isWebSocketUpgrade({ headers: { upgrade: 'websocket', 'sec-websocket-version': '13' } }), false);
+});
+
+test('echoes messages, fragmented ones included, and answers pings', async t => {
+  const port = await useEchoServer(t, { headers: { 'X-Correlation-ID': 'corr-echo' } });
+  const ws = await connectWebSocket(port, '/');
+  assert.equal(ws.headers['x-correlation-id'], 'corr-echo');
+
+  ws.send({ hello: 'world' });
+  assert.deepEqual(await ws.nextMessage(), { hello: 'world' });
+
+  ws.sendFrame(0x1, Buffer.from('{"part'), { fin: false });
+  ws.sendFrame(0x0, Buffer.from('":1}'));
+  assert.deepEqual(await ws.nextMessage(), { part: 1 });
+
+  ws.sendFrame(0x9, Buffer.from('ping'));
+  ws.close();
+  assert.equal((await ws.closed).code, 1000);
+  const pong = ws.frames.find(frame => frame.opcode === 0xA);
+  assert.equal(pong.payload.toString(), 'ping');
+});
+
+test('closes with 1002 on an unmasked client frame', async t => {
+  const port = await useEchoServer(t);
+  const ws = await connectWebSocket(port, '/');
+
+  ws.sendFrame(0x1, Buffer.from('{}'), { masked: false });
+  assert.equal((await ws.closed).code, 1002);
+  assert.deepEqual(ws.messages, []);
+});
+
+test('closes with 1009 on a message over the size limit', async t => {
+  const port = await useEchoServer(t, { maxMessageBytes: 16 });
+  const ws = await connectWebSocket(port, '/');
+
+  ws.sendFrame(0x1, Buffer.from('"0123456789"'), { fin: false });
+  ws.sendFrame(0x0, Buffer.from('0123456789'));
+  assert.equal((await ws.closed).code, 1009);
+  assert.deepEqual(ws.messages, []);
+});
+
+test('allows handshakes without an Origin or from an allowed one', () => {
+  const allowed = ['https://dashboard.example.com'];
+
+  assert.equal(isAllowedOrigin({ headers: {} }, allowed), true);
+  assert.equal(isAllowedOrigin({ headers: { origin: 'https://dashboard.example.com' } }, allowed), true);
+  assert.equal(isAllowedOrigin({ headers: { origin: 'https://evil.example' } }, allowed), false);
+  assert.equal(isAllowedOrigin({ headers: { origin: 'https://dashboard.example.com' } }, []), false);
+});